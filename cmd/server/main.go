@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"nihongo-api/internal/adapters/http/router"
+	"nihongo-api/internal/adapters/jwtkeys"
+	"nihongo-api/internal/adapters/mail"
+	"nihongo-api/internal/adapters/oidc"
+	"nihongo-api/internal/adapters/revenuecat"
 	"nihongo-api/internal/adapters/storage/mongo"
+	redisstore "nihongo-api/internal/adapters/storage/redis"
+	"nihongo-api/internal/application/scheduler"
 	"nihongo-api/internal/application/service"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
 	"nihongo-api/pkg/config"
 	"nihongo-api/pkg/database"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
+	_ "time/tzdata" // user time zones are validated and applied without relying on the host's zoneinfo
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/redis/go-redis/v9"
@@ -42,6 +54,15 @@ func main() {
 		}
 	}()
 
+	// One-off data migrations, each applied once per database
+	applied, err := mongo.Migrate(context.Background(), db)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to migrate database")
+	}
+	for _, name := range applied {
+		logger.Info().Str("migration", name).Msg("Migration applied")
+	}
+
 	// Initialize Redis
 	rdb := redis.NewClient(&redis.Options{
 		Addr: cfg.Database.RedisAddr,
@@ -55,16 +76,159 @@ func main() {
 	// Initialize repositories
 	userRepo := mongo.NewMongoUserRepository(db)
 	subRepo := mongo.NewMongoSubscriptionRepository(db)
+	processedEventRepo := mongo.NewMongoProcessedEventRepository(db)
 	syllableRepo := mongo.NewMongoSyllableRepository(db)
 	courseRepo := mongo.NewMongoCourseRepository(db)
 	kanjiRepo := mongo.NewMongoKanjiRepository(db)
 	progressRepo := mongo.NewMongoProgressRepository(db)
+	catalogRepo := mongo.NewMongoCatalogRepository(db)
+	userTokenRepo := mongo.NewMongoUserTokenRepository(db)
+	auditLog := mongo.NewMongoAuditLog(db)
+	sessionRepo := mongo.NewMongoSessionRepository(db)
+	erasureReceiptRepo := mongo.NewMongoErasureReceiptRepository(db)
+	streakRepo := mongo.NewMongoStreakRepository(db)
+	xpRepo := mongo.NewMongoXPRepository(db)
+	achievementRepo := mongo.NewMongoAchievementRepository(db)
+	leaderboardArchiveRepo := mongo.NewMongoLeaderboardArchiveRepository(db)
+	followRepo := mongo.NewMongoFollowRepository(db)
+	activityRepo := mongo.NewMongoActivityRepository(db)
+	attemptLog := mongo.NewMongoAttemptLog(db)
+	studySessionRepo := mongo.NewMongoStudySessionRepository(db)
+	if err := achievementRepo.EnsureDefinitions(context.Background(), domain.DefaultAchievements); err != nil {
+		logger.Error().Err(err).Msg("Failed to add default achievements")
+	}
+
+	// Access token keys
+	tokenKeys, err := loadTokenKeys(cfg.Auth, logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load token signing keys")
+	}
+
+	// Initialize mailer
+	var mailer ports.Mailer
+	if cfg.Mail.Driver == "smtp" {
+		mailer = mail.NewSMTPMailer(cfg.Mail.SMTPHost, cfg.Mail.SMTPPort, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	} else {
+		logger.Warn().Msg("Using log mailer; emails are not delivered")
+		mailer = mail.NewLogMailer(cfg.Mail.From, cfg.Mail.OutputDir, logger)
+	}
 
 	// Initialize services
-	userService := service.NewUserService(userRepo, subRepo, logger)
-	subscriptionService := service.NewSubscriptionService(subRepo, userRepo, userService, logger)
-	courseService := service.NewCourseService(courseRepo)
-	progressService := service.NewProgressService(progressRepo)
+	unverifiedAccess := service.UnverifiedAccess(cfg.Auth.UnverifiedAccess)
+	userService := service.NewUserService(userRepo, subRepo, unverifiedAccess, logger)
+	catalogService := service.NewCatalogService(catalogEntries(cfg.Catalog), catalogRepo, cfg.Catalog.RefreshInterval, logger)
+	subscriptionService := service.NewSubscriptionService(subRepo, processedEventRepo, userRepo, userService, catalogService, cfg.Subscription.GracePeriod, logger)
+	revenueCatClient := revenuecat.NewClient(cfg.RevenueCat.BaseURL, cfg.RevenueCat.APIKey, cfg.RevenueCat.Timeout, cfg.RevenueCat.MaxRetries, logger)
+	reconciliationService := service.NewReconciliationService(revenueCatClient, subRepo, userRepo, catalogService, logger)
+	sessionService := service.NewSessionService(sessionRepo, cfg.Auth.TokenTTL, logger)
+	passwordResetService := service.NewPasswordResetService(userRepo, userTokenRepo, mailer, sessionService, cfg.Auth.PasswordResetURL, cfg.Auth.PasswordResetTTL, cfg.Auth.PasswordResetCooldown, logger)
+	emailVerificationService := service.NewEmailVerificationService(userRepo, userTokenRepo, mailer, cfg.Auth.EmailVerificationURL, cfg.Auth.EmailVerificationTTL, unverifiedAccess, logger)
+	loginGuard := service.NewLoginGuard(redisstore.NewRedisAttemptStore(rdb), auditLog, userRepo, userTokenRepo, mailer, cfg.Auth.Lockout.UnlockURL, service.LockoutPolicy{
+		MaxAccountFailures: cfg.Auth.Lockout.MaxAccountFailures,
+		MaxIPFailures:      cfg.Auth.Lockout.MaxIPFailures,
+		FailureWindow:      cfg.Auth.Lockout.FailureWindow,
+		LockoutDuration:    cfg.Auth.Lockout.Duration,
+		DelayAfter:         cfg.Auth.Lockout.DelayAfter,
+		BaseDelay:          cfg.Auth.Lockout.BaseDelay,
+		MaxDelay:           cfg.Auth.Lockout.MaxDelay,
+	}, logger)
+	twoFactorService := service.NewTwoFactorService(userRepo, userTokenRepo, loginGuard, sessionService, cfg.Auth.TwoFactor.Issuer, userRoles(cfg.Auth.TwoFactor.RequiredRoles), cfg.Auth.TwoFactor.ChallengeTTL, logger)
+	oauthService := service.NewOAuthService(userRepo, identityVerifiers(cfg.OAuth, logger), unverifiedAccess, logger)
+	guestService := service.NewGuestService(userRepo, progressRepo, subRepo, sessionRepo, revenueCatClient, logger)
+	privacyService := service.NewPrivacyService(userRepo, progressRepo, subRepo, sessionRepo, auditLog, erasureReceiptRepo, logger)
+	accountService := service.NewAccountService(userRepo, emailVerificationService, privacyService, oauthService, guestService, sessionService, cfg.Account.DeletionGracePeriod, logger)
+	entitlements := guestService.RestrictEntitlements(emailVerificationService.RestrictEntitlements(subscriptionService))
+	progressService := service.NewProgressService(progressRepo, syllableRepo, kanjiRepo, courseRepo, entitlements, redisstore.NewRedisProgressSummaryCache(rdb), logger)
+	courseService := service.NewCourseService(courseRepo, entitlements, progressService)
+	streakService := service.NewStreakService(streakRepo, userRepo, revenueCatClient, service.StreakPolicy{
+		MaxFreezes:      cfg.Streak.MaxFreezes,
+		EarnFreezeEvery: cfg.Streak.EarnFreezeEvery,
+		FreezeProducts:  cfg.Streak.FreezeProducts,
+	}, logger)
+	progressService.AddObserver(streakService)
+	privacyService.AddStore(streakService)
+	guestService.AddMerger(streakService)
+	xpService := service.NewXPService(xpRepo, userRepo, kanjiRepo, courseRepo, xpPolicy(cfg.XP), logger)
+	progressService.AddObserver(xpService)
+	privacyService.AddStore(xpService)
+	guestService.AddMerger(xpService)
+	leaderboardService := service.NewLeaderboardService(redisstore.NewRedisLeaderboardStore(rdb), leaderboardArchiveRepo, userRepo, kanjiRepo, courseRepo, service.LeaderboardPolicy{
+		CompletionPoints: cfg.Leaderboard.CompletionPoints,
+		MaxScorePoints:   cfg.Leaderboard.MaxScorePoints,
+		MaxTop:           cfg.Leaderboard.MaxTop,
+		Neighbours:       cfg.Leaderboard.Neighbours,
+		ArchiveSize:      cfg.Leaderboard.ArchiveSize,
+	}, logger)
+	progressService.AddObserver(leaderboardService)
+	privacyService.AddStore(leaderboardService)
+	socialService := service.NewSocialService(followRepo, activityRepo, userRepo, courseRepo, streakRepo, xpRepo, service.SocialPolicy{
+		MaxFollowing:     cfg.Social.MaxFollowing,
+		MaxFeedPage:      cfg.Social.MaxFeedPage,
+		StreakMilestones: cfg.Social.StreakMilestones,
+		LevelBase:        cfg.XP.LevelBase,
+	}, logger)
+	progressService.AddObserver(socialService)
+	privacyService.AddStore(socialService)
+	mistakeService := service.NewMistakeService(attemptLog, service.MistakePolicy{
+		Window:        cfg.Mistakes.Window,
+		LeechFailures: cfg.Mistakes.LeechFailures,
+		WeakAccuracy:  cfg.Mistakes.WeakAccuracy,
+		MinConfusions: cfg.Mistakes.MinConfusions,
+		MaxItems:      cfg.Mistakes.MaxItems,
+	}, logger)
+	progressService.SetAttemptRecorder(mistakeService)
+	privacyService.AddStore(mistakeService)
+	guestService.AddMerger(mistakeService)
+	studyService := service.NewStudyService(studySessionRepo, attemptLog, service.StudyPolicy{
+		MaxSessionLength: cfg.Study.MaxSessionLength,
+		MaxRangeDays:     cfg.Study.MaxRangeDays,
+	}, logger)
+	privacyService.AddStore(studyService)
+	guestService.AddMerger(studyService)
+	// Registered last so the streak and XP written for the same progress are counted
+	achievementService := service.NewAchievementService(achievementRepo, progressRepo, syllableRepo, streakRepo, xpRepo, progressService, cfg.Achievements.RefreshInterval, cfg.Achievements.QueueSize, logger)
+	progressService.AddObserver(achievementService)
+	privacyService.AddStore(achievementService)
+	guestService.AddMerger(achievementService)
+
+	// Background jobs; a Redis lock makes sure only one replica runs each tick
+	hostname, _ := os.Hostname()
+	jobs := scheduler.New(redisstore.NewRedisLocker(rdb, hostname), logger)
+	jobs.Register(scheduler.Job{
+		Name:     "subscription-expiry-sweep",
+		Interval: cfg.Subscription.ExpirySweepInterval,
+		Run: func(ctx context.Context) error {
+			_, err := subscriptionService.ExpireOverdue(ctx, cfg.Subscription.ExpiryTolerance)
+			return err
+		},
+	})
+	jobs.Register(scheduler.Job{
+		Name:     "subscription-reconciliation-sweep",
+		Interval: cfg.Subscription.ReconcileInterval,
+		Run: func(ctx context.Context) error {
+			_, err := reconciliationService.ReconcileStale(ctx, cfg.Subscription.ReconcileMaxAge, cfg.Subscription.ReconcileBatchSize)
+			return err
+		},
+	})
+	jobs.Register(scheduler.Job{
+		Name:     "account-deletion-sweep",
+		Interval: cfg.Account.DeletionSweepInterval,
+		Run: func(ctx context.Context) error {
+			_, err := accountService.PurgeDeleted(ctx)
+			return err
+		},
+	})
+	jobs.Register(scheduler.Job{
+		Name:     "leaderboard-archive",
+		Interval: cfg.Leaderboard.ArchiveInterval,
+		Run: func(ctx context.Context) error {
+			_, err := leaderboardService.ArchiveWeek(ctx, time.Now())
+			return err
+		},
+	})
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobs.Start(jobsCtx)
+	achievementService.Start(jobsCtx, cfg.Achievements.Workers)
 
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
@@ -100,7 +264,7 @@ func main() {
 	if len(webhookSecrets) == 0 {
 		logger.Fatal().Msg("APP_REVENUECAT_WEBHOOK_SECRET(s) required")
 	}
-	router.SetupRoutes(app, userService, subscriptionService, courseService, progressService, syllableRepo, kanjiRepo, cfg.Auth.JWTSecret, webhookSecrets, logger)
+	router.SetupRoutes(app, userService, subscriptionService, courseService, progressService, catalogService, reconciliationService, passwordResetService, emailVerificationService, oauthService, loginGuard, twoFactorService, accountService, privacyService, sessionService, guestService, streakService, xpService, achievementService, leaderboardService, socialService, mistakeService, studyService, syllableRepo, kanjiRepo, tokenKeys, cfg.Auth.TokenTTL, webhookSecrets, logger)
 
 	// Start server
 	go func() {
@@ -120,5 +284,104 @@ func main() {
 		logger.Error().Err(err).Msg("Server shutdown error")
 	}
 
+	stopJobs()
+	jobs.Wait()
+	achievementService.Wait()
+
 	logger.Info().Msg("Server stopped")
 }
+
+// catalogEntries converts the configured catalog into domain entries
+func catalogEntries(cfg config.CatalogConfig) []domain.CatalogEntry {
+	var entries []domain.CatalogEntry
+	for _, p := range cfg.Products {
+		entries = append(entries, domain.CatalogEntry{
+			Kind:                domain.CatalogProduct,
+			ExternalID:          p.ID,
+			Entitlements:        p.Entitlements,
+			DefaultDurationDays: p.DefaultDurationDays,
+			Lifetime:            p.Lifetime,
+		})
+	}
+	for _, e := range cfg.Entitlements {
+		entries = append(entries, domain.CatalogEntry{
+			Kind:                domain.CatalogEntitlement,
+			ExternalID:          e.ID,
+			Entitlements:        e.Entitlements,
+			DefaultDurationDays: e.DefaultDurationDays,
+		})
+	}
+	return entries
+}
+
+// userRoles converts configured role names into domain roles
+func userRoles(names []string) []domain.UserRole {
+	roles := make([]domain.UserRole, 0, len(names))
+	for _, name := range names {
+		roles = append(roles, domain.UserRole(name))
+	}
+	return roles
+}
+
+// xpPolicy converts the XP configuration. Config keys are case-insensitive, so JLPT levels
+// are upper-cased again.
+func xpPolicy(cfg config.XPConfig) service.XPPolicy {
+	rules := domain.XPRules{
+		ByEntityType: make(map[domain.EntityType]domain.XPRule, len(cfg.Rules)),
+		Difficulty:   make(map[domain.JLPTLevel]float64, len(cfg.Difficulty)),
+	}
+	for entityType, rule := range cfg.Rules {
+		rules.ByEntityType[domain.EntityType(entityType)] = domain.XPRule{Completion: rule.Completion, Review: rule.Review}
+	}
+	for level, multiplier := range cfg.Difficulty {
+		rules.Difficulty[domain.JLPTLevel(strings.ToUpper(level))] = multiplier
+	}
+	return service.XPPolicy{
+		Rules:            rules,
+		LevelBase:        cfg.LevelBase,
+		DefaultDailyGoal: cfg.DefaultDailyGoal,
+		MaxHistoryDays:   cfg.MaxHistoryDays,
+	}
+}
+
+// identityVerifiers creates a verifier for each identity provider that has client IDs configured
+func identityVerifiers(cfg config.OAuthConfig, logger zerolog.Logger) map[string]ports.IdentityVerifier {
+	providers := []oidc.ProviderConfig{
+		{Name: "google", JWKSURL: cfg.Google.JWKSURL, Issuers: cfg.Google.Issuers, Audiences: cfg.Google.ClientIDs},
+		{Name: "apple", JWKSURL: cfg.Apple.JWKSURL, Issuers: cfg.Apple.Issuers, Audiences: cfg.Apple.ClientIDs},
+	}
+
+	verifiers := make(map[string]ports.IdentityVerifier)
+	for _, p := range providers {
+		if len(p.Audiences) == 0 {
+			continue
+		}
+		p.RefreshInterval = cfg.JWKSRefreshInterval
+		verifier, err := oidc.NewVerifier(context.Background(), p, logger)
+		if err != nil {
+			logger.Fatal().Err(err).Str("provider", p.Name).Msg("Failed to initialize identity provider")
+		}
+		verifiers[p.Name] = verifier
+	}
+	return verifiers
+}
+
+// loadTokenKeys loads the configured signing keys. Outside production a throwaway key is
+// generated when none are configured, so local setups work without key files.
+func loadTokenKeys(cfg config.AuthConfig, logger zerolog.Logger) (*jwtkeys.KeySet, error) {
+	keys, err := jwtkeys.Load(cfg.SigningKeyFiles, cfg.SigningKeys)
+	if errors.Is(err, jwtkeys.ErrNoSigningKey) && os.Getenv("APP_ENV") != "production" {
+		logger.Warn().Msg("No signing keys configured, using an ephemeral key; tokens will not survive a restart")
+		keys, err = jwtkeys.Generate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.JWTSecret != "" {
+		logger.Warn().Msg("Still accepting HS256 tokens signed with auth.jwt_secret")
+		keys.AllowLegacySecret(cfg.JWTSecret)
+	}
+	logger.Info().Str("kid", keys.ActiveKeyID()).Msg("Token signing key loaded")
+	return keys, nil
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+)
+
+// SessionValidator reports whether a login session is still active
+type SessionValidator interface {
+	Validate(ctx context.Context, sessionID, userID, ip string) (bool, error)
+}
+
+// RequireSession rejects tokens whose session ("sid" claim) was revoked or has expired.
+// Tokens issued before sessions existed carry no sid and are accepted until they expire.
+// It must run after the JWT middleware.
+func RequireSession(sessions SessionValidator, logger zerolog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, ok := c.Locals("user").(*jwt.Token)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		}
+
+		sessionID, _ := claims["sid"].(string)
+		if sessionID == "" {
+			return c.Next()
+		}
+		userID, _ := claims["user_id"].(string)
+
+		active, err := sessions.Validate(c.Context(), sessionID, userID, c.IP())
+		if err != nil {
+			logger.Error().Err(err).Str("session_id", sessionID).Msg("Failed to validate session")
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Could not validate session"})
+		}
+		if !active {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session revoked or expired"})
+		}
+		return c.Next()
+	}
+}
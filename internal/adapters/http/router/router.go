@@ -1,23 +1,37 @@
 package router
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
 	"nihongo-api/internal/adapters/http/middleware"
 	"nihongo-api/internal/adapters/http/webhook"
+	"nihongo-api/internal/adapters/jwtkeys"
 	"nihongo-api/internal/application/service"
 	"nihongo-api/internal/domain"
 	"nihongo-api/internal/ports"
+	"strconv"
 	"time"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/expvar"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/rs/zerolog"
 )
 
 // SetupRoutes configures all HTTP routes
-func SetupRoutes(app *fiber.App, userService *service.UserService, subscriptionService *service.SubscriptionService, courseService *service.CourseService, progressService *service.ProgressService, syllableRepo ports.SyllableRepository, kanjiRepo ports.KanjiRepository, jwtSecret string, revenueCatSecrets []string, logger zerolog.Logger) {
+func SetupRoutes(app *fiber.App, userService *service.UserService, subscriptionService *service.SubscriptionService, courseService *service.CourseService, progressService *service.ProgressService, catalogService *service.CatalogService, reconciliationService *service.ReconciliationService, passwordResetService *service.PasswordResetService, emailVerificationService *service.EmailVerificationService, oauthService *service.OAuthService, loginGuard *service.LoginGuard, twoFactorService *service.TwoFactorService, accountService *service.AccountService, privacyService *service.PrivacyService, sessionService *service.SessionService, guestService *service.GuestService, streakService *service.StreakService, xpService *service.XPService, achievementService *service.AchievementService, leaderboardService *service.LeaderboardService, socialService *service.SocialService, mistakeService *service.MistakeService, studyService *service.StudyService, syllableRepo ports.SyllableRepository, kanjiRepo ports.KanjiRepository, keys *jwtkeys.KeySet, tokenTTL time.Duration, revenueCatSecrets []string, logger zerolog.Logger) {
 	api := app.Group("/api")
 
+	// Public token verification keys, so other services can verify access tokens
+	// without sharing a secret. Cached briefly so rotations propagate quickly.
+	app.Get("/.well-known/jwks.json", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.JSON(keys.JWKS())
+	})
+
 	// Health check
 	api.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok"})
@@ -70,13 +84,29 @@ func SetupRoutes(app *fiber.App, userService *service.UserService, subscriptionS
 		return c.JSON(kanjiList)
 	})
 
+	// mergeGuest upgrades the guest behind credential into user. A failed merge does not fail
+	// the registration or login; the guest stays as it was and the merge can be retried.
+	mergeGuest := func(c *fiber.Ctx, user *domain.User, credential string) *service.GuestMerge {
+		if credential == "" {
+			return nil
+		}
+		merge, err := guestService.Merge(c.Context(), credential, user)
+		if err != nil {
+			logger.Warn().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to merge guest account")
+			return nil
+		}
+		progressService.InvalidateSummary(c.Context(), user.ID.Hex())
+		return merge
+	}
+
 	// Auth routes
 	auth := api.Group("/auth")
 	auth.Post("/register", func(c *fiber.Ctx) error {
 		var req struct {
-			Name     string `json:"name"`
-			Email    string `json:"email"`
-			Password string `json:"password"`
+			Name            string `json:"name"`
+			Email           string `json:"email"`
+			Password        string `json:"password"`
+			GuestCredential string `json:"guest_credential"` // Upgrades this guest into the new account
 		}
 
 		if err := c.BodyParser(&req); err != nil {
@@ -85,69 +115,808 @@ func SetupRoutes(app *fiber.App, userService *service.UserService, subscriptionS
 
 		user, err := userService.RegisterUser(c.Context(), req.Name, req.Email, req.Password)
 		if err != nil {
+			var verr *service.ValidationError
+			if errors.As(err, &verr) {
+				return c.Status(400).JSON(fiber.Map{"error": "Invalid registration", "fields": verr.Fields})
+			}
 			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		return c.Status(201).JSON(user)
+		// Sent in the background so a slow mail server does not hold up registration;
+		// the user can ask for a new link if this one never arrives
+		go func(user domain.User) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := emailVerificationService.SendVerification(ctx, &user); err != nil {
+				logger.Error().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to send verification email")
+			}
+		}(*user)
+
+		return c.Status(201).JSON(struct {
+			*domain.User
+			GuestMerge *service.GuestMerge `json:"guest_merge,omitempty"`
+		}{user, mergeGuest(c, user, req.GuestCredential)})
 	})
 
+	// issueToken starts a session for the device making the request and returns its access
+	// token; mfa records whether the login included a second factor
+	issueToken := func(c *fiber.Ctx, user *domain.User, mfa bool) (string, error) {
+		session, err := sessionService.Start(c.Context(), user, deviceInfo(c), c.IP())
+		if err != nil {
+			return "", err
+		}
+		return keys.Sign(jwt.MapClaims{
+			"user_id":        user.ID.Hex(),
+			"sid":            session.ID.Hex(),
+			"email":          user.Email,
+			"role":           string(user.Role),
+			"email_verified": user.EmailVerified,
+			"mfa":            mfa,
+			"exp":            time.Now().Add(tokenTTL).Unix(),
+		})
+	}
+
+	// restoreAccount cancels a pending account deletion once the user has fully logged in
+	restoreAccount := func(c *fiber.Ctx, user *domain.User) {
+		if err := accountService.RestoreIfScheduled(c.Context(), user); err != nil {
+			logger.Error().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to cancel account deletion")
+		}
+	}
+
+	// completeLogin answers a successful first login step: with an access token, or with a
+	// challenge for the second step when the user has two-factor authentication enabled
+	completeLogin := func(c *fiber.Ctx, user *domain.User, guestCredential string) error {
+		if user.TwoFactorEnabled() {
+			challenge, err := twoFactorService.StartChallenge(c.Context(), user)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to start two-factor login"})
+			}
+			return c.JSON(fiber.Map{"two_factor_required": true, "challenge_token": challenge})
+		}
+		restoreAccount(c, user)
+
+		t, err := issueToken(c, user, false)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate token"})
+		}
+		resp := fiber.Map{"token": t, "user": user}
+		if twoFactorService.Required(user.Role) {
+			resp["two_factor_setup_required"] = true
+		}
+		if merge := mergeGuest(c, user, guestCredential); merge != nil {
+			resp["guest_merge"] = merge
+		}
+		return c.JSON(resp)
+	}
+
 	auth.Post("/login", func(c *fiber.Ctx) error {
 		var req struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
+			Email           string `json:"email"`
+			Password        string `json:"password"`
+			GuestCredential string `json:"guest_credential"`
 		}
 
 		if err := c.BodyParser(&req); err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
 		}
 
+		if err := loginGuard.Check(c.Context(), req.Email, c.IP()); err != nil {
+			return loginThrottled(c, err)
+		}
+
 		user, err := userService.AuthenticateUser(c.Context(), req.Email, req.Password)
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			if err := loginGuard.RecordFailure(c.Context(), req.Email, c.IP()); err != nil {
+				logger.Error().Err(err).Msg("Failed to record failed login")
+			}
+			return c.Status(401).JSON(fiber.Map{"error": "Invalid credentials"})
+		}
+		// The password was right, so earlier failures no longer count. With 2FA they are only
+		// cleared once the code is right too, or a leaked password would allow unlimited guesses.
+		if (err == nil && !user.TwoFactorEnabled()) || errors.Is(err, service.ErrEmailNotVerified) {
+			if err := loginGuard.RecordSuccess(c.Context(), req.Email); err != nil {
+				logger.Error().Err(err).Msg("Failed to reset login attempts")
+			}
+		}
 		if err != nil {
+			if errors.Is(err, service.ErrEmailNotVerified) {
+				return c.Status(403).JSON(fiber.Map{"error": "Email not verified"})
+			}
 			return c.Status(401).JSON(fiber.Map{"error": "Invalid credentials"})
 		}
 
-		// Generate JWT token
-		token := jwt.New(jwt.SigningMethodHS256)
-		claims := token.Claims.(jwt.MapClaims)
-		claims["user_id"] = user.ID.Hex()
-		claims["email"] = user.Email
-		claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
+		return completeLogin(c, user, req.GuestCredential)
+	})
 
-		t, err := token.SignedString([]byte(jwtSecret))
+	auth.Post("/login/2fa", func(c *fiber.Ctx) error {
+		var req struct {
+			ChallengeToken  string `json:"challenge_token"`
+			Code            string `json:"code"` // TOTP code or recovery code
+			GuestCredential string `json:"guest_credential"`
+		}
+
+		if err := c.BodyParser(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		user, err := twoFactorService.CompleteChallenge(c.Context(), req.ChallengeToken, req.Code, c.IP())
+		if err != nil {
+			var throttled *service.LoginThrottledError
+			if errors.As(err, &throttled) {
+				return loginThrottled(c, err)
+			}
+			if errors.Is(err, service.ErrInvalidChallenge) || errors.Is(err, service.ErrInvalidTwoFactorCode) || errors.Is(err, service.ErrTwoFactorNotEnabled) {
+				return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to complete login"})
+		}
+		restoreAccount(c, user)
+
+		t, err := issueToken(c, user, true)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate token"})
 		}
 
-		return c.JSON(fiber.Map{"token": t, "user": user})
+		resp := fiber.Map{"token": t, "user": user}
+		if merge := mergeGuest(c, user, req.GuestCredential); merge != nil {
+			resp["guest_merge"] = merge
+		}
+		return c.JSON(resp)
+	})
+
+	// Anonymous guest accounts let people try free content before signing up. Without a
+	// credential a new guest is created; the credential is only returned then and the app
+	// keeps it on the device.
+	guestLimiter := middleware.NewInMemoryRateLimiter(10, time.Minute)
+	auth.Post("/guest", guestLimiter.Handler(), func(c *fiber.Ctx) error {
+		var req struct {
+			Credential          string `json:"credential"`
+			RevenueCatAppUserID string `json:"revenuecat_app_user_id"` // The device's anonymous RevenueCat ID
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		if req.Credential != "" {
+			guest, err := guestService.Authenticate(c.Context(), req.Credential)
+			if err != nil {
+				return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+			}
+			t, err := issueToken(c, guest, false)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Failed to generate token"})
+			}
+			return c.JSON(fiber.Map{"token": t, "user": guest})
+		}
+
+		guest, credential, err := guestService.Create(c.Context(), req.RevenueCatAppUserID)
+		if errors.Is(err, service.ErrInvalidRevenueCatID) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to create guest"})
+		}
+		t, err := issueToken(c, guest, false)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to generate token"})
+		}
+		return c.Status(201).JSON(fiber.Map{"token": t, "user": guest, "credential": credential})
+	})
+
+	auth.Post("/unlock", func(c *fiber.Ctx) error {
+		var req struct {
+			Token string `json:"token"`
+		}
+
+		if err := c.BodyParser(&req); err != nil || req.Token == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		if err := loginGuard.Unlock(c.Context(), req.Token); err != nil {
+			if errors.Is(err, service.ErrInvalidUnlockToken) {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to unlock account"})
+		}
+
+		return c.JSON(fiber.Map{"message": "Account unlocked"})
+	})
+
+	auth.Post("/oauth/:provider", func(c *fiber.Ctx) error {
+		var req struct {
+			IDToken         string `json:"id_token"`
+			Name            string `json:"name"` // Apple only shares the name with the app, on first sign-in
+			GuestCredential string `json:"guest_credential"`
+		}
+
+		if err := c.BodyParser(&req); err != nil || req.IDToken == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		user, err := oauthService.SignIn(c.Context(), c.Params("provider"), req.IDToken, req.Name)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrUnknownProvider):
+				return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, ports.ErrInvalidIDToken):
+				return c.Status(401).JSON(fiber.Map{"error": "Invalid ID token"})
+			case errors.Is(err, service.ErrIdentityEmailUnverified):
+				return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, service.ErrEmailNotVerified):
+				return c.Status(403).JSON(fiber.Map{"error": "Email not verified"})
+			}
+			logger.Error().Err(err).Msg("OAuth sign-in failed")
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to sign in"})
+		}
+
+		return completeLogin(c, user, req.GuestCredential)
+	})
+
+	forgotLimiter := middleware.NewInMemoryRateLimiter(5, time.Minute)
+	auth.Post("/password/forgot", forgotLimiter.Handler(), func(c *fiber.Ctx) error {
+		var req struct {
+			Email string `json:"email"`
+		}
+
+		if err := c.BodyParser(&req); err != nil || req.Email == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		// Handled in the background so neither the status nor the response time
+		// reveals whether an account exists for this email
+		go func(email string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := passwordResetService.RequestReset(ctx, email); err != nil {
+				logger.Error().Err(err).Msg("Failed to process password reset request")
+			}
+		}(req.Email)
+
+		return c.Status(202).JSON(fiber.Map{"message": "If an account exists for this email, a reset link has been sent"})
+	})
+
+	auth.Post("/password/reset", func(c *fiber.Ctx) error {
+		var req struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+
+		if err := c.BodyParser(&req); err != nil || req.Token == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		if err := passwordResetService.ResetPassword(c.Context(), req.Token, req.Password); err != nil {
+			if errors.Is(err, service.ErrInvalidResetToken) || errors.Is(err, service.ErrWeakPassword) {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to reset password"})
+		}
+
+		return c.JSON(fiber.Map{"message": "Password updated"})
+	})
+
+	auth.Post("/verify-email", func(c *fiber.Ctx) error {
+		var req struct {
+			Token string `json:"token"`
+		}
+
+		if err := c.BodyParser(&req); err != nil || req.Token == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		user, err := emailVerificationService.VerifyEmail(c.Context(), req.Token)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidVerificationToken):
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, service.ErrEmailTaken):
+				return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to verify email"})
+		}
+
+		return c.JSON(fiber.Map{"message": "Email verified", "user": user})
 	})
 
 	// JWT middleware
 	jwtMiddleware := jwtware.New(jwtware.Config{
-		SigningKey: jwtware.SigningKey{Key: []byte(jwtSecret)},
+		KeyFunc: keys.Keyfunc,
 	})
 
+	// Valid token whose session has not been revoked
+	authenticated := []fiber.Handler{jwtMiddleware, middleware.RequireSession(sessionService, logger)}
+
 	// Protected routes
-	protected := api.Group("/protected", jwtMiddleware)
+	protected := api.Group("/protected", authenticated...)
 	protected.Get("/courses", func(c *fiber.Ctx) error {
-		courses, err := courseService.GetAllCourses(c.Context())
+		courses, err := courseService.GetCoursesForUser(c.Context(), currentUserID(c))
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
 		return c.JSON(courses)
 	})
 
+	protected.Get("/courses/:id", func(c *fiber.Ctx) error {
+		course, err := courseService.GetCourseForUser(c.Context(), c.Params("id"), currentUserID(c))
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidCourseID):
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, ports.ErrCourseNotFound):
+				return c.Status(404).JSON(fiber.Map{"error": "Course not found"})
+			}
+			logger.Error().Err(err).Str("course_id", c.Params("id")).Msg("Failed to get course")
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to get course"})
+		}
+		return c.JSON(course)
+	})
+
+	// Learner progress on syllables, kanji, lessons and exercises
+	protected.Get("/progress", func(c *fiber.Ctx) error {
+		progress, err := progressService.GetUserProgress(c.Context(), currentUserID(c), domain.EntityType(c.Query("entity_type")))
+		if err != nil {
+			return progressError(c, err, "Failed to get progress")
+		}
+		return c.JSON(progress)
+	})
+
+	// Completion per course and kana/kanji mastery per JLPT level
+	protected.Get("/progress/summary", func(c *fiber.Ctx) error {
+		summary, err := progressService.GetSummary(c.Context(), currentUserID(c))
+		if err != nil {
+			logger.Error().Err(err).Msg("Progress summary failed")
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to summarize progress"})
+		}
+		return c.JSON(summary)
+	})
+
+	protected.Get("/progress/:entityType/:entityId", func(c *fiber.Ctx) error {
+		progress, err := progressService.GetProgressByEntity(c.Context(), currentUserID(c), c.Params("entityId"), domain.EntityType(c.Params("entityType")))
+		if err != nil {
+			if errors.Is(err, ports.ErrProgressNotFound) {
+				return c.Status(404).JSON(fiber.Map{"error": "Progress not found"})
+			}
+			return progressError(c, err, "Failed to get progress")
+		}
+		return c.JSON(progress)
+	})
+
+	protected.Put("/progress/:entityType/:entityId", func(c *fiber.Ctx) error {
+		var req service.ProgressUpdate
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		progress, err := progressService.UpdateProgress(c.Context(), currentUserID(c), c.Params("entityId"), domain.EntityType(c.Params("entityType")), req)
+		if err != nil {
+			return progressError(c, err, "Failed to save progress")
+		}
+		return c.JSON(progress)
+	})
+
+	// Leeches, weak items and confused answers for a targeted practice session
+	protected.Get("/weak-items", func(c *fiber.Ctx) error {
+		weak, err := mistakeService.WeakItems(c.Context(), currentUserID(c), domain.EntityType(c.Query("entity_type")), c.QueryInt("limit", 20))
+		if errors.Is(err, service.ErrInvalidWeakItemsSize) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return progressError(c, err, "Failed to analyse mistakes")
+		}
+		return c.JSON(weak)
+	})
+
+	// Completed study sessions, uploaded in batches; distinct from the login sessions below
+	protected.Post("/sessions/study", func(c *fiber.Ctx) error {
+		var req service.StudySessionUpload
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		result, err := studyService.RecordSessions(c.Context(), currentUserID(c), req)
+		if err != nil {
+			return progressError(c, err, "Failed to record study sessions")
+		}
+		return c.Status(201).JSON(result)
+	})
+
+	// Study per day over a range, for a heatmap
+	protected.Get("/stats/study", func(c *fiber.Ctx) error {
+		user, err := userService.GetUserByID(c.Context(), currentUserID(c))
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		stats, err := studyService.Stats(c.Context(), user, c.Query("from"), c.Query("to"))
+		if errors.Is(err, service.ErrInvalidStatsRange) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("Study stats failed")
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to compute study stats"})
+		}
+		return c.JSON(stats)
+	})
+
+	protected.Post("/verify-email/resend", func(c *fiber.Ctx) error {
+		if err := emailVerificationService.ResendVerification(c.Context(), currentUserID(c)); err != nil {
+			if errors.Is(err, service.ErrEmailAlreadyVerified) {
+				return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to send verification email"})
+		}
+		return c.Status(202).JSON(fiber.Map{"message": "Verification email sent"})
+	})
+
+	// Two-factor authentication
+	twoFactor := protected.Group("/2fa")
+	twoFactor.Post("/enroll", func(c *fiber.Ctx) error {
+		enrolment, err := twoFactorService.Enroll(c.Context(), currentUserID(c))
+		if err != nil {
+			if errors.Is(err, service.ErrTwoFactorAlreadyEnabled) {
+				return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to start enrolment"})
+		}
+		return c.JSON(enrolment)
+	})
+
+	twoFactor.Post("/confirm", func(c *fiber.Ctx) error {
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := c.BodyParser(&req); err != nil || req.Code == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		codes, err := twoFactorService.Confirm(c.Context(), currentUserID(c), currentSessionID(c), req.Code)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrTwoFactorNotEnrolled):
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, service.ErrTwoFactorAlreadyEnabled):
+				return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to enable two-factor authentication"})
+		}
+		return c.JSON(fiber.Map{"recovery_codes": codes})
+	})
+
+	twoFactor.Post("/disable", func(c *fiber.Ctx) error {
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := c.BodyParser(&req); err != nil || req.Code == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		if err := twoFactorService.Disable(c.Context(), currentUserID(c), currentSessionID(c), req.Code); err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrTwoFactorNotEnabled):
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			case errors.Is(err, service.ErrTwoFactorRequired):
+				return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to disable two-factor authentication"})
+		}
+		return c.JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+	})
+
 	protected.Get("/profile", func(c *fiber.Ctx) error {
-		user := c.Locals("user").(*jwt.Token)
-		claims := user.Claims.(jwt.MapClaims)
-		userID := claims["user_id"].(string)
+		userID := currentUserID(c)
 
 		userData, err := userService.GetUserByID(c.Context(), userID)
 		if err != nil {
 			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 		}
 
-		return c.JSON(userData)
+		access, err := subscriptionService.GetAccess(c.Context(), userID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		streak, err := streakService.GetStreak(c.Context(), userData)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		// billing_issue inside subscription tells the app to prompt for a payment update
+		return c.JSON(struct {
+			*domain.User
+			Subscription *domain.SubscriptionAccess `json:"subscription"`
+			Streak       *domain.StreakStatus       `json:"streak"`
+		}{userData, access, streak})
 	})
+
+	// Daily streak in the user's timezone
+	protected.Get("/streak", func(c *fiber.Ctx) error {
+		user, err := userService.GetUserByID(c.Context(), currentUserID(c))
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		streak, err := streakService.GetStreak(c.Context(), user)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(streak)
+	})
+
+	// Credit streak freezes bought in the app store; safe to call after every purchase
+	protected.Post("/streak/freezes/claim", func(c *fiber.Ctx) error {
+		user, err := userService.GetUserByID(c.Context(), currentUserID(c))
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		credited, streak, err := streakService.ClaimFreezes(c.Context(), user)
+		if err != nil {
+			logger.Error().Err(err).Msg("Claiming streak freezes failed")
+			return c.Status(502).JSON(fiber.Map{"error": "Failed to verify purchases"})
+		}
+		return c.JSON(fiber.Map{"credited": credited, "streak": streak})
+	})
+
+	// XP, level and daily goal; days is how much history to return
+	protected.Get("/xp", func(c *fiber.Ctx) error {
+		user, err := userService.GetUserByID(c.Context(), currentUserID(c))
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+		}
+
+		xp, err := xpService.GetXP(c.Context(), user, c.QueryInt("days", 7))
+		if errors.Is(err, service.ErrInvalidHistoryDays) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(xp)
+	})
+
+	// Every achievement with whether the user earned it and their progress towards it
+	protected.Get("/achievements", func(c *fiber.Ctx) error {
+		achievements, err := achievementService.Evaluate(c.Context(), currentUserID(c))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(achievements)
+	})
+
+	// Top n of a board with the caller's rank and neighbours; week picks an archived week
+	protected.Get("/leaderboards/:board", func(c *fiber.Ctx) error {
+		standing, err := leaderboardService.Get(c.Context(), currentUserID(c), c.Params("board"), c.Query("week"), c.QueryInt("limit", 10))
+		switch {
+		case errors.Is(err, domain.ErrUnknownLeaderboard), errors.Is(err, ports.ErrLeaderboardArchiveNotFound):
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidLeaderboardSize):
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		case err != nil:
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(standing)
+	})
+
+	// Follow a user; users who approve follows get a request instead
+	protected.Post("/following/:userId", func(c *fiber.Ctx) error {
+		follow, err := socialService.Follow(c.Context(), currentUserID(c), c.Params("userId"))
+		switch {
+		case errors.Is(err, service.ErrCannotFollowSelf):
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrGuestCannotFollow):
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrFolloweeNotFound):
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrFollowLimit):
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		case err != nil:
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(follow)
+	})
+
+	// Unfollow, or withdraw a follow request
+	protected.Delete("/following/:userId", func(c *fiber.Ctx) error {
+		return followResult(c, socialService.Unfollow(c.Context(), currentUserID(c), c.Params("userId")))
+	})
+
+	protected.Get("/following", func(c *fiber.Ctx) error {
+		following, err := socialService.Following(c.Context(), currentUserID(c))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(following)
+	})
+
+	protected.Get("/followers", func(c *fiber.Ctx) error {
+		followers, err := socialService.Followers(c.Context(), currentUserID(c))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(followers)
+	})
+
+	protected.Delete("/followers/:userId", func(c *fiber.Ctx) error {
+		return followResult(c, socialService.RemoveFollower(c.Context(), currentUserID(c), c.Params("userId")))
+	})
+
+	// Follow requests waiting for approval
+	protected.Get("/follow-requests", func(c *fiber.Ctx) error {
+		requests, err := socialService.Requests(c.Context(), currentUserID(c))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(requests)
+	})
+
+	protected.Post("/follow-requests/:userId/accept", func(c *fiber.Ctx) error {
+		return followResult(c, socialService.Accept(c.Context(), currentUserID(c), c.Params("userId")))
+	})
+
+	protected.Delete("/follow-requests/:userId", func(c *fiber.Ctx) error {
+		return followResult(c, socialService.RemoveFollower(c.Context(), currentUserID(c), c.Params("userId")))
+	})
+
+	// Milestones of the users followed, newest first; before is the next_cursor of the previous page
+	protected.Get("/feed", func(c *fiber.Ctx) error {
+		page, err := socialService.Feed(c.Context(), currentUserID(c), c.Query("before"), c.QueryInt("limit", 20))
+		if errors.Is(err, service.ErrInvalidFeedSize) || errors.Is(err, service.ErrInvalidFeedCursor) {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(page)
+	})
+
+	// Self-service account management
+	protected.Patch("/profile", func(c *fiber.Ctx) error {
+		var req service.ProfileUpdate
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		user, err := accountService.UpdateProfile(c.Context(), currentUserID(c), req)
+		if err != nil {
+			return accountError(c, err, "Failed to update profile")
+		}
+		if user.LeaderboardOptOut {
+			if _, err := leaderboardService.RemoveUser(c.Context(), user.ID.Hex()); err != nil {
+				logger.Error().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to remove user from leaderboards")
+			}
+		}
+		if req.FollowApproval != nil || req.ActivityVisibility != nil {
+			if err := socialService.SettingsChanged(c.Context(), user); err != nil {
+				logger.Error().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to apply social settings")
+			}
+		}
+		return c.JSON(user)
+	})
+
+	protected.Post("/profile/password", func(c *fiber.Ctx) error {
+		var req service.PasswordChange
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		if err := accountService.ChangePassword(c.Context(), currentUserID(c), currentSessionID(c), req); err != nil {
+			return accountError(c, err, "Failed to change password")
+		}
+		return c.JSON(fiber.Map{"message": "Password updated"})
+	})
+
+	protected.Post("/profile/email", func(c *fiber.Ctx) error {
+		var req service.EmailChange
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		user, err := accountService.ChangeEmail(c.Context(), currentUserID(c), req)
+		if err != nil {
+			return accountError(c, err, "Failed to change email")
+		}
+		return c.Status(202).JSON(fiber.Map{"message": "Confirmation link sent to the new address", "pending_email": user.PendingEmail})
+	})
+
+	protected.Delete("/profile", func(c *fiber.Ctx) error {
+		var req service.AccountDeletion
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+		}
+
+		user, err := accountService.ScheduleDeletion(c.Context(), currentUserID(c), req)
+		if err != nil {
+			return accountError(c, err, "Failed to delete account")
+		}
+		// Logging in again before this time restores the account
+		return c.Status(202).JSON(fiber.Map{"message": "Account scheduled for deletion", "deletion_scheduled_at": user.DeletionScheduledAt})
+	})
+
+	// Devices the user is logged in on
+	protected.Get("/sessions", func(c *fiber.Ctx) error {
+		sessions, err := sessionService.List(c.Context(), currentUserID(c))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		current := currentSessionID(c)
+		resp := make([]fiber.Map, 0, len(sessions))
+		for _, s := range sessions {
+			resp = append(resp, fiber.Map{
+				"id":           s.ID.Hex(),
+				"device_name":  s.DeviceName,
+				"platform":     s.Platform,
+				"app_version":  s.AppVersion,
+				"ip":           s.IP,
+				"created_at":   s.CreatedAt,
+				"last_seen_at": s.LastSeenAt,
+				"expires_at":   s.ExpiresAt,
+				"current":      s.ID.Hex() == current,
+			})
+		}
+		return c.JSON(resp)
+	})
+
+	protected.Delete("/sessions/:id", func(c *fiber.Ctx) error {
+		if err := sessionService.Revoke(c.Context(), currentUserID(c), c.Params("id")); err != nil {
+			if errors.Is(err, ports.ErrSessionNotFound) {
+				return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke session"})
+		}
+		return c.SendStatus(204)
+	})
+
+	// Copy of everything stored about the user, for data access requests
+	protected.Post("/account/export", func(c *fiber.Ctx) error {
+		var buf bytes.Buffer
+		if err := privacyService.Export(c.Context(), currentUserID(c), &buf); err != nil {
+			logger.Error().Err(err).Msg("Data export failed")
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to export data"})
+		}
+
+		c.Attachment("nihongo-export-" + time.Now().UTC().Format("2006-01-02") + ".zip")
+		return c.Send(buf.Bytes())
+	})
+
+	// Admin routes
+	adminOnly := append(authenticated, middleware.RequireRole(string(domain.RoleAdmin)))
+	if twoFactorService.Required(domain.RoleAdmin) {
+		adminOnly = append(adminOnly, middleware.RequireMFA())
+	}
+	admin := api.Group("/admin", adminOnly...)
+	admin.Get("/catalog", func(c *fiber.Ctx) error {
+		catalog, err := catalogService.GetCatalog(c.Context())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(catalog)
+	})
+
+	// Re-sync a subscriber from RevenueCat, e.g. after a lost webhook
+	admin.Post("/subscriptions/:appUserId/reconcile", func(c *fiber.Ctx) error {
+		result, err := reconciliationService.ReconcileUser(c.Context(), c.Params("appUserId"))
+		if err != nil {
+			if errors.Is(err, ports.ErrSubscriberNotFound) {
+				return c.Status(404).JSON(fiber.Map{"error": "Subscriber not found"})
+			}
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(result)
+	})
+
+	// Recompute the erasure receipt hash chain to detect tampering
+	admin.Get("/erasure-receipts/verify", func(c *fiber.Ctx) error {
+		status, err := privacyService.VerifyReceipts(c.Context())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(status)
+	})
+
+	// Runtime metrics (expvar), e.g. scheduler runs and subscriptions expired by the sweeper
+	app.Get("/debug/vars", append(adminOnly, expvar.New())...)
+
 	// Webhook routes (no auth needed)
 	webhooks := app.Group("/webhooks")
 
@@ -158,3 +927,85 @@ func SetupRoutes(app *fiber.App, userService *service.UserService, subscriptionS
 	revenueCatHandler := webhook.NewRevenueCatHandler(subscriptionService, revenueCatSecrets, logger)
 	webhooks.Post("/revenuecat", revenueCatHandler.Handle)
 }
+
+// accountError maps account management errors to responses; fallback is the message for
+// unexpected errors
+func accountError(c *fiber.Ctx, err error, fallback string) error {
+	var verr *service.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request", "fields": verr.Fields})
+	case errors.Is(err, service.ErrSameEmail):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrReauthenticationFailed):
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailTaken):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": fallback})
+}
+
+// progressError maps progress errors to responses; fallback is the message for unexpected
+// errors
+func progressError(c *fiber.Ctx, err error, fallback string) error {
+	var verr *service.ValidationError
+	var locked *service.LessonLockedError
+	switch {
+	case errors.As(err, &verr):
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request", "fields": verr.Fields})
+	case errors.As(err, &locked):
+		return c.Status(403).JSON(fiber.Map{"error": locked.Error(), "lesson_id": locked.LessonID, "unmet_prerequisites": locked.UnmetPrerequisites})
+	case errors.Is(err, service.ErrUnknownEntityType), errors.Is(err, service.ErrInvalidEntityID):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrEntityNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{"error": fallback})
+}
+
+// followResult answers a change to a follow: 204 when done, 404 when there was no such follow
+func followResult(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ports.ErrFollowNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
+
+// currentUserID returns the user ID from the JWT validated by the JWT middleware
+func currentUserID(c *fiber.Ctx) string {
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userID, _ := claims["user_id"].(string)
+	return userID
+}
+
+// currentSessionID returns the session ID ("sid" claim) of the validated JWT, if any
+func currentSessionID(c *fiber.Ctx) string {
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	sessionID, _ := claims["sid"].(string)
+	return sessionID
+}
+
+// deviceInfo reads the device details the apps send with login requests
+func deviceInfo(c *fiber.Ctx) service.DeviceInfo {
+	return service.DeviceInfo{
+		Name:       c.Get("X-Device-Name"),
+		Platform:   c.Get("X-Device-Platform"),
+		AppVersion: c.Get("X-App-Version"),
+	}
+}
+
+// loginThrottled answers 429 with Retry-After for throttled logins
+func loginThrottled(c *fiber.Ctx, err error) error {
+	var throttled *service.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to check login attempts"})
+	}
+	retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return c.Status(429).JSON(fiber.Map{"error": throttled.Error(), "retry_after": retryAfter, "locked": throttled.Locked})
+}
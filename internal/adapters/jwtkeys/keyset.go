@@ -0,0 +1,269 @@
+// Package jwtkeys holds the asymmetric keys used to sign and verify API access tokens.
+//
+// The first private key in a KeySet signs new tokens; every key (including public-only
+// ones) verifies them. Rotating means putting a new key first and keeping the old one
+// until the tokens it signed have expired, so nobody is logged out. Key IDs are RFC 7638
+// thumbprints, so they never have to be configured by hand.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// minRSABits is the smallest RSA modulus accepted for signing keys
+	minRSABits = 2048
+)
+
+var (
+	ErrNoSigningKey = errors.New("no private signing key configured")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// Key is a single verification key, optionally able to sign
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Public  crypto.PublicKey
+	private crypto.Signer
+}
+
+// KeySet is the set of keys accepted for access tokens
+type KeySet struct {
+	keys   []*Key
+	byID   map[string]*Key
+	active *Key
+	// legacySecret verifies HS256 tokens issued before asymmetric keys; empty disables them
+	legacySecret []byte
+}
+
+// Load reads PEM-encoded keys from each file and then from pemData (e.g. an environment
+// variable holding one or more PEM blocks). The first private key becomes the active key.
+func Load(files []string, pemData string) (*KeySet, error) {
+	var keys []*Key
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		parsed, err := ParsePEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys = append(keys, parsed...)
+	}
+
+	parsed, err := ParsePEM([]byte(pemData))
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, parsed...)
+
+	return New(keys...)
+}
+
+// Generate returns a key set with a single new Ed25519 key, for development setups
+// without configured keys. Tokens stop verifying when the process restarts.
+func Generate() (*KeySet, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := newKey(private)
+	if err != nil {
+		return nil, err
+	}
+	return New(key)
+}
+
+// New builds a key set; the first key with a private part is the active one
+func New(keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{byID: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, dup := ks.byID[key.ID]; dup {
+			continue
+		}
+		ks.keys = append(ks.keys, key)
+		ks.byID[key.ID] = key
+		if ks.active == nil && key.private != nil {
+			ks.active = key
+		}
+	}
+	if ks.active == nil {
+		return nil, ErrNoSigningKey
+	}
+	return ks, nil
+}
+
+// AllowLegacySecret keeps accepting HS256 tokens signed with the old shared secret. It is
+// meant for the switch to asymmetric keys and can be dropped once those tokens have expired.
+func (ks *KeySet) AllowLegacySecret(secret string) {
+	ks.legacySecret = []byte(secret)
+}
+
+// ActiveKeyID returns the kid of the key that signs new tokens
+func (ks *KeySet) ActiveKeyID() string {
+	return ks.active.ID
+}
+
+// Sign signs claims with the active key and sets the kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.private)
+}
+
+// Keyfunc selects the verification key by the token's kid and rejects algorithm mismatches
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(ks.legacySecret) > 0 {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("%w: unexpected algorithm %s", ErrUnknownKey, token.Method.Alg())
+		}
+		return ks.legacySecret, nil
+	}
+
+	key, ok := ks.byID[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("%w: algorithm %s does not match key %s", ErrUnknownKey, token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys as a JSON Web Key Set document
+func (ks *KeySet) JWKS() map[string][]JWK {
+	jwks := make([]JWK, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		jwk := publicJWK(key.Public)
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.Method.Alg()
+		jwks = append(jwks, jwk)
+	}
+	return map[string][]JWK{"keys": jwks}
+}
+
+// ParsePEM parses every key in data. PKCS#8 and PKCS#1 private keys sign and verify;
+// PKIX public keys only verify, which is enough for keys that have been rotated out.
+func ParsePEM(data []byte) ([]*Key, error) {
+	var keys []*Key
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return keys, nil
+		}
+
+		var (
+			parsed interface{}
+			err    error
+		)
+		switch block.Type {
+		case "PRIVATE KEY":
+			parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "PUBLIC KEY":
+			parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+		default:
+			return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", block.Type, err)
+		}
+
+		key, err := newKey(parsed)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+}
+
+func newKey(parsed interface{}) (*Key, error) {
+	key := &Key{}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.private = signer
+		parsed = signer.Public()
+	}
+
+	switch pub := parsed.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", parsed)
+	}
+	key.Public = parsed
+	key.ID = thumbprint(publicJWK(key.Public))
+	return key, nil
+}
+
+func publicJWK(pub crypto.PublicKey) JWK {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)}
+	}
+	return JWK{}
+}
+
+// thumbprint computes the RFC 7638 SHA-256 thumbprint of a public JWK
+func thumbprint(jwk JWK) string {
+	// Required members only, in lexicographic order
+	var members interface{}
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	canonical, _ := json.Marshal(members)
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,131 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func privatePEM(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func publicPEM(t *testing.T, key interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": "u1", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	// Before rotation: RSA signs
+	before, err := Load(nil, privatePEM(t, rsaKey))
+	require.NoError(t, err)
+	oldToken, err := before.Sign(claims())
+	require.NoError(t, err)
+
+	// After rotation: Ed25519 signs, the old RSA key only verifies
+	after, err := Load(nil, privatePEM(t, edKey)+publicPEM(t, &rsaKey.PublicKey))
+	require.NoError(t, err)
+	assert.NotEqual(t, before.ActiveKeyID(), after.ActiveKeyID())
+	newToken, err := after.Sign(claims())
+	require.NoError(t, err)
+
+	for _, tok := range []string{oldToken, newToken} {
+		parsed, err := jwt.Parse(tok, after.Keyfunc)
+		require.NoError(t, err)
+		assert.True(t, parsed.Valid)
+	}
+	parsed, _ := jwt.Parse(newToken, after.Keyfunc)
+	assert.Equal(t, after.ActiveKeyID(), parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+
+	_, err = jwt.Parse(newToken, before.Keyfunc)
+	assert.ErrorIs(t, err, ErrUnknownKey, "keys that were never loaded are rejected")
+
+	jwks := after.JWKS()["keys"]
+	require.Len(t, jwks, 2)
+	assert.Equal(t, "OKP", jwks[0].Kty)
+	assert.Equal(t, "RSA", jwks[1].Kty)
+	assert.Equal(t, before.ActiveKeyID(), jwks[1].Kid)
+}
+
+func TestKeySet_RejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ks, err := Load(nil, privatePEM(t, rsaKey))
+	require.NoError(t, err)
+
+	// An HS256 token "signed" with the public key under the RSA kid must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	forged.Header["kid"] = ks.ActiveKeyID()
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	signed, err := forged.SignedString(der)
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(signed, ks.Keyfunc)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestKeySet_LegacySecret(t *testing.T) {
+	ks, err := Generate()
+	require.NoError(t, err)
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims()).SignedString([]byte("an-old-secret-of-at-least-32-chars!!"))
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(legacy, ks.Keyfunc)
+	assert.Error(t, err)
+
+	ks.AllowLegacySecret("an-old-secret-of-at-least-32-chars!!")
+	_, err = jwt.Parse(legacy, ks.Keyfunc)
+	assert.NoError(t, err)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	_, err := Load(nil, "")
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = Load(nil, publicPEM(t, &rsaKey.PublicKey))
+	assert.ErrorIs(t, err, ErrNoSigningKey, "a public key alone cannot sign")
+
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = Load(nil, privatePEM(t, weak))
+	assert.Error(t, err)
+
+	_, err = Load([]string{"does-not-exist.pem"}, "")
+	assert.Error(t, err)
+}
+
+// Example key from RFC 7638 section 3.1
+func TestThumbprint_RFC7638(t *testing.T) {
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	require.NoError(t, err)
+	key, err := newKey(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	require.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", key.ID)
+}
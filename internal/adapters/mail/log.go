@@ -0,0 +1,60 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+)
+
+// LogMailer is a development and test stand-in that logs each email and, when a
+// directory is configured, writes it there as an .eml file instead of sending it
+type LogMailer struct {
+	from   string
+	dir    string
+	logger zerolog.Logger
+}
+
+// NewLogMailer creates a new log mailer; dir may be empty to only log
+func NewLogMailer(from, dir string, logger zerolog.Logger) ports.Mailer {
+	return &LogMailer{
+		from:   from,
+		dir:    dir,
+		logger: logger,
+	}
+}
+
+func (m *LogMailer) Send(ctx context.Context, email ports.Email) error {
+	event := m.logger.Info().Str("to", email.To).Str("subject", email.Subject)
+	if m.dir == "" {
+		// Without an output directory the body (and its links) only exist in the log
+		event.Str("body", email.Body).Msg("Email not sent (log mailer)")
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create mail output directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), sanitizeFilename(email.To))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, buildMessage(m.from, email), 0o600); err != nil {
+		return fmt.Errorf("failed to write email file: %w", err)
+	}
+	event.Str("file", path).Msg("Email written to file (log mailer)")
+	return nil
+}
+
+func sanitizeFilename(s string) string {
+	out := []rune(s)
+	for i, r := range out {
+		if !(r == '@' || r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')) {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nihongo-api/internal/ports"
+)
+
+func TestLogMailer_WritesEmlFiles(t *testing.T) {
+	dir := t.TempDir()
+	m := NewLogMailer("Nihongo <no-reply@nihongo.app>", dir, zerolog.Nop())
+
+	err := m.Send(context.Background(), ports.Email{
+		To:      "aiko@example.com",
+		Subject: "Reset\r\nBcc: evil@example.com",
+		Body:    "line one\nline two",
+	})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	raw, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	msg := string(raw)
+	assert.Contains(t, msg, "To: aiko@example.com\r\n")
+	assert.Contains(t, msg, "Subject: ResetBcc: evil@example.com\r\n")
+	assert.NotContains(t, msg, "\r\nBcc:")
+	assert.True(t, strings.HasSuffix(msg, "line one\r\nline two"))
+}
@@ -0,0 +1,127 @@
+// Package oidc implements ports.IdentityVerifier for OpenID Connect providers such as
+// Sign in with Apple and Google Sign-In, verifying ID tokens against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"nihongo-api/internal/ports"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// clockSkew tolerates small differences between our clock and the provider's
+	clockSkew = time.Minute
+)
+
+// ProviderConfig describes where to fetch a provider's keys and which tokens to accept
+type ProviderConfig struct {
+	Name      string   // Provider name used in routes and stored identities, e.g. "google"
+	JWKSURL   string   // URL of the provider's JSON Web Key Set
+	Issuers   []string // Accepted "iss" values
+	Audiences []string // Our client IDs; the token's "aud" must contain one of them
+	// RefreshInterval is how often the key set is refetched in the background. Unknown
+	// key IDs also trigger a refetch, rate limited to once a minute.
+	RefreshInterval time.Duration
+}
+
+// Verifier verifies ID tokens for a single provider
+type Verifier struct {
+	cfg    ProviderConfig
+	jwks   *keyfunc.JWKS
+	logger zerolog.Logger
+}
+
+// NewVerifier creates a verifier and starts caching the provider's key set. A provider that
+// cannot be reached at startup does not fail: keys are fetched again on the first unknown kid.
+// Background refreshes stop when ctx is cancelled.
+func NewVerifier(ctx context.Context, cfg ProviderConfig, logger zerolog.Logger) (*Verifier, error) {
+	logger = logger.With().Str("provider", cfg.Name).Logger()
+	jwks, err := keyfunc.Get(cfg.JWKSURL, keyfunc.Options{
+		Ctx:               ctx,
+		Client:            &http.Client{Timeout: 10 * time.Second},
+		RefreshInterval:   cfg.RefreshInterval,
+		RefreshRateLimit:  time.Minute,
+		RefreshTimeout:    10 * time.Second,
+		RefreshUnknownKID: true,
+		RefreshErrorHandler: func(err error) {
+			logger.Warn().Err(err).Msg("Failed to refresh identity provider keys")
+		},
+		TolerateInitialJWKHTTPError: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s keys: %w", cfg.Name, err)
+	}
+
+	return &Verifier{cfg: cfg, jwks: jwks, logger: logger}, nil
+}
+
+// Verify checks the token signature, expiry, issuer and audience and returns the identity it asserts
+func (v *Verifier) Verify(ctx context.Context, idToken string) (*ports.VerifiedIdentity, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(idToken, &claims, v.jwks.Keyfunc,
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		v.logger.Warn().Err(err).Msg("Rejected ID token")
+		return nil, fmt.Errorf("%w: %v", ports.ErrInvalidIDToken, err)
+	}
+
+	if !slices.Contains(v.cfg.Issuers, claims.Issuer) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ports.ErrInvalidIDToken, claims.Issuer)
+	}
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool { return slices.Contains(v.cfg.Audiences, aud) }) {
+		return nil, fmt.Errorf("%w: unexpected audience", ports.ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ports.ErrInvalidIDToken)
+	}
+
+	identity := &ports.VerifiedIdentity{
+		Provider:      v.cfg.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}
+	if claims.IssuedAt != nil {
+		identity.IssuedAt = claims.IssuedAt.Time
+	}
+	return identity, nil
+}
+
+// Close stops the background key refresh
+func (v *Verifier) Close() {
+	v.jwks.EndBackground()
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Email         string       `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+	Name          string       `json:"name"`
+}
+
+// flexibleBool accepts both JSON booleans (Google) and "true"/"false" strings (Apple)
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	case "false", `"false"`, "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nihongo-api/internal/ports"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jwksServer serves an RSA key as a JSON Web Key Set, standing in for a provider
+func jwksServer(t *testing.T, kid string, key *rsa.PublicKey) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": kid,
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv := jwksServer(t, "k1", &key.PublicKey)
+
+	v, err := NewVerifier(context.Background(), ProviderConfig{
+		Name:            "apple",
+		JWKSURL:         srv.URL,
+		Issuers:         []string{"https://appleid.apple.com"},
+		Audiences:       []string{"app.nihongo.ios"},
+		RefreshInterval: time.Hour,
+	}, zerolog.Nop())
+	require.NoError(t, err)
+	defer v.Close()
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            "https://appleid.apple.com",
+			"aud":            "app.nihongo.ios",
+			"sub":            "001234.abcd",
+			"email":          "aiko@privaterelay.appleid.com",
+			"email_verified": "true",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"iat":            time.Now().Unix(),
+		}
+	}
+
+	identity, err := v.Verify(context.Background(), signIDToken(t, key, "k1", valid()))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), identity.IssuedAt, time.Minute)
+	identity.IssuedAt = time.Time{}
+	assert.Equal(t, &ports.VerifiedIdentity{
+		Provider:      "apple",
+		Subject:       "001234.abcd",
+		Email:         "aiko@privaterelay.appleid.com",
+		EmailVerified: true,
+	}, identity)
+
+	tests := []struct {
+		name   string
+		key    *rsa.PrivateKey
+		mutate func(jwt.MapClaims)
+	}{
+		{"wrong signing key", other, func(jwt.MapClaims) {}},
+		{"wrong issuer", key, func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"wrong audience", key, func(c jwt.MapClaims) { c["aud"] = "someone.else" }},
+		{"expired", key, func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"no expiry", key, func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"no subject", key, func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.mutate(claims)
+			_, err := v.Verify(context.Background(), signIDToken(t, tt.key, "k1", claims))
+			assert.ErrorIs(t, err, ports.ErrInvalidIDToken)
+		})
+	}
+}
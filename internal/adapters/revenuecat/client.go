@@ -0,0 +1,150 @@
+// Package revenuecat implements ports.SubscriberProvider on top of the RevenueCat REST API.
+package revenuecat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// maxRetryAfter caps how long a 429 Retry-After header can stall a request
+	maxRetryAfter = 30 * time.Second
+)
+
+var (
+	ErrRateLimited = errors.New("revenuecat rate limit exceeded")
+)
+
+// Client is an HTTP client for RevenueCat's v1 REST API
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+	logger     zerolog.Logger
+}
+
+// NewClient creates a RevenueCat client. timeout bounds each HTTP attempt and maxRetries
+// is the number of extra attempts for 429s, 5xx responses and network errors.
+func NewClient(baseURL, apiKey string, timeout time.Duration, maxRetries int, logger zerolog.Logger) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: timeout},
+		maxRetries: maxRetries,
+		backoff:    200 * time.Millisecond,
+		logger:     logger,
+	}
+}
+
+// GetSubscriber calls GET /subscribers/{app_user_id}
+func (c *Client) GetSubscriber(ctx context.Context, appUserID string) (*ports.Subscriber, error) {
+	endpoint := c.baseURL + "/subscribers/" + url.PathEscape(appUserID)
+
+	var body subscriberResponse
+	if err := c.getJSON(ctx, endpoint, &body); err != nil {
+		return nil, err
+	}
+	return body.Subscriber.toPort(appUserID), nil
+}
+
+// getJSON performs a GET with retries and decodes a 2xx JSON body into out
+func (c *Client) getJSON(ctx context.Context, endpoint string, out interface{}) error {
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			wait := c.backoff * time.Duration(1<<(attempt-1))
+			if errors.Is(lastErr, ErrRateLimited) {
+				var rl *rateLimitError
+				if errors.As(lastErr, &rl) && rl.retryAfter > 0 {
+					wait = rl.retryAfter
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		retry, err := c.doGet(ctx, endpoint, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			return err
+		}
+		c.logger.Warn().Err(err).Int("attempt", attempt+1).Str("endpoint", endpoint).Msg("RevenueCat request failed; retrying")
+	}
+	return lastErr
+}
+
+// doGet performs a single attempt and reports whether a failure is worth retrying
+func (c *Client) doGet(ctx context.Context, endpoint string, out interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return true, fmt.Errorf("revenuecat request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true, &rateLimitError{retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	case resp.StatusCode == http.StatusNotFound:
+		return false, ports.ErrSubscriberNotFound
+	case resp.StatusCode >= 500:
+		return true, fmt.Errorf("revenuecat server error: %s", resp.Status)
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return false, fmt.Errorf("revenuecat request rejected: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("failed to decode revenuecat response: %w", err)
+	}
+	return false, nil
+}
+
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string { return ErrRateLimited.Error() }
+func (e *rateLimitError) Unwrap() error { return ErrRateLimited }
+
+// parseRetryAfter reads a Retry-After header expressed in seconds
+func parseRetryAfter(v string) time.Duration {
+	secs, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	d := time.Duration(secs) * time.Second
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
@@ -0,0 +1,119 @@
+package revenuecat
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nihongo-api/internal/adapters/revenuecat/revenuecattest"
+	"nihongo-api/internal/ports"
+)
+
+const subscriberFixture = `{
+	"original_app_user_id": "user1",
+	"entitlements": {
+		"premium": {"product_identifier": "premium_monthly", "purchase_date": "2026-01-01T00:00:00Z", "expires_date": "2026-02-01T00:00:00Z"}
+	},
+	"subscriptions": {
+		"premium_monthly": {
+			"store": "app_store",
+			"period_type": "normal",
+			"purchase_date": "2026-01-01T00:00:00Z",
+			"expires_date": "2026-02-01T00:00:00Z",
+			"billing_issues_detected_at": "2026-01-31T00:00:00Z",
+			"grace_period_expires_date": "2026-02-07T00:00:00Z",
+			"unsubscribe_detected_at": null,
+			"refunded_at": null,
+			"is_sandbox": false
+		}
+	},
+	"non_subscriptions": {
+		"jlpt_n2_pack": [{"id": "abc", "store": "play_store", "purchase_date": "2026-01-05T00:00:00Z", "is_sandbox": false}]
+	}
+}`
+
+func newTestClient(server *revenuecattest.Server) *Client {
+	c := NewClient(server.URL, server.APIKey, time.Second, 2, zerolog.Nop())
+	c.backoff = time.Millisecond
+	return c
+}
+
+func TestClient_GetSubscriber(t *testing.T) {
+	server := revenuecattest.NewServer("sk_test")
+	defer server.Close()
+	server.SetSubscriber("user1", subscriberFixture)
+
+	sub, err := newTestClient(server).GetSubscriber(context.Background(), "user1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "user1", sub.AppUserID)
+	assert.Equal(t, "user1", sub.OriginalAppUserID)
+	assert.Equal(t, "premium_monthly", sub.Entitlements["premium"].ProductID)
+	monthly := sub.Subscriptions["premium_monthly"]
+	assert.Equal(t, "app_store", monthly.Store)
+	assert.True(t, monthly.ExpiresAt.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)))
+	assert.NotNil(t, monthly.BillingIssuesDetectedAt)
+	assert.NotNil(t, monthly.GracePeriodExpiresAt)
+	assert.Nil(t, monthly.RefundedAt)
+	assert.Len(t, sub.NonSubscriptions["jlpt_n2_pack"], 1)
+}
+
+func TestClient_GetSubscriberErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		apiKey       string
+		failures     []int
+		wantErr      error
+		wantAnyErr   bool
+		wantRequests int
+	}{
+		{name: "retries server errors", apiKey: "sk_test", failures: []int{http.StatusBadGateway, http.StatusServiceUnavailable}, wantRequests: 3},
+		{name: "retries rate limiting", apiKey: "sk_test", failures: []int{http.StatusTooManyRequests}, wantRequests: 2},
+		{name: "gives up after max retries", apiKey: "sk_test", failures: []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}, wantErr: ErrRateLimited, wantRequests: 3},
+		{name: "does not retry client errors", apiKey: "wrong", wantAnyErr: true, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := revenuecattest.NewServer("sk_test")
+			defer server.Close()
+			server.SetSubscriber("user1", subscriberFixture)
+			server.FailNext(tt.failures...)
+
+			client := NewClient(server.URL, tt.apiKey, time.Second, 2, zerolog.Nop())
+			client.backoff = time.Millisecond
+			_, err := client.GetSubscriber(context.Background(), "user1")
+
+			switch {
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+			case tt.wantAnyErr:
+				assert.Error(t, err)
+			default:
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantRequests, server.Requests())
+		})
+	}
+}
+
+func TestClient_GetSubscriberNotFound(t *testing.T) {
+	server := revenuecattest.NewServer("sk_test")
+	defer server.Close()
+
+	_, err := newTestClient(server).GetSubscriber(context.Background(), "missing")
+	assert.ErrorIs(t, err, ports.ErrSubscriberNotFound)
+	assert.Equal(t, 1, server.Requests())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 2*time.Second, parseRetryAfter("2"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+	assert.Equal(t, maxRetryAfter, parseRetryAfter("3600"))
+}
@@ -0,0 +1,92 @@
+// Package revenuecattest provides a fake RevenueCat REST API for tests.
+package revenuecattest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Server is an httptest server that answers GET /subscribers/{app_user_id}
+// from subscribers registered with SetSubscriber.
+type Server struct {
+	*httptest.Server
+	APIKey string
+
+	mu          sync.Mutex
+	subscribers map[string]string
+	failures    []int
+	requests    int
+}
+
+// NewServer starts a fake RevenueCat API that expects the given API key
+func NewServer(apiKey string) *Server {
+	s := &Server{
+		APIKey:      apiKey,
+		subscribers: make(map[string]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SetSubscriber registers the raw JSON "subscriber" object returned for appUserID
+func (s *Server) SetSubscriber(appUserID, subscriberJSON string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers[appUserID] = subscriberJSON
+}
+
+// FailNext makes the next requests answer with the given status codes, in order.
+// 429 responses carry "Retry-After: 0" so tests do not wait.
+func (s *Server) FailNext(statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statusCodes...)
+}
+
+// Requests returns how many requests the server has received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	var fail int
+	if len(s.failures) > 0 {
+		fail, s.failures = s.failures[0], s.failures[1:]
+	}
+	s.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+s.APIKey {
+		http.Error(w, `{"code":7225,"message":"Invalid API Key."}`, http.StatusUnauthorized)
+		return
+	}
+	if fail != 0 {
+		if fail == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		http.Error(w, `{"message":"simulated failure"}`, fail)
+		return
+	}
+
+	appUserID, ok := strings.CutPrefix(r.URL.Path, "/subscribers/")
+	if r.Method != http.MethodGet || !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	body, found := s.subscribers[appUserID]
+	s.mu.Unlock()
+	if !found {
+		http.Error(w, `{"code":7259,"message":"Subscriber not found."}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"request_date_ms":0,"subscriber":` + body + `}`))
+}
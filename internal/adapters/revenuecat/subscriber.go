@@ -0,0 +1,86 @@
+package revenuecat
+
+import (
+	"time"
+
+	"nihongo-api/internal/ports"
+)
+
+// subscriberResponse mirrors the body of GET /subscribers/{app_user_id}
+// See: https://www.revenuecat.com/docs/api-v1#tag/customers
+type subscriberResponse struct {
+	Subscriber subscriberJSON `json:"subscriber"`
+}
+
+type subscriberJSON struct {
+	OriginalAppUserID string                           `json:"original_app_user_id"`
+	Entitlements      map[string]entitlementJSON       `json:"entitlements"`
+	Subscriptions     map[string]subscriptionJSON      `json:"subscriptions"`
+	NonSubscriptions  map[string][]nonSubscriptionJSON `json:"non_subscriptions"`
+}
+
+type entitlementJSON struct {
+	ProductIdentifier string     `json:"product_identifier"`
+	PurchaseDate      time.Time  `json:"purchase_date"`
+	ExpiresDate       *time.Time `json:"expires_date"`
+}
+
+type subscriptionJSON struct {
+	Store                   string     `json:"store"`
+	PeriodType              string     `json:"period_type"`
+	PurchaseDate            time.Time  `json:"purchase_date"`
+	ExpiresDate             *time.Time `json:"expires_date"`
+	GracePeriodExpiresDate  *time.Time `json:"grace_period_expires_date"`
+	UnsubscribeDetectedAt   *time.Time `json:"unsubscribe_detected_at"`
+	BillingIssuesDetectedAt *time.Time `json:"billing_issues_detected_at"`
+	RefundedAt              *time.Time `json:"refunded_at"`
+	IsSandbox               bool       `json:"is_sandbox"`
+}
+
+type nonSubscriptionJSON struct {
+	ID           string    `json:"id"`
+	Store        string    `json:"store"`
+	PurchaseDate time.Time `json:"purchase_date"`
+	IsSandbox    bool      `json:"is_sandbox"`
+}
+
+func (s subscriberJSON) toPort(appUserID string) *ports.Subscriber {
+	sub := &ports.Subscriber{
+		AppUserID:         appUserID,
+		OriginalAppUserID: s.OriginalAppUserID,
+		Entitlements:      make(map[string]ports.SubscriberEntitlement, len(s.Entitlements)),
+		Subscriptions:     make(map[string]ports.SubscriberSubscription, len(s.Subscriptions)),
+		NonSubscriptions:  make(map[string][]ports.SubscriberPurchase, len(s.NonSubscriptions)),
+	}
+	for id, e := range s.Entitlements {
+		sub.Entitlements[id] = ports.SubscriberEntitlement{
+			ProductID:   e.ProductIdentifier,
+			PurchasedAt: e.PurchaseDate,
+			ExpiresAt:   e.ExpiresDate,
+		}
+	}
+	for productID, p := range s.Subscriptions {
+		sub.Subscriptions[productID] = ports.SubscriberSubscription{
+			Store:                   p.Store,
+			PeriodType:              p.PeriodType,
+			PurchasedAt:             p.PurchaseDate,
+			ExpiresAt:               p.ExpiresDate,
+			GracePeriodExpiresAt:    p.GracePeriodExpiresDate,
+			UnsubscribeDetectedAt:   p.UnsubscribeDetectedAt,
+			BillingIssuesDetectedAt: p.BillingIssuesDetectedAt,
+			RefundedAt:              p.RefundedAt,
+			IsSandbox:               p.IsSandbox,
+		}
+	}
+	for productID, purchases := range s.NonSubscriptions {
+		for _, p := range purchases {
+			sub.NonSubscriptions[productID] = append(sub.NonSubscriptions[productID], ports.SubscriberPurchase{
+				ID:          p.ID,
+				Store:       p.Store,
+				PurchasedAt: p.PurchaseDate,
+				IsSandbox:   p.IsSandbox,
+			})
+		}
+	}
+	return sub
+}
@@ -0,0 +1,128 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoAchievementRepository keeps definitions in achievements and awards in user_achievements
+type mongoAchievementRepository struct {
+	definitions *mongo.Collection
+	earned      *mongo.Collection
+}
+
+// NewMongoAchievementRepository creates a new MongoDB achievement repository
+func NewMongoAchievementRepository(db *mongo.Database) ports.AchievementRepository {
+	earned := db.Collection("user_achievements")
+
+	// An achievement is earned once per user
+	indexUserAchievement := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "achievement_id", Value: 1}},
+		Options: options.Index().SetName("user_achievement").SetUnique(true),
+	}
+	_, _ = earned.Indexes().CreateOne(context.Background(), indexUserAchievement)
+
+	return &mongoAchievementRepository{
+		definitions: db.Collection("achievements"),
+		earned:      earned,
+	}
+}
+
+func (r *mongoAchievementRepository) Definitions(ctx context.Context) ([]domain.AchievementDefinition, error) {
+	cursor, err := r.definitions.Find(ctx, bson.M{"disabled": bson.M{"$ne": true}}, options.Find().SetSort(bson.D{{Key: "order", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get achievements: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	definitions := []domain.AchievementDefinition{}
+	if err := cursor.All(ctx, &definitions); err != nil {
+		return nil, fmt.Errorf("failed to decode achievements: %w", err)
+	}
+	return definitions, nil
+}
+
+func (r *mongoAchievementRepository) EnsureDefinitions(ctx context.Context, definitions []domain.AchievementDefinition) error {
+	if len(definitions) == 0 {
+		return nil
+	}
+	docs := make([]any, len(definitions))
+	for i := range definitions {
+		docs[i] = definitions[i]
+	}
+
+	// Unordered so every missing definition is inserted past the duplicates
+	_, err := r.definitions.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !onlyDuplicateKeyErrors(err) {
+		return fmt.Errorf("failed to add achievements: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoAchievementRepository) Earned(ctx context.Context, userID string) ([]domain.UserAchievement, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	cursor, err := r.earned.Find(ctx, bson.M{"user_id": objID}, options.Find().SetSort(bson.D{{Key: "earned_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get earned achievements: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	earned := []domain.UserAchievement{}
+	if err := cursor.All(ctx, &earned); err != nil {
+		return nil, fmt.Errorf("failed to decode earned achievements: %w", err)
+	}
+	return earned, nil
+}
+
+func (r *mongoAchievementRepository) Award(ctx context.Context, achievement *domain.UserAchievement) error {
+	achievement.ID = primitive.NewObjectID()
+	_, err := r.earned.InsertOne(ctx, achievement)
+	if mongo.IsDuplicateKeyError(err) {
+		return ports.ErrAchievementAlreadyEarned
+	}
+	if err != nil {
+		return fmt.Errorf("failed to award achievement: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoAchievementRepository) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := r.earned.DeleteMany(ctx, bson.M{"user_id": objID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete earned achievements: %w", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// onlyDuplicateKeyErrors reports whether every write of a bulk insert failed on a
+// duplicate key
+func onlyDuplicateKeyErrors(err error) bool {
+	var bulk mongo.BulkWriteException
+	if !errors.As(err, &bulk) || bulk.WriteConcernError != nil {
+		return false
+	}
+	for _, e := range bulk.WriteErrors {
+		if e.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoActivityRepository keeps each user's milestones. Feeds are assembled when read
+// from the activities of everyone followed, so recording a milestone is a single insert
+// however many followers there are.
+type mongoActivityRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoActivityRepository creates a new MongoDB activity repository
+func NewMongoActivityRepository(db *mongo.Database) ports.ActivityRepository {
+	coll := db.Collection("activities")
+
+	// A milestone is recorded once per user
+	indexUserKindKey := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetName("user_kind_key").SetUnique(true),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexUserKindKey)
+
+	// Lets feeds merge the newest activities of each user followed instead of sorting them all
+	indexUserNewest := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetName("user_id_newest"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexUserNewest)
+
+	return &mongoActivityRepository{
+		collection: coll,
+	}
+}
+
+func (r *mongoActivityRepository) Record(ctx context.Context, activity *domain.Activity) error {
+	activity.ID = primitive.NewObjectID()
+	_, err := r.collection.InsertOne(ctx, activity)
+	if mongo.IsDuplicateKeyError(err) {
+		return ports.ErrActivityExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record activity: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoActivityRepository) Feed(ctx context.Context, followers, friends []string, before string, limit int) ([]domain.Activity, error) {
+	followerIDs, err := objectIDs(followers)
+	if err != nil {
+		return nil, err
+	}
+	friendIDs, err := objectIDs(friends)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"user_id": bson.M{"$in": followerIDs}, "visibility": domain.VisibleToFollowers},
+		bson.M{"user_id": bson.M{"$in": friendIDs}, "visibility": bson.M{"$in": bson.A{domain.VisibleToFollowers, domain.VisibleToFriends}}},
+	}}
+	if before != "" {
+		beforeID, err := primitive.ObjectIDFromHex(before)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		filter["_id"] = bson.M{"$lt": beforeID}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	activities := []domain.Activity{}
+	if err := cursor.All(ctx, &activities); err != nil {
+		return nil, fmt.Errorf("failed to decode feed: %w", err)
+	}
+	return activities, nil
+}
+
+func (r *mongoActivityRepository) ByUser(ctx context.Context, userID string) ([]domain.Activity, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": objID}, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get activities: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	activities := []domain.Activity{}
+	if err := cursor.All(ctx, &activities); err != nil {
+		return nil, fmt.Errorf("failed to decode activities: %w", err)
+	}
+	return activities, nil
+}
+
+func (r *mongoActivityRepository) SetVisibility(ctx context.Context, userID string, visibility domain.ActivityVisibility) error {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	_, err = r.collection.UpdateMany(
+		ctx,
+		bson.M{"user_id": objID, "visibility": bson.M{"$ne": visibility}},
+		bson.M{"$set": bson.M{"visibility": visibility}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update activity visibility: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoActivityRepository) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": objID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete activities: %w", err)
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,262 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// attemptRetention is how long attempts are kept; analyses look at far less
+const attemptRetention = 180 * 24 * time.Hour
+
+// mongoAttemptLog implements ports.AttemptLog
+type mongoAttemptLog struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAttemptLog creates a new MongoDB attempt log
+func NewMongoAttemptLog(db *mongo.Database) ports.AttemptLog {
+	coll := db.Collection("attempts")
+
+	indexUser := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("user_created_at"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexUser)
+
+	// Serves the lookup of earlier attempts on an item in DailyStats
+	indexEntity := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "entity_id", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("user_entity_created_at"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexEntity)
+
+	indexExpiry := mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("created_at_ttl").SetExpireAfterSeconds(int32(attemptRetention.Seconds())),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexExpiry)
+
+	return &mongoAttemptLog{
+		collection: coll,
+	}
+}
+
+func (l *mongoAttemptLog) Record(ctx context.Context, attempts []domain.Attempt) error {
+	if len(attempts) == 0 {
+		return nil
+	}
+	docs := make([]any, len(attempts))
+	for i := range attempts {
+		attempts[i].ID = primitive.NewObjectID()
+		docs[i] = attempts[i]
+	}
+	if _, err := l.collection.InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("failed to record attempts: %w", err)
+	}
+	return nil
+}
+
+// attemptsSince matches the user's attempts since the given time, of one entity type if set
+func attemptsSince(userID string, entityType domain.EntityType, since time.Time) (bson.M, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	filter := bson.M{"user_id": objID, "created_at": bson.M{"$gte": since}}
+	if entityType != "" {
+		filter["entity_type"] = entityType
+	}
+	return filter, nil
+}
+
+func (l *mongoAttemptLog) ItemStats(ctx context.Context, userID string, entityType domain.EntityType, since time.Time) ([]domain.ItemAttempts, error) {
+	filter, err := attemptsSince(userID, entityType, since)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":                  "$entity_id",
+			"entity_type":          bson.M{"$last": "$entity_type"},
+			"expected":             bson.M{"$last": "$expected"},
+			"attempts":             bson.M{"$sum": 1},
+			"failures":             bson.M{"$sum": bson.M{"$cond": bson.A{"$correct", 0, 1}}},
+			"avg_response_time_ms": bson.M{"$avg": "$response_time_ms"},
+			"last_correct":         bson.M{"$last": "$correct"},
+			"last_attempt_at":      bson.M{"$last": "$created_at"},
+		}}},
+		{{Key: "$match", Value: bson.M{"failures": bson.M{"$gt": 0}}}},
+		{{Key: "$set", Value: bson.M{"avg_response_time_ms": bson.M{"$round": bson.A{"$avg_response_time_ms", 0}}}}},
+	}
+
+	stats := []domain.ItemAttempts{}
+	if err := aggregateAll(ctx, l.collection, pipeline, &stats); err != nil {
+		return nil, fmt.Errorf("failed to aggregate attempts: %w", err)
+	}
+	return stats, nil
+}
+
+func (l *mongoAttemptLog) Confusions(ctx context.Context, userID string, entityType domain.EntityType, since time.Time, minCount, limit int) ([]domain.ConfusionPair, error) {
+	filter, err := attemptsSince(userID, entityType, since)
+	if err != nil {
+		return nil, err
+	}
+	filter["correct"] = false
+	filter["answer"] = bson.M{"$ne": ""}
+	// Compares the fields of a document, which a query filter cannot do
+	filter["$expr"] = bson.M{"$ne": bson.A{"$answer", "$expected"}}
+
+	// Each pair is keyed by its two answers in order, so both directions count together
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"entity_type": "$entity_type",
+				"a":           bson.M{"$min": bson.A{"$answer", "$expected"}},
+				"b":           bson.M{"$max": bson.A{"$answer", "$expected"}},
+			},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gte": minCount}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id.a", Value: 1}, {Key: "_id.b", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "entity_type": "$_id.entity_type", "a": "$_id.a", "b": "$_id.b", "count": 1}}},
+	}
+
+	pairs := []domain.ConfusionPair{}
+	if err := aggregateAll(ctx, l.collection, pipeline, &pairs); err != nil {
+		return nil, fmt.Errorf("failed to aggregate confusions: %w", err)
+	}
+	return pairs, nil
+}
+
+func (l *mongoAttemptLog) DailyStats(ctx context.Context, userID string, loc *time.Location, from, to string) ([]domain.AttemptDay, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	start, end, err := dayRange(loc, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// An item answered again on a later day is a review, and the first answer of that day
+	// tells whether it was retained. Only attempts in the range are scanned; whether an item
+	// was answered before the range is a lookup of one earlier attempt, no further back
+	// than attempts are kept.
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": objID, "created_at": bson.M{"$gte": start, "$lt": end}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           bson.M{"entity_id": "$entity_id", "day": dayOf("$created_at", loc)},
+			"attempts":      bson.M{"$sum": 1},
+			"correct":       bson.M{"$sum": bson.M{"$cond": bson.A{"$correct", 1, 0}}},
+			"first_correct": bson.M{"$first": "$correct"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id.day", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       "$_id.entity_id",
+			"first_day": bson.M{"$first": "$_id.day"},
+			"days": bson.M{"$push": bson.M{
+				"day":           "$_id.day",
+				"attempts":      "$attempts",
+				"correct":       "$correct",
+				"first_correct": "$first_correct",
+			}},
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": l.collection.Name(),
+			"let":  bson.M{"entity_id": "$_id"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"user_id":    objID,
+					"created_at": bson.M{"$gte": start.Add(-attemptRetention), "$lt": start},
+					"$expr":      bson.M{"$eq": bson.A{"$entity_id", "$$entity_id"}},
+				}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+			"as": "earlier",
+		}}},
+		{{Key: "$unwind", Value: "$days"}},
+		{{Key: "$set", Value: bson.M{"review": bson.M{"$or": bson.A{
+			bson.M{"$gt": bson.A{bson.M{"$size": "$earlier"}, 0}},
+			bson.M{"$gt": bson.A{"$days.day", "$first_day"}},
+		}}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$days.day",
+			"attempts": bson.M{"$sum": "$days.attempts"},
+			"correct":  bson.M{"$sum": "$days.correct"},
+			"reviews":  bson.M{"$sum": bson.M{"$cond": bson.A{"$review", 1, 0}}},
+			"retained": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$and": bson.A{"$review", "$days.first_correct"}}, 1, 0}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+
+	days := []domain.AttemptDay{}
+	if err := aggregateAll(ctx, l.collection, pipeline, &days); err != nil {
+		return nil, fmt.Errorf("failed to aggregate attempt days: %w", err)
+	}
+	return days, nil
+}
+
+func (l *mongoAttemptLog) ListByUser(ctx context.Context, userID string) ([]domain.Attempt, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	cursor, err := l.collection.Find(ctx, bson.M{"user_id": objID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attempts: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	attempts := []domain.Attempt{}
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return nil, fmt.Errorf("failed to decode attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+func (l *mongoAttemptLog) Reassign(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	from, err := primitive.ObjectIDFromHex(fromUserID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+	to, err := primitive.ObjectIDFromHex(toUserID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := l.collection.UpdateMany(ctx, bson.M{"user_id": from}, bson.M{"$set": bson.M{"user_id": to}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to reassign attempts: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+func (l *mongoAttemptLog) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := l.collection.DeleteMany(ctx, bson.M{"user_id": objID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete attempts: %w", err)
+	}
+	return result.DeletedCount, nil
+}
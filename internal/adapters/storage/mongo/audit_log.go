@@ -0,0 +1,72 @@
+package mongo
+
+import (
+	"context"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoAuditLog implements ports.AuditLog
+type mongoAuditLog struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAuditLog creates a new MongoDB audit log
+func NewMongoAuditLog(db *mongo.Database) ports.AuditLog {
+	coll := db.Collection("audit_log")
+
+	indexUser := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("user_created_at"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexUser)
+
+	return &mongoAuditLog{
+		collection: coll,
+	}
+}
+
+func (l *mongoAuditLog) Record(ctx context.Context, event *domain.AuditEvent) error {
+	event.ID = primitive.NewObjectID()
+	_, err := l.collection.InsertOne(ctx, event)
+	return err
+}
+
+func (l *mongoAuditLog) ListByUser(ctx context.Context, userID string) ([]*domain.AuditEvent, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := l.collection.Find(ctx, bson.M{"user_id": objID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var events []*domain.AuditEvent
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (l *mongoAuditLog) AnonymizeUser(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	update := bson.M{"$unset": bson.M{"user_id": "", "email": "", "ip": ""}}
+	result, err := l.collection.UpdateMany(ctx, bson.M{"user_id": objID}, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,37 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoCatalogRepository implements ports.CatalogRepository
+type mongoCatalogRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoCatalogRepository creates a new MongoDB catalog override repository
+func NewMongoCatalogRepository(db *mongo.Database) ports.CatalogRepository {
+	return &mongoCatalogRepository{
+		collection: db.Collection("catalog_overrides"),
+	}
+}
+
+func (r *mongoCatalogRepository) GetOverrides(ctx context.Context) ([]domain.CatalogEntry, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get catalog overrides: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var entries []domain.CatalogEntry
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode catalog overrides: %w", err)
+	}
+	return entries, nil
+}
@@ -41,13 +41,41 @@ func (r *mongoCourseRepository) GetByID(ctx context.Context, id string) (*domain
 	err = r.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&course)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("course not found")
+			return nil, ports.ErrCourseNotFound
 		}
 		return nil, fmt.Errorf("failed to get course by ID: %w", err)
 	}
 	return &course, nil
 }
 
+func (r *mongoCourseRepository) GetByLessonID(ctx context.Context, lessonID string) (*domain.Course, error) {
+	objID, err := primitive.ObjectIDFromHex(lessonID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lesson ID: %w", err)
+	}
+	return r.findOne(ctx, bson.M{"lessons._id": objID})
+}
+
+func (r *mongoCourseRepository) GetByExerciseID(ctx context.Context, exerciseID string) (*domain.Course, error) {
+	objID, err := primitive.ObjectIDFromHex(exerciseID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exercise ID: %w", err)
+	}
+	return r.findOne(ctx, bson.M{"lessons.exercises._id": objID})
+}
+
+func (r *mongoCourseRepository) findOne(ctx context.Context, filter bson.M) (*domain.Course, error) {
+	var course domain.Course
+	err := r.collection.FindOne(ctx, filter).Decode(&course)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ports.ErrCourseNotFound
+		}
+		return nil, fmt.Errorf("failed to find course: %w", err)
+	}
+	return &course, nil
+}
+
 func (r *mongoCourseRepository) GetAll(ctx context.Context) ([]domain.Course, error) {
 	cursor, err := r.collection.Find(ctx, bson.M{})
 	if err != nil {
@@ -77,7 +105,10 @@ func (r *mongoCourseRepository) GetByLevel(ctx context.Context, level domain.JLP
 }
 
 func (r *mongoCourseRepository) GetPremium(ctx context.Context) ([]domain.Course, error) {
-	cursor, err := r.collection.Find(ctx, bson.M{"is_premium": true})
+	cursor, err := r.collection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"is_premium": true},
+		bson.M{"required_entitlements.0": bson.M{"$exists": true}},
+	}})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get premium courses: %w", err)
 	}
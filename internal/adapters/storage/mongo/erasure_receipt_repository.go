@@ -0,0 +1,86 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoErasureReceiptRepository implements ports.ErasureReceiptRepository
+type mongoErasureReceiptRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoErasureReceiptRepository creates a new MongoDB erasure receipt repository
+func NewMongoErasureReceiptRepository(db *mongo.Database) ports.ErasureReceiptRepository {
+	coll := db.Collection("erasure_receipts")
+
+	indexSequence := mongo.IndexModel{
+		Keys:    bson.D{{Key: "sequence", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("unique_sequence"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexSequence)
+
+	indexSubject := mongo.IndexModel{
+		Keys:    bson.D{{Key: "subject_hash", Value: 1}},
+		Options: options.Index().SetName("idx_subject_hash"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexSubject)
+
+	return &mongoErasureReceiptRepository{
+		collection: coll,
+	}
+}
+
+func (r *mongoErasureReceiptRepository) Append(ctx context.Context, receipt *domain.ErasureReceipt) error {
+	receipt.ID = primitive.NewObjectID()
+	_, err := r.collection.InsertOne(ctx, receipt)
+	return err
+}
+
+func (r *mongoErasureReceiptRepository) Last(ctx context.Context) (*domain.ErasureReceipt, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "sequence", Value: -1}})
+
+	var receipt domain.ErasureReceipt
+	err := r.collection.FindOne(ctx, bson.M{}, opts).Decode(&receipt)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+func (r *mongoErasureReceiptRepository) GetBySubject(ctx context.Context, subjectHash string) (*domain.ErasureReceipt, error) {
+	var receipt domain.ErasureReceipt
+	err := r.collection.FindOne(ctx, bson.M{"subject_hash": subjectHash}).Decode(&receipt)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+func (r *mongoErasureReceiptRepository) List(ctx context.Context) ([]*domain.ErasureReceipt, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var receipts []*domain.ErasureReceipt
+	if err = cursor.All(ctx, &receipts); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
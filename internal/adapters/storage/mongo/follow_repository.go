@@ -0,0 +1,230 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoFollowRepository keeps one document per follower and followee
+type mongoFollowRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoFollowRepository creates a new MongoDB follow repository
+func NewMongoFollowRepository(db *mongo.Database) ports.FollowRepository {
+	coll := db.Collection("follows")
+
+	// Serves following lists and the feed; a user follows another once
+	indexFollowerFollowee := mongo.IndexModel{
+		Keys:    bson.D{{Key: "follower_id", Value: 1}, {Key: "followee_id", Value: 1}},
+		Options: options.Index().SetName("follower_followee").SetUnique(true),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexFollowerFollowee)
+
+	indexFolloweeStatus := mongo.IndexModel{
+		Keys:    bson.D{{Key: "followee_id", Value: 1}, {Key: "status", Value: 1}, {Key: "follower_id", Value: 1}},
+		Options: options.Index().SetName("followee_status_follower"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexFolloweeStatus)
+
+	return &mongoFollowRepository{
+		collection: coll,
+	}
+}
+
+// pairFilter matches the follow from follower to followee; there is none between invalid IDs
+func pairFilter(followerID, followeeID string) (bson.M, error) {
+	follower, err := primitive.ObjectIDFromHex(followerID)
+	if err != nil {
+		return nil, ports.ErrFollowNotFound
+	}
+	followee, err := primitive.ObjectIDFromHex(followeeID)
+	if err != nil {
+		return nil, ports.ErrFollowNotFound
+	}
+	return bson.M{"follower_id": follower, "followee_id": followee}, nil
+}
+
+func (r *mongoFollowRepository) Create(ctx context.Context, follow *domain.Follow) error {
+	follow.ID = primitive.NewObjectID()
+	_, err := r.collection.InsertOne(ctx, follow)
+	if mongo.IsDuplicateKeyError(err) {
+		return ports.ErrFollowExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create follow: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoFollowRepository) Get(ctx context.Context, followerID, followeeID string) (*domain.Follow, error) {
+	filter, err := pairFilter(followerID, followeeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var follow domain.Follow
+	err = r.collection.FindOne(ctx, filter).Decode(&follow)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrFollowNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get follow: %w", err)
+	}
+	return &follow, nil
+}
+
+func (r *mongoFollowRepository) Accept(ctx context.Context, followerID, followeeID string, at time.Time) error {
+	filter, err := pairFilter(followerID, followeeID)
+	if err != nil {
+		return err
+	}
+	filter["status"] = domain.FollowPending
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"status": domain.FollowAccepted, "accepted_at": at}})
+	if err != nil {
+		return fmt.Errorf("failed to accept follow: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ports.ErrFollowNotFound
+	}
+	return nil
+}
+
+func (r *mongoFollowRepository) AcceptAll(ctx context.Context, followeeID string, at time.Time) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(followeeID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"followee_id": objID, "status": domain.FollowPending},
+		bson.M{"$set": bson.M{"status": domain.FollowAccepted, "accepted_at": at}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to accept follows: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoFollowRepository) Delete(ctx context.Context, followerID, followeeID string) error {
+	filter, err := pairFilter(followerID, followeeID)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to delete follow: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ports.ErrFollowNotFound
+	}
+	return nil
+}
+
+func (r *mongoFollowRepository) Following(ctx context.Context, followerID string, status domain.FollowStatus) ([]domain.Follow, error) {
+	return r.list(ctx, "follower_id", followerID, status)
+}
+
+func (r *mongoFollowRepository) Followers(ctx context.Context, followeeID string, status domain.FollowStatus) ([]domain.Follow, error) {
+	return r.list(ctx, "followee_id", followeeID, status)
+}
+
+// list returns the follows whose field is userID, newest first
+func (r *mongoFollowRepository) list(ctx context.Context, field, userID string, status domain.FollowStatus) ([]domain.Follow, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{field: objID, "status": status}, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list follows: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	follows := []domain.Follow{}
+	if err := cursor.All(ctx, &follows); err != nil {
+		return nil, fmt.Errorf("failed to decode follows: %w", err)
+	}
+	return follows, nil
+}
+
+func (r *mongoFollowRepository) CountFollowing(ctx context.Context, followerID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(followerID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	count, err := r.collection.CountDocuments(ctx, bson.M{"follower_id": objID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count follows: %w", err)
+	}
+	return count, nil
+}
+
+func (r *mongoFollowRepository) FollowersAmong(ctx context.Context, followeeID string, userIDs []string) ([]string, error) {
+	objID, err := primitive.ObjectIDFromHex(followeeID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	among, err := objectIDs(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"followee_id": objID, "status": domain.FollowAccepted, "follower_id": bson.M{"$in": among}}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"follower_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find followers: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var follows []domain.Follow
+	if err := cursor.All(ctx, &follows); err != nil {
+		return nil, fmt.Errorf("failed to decode followers: %w", err)
+	}
+	followers := make([]string, len(follows))
+	for i, f := range follows {
+		followers[i] = f.FollowerID.Hex()
+	}
+	return followers, nil
+}
+
+func (r *mongoFollowRepository) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"$or": bson.A{bson.M{"follower_id": objID}, bson.M{"followee_id": objID}}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete follows: %w", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// objectIDs parses hex IDs
+func objectIDs(ids []string) ([]primitive.ObjectID, error) {
+	objIDs := make([]primitive.ObjectID, len(ids))
+	for i, id := range ids {
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q: %w", id, err)
+		}
+		objIDs[i] = objID
+	}
+	return objIDs, nil
+}
@@ -41,7 +41,7 @@ func (r *mongoKanjiRepository) GetByID(ctx context.Context, id string) (*domain.
 	err = r.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&kanji)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("kanji not found")
+			return nil, ports.ErrKanjiNotFound
 		}
 		return nil, fmt.Errorf("failed to get kanji by ID: %w", err)
 	}
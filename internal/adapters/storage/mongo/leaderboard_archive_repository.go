@@ -0,0 +1,79 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoLeaderboardArchiveRepository keeps one document per board and week
+type mongoLeaderboardArchiveRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoLeaderboardArchiveRepository creates a new MongoDB leaderboard archive repository
+func NewMongoLeaderboardArchiveRepository(db *mongo.Database) ports.LeaderboardArchiveRepository {
+	coll := db.Collection("leaderboard_archives")
+
+	indexBoardWeek := mongo.IndexModel{
+		Keys:    bson.D{{Key: "board", Value: 1}, {Key: "week", Value: 1}},
+		Options: options.Index().SetName("board_week").SetUnique(true),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexBoardWeek)
+
+	// Serves erasure, which removes a user from every archive
+	indexEntryUser := mongo.IndexModel{
+		Keys:    bson.D{{Key: "entries.user_id", Value: 1}},
+		Options: options.Index().SetName("entries_user_id"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexEntryUser)
+
+	return &mongoLeaderboardArchiveRepository{
+		collection: coll,
+	}
+}
+
+func (r *mongoLeaderboardArchiveRepository) Save(ctx context.Context, archive *domain.LeaderboardArchive) error {
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"board": archive.Board, "week": archive.Week},
+		bson.M{"$set": bson.M{"entries": archive.Entries, "archived_at": archive.ArchivedAt}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to archive leaderboard: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoLeaderboardArchiveRepository) Get(ctx context.Context, board, week string) (*domain.LeaderboardArchive, error) {
+	var archive domain.LeaderboardArchive
+	err := r.collection.FindOne(ctx, bson.M{"board": board, "week": week}).Decode(&archive)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ports.ErrLeaderboardArchiveNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leaderboard archive: %w", err)
+	}
+	return &archive, nil
+}
+
+func (r *mongoLeaderboardArchiveRepository) RemoveUser(ctx context.Context, userID string) (int64, error) {
+	// Ranks of the others are kept as they were that week
+	result, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"entries.user_id": userID},
+		bson.M{"$pull": bson.M{"entries": bson.M{"user_id": userID}}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove user from leaderboard archives: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,116 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"nihongo-api/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migration is a one-off change to stored data
+type migration struct {
+	name string
+	run  func(ctx context.Context, db *mongo.Database) error
+}
+
+// migrations are applied in order, each once per database. Never rename or remove one
+// that has been released; add a new one instead.
+var migrations = []migration{
+	{
+		// Accounts created before email verification existed are treated as verified.
+		// Must only ever run once: afterwards every user has email_verified set.
+		name: "users_email_verified_backfill",
+		run: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("users").UpdateMany(ctx,
+				bson.M{"email_verified": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"email_verified": true}},
+			)
+			return err
+		},
+	},
+	{
+		// Concurrent first writes could store a user's progress on an entity twice. The copies
+		// are folded into one so the unique index on them can be built.
+		name: "progress_merge_duplicates",
+		run:  mergeDuplicateProgress,
+	},
+}
+
+// mergeDuplicateProgress keeps the oldest progress record of each user and entity, merged
+// with the others, and deletes the rest
+func mergeDuplicateProgress(ctx context.Context, db *mongo.Database) error {
+	coll := db.Collection("progress")
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"user_id": "$user_id", "entity_id": "$entity_id", "entity_type": "$entity_type"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+	var duplicates []struct {
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+	if err := aggregateAll(ctx, coll, pipeline, &duplicates); err != nil {
+		return err
+	}
+
+	for _, d := range duplicates {
+		cursor, err := coll.Find(ctx, bson.M{"_id": bson.M{"$in": d.IDs}}, options.Find().SetSort(bson.M{"_id": 1}))
+		if err != nil {
+			return err
+		}
+		var records []domain.Progress
+		if err := cursor.All(ctx, &records); err != nil {
+			return err
+		}
+		if len(records) < 2 {
+			continue
+		}
+
+		kept, extra := records[0], make([]primitive.ObjectID, 0, len(records)-1)
+		for _, r := range records[1:] {
+			kept.Merge(r)
+			extra = append(extra, r.ID)
+		}
+		if _, err := coll.UpdateOne(ctx, bson.M{"_id": kept.ID}, bson.M{"$set": kept}); err != nil {
+			return err
+		}
+		if _, err := coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": extra}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrate applies the migrations db has not had yet, recording each in the migrations
+// collection, and returns the names of those applied
+func Migrate(ctx context.Context, db *mongo.Database) ([]string, error) {
+	coll := db.Collection("migrations")
+	applied := []string{}
+	for _, m := range migrations {
+		count, err := coll.CountDocuments(ctx, bson.M{"_id": m.name})
+		if err != nil {
+			return applied, fmt.Errorf("failed to check migration %s: %w", m.name, err)
+		}
+		if count > 0 {
+			continue
+		}
+		if err := m.run(ctx, db); err != nil {
+			return applied, fmt.Errorf("failed to apply migration %s: %w", m.name, err)
+		}
+		// Another replica starting at the same time may have recorded it first
+		_, err = coll.InsertOne(ctx, bson.M{"_id": m.name, "applied_at": time.Now()})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return applied, fmt.Errorf("failed to record migration %s: %w", m.name, err)
+		}
+		applied = append(applied, m.name)
+	}
+	return applied, nil
+}
@@ -0,0 +1,62 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// processedEventRetention is how long event IDs are kept. RevenueCat stops retrying long
+// before; older redeliveries are still ignored because they predate the last applied event.
+const processedEventRetention = 90 * 24 * time.Hour
+
+// mongoProcessedEventRepository implements ports.ProcessedEventRepository
+type mongoProcessedEventRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoProcessedEventRepository creates a new MongoDB processed event repository
+func NewMongoProcessedEventRepository(db *mongo.Database) ports.ProcessedEventRepository {
+	coll := db.Collection("processed_events")
+
+	indexEvent := mongo.IndexModel{
+		Keys:    bson.D{{Key: "event_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("unique_event_id"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexEvent)
+
+	indexExpiry := mongo.IndexModel{
+		Keys:    bson.D{{Key: "processed_at", Value: 1}},
+		Options: options.Index().SetName("processed_at_ttl").SetExpireAfterSeconds(int32(processedEventRetention.Seconds())),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexExpiry)
+
+	return &mongoProcessedEventRepository{
+		collection: coll,
+	}
+}
+
+func (r *mongoProcessedEventRepository) Exists(ctx context.Context, eventID string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"event_id": eventID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to look up processed event: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (r *mongoProcessedEventRepository) Record(ctx context.Context, eventID string, processedAt time.Time) error {
+	_, err := r.collection.InsertOne(ctx, bson.M{"event_id": eventID, "processed_at": processedAt})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ports.ErrDuplicateEvent
+		}
+		return fmt.Errorf("failed to record processed event: %w", err)
+	}
+	return nil
+}
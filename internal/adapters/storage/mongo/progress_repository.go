@@ -10,21 +10,48 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type mongoProgressRepository struct {
 	collection *mongo.Collection
+	// Content collections joined by the progress aggregations
+	courses   *mongo.Collection
+	kanji     *mongo.Collection
+	syllables *mongo.Collection
 }
 
 func NewMongoProgressRepository(db *mongo.Database) ports.ProgressRepository {
+	coll := db.Collection("progress")
+
+	// Serves the per-user lookups of the summary aggregations
+	indexUserType := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "entity_type", Value: 1}},
+		Options: options.Index().SetName("user_entity_type"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexUserType)
+
+	// One record per user and entity, so concurrent first writes cannot both insert
+	indexUserEntity := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "entity_id", Value: 1}, {Key: "entity_type", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("uniq_user_entity"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexUserEntity)
+
 	return &mongoProgressRepository{
-		collection: db.Collection("progress"),
+		collection: coll,
+		courses:    db.Collection("courses"),
+		kanji:      db.Collection("kanji"),
+		syllables:  db.Collection("syllables"),
 	}
 }
 
 func (r *mongoProgressRepository) Create(ctx context.Context, progress *domain.Progress) error {
 	progress.ID = primitive.NewObjectID()
 	_, err := r.collection.InsertOne(ctx, progress)
+	if mongo.IsDuplicateKeyError(err) {
+		return ports.ErrProgressExists
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create progress: %w", err)
 	}
@@ -41,7 +68,7 @@ func (r *mongoProgressRepository) GetByID(ctx context.Context, id string) (*doma
 	err = r.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&progress)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("progress not found")
+			return nil, ports.ErrProgressNotFound
 		}
 		return nil, fmt.Errorf("failed to get progress by ID: %w", err)
 	}
@@ -86,13 +113,44 @@ func (r *mongoProgressRepository) GetByUserAndEntity(ctx context.Context, userID
 	}).Decode(&progress)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("progress not found")
+			return nil, ports.ErrProgressNotFound
 		}
 		return nil, fmt.Errorf("failed to get progress by user and entity: %w", err)
 	}
 	return &progress, nil
 }
 
+func (r *mongoProgressRepository) GetByUserAndEntities(ctx context.Context, userID string, entityIDs []string) ([]domain.Progress, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	entityObjIDs := make([]primitive.ObjectID, 0, len(entityIDs))
+	for _, id := range entityIDs {
+		entityObjID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entity ID: %w", err)
+		}
+		entityObjIDs = append(entityObjIDs, entityObjID)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{
+		"user_id":   objID,
+		"entity_id": bson.M{"$in": entityObjIDs},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get progress by user and entities: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var progresses []domain.Progress
+	if err = cursor.All(ctx, &progresses); err != nil {
+		return nil, fmt.Errorf("failed to decode progresses: %w", err)
+	}
+	return progresses, nil
+}
+
 func (r *mongoProgressRepository) Update(ctx context.Context, progress *domain.Progress) error {
 	_, err := r.collection.UpdateOne(
 		ctx,
@@ -117,3 +175,178 @@ func (r *mongoProgressRepository) Delete(ctx context.Context, id string) error {
 	}
 	return nil
 }
+
+func (r *mongoProgressRepository) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": objID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete progress by user ID: %w", err)
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *mongoProgressRepository) LessonStats(ctx context.Context, userID string) ([]domain.LessonProgressStats, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	// Lessons and exercises live inside courses, so the pipeline starts from the courses
+	// and joins each lesson with the user's progress on it and on its exercises
+	pipeline := mongo.Pipeline{
+		{{Key: "$unwind", Value: bson.M{"path": "$lessons", "includeArrayIndex": "lesson_index"}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": r.collection.Name(),
+			"let": bson.M{
+				"lesson_id":    "$lessons._id",
+				"exercise_ids": bson.M{"$ifNull": bson.A{"$lessons.exercises._id", bson.A{}}},
+			},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"user_id": objID, "entity_type": bson.M{"$in": bson.A{domain.LessonEntity, domain.ExerciseEntity}}}},
+				bson.M{"$match": bson.M{"$expr": bson.M{"$or": bson.A{
+					bson.M{"$and": bson.A{bson.M{"$eq": bson.A{"$entity_type", domain.LessonEntity}}, bson.M{"$eq": bson.A{"$entity_id", "$$lesson_id"}}}},
+					bson.M{"$and": bson.A{bson.M{"$eq": bson.A{"$entity_type", domain.ExerciseEntity}}, bson.M{"$in": bson.A{"$entity_id", "$$exercise_ids"}}}},
+				}}}},
+			},
+			"as": "progress",
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"exercise_progress": bson.M{"$filter": bson.M{
+				"input": "$progress",
+				"as":    "p",
+				"cond":  bson.M{"$eq": bson.A{"$$p.entity_type", domain.ExerciseEntity}},
+			}},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":          0,
+			"course_id":    "$_id",
+			"course_name":  "$name",
+			"course_level": "$level",
+			"lesson_id":    "$lessons._id",
+			"lesson_title": "$lessons.title",
+			"lesson_index": 1,
+			"started":      bson.M{"$gt": bson.A{bson.M{"$size": "$progress"}, 0}},
+			"lesson_completed": bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+				"input": "$progress",
+				"as":    "p",
+				"in":    bson.M{"$and": bson.A{bson.M{"$eq": bson.A{"$$p.entity_type", domain.LessonEntity}}, "$$p.completed"}},
+			}}}},
+			"exercises_total": bson.M{"$size": bson.M{"$ifNull": bson.A{"$lessons.exercises", bson.A{}}}},
+			"exercises_completed": bson.M{"$size": bson.M{"$filter": bson.M{
+				"input": "$exercise_progress",
+				"as":    "p",
+				"cond":  "$$p.completed",
+			}}},
+			"exercises_attempted": bson.M{"$size": "$exercise_progress"},
+			"score_sum":           bson.M{"$sum": "$exercise_progress.score"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "course_id", Value: 1}, {Key: "lesson_index", Value: 1}}}},
+	}
+
+	var stats []domain.LessonProgressStats
+	if err := aggregateAll(ctx, r.courses, pipeline, &stats); err != nil {
+		return nil, fmt.Errorf("failed to aggregate lesson progress: %w", err)
+	}
+	return stats, nil
+}
+
+func (r *mongoProgressRepository) MasteryByLevel(ctx context.Context, userID string) ([]domain.LevelMastery, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	// Completed kana and kanji by level. The joins drop progress on content that has since
+	// been deleted and give kanji their level; kana belong to N5.
+	masteredPipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"user_id":     objID,
+			"completed":   true,
+			"entity_type": bson.M{"$in": bson.A{domain.SyllableEntity, domain.KanjiEntity}},
+		}}},
+		{{Key: "$lookup", Value: bson.M{"from": r.kanji.Name(), "localField": "entity_id", "foreignField": "_id", "as": "kanji"}}},
+		{{Key: "$lookup", Value: bson.M{"from": r.syllables.Name(), "localField": "entity_id", "foreignField": "_id", "as": "syllable"}}},
+		{{Key: "$project", Value: bson.M{
+			"entity_type": 1,
+			"level": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$entity_type", domain.KanjiEntity}},
+				bson.M{"$arrayElemAt": bson.A{"$kanji.level", 0}},
+				domain.N5,
+			}},
+			"exists": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$entity_type", domain.KanjiEntity}},
+				bson.M{"$gt": bson.A{bson.M{"$size": "$kanji"}, 0}},
+				bson.M{"$gt": bson.A{bson.M{"$size": "$syllable"}, 0}},
+			}},
+		}}},
+		{{Key: "$match", Value: bson.M{"exists": true}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"level": "$level", "entity_type": "$entity_type"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+
+	var mastered []struct {
+		ID struct {
+			Level      domain.JLPTLevel  `bson:"level"`
+			EntityType domain.EntityType `bson:"entity_type"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := aggregateAll(ctx, r.collection, masteredPipeline, &mastered); err != nil {
+		return nil, fmt.Errorf("failed to aggregate mastery: %w", err)
+	}
+
+	var kanjiTotals []struct {
+		Level domain.JLPTLevel `bson:"_id"`
+		Count int              `bson:"count"`
+	}
+	totalsPipeline := mongo.Pipeline{{{Key: "$group", Value: bson.M{"_id": "$level", "count": bson.M{"$sum": 1}}}}}
+	if err := aggregateAll(ctx, r.kanji, totalsPipeline, &kanjiTotals); err != nil {
+		return nil, fmt.Errorf("failed to count kanji by level: %w", err)
+	}
+
+	kanaTotal, err := r.syllables.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count syllables: %w", err)
+	}
+
+	byLevel := make(map[domain.JLPTLevel]*domain.LevelMastery, len(domain.JLPTLevels))
+	levels := make([]domain.LevelMastery, len(domain.JLPTLevels))
+	for i, level := range domain.JLPTLevels {
+		levels[i].Level = level
+		byLevel[level] = &levels[i]
+	}
+	byLevel[domain.N5].KanaTotal = int(kanaTotal)
+	for _, t := range kanjiTotals {
+		if m, ok := byLevel[t.Level]; ok {
+			m.KanjiTotal = t.Count
+		}
+	}
+	for _, g := range mastered {
+		m, ok := byLevel[g.ID.Level]
+		if !ok {
+			continue
+		}
+		if g.ID.EntityType == domain.KanjiEntity {
+			m.KanjiMastered = g.Count
+		} else {
+			m.KanaMastered = g.Count
+		}
+	}
+	return levels, nil
+}
+
+// aggregateAll runs a pipeline and decodes every result into out
+func aggregateAll(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline, out any) error {
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, out)
+}
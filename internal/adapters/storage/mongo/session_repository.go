@@ -0,0 +1,160 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoSessionRepository implements ports.SessionRepository
+type mongoSessionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSessionRepository creates a new MongoDB session repository
+func NewMongoSessionRepository(db *mongo.Database) ports.SessionRepository {
+	coll := db.Collection("sessions")
+
+	indexUser := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}},
+		Options: options.Index().SetName("user_last_seen_at"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexUser)
+
+	// Expired sessions are kept for a week so recent logins can still be reviewed
+	indexTTL := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60).SetName("ttl_expires_at"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexTTL)
+
+	return &mongoSessionRepository{
+		collection: coll,
+	}
+}
+
+func (r *mongoSessionRepository) Create(ctx context.Context, session *domain.Session) error {
+	session.ID = primitive.NewObjectID()
+	if _, err := r.collection.InsertOne(ctx, session); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoSessionRepository) GetByID(ctx context.Context, id string) (*domain.Session, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ports.ErrSessionNotFound
+	}
+
+	var session domain.Session
+	err = r.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ports.ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return &session, nil
+}
+
+func (r *mongoSessionRepository) ListByUser(ctx context.Context, userID string) ([]*domain.Session, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": objID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []*domain.Session
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (r *mongoSessionRepository) Touch(ctx context.Context, id, ip string, now time.Time) error {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ports.ErrSessionNotFound
+	}
+
+	_, err = r.collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": bson.M{"last_seen_at": now, "ip": ip}})
+	if err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoSessionRepository) Revoke(ctx context.Context, userID, id string, now time.Time) error {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ports.ErrSessionNotFound
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ports.ErrSessionNotFound
+	}
+
+	filter := bson.M{
+		"_id":        objID,
+		"user_id":    userObjID,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": now}})
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ports.ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *mongoSessionRepository) RevokeAllByUser(ctx context.Context, userID, exceptID string, now time.Time) (int64, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	filter := bson.M{
+		"user_id":    userObjID,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	if exceptObjID, err := primitive.ObjectIDFromHex(exceptID); err == nil {
+		filter["_id"] = bson.M{"$ne": exceptObjID}
+	}
+	result, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": now}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoSessionRepository) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": objID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,85 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoStreakRepository stores one streak document per user, keyed by user ID
+type mongoStreakRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStreakRepository creates a new MongoDB streak repository
+func NewMongoStreakRepository(db *mongo.Database) ports.StreakRepository {
+	return &mongoStreakRepository{
+		collection: db.Collection("streaks"),
+	}
+}
+
+func (r *mongoStreakRepository) Get(ctx context.Context, userID string) (*domain.Streak, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	var streak domain.Streak
+	err = r.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&streak)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get streak: %w", err)
+	}
+	return &streak, nil
+}
+
+func (r *mongoStreakRepository) Save(ctx context.Context, streak *domain.Streak) error {
+	expected := streak.Version
+	streak.Version++
+
+	if expected == 0 {
+		_, err := r.collection.InsertOne(ctx, streak)
+		if mongo.IsDuplicateKeyError(err) {
+			streak.Version = expected
+			return ports.ErrStreakConflict
+		}
+		if err != nil {
+			streak.Version = expected
+			return fmt.Errorf("failed to create streak: %w", err)
+		}
+		return nil
+	}
+
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": streak.UserID, "version": expected}, streak)
+	if err != nil {
+		streak.Version = expected
+		return fmt.Errorf("failed to save streak: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		streak.Version = expected
+		return ports.ErrStreakConflict
+	}
+	return nil
+}
+
+func (r *mongoStreakRepository) Delete(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete streak: %w", err)
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,173 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoStudySessionRepository implements ports.StudySessionRepository
+type mongoStudySessionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStudySessionRepository creates a new MongoDB study session repository
+func NewMongoStudySessionRepository(db *mongo.Database) ports.StudySessionRepository {
+	coll := db.Collection("study_sessions")
+
+	indexClientID := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "client_id", Value: 1}},
+		Options: options.Index().SetName("user_client_id").SetUnique(true),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexClientID)
+
+	indexStarted := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "started_at", Value: 1}},
+		Options: options.Index().SetName("user_started_at"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexStarted)
+
+	return &mongoStudySessionRepository{
+		collection: coll,
+	}
+}
+
+func (r *mongoStudySessionRepository) Save(ctx context.Context, sessions []domain.StudySession) (int64, error) {
+	if len(sessions) == 0 {
+		return 0, nil
+	}
+	docs := make([]any, len(sessions))
+	for i := range sessions {
+		sessions[i].ID = primitive.NewObjectID()
+		docs[i] = sessions[i]
+	}
+
+	// Unordered so every new session is inserted past those already saved
+	_, err := r.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return int64(len(docs)), nil
+	}
+	if !onlyDuplicateKeyErrors(err) {
+		return 0, fmt.Errorf("failed to save study sessions: %w", err)
+	}
+	var bulk mongo.BulkWriteException
+	errors.As(err, &bulk)
+	return int64(len(docs) - len(bulk.WriteErrors)), nil
+}
+
+// dayRange returns the start of the first day and the end of the last day in loc
+func dayRange(loc *time.Location, from, to string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(domain.DayLayout, from, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid day: %w", err)
+	}
+	last, err := time.ParseInLocation(domain.DayLayout, to, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid day: %w", err)
+	}
+	return start, last.AddDate(0, 0, 1), nil
+}
+
+// dayOf formats a date field as the calendar day it falls on in loc
+func dayOf(field string, loc *time.Location) bson.M {
+	return bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": field, "timezone": loc.String()}}
+}
+
+func (r *mongoStudySessionRepository) DailyStats(ctx context.Context, userID string, loc *time.Location, from, to string) ([]domain.SessionDay, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	start, end, err := dayRange(loc, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions count on the day they started, even if they ran past midnight
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": objID, "started_at": bson.M{"$gte": start, "$lt": end}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           dayOf("$started_at", loc),
+			"sessions":      bson.M{"$sum": 1},
+			"seconds":       bson.M{"$sum": bson.M{"$dateDiff": bson.M{"startDate": "$started_at", "endDate": "$ended_at", "unit": "second"}}},
+			"items_seen":    bson.M{"$sum": "$items_seen"},
+			"items_correct": bson.M{"$sum": "$items_correct"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+
+	days := []domain.SessionDay{}
+	if err := aggregateAll(ctx, r.collection, pipeline, &days); err != nil {
+		return nil, fmt.Errorf("failed to aggregate study sessions: %w", err)
+	}
+	return days, nil
+}
+
+func (r *mongoStudySessionRepository) ListByUser(ctx context.Context, userID string) ([]domain.StudySession, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": objID}, options.Find().SetSort(bson.D{{Key: "started_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list study sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []domain.StudySession{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode study sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (r *mongoStudySessionRepository) Reassign(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	from, err := primitive.ObjectIDFromHex(fromUserID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+	to, err := primitive.ObjectIDFromHex(toUserID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	// A session uploaded to both users would break the unique client ID index
+	existing, err := r.collection.Distinct(ctx, "client_id", bson.M{"user_id": to})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list study sessions: %w", err)
+	}
+	if len(existing) > 0 {
+		if _, err := r.collection.DeleteMany(ctx, bson.M{"user_id": from, "client_id": bson.M{"$in": existing}}); err != nil {
+			return 0, fmt.Errorf("failed to drop duplicate study sessions: %w", err)
+		}
+	}
+
+	result, err := r.collection.UpdateMany(ctx, bson.M{"user_id": from}, bson.M{"$set": bson.M{"user_id": to}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to reassign study sessions: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoStudySessionRepository) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": objID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete study sessions: %w", err)
+	}
+	return result.DeletedCount, nil
+}
@@ -34,6 +34,26 @@ func NewMongoSubscriptionRepository(db *mongo.Database) ports.SubscriptionReposi
 	}
 	_, _ = coll.Indexes().CreateOne(context.Background(), indexExternal)
 
+	// Create index for internal_user_id to resolve a user's subscriptions
+	indexInternal := mongo.IndexModel{
+		Keys:    bson.D{{Key: "internal_user_id", Value: 1}},
+		Options: options.Index().SetName("idx_internal_user_id"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexInternal)
+
+	// Create index for the expiry sweeper
+	indexExpiry := mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("idx_status_expires_at"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexExpiry)
+
+	indexReconciled := mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "reconciled_at", Value: 1}},
+		Options: options.Index().SetName("idx_status_reconciled_at"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexReconciled)
+
 	return &mongoSubscriptionRepository{
 		collection: coll,
 	}
@@ -81,6 +101,24 @@ func (r *mongoSubscriptionRepository) UpdateByEventID(ctx context.Context, event
 	return nil
 }
 
+// Update replaces the stored subscription, so fields cleared on sub (omitted when empty)
+// are removed too
+func (r *mongoSubscriptionRepository) Update(ctx context.Context, sub *domain.Subscription) error {
+	sub.UpdatedAt = time.Now()
+
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": sub.ID}, sub)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ports.ErrDuplicateEvent
+		}
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("subscription not found")
+	}
+	return nil
+}
+
 func (r *mongoSubscriptionRepository) GetByExternalUserID(ctx context.Context, externalUserID string) ([]*domain.Subscription, error) {
 	cursor, err := r.collection.Find(ctx, bson.M{"external_user_id": externalUserID})
 	if err != nil {
@@ -95,6 +133,26 @@ func (r *mongoSubscriptionRepository) GetByExternalUserID(ctx context.Context, e
 	return subs, nil
 }
 
+func (r *mongoSubscriptionRepository) GetByInternalUserID(ctx context.Context, internalUserID string) ([]*domain.Subscription, error) {
+	objID, err := primitive.ObjectIDFromHex(internalUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"internal_user_id": objID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var subs []*domain.Subscription
+	if err = cursor.All(ctx, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
 func (r *mongoSubscriptionRepository) UpdateInternalUserID(ctx context.Context, externalUserID string, internalUserID string) error {
 	objID, err := primitive.ObjectIDFromHex(internalUserID)
 	if err != nil {
@@ -118,3 +176,98 @@ func (r *mongoSubscriptionRepository) UpdateInternalUserID(ctx context.Context,
 	}
 	return nil
 }
+
+func (r *mongoSubscriptionRepository) FindOverdue(ctx context.Context, cutoff time.Time, limit int) ([]*domain.Subscription, error) {
+	filter := bson.M{"$or": bson.A{
+		// A zero expires_at marks purchases that never expire
+		bson.M{
+			"status":     bson.M{"$in": bson.A{domain.SubscriptionActive, domain.SubscriptionCancelled}},
+			"expires_at": bson.M{"$gt": time.Time{}, "$lt": cutoff},
+		},
+		bson.M{
+			"status":                  domain.SubscriptionGracePeriod,
+			"grace_period_expires_at": bson.M{"$lt": cutoff},
+		},
+	}}
+
+	opts := options.Find().SetLimit(int64(limit)).SetSort(bson.D{{Key: "expires_at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var subs []*domain.Subscription
+	if err = cursor.All(ctx, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (r *mongoSubscriptionRepository) FindUnreconciled(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	// A missing reconciled_at sorts before any date, so new subscribers come first
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"status": bson.M{"$in": bson.A{domain.SubscriptionActive, domain.SubscriptionGracePeriod}},
+			"$or": bson.A{
+				bson.M{"reconciled_at": bson.M{"$exists": false}},
+				bson.M{"reconciled_at": bson.M{"$lt": before}},
+			},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$external_user_id", "reconciled_at": bson.M{"$min": "$reconciled_at"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "reconciled_at", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	var subscribers []struct {
+		ID string `bson:"_id"`
+	}
+	if err := aggregateAll(ctx, r.collection, pipeline, &subscribers); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(subscribers))
+	for i, s := range subscribers {
+		ids[i] = s.ID
+	}
+	return ids, nil
+}
+
+func (r *mongoSubscriptionRepository) MarkReconciled(ctx context.Context, externalUserID string, at time.Time) error {
+	_, err := r.collection.UpdateMany(ctx, bson.M{"external_user_id": externalUserID}, bson.M{"$set": bson.M{"reconciled_at": at}})
+	return err
+}
+
+func (r *mongoSubscriptionRepository) DetachInternalUserID(ctx context.Context, internalUserID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(internalUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	update := bson.M{
+		"$unset": bson.M{"internal_user_id": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	}
+	result, err := r.collection.UpdateMany(ctx, bson.M{"internal_user_id": objID}, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoSubscriptionRepository) ReassignInternalUserID(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	fromID, err := primitive.ObjectIDFromHex(fromUserID)
+	if err != nil {
+		return 0, err
+	}
+	toID, err := primitive.ObjectIDFromHex(toUserID)
+	if err != nil {
+		return 0, err
+	}
+
+	update := bson.M{"$set": bson.M{"internal_user_id": toID, "updated_at": time.Now()}}
+	result, err := r.collection.UpdateMany(ctx, bson.M{"internal_user_id": fromID}, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
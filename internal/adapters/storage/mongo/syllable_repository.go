@@ -43,7 +43,7 @@ func (r *mongoSyllableRepository) GetByID(ctx context.Context, id string) (*doma
 	err = r.collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&syllable)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("syllable not found")
+			return nil, ports.ErrSyllableNotFound
 		}
 		return nil, fmt.Errorf("failed to get syllable by ID: %w", err)
 	}
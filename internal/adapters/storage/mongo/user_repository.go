@@ -10,6 +10,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // mongoUserRepository implements ports.UserRepository
@@ -19,8 +20,26 @@ type mongoUserRepository struct {
 
 // NewMongoUserRepository creates a new MongoDB user repository
 func NewMongoUserRepository(db *mongo.Database) ports.UserRepository {
+	collection := db.Collection("users")
+
+	// One provider account can only be linked to a single user
+	indexIdentity := mongo.IndexModel{
+		Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}).
+			SetName("uniq_identity"),
+	}
+	_, _ = collection.Indexes().CreateOne(context.Background(), indexIdentity)
+
+	indexDeletion := mongo.IndexModel{
+		Keys:    bson.D{{Key: "deletion_scheduled_at", Value: 1}},
+		Options: options.Index().SetSparse(true).SetName("deletion_scheduled_at"),
+	}
+	_, _ = collection.Indexes().CreateOne(context.Background(), indexDeletion)
+
 	return &mongoUserRepository{
-		collection: db.Collection("users"),
+		collection: collection,
 	}
 }
 
@@ -63,6 +82,20 @@ func (r *mongoUserRepository) GetByRevenueCatID(ctx context.Context, revenueCatI
 	return &user, nil
 }
 
+// GetByIdentity retrieves the user an external provider account is linked to
+func (r *mongoUserRepository) GetByIdentity(ctx context.Context, provider, subject string) (*domain.User, error) {
+	var user domain.User
+	filter := bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}}
+	err := r.collection.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (r *mongoUserRepository) Create(ctx context.Context, user *domain.User) error {
 	user.ID = primitive.NewObjectID()
 	_, err := r.collection.InsertOne(ctx, user)
@@ -86,6 +119,25 @@ func (r *mongoUserRepository) GetByID(ctx context.Context, id string) (*domain.U
 	return &user, nil
 }
 
+func (r *mongoUserRepository) GetByIDs(ctx context.Context, ids []string) ([]*domain.User, error) {
+	objIDs, err := objectIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"_id": bson.M{"$in": objIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []*domain.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (r *mongoUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var user domain.User
 	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
@@ -98,15 +150,28 @@ func (r *mongoUserRepository) GetByEmail(ctx context.Context, email string) (*do
 	return &user, nil
 }
 
+// Update replaces the stored user, so fields cleared on user (omitted when empty) are removed too
 func (r *mongoUserRepository) Update(ctx context.Context, user *domain.User) error {
-	_, err := r.collection.UpdateOne(
-		ctx,
-		bson.M{"_id": user.ID},
-		bson.M{"$set": user},
-	)
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": user.ID}, user)
 	return err
 }
 
+// FindDeletionDue returns users whose scheduled deletion is before cutoff, oldest first
+func (r *mongoUserRepository) FindDeletionDue(ctx context.Context, cutoff time.Time, limit int) ([]*domain.User, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "deletion_scheduled_at", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, bson.M{"deletion_scheduled_at": bson.M{"$lt": cutoff}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*domain.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (r *mongoUserRepository) Delete(ctx context.Context, id string) error {
 	objID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -0,0 +1,103 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoUserTokenRepository implements ports.UserTokenRepository
+type mongoUserTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserTokenRepository creates a new MongoDB user token repository
+func NewMongoUserTokenRepository(db *mongo.Database) ports.UserTokenRepository {
+	coll := db.Collection("user_tokens")
+
+	indexHash := mongo.IndexModel{
+		Keys:    bson.D{{Key: "token_hash", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("unique_token_hash"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexHash)
+
+	// Let MongoDB purge tokens a day after they expire
+	indexTTL := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(24 * 60 * 60).SetName("ttl_expires_at"),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexTTL)
+
+	return &mongoUserTokenRepository{
+		collection: coll,
+	}
+}
+
+func (r *mongoUserTokenRepository) Create(ctx context.Context, token *domain.UserToken) error {
+	token.ID = primitive.NewObjectID()
+	_, err := r.collection.InsertOne(ctx, token)
+	if err != nil {
+		return fmt.Errorf("failed to create user token: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoUserTokenRepository) Consume(ctx context.Context, purpose domain.TokenPurpose, tokenHash string, now time.Time) (*domain.UserToken, error) {
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"purpose":    purpose,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"used_at": now}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var token domain.UserToken
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ports.ErrTokenInvalid
+		}
+		return nil, fmt.Errorf("failed to consume user token: %w", err)
+	}
+	return &token, nil
+}
+
+func (r *mongoUserTokenRepository) DeleteByUser(ctx context.Context, userID string, purpose domain.TokenPurpose) error {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	_, err = r.collection.DeleteMany(ctx, bson.M{"user_id": objID, "purpose": purpose})
+	if err != nil {
+		return fmt.Errorf("failed to delete user tokens: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoUserTokenRepository) IssuedSince(ctx context.Context, userID string, purpose domain.TokenPurpose, since time.Time) (bool, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	count, err := r.collection.CountDocuments(ctx, bson.M{
+		"user_id":    objID,
+		"purpose":    purpose,
+		"used_at":    bson.M{"$exists": false},
+		"created_at": bson.M{"$gte": since},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to look up user tokens: %w", err)
+	}
+	return count > 0, nil
+}
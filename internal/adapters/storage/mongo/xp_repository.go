@@ -0,0 +1,189 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoXPRepository keeps the XP ledger in xp_events and per-day totals in xp_days
+type mongoXPRepository struct {
+	events *mongo.Collection
+	days   *mongo.Collection
+}
+
+// NewMongoXPRepository creates a new MongoDB XP repository
+func NewMongoXPRepository(db *mongo.Database) ports.XPRepository {
+	events := db.Collection("xp_events")
+	days := db.Collection("xp_days")
+
+	// One award per entity and day; also serves the per-entity lookups
+	indexUserEntityDay := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "entity_id", Value: 1}, {Key: "day", Value: 1}},
+		Options: options.Index().SetName("user_entity_day").SetUnique(true),
+	}
+	_, _ = events.Indexes().CreateOne(context.Background(), indexUserEntityDay)
+
+	indexUserDay := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "day", Value: 1}},
+		Options: options.Index().SetName("user_day").SetUnique(true),
+	}
+	_, _ = days.Indexes().CreateOne(context.Background(), indexUserDay)
+
+	return &mongoXPRepository{events: events, days: days}
+}
+
+func (r *mongoXPRepository) Record(ctx context.Context, event *domain.XPEvent) error {
+	event.ID = primitive.NewObjectID()
+	_, err := r.events.InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return ports.ErrXPAlreadyAwarded
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record xp: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoXPRepository) HasEvents(ctx context.Context, userID, entityID string) (bool, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID: %w", err)
+	}
+	entityObjID, err := primitive.ObjectIDFromHex(entityID)
+	if err != nil {
+		return false, fmt.Errorf("invalid entity ID: %w", err)
+	}
+
+	count, err := r.events.CountDocuments(ctx, bson.M{"user_id": userObjID, "entity_id": entityObjID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to look up xp events: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (r *mongoXPRepository) Events(ctx context.Context, userID string) ([]domain.XPEvent, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	cursor, err := r.events.Find(ctx, bson.M{"user_id": objID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get xp events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []domain.XPEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("failed to decode xp events: %w", err)
+	}
+	return events, nil
+}
+
+func (r *mongoXPRepository) Total(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	// Summing the days reads one document per active day rather than one per award
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": objID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$xp"}}}},
+	}
+	var totals []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := aggregateAll(ctx, r.days, pipeline, &totals); err != nil {
+		return 0, fmt.Errorf("failed to sum xp: %w", err)
+	}
+	if len(totals) == 0 {
+		return 0, nil
+	}
+	return totals[0].Total, nil
+}
+
+func (r *mongoXPRepository) AddToDay(ctx context.Context, userID, day string, xp, goal int) (*domain.XPDay, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	var updated domain.XPDay
+	err = r.days.FindOneAndUpdate(
+		ctx,
+		bson.M{"user_id": objID, "day": day},
+		bson.M{"$inc": bson.M{"xp": xp}, "$set": bson.M{"goal": goal}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add xp to day: %w", err)
+	}
+	return &updated, nil
+}
+
+func (r *mongoXPRepository) MarkGoalMet(ctx context.Context, userID, day string) (bool, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	result, err := r.days.UpdateOne(
+		ctx,
+		bson.M{"user_id": objID, "day": day, "goal_met_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"goal_met_at": time.Now()}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark daily goal met: %w", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *mongoXPRepository) Days(ctx context.Context, userID, from, to string) ([]domain.XPDay, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	cursor, err := r.days.Find(
+		ctx,
+		bson.M{"user_id": objID, "day": bson.M{"$gte": from, "$lte": to}},
+		options.Find().SetSort(bson.D{{Key: "day", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get xp days: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	days := []domain.XPDay{}
+	if err := cursor.All(ctx, &days); err != nil {
+		return nil, fmt.Errorf("failed to decode xp days: %w", err)
+	}
+	return days, nil
+}
+
+func (r *mongoXPRepository) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	events, err := r.events.DeleteMany(ctx, bson.M{"user_id": objID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete xp events: %w", err)
+	}
+	days, err := r.days.DeleteMany(ctx, bson.M{"user_id": objID})
+	if err != nil {
+		return events.DeletedCount, fmt.Errorf("failed to delete xp days: %w", err)
+	}
+	return events.DeletedCount + days.DeletedCount, nil
+}
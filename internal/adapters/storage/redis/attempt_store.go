@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"nihongo-api/internal/ports"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisAttemptStore implements ports.AttemptStore with INCR and expiring keys
+type redisAttemptStore struct {
+	client *redis.Client
+}
+
+// NewRedisAttemptStore creates a new Redis-backed attempt store
+func NewRedisAttemptStore(client *redis.Client) ports.AttemptStore {
+	return &redisAttemptStore{
+		client: client,
+	}
+}
+
+// incrementScript starts the expiry window on the first increment only
+var incrementScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+func (s *redisAttemptStore) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	n, err := incrementScript.Run(ctx, s.client, []string{"attempts:" + key}, window.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count attempt %s: %w", key, err)
+	}
+	return n, nil
+}
+
+func (s *redisAttemptStore) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	if err := s.client.Set(ctx, "attempts:lock:"+key, 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *redisAttemptStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, "attempts:lock:"+key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read lock %s: %w", key, err)
+	}
+	// Negative values mean the key does not exist or has no expiry
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s *redisAttemptStore) Reset(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	redisKeys := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		redisKeys = append(redisKeys, "attempts:"+key, "attempts:lock:"+key)
+	}
+	return s.client.Del(ctx, redisKeys...).Err()
+}
@@ -0,0 +1,139 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const leaderboardNamesKey = "leaderboard:names"
+
+// redisLeaderboardStore keeps each board in a sorted set. Next to it, a hash per user
+// holds the points each entity gave them, so raising an entity's points only adds the
+// difference. Both keys share a hash tag to stay in one cluster slot.
+type redisLeaderboardStore struct {
+	client *redis.Client
+}
+
+// NewRedisLeaderboardStore creates a new Redis-backed leaderboard store
+func NewRedisLeaderboardStore(client *redis.Client) ports.LeaderboardStore {
+	return &redisLeaderboardStore{
+		client: client,
+	}
+}
+
+func boardKey(board string) string {
+	return "leaderboard:{" + board + "}"
+}
+
+func pointsKey(board, userID string) string {
+	return boardKey(board) + ":points:" + userID
+}
+
+// submitScript raises an entity's points for a user and adds the difference to the score
+var submitScript = redis.NewScript(`
+local old = tonumber(redis.call("HGET", KEYS[2], ARGV[2]) or "0")
+local new = tonumber(ARGV[3])
+if new > old then
+	redis.call("HSET", KEYS[2], ARGV[2], new)
+	redis.call("ZINCRBY", KEYS[1], new - old, ARGV[1])
+end
+if tonumber(ARGV[4]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[4])
+	redis.call("PEXPIRE", KEYS[2], ARGV[4])
+end
+return new - old
+`)
+
+func (s *redisLeaderboardStore) Submit(ctx context.Context, board, userID, entityID string, points int64, ttl time.Duration) error {
+	keys := []string{boardKey(board), pointsKey(board, userID)}
+	if err := submitScript.Run(ctx, s.client, keys, userID, entityID, points, ttl.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to submit to leaderboard %s: %w", board, err)
+	}
+	return nil
+}
+
+func (s *redisLeaderboardStore) SetName(ctx context.Context, userID, name string) error {
+	if err := s.client.HSet(ctx, leaderboardNamesKey, userID, name).Err(); err != nil {
+		return fmt.Errorf("failed to set leaderboard name: %w", err)
+	}
+	return nil
+}
+
+func (s *redisLeaderboardStore) Top(ctx context.Context, board string, n int) ([]domain.LeaderboardEntry, error) {
+	return s.rangeByRank(ctx, board, 0, int64(n-1))
+}
+
+func (s *redisLeaderboardStore) Around(ctx context.Context, board, userID string, radius int) ([]domain.LeaderboardEntry, error) {
+	rank, err := s.client.ZRevRank(ctx, boardKey(board), userID).Result()
+	if errors.Is(err, redis.Nil) {
+		return []domain.LeaderboardEntry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank on leaderboard %s: %w", board, err)
+	}
+	return s.rangeByRank(ctx, board, max(0, rank-int64(radius)), rank+int64(radius))
+}
+
+// rangeByRank returns the entries from start to stop, 0-based and inclusive, with names
+func (s *redisLeaderboardStore) rangeByRank(ctx context.Context, board string, start, stop int64) ([]domain.LeaderboardEntry, error) {
+	members, err := s.client.ZRevRangeWithScores(ctx, boardKey(board), start, stop).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read leaderboard %s: %w", board, err)
+	}
+	entries := make([]domain.LeaderboardEntry, len(members))
+	if len(members) == 0 {
+		return entries, nil
+	}
+
+	userIDs := make([]string, len(members))
+	for i, m := range members {
+		userIDs[i], _ = m.Member.(string)
+	}
+	names, err := s.client.HMGet(ctx, leaderboardNamesKey, userIDs...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read leaderboard names: %w", err)
+	}
+
+	for i, m := range members {
+		name, _ := names[i].(string)
+		entries[i] = domain.LeaderboardEntry{
+			Rank:   start + int64(i) + 1,
+			UserID: userIDs[i],
+			Name:   name,
+			Score:  int64(m.Score),
+		}
+	}
+	return entries, nil
+}
+
+func (s *redisLeaderboardStore) Remove(ctx context.Context, boards []string, userID string) (int64, error) {
+	pipe := s.client.TxPipeline()
+	removed := make([]*redis.IntCmd, len(boards))
+	for i, board := range boards {
+		removed[i] = pipe.ZRem(ctx, boardKey(board), userID)
+		pipe.Del(ctx, pointsKey(board, userID))
+	}
+	pipe.HDel(ctx, leaderboardNamesKey, userID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to remove user from leaderboards: %w", err)
+	}
+
+	var count int64
+	for _, cmd := range removed {
+		count += cmd.Val()
+	}
+	return count, nil
+}
+
+func (s *redisLeaderboardStore) Delete(ctx context.Context, board string) error {
+	if err := s.client.Del(ctx, boardKey(board)).Err(); err != nil {
+		return fmt.Errorf("failed to delete leaderboard %s: %w", board, err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"nihongo-api/internal/ports"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisLocker implements ports.Locker with SET NX PX
+type redisLocker struct {
+	client *redis.Client
+	owner  string
+}
+
+// NewRedisLocker creates a new Redis-backed locker. owner identifies this replica in the lock value.
+func NewRedisLocker(client *redis.Client, owner string) ports.Locker {
+	return &redisLocker{
+		client: client,
+		owner:  owner,
+	}
+}
+
+func (l *redisLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	ok, err := l.client.SetNX(ctx, "lock:"+key, l.owner, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+	return ok, nil
+}
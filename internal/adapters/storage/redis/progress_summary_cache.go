@@ -0,0 +1,87 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// summaryVersionTTL keeps version counters well beyond any summary stored under them, so
+// an expired counter can only restart at a version with nothing cached
+const summaryVersionTTL = 30 * 24 * time.Hour
+
+// redisProgressSummaryCache implements ports.ProgressSummaryCache with one JSON value per
+// user and version, next to an INCR version counter
+type redisProgressSummaryCache struct {
+	client *redis.Client
+}
+
+// NewRedisProgressSummaryCache creates a new Redis-backed progress summary cache
+func NewRedisProgressSummaryCache(client *redis.Client) ports.ProgressSummaryCache {
+	return &redisProgressSummaryCache{
+		client: client,
+	}
+}
+
+func (c *redisProgressSummaryCache) Version(ctx context.Context, userID string) (int64, error) {
+	version, err := c.client.Get(ctx, versionKey(userID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read progress version for %s: %w", userID, err)
+	}
+	return version, nil
+}
+
+func (c *redisProgressSummaryCache) Get(ctx context.Context, userID string, version int64) (*domain.ProgressSummary, error) {
+	data, err := c.client.Get(ctx, summaryKey(userID, version)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read progress summary for %s: %w", userID, err)
+	}
+
+	var summary domain.ProgressSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("failed to decode progress summary for %s: %w", userID, err)
+	}
+	return &summary, nil
+}
+
+func (c *redisProgressSummaryCache) Set(ctx context.Context, userID string, version int64, summary *domain.ProgressSummary, ttl time.Duration) error {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to encode progress summary: %w", err)
+	}
+	if err := c.client.Set(ctx, summaryKey(userID, version), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store progress summary for %s: %w", userID, err)
+	}
+	return nil
+}
+
+func (c *redisProgressSummaryCache) Invalidate(ctx context.Context, userID string) error {
+	pipe := c.client.TxPipeline()
+	pipe.Incr(ctx, versionKey(userID))
+	pipe.Expire(ctx, versionKey(userID), summaryVersionTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to invalidate progress summary for %s: %w", userID, err)
+	}
+	return nil
+}
+
+func versionKey(userID string) string {
+	return "progress:summary:version:" + userID
+}
+
+func summaryKey(userID string, version int64) string {
+	return "progress:summary:" + userID + ":" + strconv.FormatInt(version, 10)
+}
@@ -0,0 +1,105 @@
+// Package scheduler runs periodic background jobs on exactly one replica at a time.
+package scheduler
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	jobRuns     = expvar.NewMap("scheduler_job_runs")
+	jobFailures = expvar.NewMap("scheduler_job_failures")
+)
+
+// Job is a unit of periodic work
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs registered jobs on their interval. Before each run the replica takes a
+// lock named after the job for one interval, so only the lock holder (the leader for that
+// tick) does the work and the others skip it.
+type Scheduler struct {
+	locker ports.Locker
+	logger zerolog.Logger
+	jobs   []Job
+	wg     sync.WaitGroup
+}
+
+// New creates a new scheduler
+func New(locker ports.Locker, logger zerolog.Logger) *Scheduler {
+	return &Scheduler{
+		locker: locker,
+		logger: logger,
+	}
+}
+
+// Register adds a job; it must be called before Start
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start launches every registered job. Jobs stop when ctx is cancelled; use Wait to block until they have.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job Job) {
+			defer s.wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+}
+
+// Wait blocks until all jobs have returned
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	s.logger.Info().Str("job", job.Name).Dur("interval", job.Interval).Msg("Scheduled job started")
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info().Str("job", job.Name).Msg("Scheduled job stopped")
+			return
+		case <-ticker.C:
+			s.runOnce(ctx, job)
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	// Keep the lock for (almost) the whole interval so other replicas skip this tick
+	acquired, err := s.locker.TryLock(ctx, "scheduler:"+job.Name, job.Interval*9/10)
+	if err != nil {
+		s.logger.Error().Err(err).Str("job", job.Name).Msg("Failed to acquire job lock")
+		return
+	}
+	if !acquired {
+		s.logger.Debug().Str("job", job.Name).Msg("Job running on another replica; skipping")
+		return
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, job.Interval)
+	defer cancel()
+
+	start := time.Now()
+	jobRuns.Add(job.Name, 1)
+	if err := job.Run(runCtx); err != nil {
+		jobFailures.Add(job.Name, 1)
+		s.logger.Error().Err(err).Str("job", job.Name).Dur("duration", time.Since(start)).Msg("Scheduled job failed")
+		return
+	}
+	s.logger.Debug().Str("job", job.Name).Dur("duration", time.Since(start)).Msg("Scheduled job finished")
+}
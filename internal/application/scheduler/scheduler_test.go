@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLocker grants each key once, like a lock held by another replica afterwards
+type fakeLocker struct {
+	mu    sync.Mutex
+	held  map[string]bool
+	err   error
+	calls int
+}
+
+func (l *fakeLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	if l.err != nil {
+		return false, l.err
+	}
+	if l.held[key] {
+		return false, nil
+	}
+	l.held[key] = true
+	return true, nil
+}
+
+func TestScheduler_RunOnceRequiresLock(t *testing.T) {
+	locker := &fakeLocker{held: map[string]bool{}}
+	s := New(locker, zerolog.Nop())
+
+	runs := 0
+	job := Job{Name: "sweep", Interval: time.Minute, Run: func(ctx context.Context) error {
+		runs++
+		return nil
+	}}
+
+	s.runOnce(context.Background(), job)
+	s.runOnce(context.Background(), job)
+	assert.Equal(t, 1, runs, "second tick must be skipped while the lock is held")
+
+	locker.err = errors.New("redis down")
+	s.runOnce(context.Background(), job)
+	assert.Equal(t, 1, runs, "jobs must not run when the lock cannot be checked")
+}
+
+func TestScheduler_StartAndStop(t *testing.T) {
+	locker := &fakeLocker{held: map[string]bool{}}
+	s := New(locker, zerolog.Nop())
+
+	ran := make(chan struct{}, 1)
+	s.Register(Job{Name: "tick", Interval: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("job did not run")
+	}
+	cancel()
+	s.Wait()
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// deletionBatchSize bounds how many accounts one purge run deletes per query
+	deletionBatchSize = 100
+)
+
+var (
+	ErrWrongPassword = errors.New("current password is incorrect")
+	ErrSameEmail     = errors.New("new email is the same as the current one")
+)
+
+// ProfileUpdate is a partial profile change; nil fields are left as they are
+type ProfileUpdate struct {
+	Name      *string `json:"name" validate:"omitempty,min=2,max=100"`
+	Locale    *string `json:"locale" validate:"omitempty,bcp47_language_tag"`
+	Timezone  *string `json:"timezone" validate:"omitempty,timezone"`
+	DailyGoal *int    `json:"daily_goal" validate:"omitempty,min=1,max=1000"`
+	// LeaderboardOptOut takes the user off leaderboards and keeps them off
+	LeaderboardOptOut *bool `json:"leaderboard_opt_out"`
+	// FollowApproval makes follows requests the user approves
+	FollowApproval     *bool   `json:"follow_approval"`
+	ActivityVisibility *string `json:"activity_visibility" validate:"omitempty,oneof=followers friends private"`
+}
+
+// PasswordChange replaces the password of a logged-in user
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=72"`
+}
+
+// Reauthentication proves the owner is present before a sensitive change. Accounts with a
+// password send it. Accounts that sign in through Apple or Google instead send a freshly
+// issued ID token from a linked provider, and guests send their device credential.
+type Reauthentication struct {
+	Password        string `json:"password"`
+	Provider        string `json:"provider"`
+	IDToken         string `json:"id_token"`
+	GuestCredential string `json:"guest_credential"`
+}
+
+// EmailChange asks to move the account to a new address
+type EmailChange struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
+	Reauthentication
+}
+
+// AccountDeletion asks to delete the account after the grace period
+type AccountDeletion struct {
+	Reauthentication
+}
+
+// EmailChangeRequester sends the confirmation for a pending email change
+type EmailChangeRequester interface {
+	RequestEmailChange(ctx context.Context, user *domain.User, newEmail string) error
+}
+
+// AccountEraser erases a user's data once their deletion grace period is over
+type AccountEraser interface {
+	Erase(ctx context.Context, user *domain.User) (*domain.ErasureReceipt, error)
+}
+
+// IdentityReauthenticator checks a fresh ID token from a provider linked to the user
+type IdentityReauthenticator interface {
+	Reauthenticate(ctx context.Context, user *domain.User, provider, idToken string) error
+}
+
+// GuestAuthenticator returns the guest a device credential belongs to
+type GuestAuthenticator interface {
+	Authenticate(ctx context.Context, credential string) (*domain.User, error)
+}
+
+// AccountService lets users manage their own account
+type AccountService struct {
+	userRepo      ports.UserRepository
+	emailChanges  EmailChangeRequester
+	eraser        AccountEraser
+	identities    IdentityReauthenticator
+	guests        GuestAuthenticator
+	sessions      SessionRevoker
+	validate      *validator.Validate
+	deletionGrace time.Duration
+	logger        zerolog.Logger
+}
+
+// NewAccountService creates a new account service. Deleted accounts can be restored by
+// logging in during deletionGrace.
+func NewAccountService(userRepo ports.UserRepository, emailChanges EmailChangeRequester, eraser AccountEraser, identities IdentityReauthenticator, guests GuestAuthenticator, sessions SessionRevoker, deletionGrace time.Duration, logger zerolog.Logger) *AccountService {
+	return &AccountService{
+		userRepo:      userRepo,
+		emailChanges:  emailChanges,
+		eraser:        eraser,
+		identities:    identities,
+		guests:        guests,
+		sessions:      sessions,
+		validate:      newValidator(),
+		deletionGrace: deletionGrace,
+		logger:        logger,
+	}
+}
+
+// UpdateProfile applies the non-nil fields of update
+func (s *AccountService) UpdateProfile(ctx context.Context, userID string, update ProfileUpdate) (*domain.User, error) {
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		update.Name = &name
+	}
+	if err := s.validate.Struct(update); err != nil {
+		return nil, validationError(err)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if update.Name != nil {
+		user.Name = *update.Name
+	}
+	if update.Locale != nil {
+		user.Locale = *update.Locale
+	}
+	if update.Timezone != nil {
+		user.Timezone = *update.Timezone
+	}
+	if update.DailyGoal != nil {
+		user.DailyGoal = *update.DailyGoal
+	}
+	if update.LeaderboardOptOut != nil {
+		user.LeaderboardOptOut = *update.LeaderboardOptOut
+	}
+	if update.FollowApproval != nil {
+		user.FollowApproval = *update.FollowApproval
+	}
+	if update.ActivityVisibility != nil {
+		user.ActivityVisibility = domain.ActivityVisibility(*update.ActivityVisibility)
+	}
+	user.UpdatedAt = time.Now()
+
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ChangePassword sets a new password after checking the current one, and logs the user
+// out everywhere except sessionID, the session making the change
+func (s *AccountService) ChangePassword(ctx context.Context, userID, sessionID string, change PasswordChange) error {
+	if err := s.validate.Struct(change); err != nil {
+		return validationError(err)
+	}
+
+	user, err := s.authorize(ctx, userID, Reauthentication{Password: change.CurrentPassword})
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(change.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hashedPassword)
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+	if err := s.sessions.RevokeAll(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Msg("Password changed")
+	return nil
+}
+
+// ChangeEmail starts moving the account to a new address. The change only happens once
+// the link sent to the new address is opened.
+func (s *AccountService) ChangeEmail(ctx context.Context, userID string, change EmailChange) (*domain.User, error) {
+	change.NewEmail = strings.TrimSpace(change.NewEmail)
+	if err := s.validate.Struct(change); err != nil {
+		return nil, validationError(err)
+	}
+
+	user, err := s.authorize(ctx, userID, change.Reauthentication)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(change.NewEmail, user.Email) {
+		return nil, ErrSameEmail
+	}
+	if _, err := s.userRepo.GetByEmail(ctx, change.NewEmail); err == nil {
+		return nil, ErrEmailTaken
+	}
+
+	if err := s.emailChanges.RequestEmailChange(ctx, user, change.NewEmail); err != nil {
+		return nil, err
+	}
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ScheduleDeletion marks the account for deletion once the grace period is over
+func (s *AccountService) ScheduleDeletion(ctx context.Context, userID string, req AccountDeletion) (*domain.User, error) {
+	if err := s.validate.Struct(req); err != nil {
+		return nil, validationError(err)
+	}
+
+	user, err := s.authorize(ctx, userID, req.Reauthentication)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletionScheduledAt != nil {
+		return user, nil
+	}
+
+	now := time.Now()
+	deleteAt := now.Add(s.deletionGrace)
+	user.DeletionScheduledAt = &deleteAt
+	user.UpdatedAt = now
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Time("delete_at", deleteAt).Msg("Account deletion scheduled")
+	return user, nil
+}
+
+// RestoreIfScheduled cancels a pending deletion; it is called on every successful login
+func (s *AccountService) RestoreIfScheduled(ctx context.Context, user *domain.User) error {
+	if user.DeletionScheduledAt == nil {
+		return nil
+	}
+
+	user.DeletionScheduledAt = nil
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Msg("Account deletion cancelled by login")
+	return nil
+}
+
+// PurgeDeleted erases accounts whose grace period has ended and returns how many were
+// erased. An account that fails to erase is logged and skipped, so it cannot hold up the
+// ones due after it; it stays due and is tried again on the next run.
+func (s *AccountService) PurgeDeleted(ctx context.Context) (int, error) {
+	purged := 0
+	failed := map[primitive.ObjectID]bool{}
+	for {
+		// Accounts that failed stay due and come first, so fetch past them
+		limit := len(failed) + deletionBatchSize
+		users, err := s.userRepo.FindDeletionDue(ctx, time.Now(), limit)
+		if err != nil {
+			return purged, err
+		}
+		attempted := 0
+		for _, user := range users {
+			if failed[user.ID] {
+				continue
+			}
+			attempted++
+			if _, err := s.eraser.Erase(ctx, user); err != nil {
+				failed[user.ID] = true
+				s.logger.Error().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to erase account due for deletion")
+				continue
+			}
+			purged++
+		}
+		if attempted == 0 || len(users) < limit {
+			break
+		}
+	}
+
+	if len(failed) > 0 && purged == 0 {
+		return 0, fmt.Errorf("failed to erase all %d accounts due for deletion", len(failed))
+	}
+	return purged, nil
+}
+
+// authorize loads the user and checks they are present, with whichever proof reauth
+// carries, before a sensitive change
+func (s *AccountService) authorize(ctx context.Context, userID string, reauth Reauthentication) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case reauth.Password != "":
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(reauth.Password)); err != nil {
+			s.logger.Warn().Str("user_id", userID).Msg("Wrong current password")
+			return nil, ErrWrongPassword
+		}
+	case reauth.IDToken != "":
+		if err := s.identities.Reauthenticate(ctx, user, reauth.Provider, reauth.IDToken); err != nil {
+			return nil, err
+		}
+	case reauth.GuestCredential != "":
+		guest, err := s.guests.Authenticate(ctx, reauth.GuestCredential)
+		if err != nil || guest.ID != user.ID {
+			s.logger.Warn().Str("user_id", userID).Msg("Wrong guest credential")
+			return nil, ErrReauthenticationFailed
+		}
+	default:
+		return nil, &ValidationError{Fields: map[string]string{"password": "is required"}}
+	}
+	return user, nil
+}
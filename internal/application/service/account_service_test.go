@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+func accountUser(t *testing.T, password string) *domain.User {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return &domain.User{ID: primitive.NewObjectID(), Name: "Aiko", Email: "aiko@example.com", Password: string(hash), EmailVerified: true}
+}
+
+func TestAccountService_UpdateProfile(t *testing.T) {
+	user := accountUser(t, "password123")
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("Update", mock.Anything, user).Return(nil).Once()
+	s := NewAccountService(userRepo, nil, nil, nil, nil, nil, 30*24*time.Hour, zerolog.Nop())
+
+	name, timezone, goal := "  Aiko Tanaka ", "Asia/Tokyo", 50
+	updated, err := s.UpdateProfile(context.Background(), user.ID.Hex(), ProfileUpdate{Name: &name, Timezone: &timezone, DailyGoal: &goal})
+	require.NoError(t, err)
+	assert.Equal(t, "Aiko Tanaka", updated.Name)
+	assert.Equal(t, "Asia/Tokyo", updated.Timezone)
+	assert.Equal(t, 50, updated.DailyGoal)
+	assert.Empty(t, updated.Locale, "fields left out are not changed")
+
+	badLocale, badTimezone, noGoal := "not a locale!", "Mars/Olympus", 0
+	_, err = s.UpdateProfile(context.Background(), user.ID.Hex(), ProfileUpdate{Locale: &badLocale, Timezone: &badTimezone, DailyGoal: &noGoal})
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "locale")
+	assert.Contains(t, verr.Fields, "timezone")
+	assert.Contains(t, verr.Fields, "daily_goal")
+	userRepo.AssertExpectations(t)
+}
+
+func TestAccountService_ChangePassword(t *testing.T) {
+	user := accountUser(t, "password123")
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("Update", mock.Anything, user).Return(nil).Once()
+	sessions := NewSessionService(newMemorySessionRepo(), time.Hour, zerolog.Nop())
+	current, _ := loggedInTwice(t, sessions, user)
+	s := NewAccountService(userRepo, nil, nil, nil, nil, sessions, 30*24*time.Hour, zerolog.Nop())
+
+	err := s.ChangePassword(context.Background(), user.ID.Hex(), current.ID.Hex(), PasswordChange{CurrentPassword: "wrong-password", NewPassword: "newpassword456"})
+	assert.ErrorIs(t, err, ErrWrongPassword)
+
+	var verr *ValidationError
+	err = s.ChangePassword(context.Background(), user.ID.Hex(), current.ID.Hex(), PasswordChange{CurrentPassword: "password123", NewPassword: "short"})
+	require.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "new_password")
+
+	assert.Len(t, activeSessionIDs(t, sessions, user.ID.Hex()), 2, "failed changes keep every session")
+
+	require.NoError(t, s.ChangePassword(context.Background(), user.ID.Hex(), current.ID.Hex(), PasswordChange{CurrentPassword: "password123", NewPassword: "newpassword456"}))
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("newpassword456")))
+	assert.Equal(t, []primitive.ObjectID{current.ID}, activeSessionIDs(t, sessions, user.ID.Hex()), "only the session making the change stays logged in")
+	userRepo.AssertExpectations(t)
+}
+
+func TestAccountService_ChangeEmail(t *testing.T) {
+	user := accountUser(t, "password123")
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("GetByEmail", mock.Anything, "taken@example.com").Return(&domain.User{ID: primitive.NewObjectID()}, nil)
+	userRepo.On("GetByEmail", mock.Anything, "aiko@new.example.com").Return((*domain.User)(nil), errors.New("user not found"))
+	userRepo.On("Update", mock.Anything, user).Return(nil).Once()
+
+	mails := &outbox{}
+	verification := NewEmailVerificationService(userRepo, &memoryTokenRepo{}, mails, "https://nihongo.app/verify", time.Hour, UnverifiedFreeAccess, zerolog.Nop())
+	s := NewAccountService(userRepo, verification, nil, nil, nil, nil, 30*24*time.Hour, zerolog.Nop())
+
+	_, err := s.ChangeEmail(context.Background(), user.ID.Hex(), EmailChange{NewEmail: "aiko@new.example.com", Reauthentication: Reauthentication{Password: "wrong-password"}})
+	assert.ErrorIs(t, err, ErrWrongPassword)
+	_, err = s.ChangeEmail(context.Background(), user.ID.Hex(), EmailChange{NewEmail: "AIKO@example.com", Reauthentication: Reauthentication{Password: "password123"}})
+	assert.ErrorIs(t, err, ErrSameEmail)
+	_, err = s.ChangeEmail(context.Background(), user.ID.Hex(), EmailChange{NewEmail: "taken@example.com", Reauthentication: Reauthentication{Password: "password123"}})
+	assert.ErrorIs(t, err, ErrEmailTaken)
+	assert.Empty(t, mails.sent)
+
+	updated, err := s.ChangeEmail(context.Background(), user.ID.Hex(), EmailChange{NewEmail: " aiko@new.example.com ", Reauthentication: Reauthentication{Password: "password123"}})
+	require.NoError(t, err)
+	assert.Equal(t, "aiko@new.example.com", updated.PendingEmail)
+	assert.Equal(t, "aiko@example.com", updated.Email)
+	assert.Len(t, mails.sent, 2)
+	userRepo.AssertExpectations(t)
+}
+
+func TestAccountService_DeletionLifecycle(t *testing.T) {
+	user := accountUser(t, "password123")
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("Update", mock.Anything, user).Return(nil)
+	s := NewAccountService(userRepo, nil, nil, nil, nil, nil, 30*24*time.Hour, zerolog.Nop())
+
+	_, err := s.ScheduleDeletion(context.Background(), user.ID.Hex(), AccountDeletion{Reauthentication{Password: "wrong-password"}})
+	assert.ErrorIs(t, err, ErrWrongPassword)
+	assert.Nil(t, user.DeletionScheduledAt)
+
+	scheduled, err := s.ScheduleDeletion(context.Background(), user.ID.Hex(), AccountDeletion{Reauthentication{Password: "password123"}})
+	require.NoError(t, err)
+	require.NotNil(t, scheduled.DeletionScheduledAt)
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), *scheduled.DeletionScheduledAt, time.Minute)
+
+	require.NoError(t, s.RestoreIfScheduled(context.Background(), user))
+	assert.Nil(t, user.DeletionScheduledAt, "logging in during the grace period restores the account")
+	userRepo.AssertNumberOfCalls(t, "Update", 2)
+}
+
+// stubEraser records the users it was asked to erase and fails for those in failing
+type stubEraser struct {
+	erased  []*domain.User
+	failing map[primitive.ObjectID]bool
+}
+
+func (e *stubEraser) Erase(ctx context.Context, user *domain.User) (*domain.ErasureReceipt, error) {
+	if e.failing[user.ID] {
+		return nil, errors.New("write conflict")
+	}
+	e.erased = append(e.erased, user)
+	return &domain.ErasureReceipt{}, nil
+}
+
+func TestAccountService_PurgeDeleted(t *testing.T) {
+	due := make([]*domain.User, deletionBatchSize)
+	for i := range due {
+		due[i] = &domain.User{ID: primitive.NewObjectID()}
+	}
+	last := &domain.User{ID: primitive.NewObjectID()}
+
+	userRepo := new(mockUserRepo)
+	userRepo.On("FindDeletionDue", mock.Anything, mock.Anything, deletionBatchSize).Return(due, nil).Once()
+	userRepo.On("FindDeletionDue", mock.Anything, mock.Anything, deletionBatchSize).Return([]*domain.User{last}, nil).Once()
+	eraser := &stubEraser{}
+	s := NewAccountService(userRepo, nil, eraser, nil, nil, nil, 30*24*time.Hour, zerolog.Nop())
+
+	purged, err := s.PurgeDeleted(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, deletionBatchSize+1, purged)
+	assert.Len(t, eraser.erased, deletionBatchSize+1)
+	assert.Same(t, last, eraser.erased[deletionBatchSize])
+	userRepo.AssertExpectations(t)
+}
+
+func TestAccountService_PurgeDeletedSkipsFailures(t *testing.T) {
+	due := make([]*domain.User, deletionBatchSize)
+	for i := range due {
+		due[i] = &domain.User{ID: primitive.NewObjectID()}
+	}
+	broken, last := due[0], &domain.User{ID: primitive.NewObjectID()}
+
+	userRepo := new(mockUserRepo)
+	userRepo.On("FindDeletionDue", mock.Anything, mock.Anything, deletionBatchSize).Return(due, nil).Once()
+	// The account that failed is still due, oldest first
+	userRepo.On("FindDeletionDue", mock.Anything, mock.Anything, deletionBatchSize+1).Return([]*domain.User{broken, last}, nil).Once()
+	eraser := &stubEraser{failing: map[primitive.ObjectID]bool{broken.ID: true}}
+	s := NewAccountService(userRepo, nil, eraser, nil, nil, nil, 30*24*time.Hour, zerolog.Nop())
+
+	purged, err := s.PurgeDeleted(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, deletionBatchSize, purged)
+	assert.Same(t, last, eraser.erased[len(eraser.erased)-1], "later accounts are erased despite the failure")
+	userRepo.AssertExpectations(t)
+
+	// Nothing erased at all is reported
+	userRepo = new(mockUserRepo)
+	userRepo.On("FindDeletionDue", mock.Anything, mock.Anything, deletionBatchSize).Return([]*domain.User{broken}, nil).Once()
+	s = NewAccountService(userRepo, nil, eraser, nil, nil, nil, 30*24*time.Hour, zerolog.Nop())
+	_, err = s.PurgeDeleted(context.Background())
+	assert.Error(t, err)
+}
+
+func TestAccountService_ReauthenticatesOAuthOnlyUser(t *testing.T) {
+	password, err := randomPasswordHash()
+	require.NoError(t, err)
+	user := &domain.User{
+		ID: primitive.NewObjectID(), Name: "Aiko", Email: "aiko@example.com", Password: password, EmailVerified: true,
+		Identities: []domain.Identity{{Provider: "google", Subject: "g-123"}, {Provider: "apple", Subject: "a-1"}},
+	}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("GetByEmail", mock.Anything, "aiko@new.example.com").Return((*domain.User)(nil), errors.New("user not found"))
+	userRepo.On("Update", mock.Anything, user).Return(nil)
+
+	verifiers := map[string]ports.IdentityVerifier{
+		"google": stubVerifier{token: "fresh", identity: ports.VerifiedIdentity{Provider: "google", Subject: "g-123", IssuedAt: time.Now()}},
+		"apple":  stubVerifier{token: "old", identity: ports.VerifiedIdentity{Provider: "apple", Subject: "a-1", IssuedAt: time.Now().Add(-time.Hour)}},
+	}
+	oauth := NewOAuthService(userRepo, verifiers, UnverifiedFreeAccess, zerolog.Nop())
+	verification := NewEmailVerificationService(userRepo, &memoryTokenRepo{}, &outbox{}, "https://nihongo.app/verify", time.Hour, UnverifiedFreeAccess, zerolog.Nop())
+	s := NewAccountService(userRepo, verification, nil, oauth, nil, nil, 30*24*time.Hour, zerolog.Nop())
+	ctx := context.Background()
+
+	var verr *ValidationError
+	_, err = s.ScheduleDeletion(ctx, user.ID.Hex(), AccountDeletion{})
+	require.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, "password")
+
+	// A token from an earlier sign-in is not enough
+	_, err = s.ScheduleDeletion(ctx, user.ID.Hex(), AccountDeletion{Reauthentication{Provider: "apple", IDToken: "old"}})
+	assert.ErrorIs(t, err, ErrReauthenticationFailed)
+	_, err = s.ScheduleDeletion(ctx, user.ID.Hex(), AccountDeletion{Reauthentication{Provider: "google", IDToken: "forged"}})
+	assert.ErrorIs(t, err, ErrReauthenticationFailed)
+	assert.Nil(t, user.DeletionScheduledAt)
+
+	updated, err := s.ChangeEmail(ctx, user.ID.Hex(), EmailChange{NewEmail: "aiko@new.example.com", Reauthentication: Reauthentication{Provider: "google", IDToken: "fresh"}})
+	require.NoError(t, err)
+	assert.Equal(t, "aiko@new.example.com", updated.PendingEmail)
+
+	scheduled, err := s.ScheduleDeletion(ctx, user.ID.Hex(), AccountDeletion{Reauthentication{Provider: "google", IDToken: "fresh"}})
+	require.NoError(t, err)
+	assert.NotNil(t, scheduled.DeletionScheduledAt)
+}
+
+func TestAccountService_ReauthenticatesGuest(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	userRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(nil).Run(func(args mock.Arguments) {
+		args.Get(1).(*domain.User).ID = primitive.NewObjectID()
+	})
+	guests := NewGuestService(userRepo, nil, nil, nil, nil, zerolog.Nop())
+	guest, credential, err := guests.Create(context.Background(), "")
+	require.NoError(t, err)
+	userRepo.On("GetByID", mock.Anything, guest.ID.Hex()).Return(guest, nil)
+	userRepo.On("Update", mock.Anything, guest).Return(nil)
+	s := NewAccountService(userRepo, nil, nil, nil, guests, nil, 30*24*time.Hour, zerolog.Nop())
+
+	_, err = s.ScheduleDeletion(context.Background(), guest.ID.Hex(), AccountDeletion{Reauthentication{GuestCredential: guest.ID.Hex() + ".wrong"}})
+	assert.ErrorIs(t, err, ErrReauthenticationFailed)
+
+	scheduled, err := s.ScheduleDeletion(context.Background(), guest.ID.Hex(), AccountDeletion{Reauthentication{GuestCredential: credential}})
+	require.NoError(t, err)
+	assert.NotNil(t, scheduled.DeletionScheduledAt)
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// evaluationTimeout bounds a background evaluation of one user's achievements
+const evaluationTimeout = 30 * time.Second
+
+// AchievementService awards badges. Progress writes queue the learner for evaluation by
+// background workers, so requests never wait for it; listing achievements evaluates too,
+// which catches up on anything a full queue dropped.
+type AchievementService struct {
+	achievementRepo ports.AchievementRepository
+	progressRepo    ports.ProgressRepository
+	syllableRepo    ports.SyllableRepository
+	streakRepo      ports.StreakRepository
+	xpRepo          ports.XPRepository
+	summaries       ProgressSummaryProvider
+	refreshTTL      time.Duration
+	logger          zerolog.Logger
+
+	queue   chan string
+	mu      sync.Mutex
+	pending map[string]bool // Users in the queue
+	wg      sync.WaitGroup
+
+	definitionsMu sync.RWMutex
+	definitions   []domain.AchievementDefinition
+	fetchedAt     time.Time
+}
+
+// NewAchievementService creates a new achievement service. Definitions are re-read at most
+// once per refreshTTL and at most queueSize users wait for evaluation.
+func NewAchievementService(achievementRepo ports.AchievementRepository, progressRepo ports.ProgressRepository, syllableRepo ports.SyllableRepository, streakRepo ports.StreakRepository, xpRepo ports.XPRepository, summaries ProgressSummaryProvider, refreshTTL time.Duration, queueSize int, logger zerolog.Logger) *AchievementService {
+	return &AchievementService{
+		achievementRepo: achievementRepo,
+		progressRepo:    progressRepo,
+		syllableRepo:    syllableRepo,
+		streakRepo:      streakRepo,
+		xpRepo:          xpRepo,
+		summaries:       summaries,
+		refreshTTL:      refreshTTL,
+		logger:          logger,
+		queue:           make(chan string, queueSize),
+		pending:         make(map[string]bool),
+	}
+}
+
+// Start launches workers that evaluate queued users until ctx is cancelled; use Wait to
+// block until they have stopped
+func (s *AchievementService) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case userID := <-s.queue:
+					s.evaluateQueued(ctx, userID)
+				}
+			}
+		}()
+	}
+}
+
+// Wait blocks until all workers have returned
+func (s *AchievementService) Wait() {
+	s.wg.Wait()
+}
+
+// ProgressRecorded queues the learner for evaluation. It must be registered after the
+// streak and XP observers so their updates are counted.
+func (s *AchievementService) ProgressRecorded(ctx context.Context, userID string, progress *domain.Progress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending[userID] {
+		return
+	}
+	select {
+	case s.queue <- userID:
+		s.pending[userID] = true
+	default:
+		s.logger.Warn().Str("user_id", userID).Msg("Achievement queue full; evaluation skipped")
+	}
+}
+
+func (s *AchievementService) evaluateQueued(ctx context.Context, userID string) {
+	// Taken off pending first so progress during the evaluation queues the user again
+	s.mu.Lock()
+	delete(s.pending, userID)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, evaluationTimeout)
+	defer cancel()
+	if _, err := s.Evaluate(ctx, userID); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msg("Failed to evaluate achievements")
+	}
+}
+
+// Evaluate awards the achievements the user has newly met and returns every achievement
+// with its state for the user
+func (s *AchievementService) Evaluate(ctx context.Context, userID string) ([]domain.AchievementStatus, error) {
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	definitions, err := s.getDefinitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	earned, err := s.achievementRepo.Earned(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.stats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	earnedAt := make(map[string]time.Time, len(earned))
+	for _, e := range earned {
+		earnedAt[e.AchievementID] = e.EarnedAt
+	}
+
+	statuses := make([]domain.AchievementStatus, len(definitions))
+	for i, d := range definitions {
+		status := domain.AchievementStatus{AchievementDefinition: d}
+		status.Current, status.Target = d.Progress(stats)
+
+		at, ok := earnedAt[d.ID]
+		if !ok && d.Earned(stats) {
+			award := &domain.UserAchievement{UserID: userObjID, AchievementID: d.ID, EarnedAt: time.Now()}
+			err := s.achievementRepo.Award(ctx, award)
+			if err != nil && !errors.Is(err, ports.ErrAchievementAlreadyEarned) {
+				return nil, err
+			}
+			if err == nil {
+				s.logger.Info().Str("user_id", userID).Str("achievement", d.ID).Msg("Achievement earned")
+			}
+			at, ok = award.EarnedAt, true
+		}
+		if ok {
+			// Earned achievements stay earned, even if the content they count grew since
+			status.Earned = true
+			status.EarnedAt = &at
+			status.Current = status.Target
+		}
+		statuses[i] = status
+	}
+	return statuses, nil
+}
+
+// stats gathers the numbers achievements are measured against
+func (s *AchievementService) stats(ctx context.Context, userID string) (*domain.AchievementStats, error) {
+	stats := &domain.AchievementStats{
+		KanaMastered:     map[domain.SyllableType]int{},
+		KanaTotal:        map[domain.SyllableType]int{},
+		KanjiMastered:    map[domain.JLPTLevel]int{},
+		KanjiTotal:       map[domain.JLPTLevel]int{},
+		CoursesCompleted: map[domain.JLPTLevel]int{},
+	}
+
+	summary, err := s.summaries.GetSummary(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range summary.Levels {
+		stats.KanjiMastered[l.Level] = l.KanjiMastered
+		stats.KanjiTotal[l.Level] = l.KanjiTotal
+	}
+	for _, c := range summary.Courses {
+		if c.LessonsTotal > 0 && c.LessonsCompleted == c.LessonsTotal {
+			stats.CoursesCompleted[c.Level]++
+		}
+	}
+
+	// The summary counts kana together; achievements tell hiragana and katakana apart
+	syllables, err := s.syllableRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scripts := make(map[primitive.ObjectID]domain.SyllableType, len(syllables))
+	for _, syl := range syllables {
+		scripts[syl.ID] = syl.Type
+		stats.KanaTotal[syl.Type]++
+	}
+	progress, err := s.progressRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range progress {
+		if script, ok := scripts[p.EntityID]; ok && p.EntityType == domain.SyllableEntity && p.Completed {
+			stats.KanaMastered[script]++
+		}
+	}
+
+	streak, err := s.streakRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if streak != nil {
+		stats.LongestStreak = streak.Longest
+	}
+	if stats.TotalXP, err = s.xpRepo.Total(ctx, userID); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// getDefinitions returns the enabled definitions, re-reading them at most once per refreshTTL
+func (s *AchievementService) getDefinitions(ctx context.Context) ([]domain.AchievementDefinition, error) {
+	s.definitionsMu.RLock()
+	if s.definitions != nil && time.Since(s.fetchedAt) < s.refreshTTL {
+		defer s.definitionsMu.RUnlock()
+		return s.definitions, nil
+	}
+	s.definitionsMu.RUnlock()
+
+	definitions, err := s.achievementRepo.Definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.definitionsMu.Lock()
+	s.definitions = definitions
+	s.fetchedAt = time.Now()
+	s.definitionsMu.Unlock()
+	return definitions, nil
+}
+
+// PersonalDataName implements PersonalDataStore
+func (s *AchievementService) PersonalDataName() string {
+	return "achievements"
+}
+
+// ExportUserData implements PersonalDataStore
+func (s *AchievementService) ExportUserData(ctx context.Context, userID string) (any, error) {
+	return s.achievementRepo.Earned(ctx, userID)
+}
+
+// EraseUserData implements PersonalDataStore
+func (s *AchievementService) EraseUserData(ctx context.Context, userID string) (int64, error) {
+	return s.achievementRepo.DeleteByUser(ctx, userID)
+}
+
+// MergeUserData implements GuestDataMerger: the account keeps the guest's achievements
+func (s *AchievementService) MergeUserData(ctx context.Context, guestID, targetID string) error {
+	earned, err := s.achievementRepo.Earned(ctx, guestID)
+	if err != nil || len(earned) == 0 {
+		return err
+	}
+	targetObjID, err := primitive.ObjectIDFromHex(targetID)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range earned {
+		e.UserID = targetObjID
+		if err := s.achievementRepo.Award(ctx, &e); err != nil && !errors.Is(err, ports.ErrAchievementAlreadyEarned) {
+			return err
+		}
+	}
+	_, err = s.achievementRepo.DeleteByUser(ctx, guestID)
+	return err
+}
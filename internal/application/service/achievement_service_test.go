@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// memoryAchievementRepo is an in-memory ports.AchievementRepository
+type memoryAchievementRepo struct {
+	mu          sync.Mutex
+	definitions []domain.AchievementDefinition
+	earned      []domain.UserAchievement
+}
+
+func (r *memoryAchievementRepo) Definitions(ctx context.Context) ([]domain.AchievementDefinition, error) {
+	return r.definitions, nil
+}
+
+func (r *memoryAchievementRepo) EnsureDefinitions(ctx context.Context, definitions []domain.AchievementDefinition) error {
+	r.definitions = append(r.definitions, definitions...)
+	return nil
+}
+
+func (r *memoryAchievementRepo) Earned(ctx context.Context, userID string) ([]domain.UserAchievement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var earned []domain.UserAchievement
+	for _, e := range r.earned {
+		if e.UserID.Hex() == userID {
+			earned = append(earned, e)
+		}
+	}
+	return earned, nil
+}
+
+func (r *memoryAchievementRepo) Award(ctx context.Context, achievement *domain.UserAchievement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.earned {
+		if e.UserID == achievement.UserID && e.AchievementID == achievement.AchievementID {
+			return ports.ErrAchievementAlreadyEarned
+		}
+	}
+	r.earned = append(r.earned, *achievement)
+	return nil
+}
+
+func (r *memoryAchievementRepo) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	kept := r.earned[:0]
+	for _, e := range r.earned {
+		if e.UserID.Hex() == userID {
+			deleted++
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	r.earned = kept
+	return deleted, nil
+}
+
+// syllableList is a ports.SyllableRepository serving a fixed list
+type syllableList struct {
+	ports.SyllableRepository
+	syllables []domain.Syllable
+}
+
+func (r *syllableList) GetAll(ctx context.Context) ([]domain.Syllable, error) {
+	return r.syllables, nil
+}
+
+// achievementFixture is a learner who completed both hiragana, one of two katakana and an
+// N3 course, mastered 12 kanji and kept a 7-day streak
+type achievementFixture struct {
+	userID    string
+	repo      *memoryAchievementRepo
+	progress  *memoryProgressRepo
+	syllables *syllableList
+	streaks   *memoryStreakRepo
+	summary   *stubSummary
+}
+
+func newAchievementFixture(t *testing.T) *achievementFixture {
+	userID := primitive.NewObjectID()
+	f := &achievementFixture{
+		userID:    userID.Hex(),
+		repo:      &memoryAchievementRepo{},
+		progress:  &memoryProgressRepo{},
+		syllables: &syllableList{},
+		streaks:   newMemoryStreakRepo(),
+		summary: &stubSummary{
+			Courses: []domain.CourseCompletion{
+				{Level: domain.N3, LessonsTotal: 4, LessonsCompleted: 4},
+				{Level: domain.N5, LessonsTotal: 4, LessonsCompleted: 3},
+			},
+			Levels: []domain.LevelMastery{
+				{Level: domain.N5, KanjiMastered: 10, KanjiTotal: 10},
+				{Level: domain.N4, KanjiMastered: 2, KanjiTotal: 20},
+				{Level: domain.N1},
+			},
+		},
+	}
+
+	for i, script := range []domain.SyllableType{domain.Hiragana, domain.Hiragana, domain.Katakana, domain.Katakana} {
+		syllable := domain.Syllable{ID: primitive.NewObjectID(), Type: script}
+		f.syllables.syllables = append(f.syllables.syllables, syllable)
+		if i < 3 {
+			require.NoError(t, f.progress.Create(context.Background(), &domain.Progress{UserID: userID, EntityID: syllable.ID, EntityType: domain.SyllableEntity, Completed: true}))
+		}
+	}
+	f.streaks.streaks[f.userID] = domain.Streak{UserID: userID, Current: 2, Longest: 7, Version: 1}
+
+	_ = f.repo.EnsureDefinitions(context.Background(), []domain.AchievementDefinition{
+		{ID: "all_hiragana", Metric: domain.MetricKanaMastered, Script: domain.Hiragana},
+		{ID: "all_katakana", Metric: domain.MetricKanaMastered, Script: domain.Katakana},
+		{ID: "kanji_10", Metric: domain.MetricKanjiMastered, Target: 10},
+		{ID: "all_n5_kanji", Metric: domain.MetricKanjiMastered, Level: domain.N5},
+		{ID: "all_n1_kanji", Metric: domain.MetricKanjiMastered, Level: domain.N1},
+		{ID: "first_n3_course", Metric: domain.MetricCoursesCompleted, Level: domain.N3, Target: 1},
+		{ID: "first_n5_course", Metric: domain.MetricCoursesCompleted, Level: domain.N5, Target: 1},
+		{ID: "streak_7", Metric: domain.MetricStreakDays, Target: 7},
+		{ID: "streak_30", Metric: domain.MetricStreakDays, Target: 30},
+		{ID: "xp_100", Metric: domain.MetricTotalXP, Target: 100},
+	})
+	return f
+}
+
+func (f *achievementFixture) service(queueSize int) *AchievementService {
+	return NewAchievementService(f.repo, f.progress, f.syllables, f.streaks, newMemoryXPRepo(), f.summary, time.Minute, queueSize, zerolog.Nop())
+}
+
+func (f *achievementFixture) earnedIDs() []string {
+	earned, _ := f.repo.Earned(context.Background(), f.userID)
+	ids := []string{}
+	for _, e := range earned {
+		ids = append(ids, e.AchievementID)
+	}
+	return ids
+}
+
+func TestAchievementService_Evaluate(t *testing.T) {
+	f := newAchievementFixture(t)
+	s := f.service(10)
+
+	statuses, err := s.Evaluate(context.Background(), f.userID)
+	require.NoError(t, err)
+
+	type state struct {
+		earned          bool
+		current, target int
+	}
+	want := map[string]state{
+		"all_hiragana":    {true, 2, 2},
+		"all_katakana":    {false, 1, 2},
+		"kanji_10":        {true, 10, 10},
+		"all_n5_kanji":    {true, 10, 10},
+		"all_n1_kanji":    {false, 0, 0}, // No N1 kanji yet, so it cannot be earned
+		"first_n3_course": {true, 1, 1},
+		"first_n5_course": {false, 0, 1},
+		"streak_7":        {true, 7, 7},
+		"streak_30":       {false, 7, 30},
+		"xp_100":          {false, 0, 100},
+	}
+	require.Len(t, statuses, len(want))
+	for _, st := range statuses {
+		assert.Equal(t, want[st.ID], state{st.Earned, st.Current, st.Target}, st.ID)
+		assert.Equal(t, st.Earned, st.EarnedAt != nil, st.ID)
+	}
+	assert.ElementsMatch(t, []string{"all_hiragana", "kanji_10", "all_n5_kanji", "first_n3_course", "streak_7"}, f.earnedIDs())
+
+	// Awards are idempotent and stay earned when the content they count grows
+	f.syllables.syllables = append(f.syllables.syllables, domain.Syllable{ID: primitive.NewObjectID(), Type: domain.Hiragana})
+	statuses, err = s.Evaluate(context.Background(), f.userID)
+	require.NoError(t, err)
+	assert.Len(t, f.earnedIDs(), 5)
+	assert.True(t, statuses[0].Earned)
+	assert.Equal(t, 3, statuses[0].Current)
+}
+
+func TestAchievementService_ProgressRecorded(t *testing.T) {
+	t.Run("evaluated in the background", func(t *testing.T) {
+		f := newAchievementFixture(t)
+		s := f.service(10)
+		ctx, cancel := context.WithCancel(context.Background())
+		s.Start(ctx, 1)
+
+		s.ProgressRecorded(context.Background(), f.userID, &domain.Progress{})
+		assert.Eventually(t, func() bool { return len(f.earnedIDs()) == 5 }, time.Second, 5*time.Millisecond)
+
+		cancel()
+		s.Wait()
+	})
+
+	t.Run("queued once and dropped when the queue is full", func(t *testing.T) {
+		f := newAchievementFixture(t)
+		s := f.service(1)
+
+		s.ProgressRecorded(context.Background(), f.userID, &domain.Progress{})
+		s.ProgressRecorded(context.Background(), f.userID, &domain.Progress{})
+		other := primitive.NewObjectID().Hex()
+		s.ProgressRecorded(context.Background(), other, &domain.Progress{})
+
+		assert.Len(t, s.queue, 1)
+		assert.Equal(t, map[string]bool{f.userID: true}, s.pending)
+	})
+}
+
+func TestAchievementService_MergeUserData(t *testing.T) {
+	f := newAchievementFixture(t)
+	s := f.service(10)
+	_, err := s.Evaluate(context.Background(), f.userID)
+	require.NoError(t, err)
+
+	target := primitive.NewObjectID()
+	require.NoError(t, f.repo.Award(context.Background(), &domain.UserAchievement{UserID: target, AchievementID: "streak_7"}))
+	require.NoError(t, s.MergeUserData(context.Background(), f.userID, target.Hex()))
+
+	earned, _ := f.repo.Earned(context.Background(), target.Hex())
+	assert.Len(t, earned, 5)
+	assert.Empty(t, f.earnedIDs())
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog"
+)
+
+// CatalogService resolves store products and RevenueCat entitlements to internal
+// entitlements, merging the configured catalog with Mongo-backed overrides
+type CatalogService struct {
+	base       []domain.CatalogEntry
+	repo       ports.CatalogRepository // Optional; nil disables overrides
+	refreshTTL time.Duration
+	validate   *validator.Validate
+	logger     zerolog.Logger
+
+	mu        sync.RWMutex
+	cached    *domain.ProductCatalog
+	fetchedAt time.Time
+}
+
+// NewCatalogService creates a new catalog service. Overrides are re-read at most once per refreshTTL.
+func NewCatalogService(base []domain.CatalogEntry, repo ports.CatalogRepository, refreshTTL time.Duration, logger zerolog.Logger) *CatalogService {
+	for i := range base {
+		base[i].Source = "config"
+	}
+	return &CatalogService{
+		base:       base,
+		repo:       repo,
+		refreshTTL: refreshTTL,
+		validate:   validator.New(),
+		logger:     logger,
+	}
+}
+
+// GetCatalog returns the merged catalog
+func (s *CatalogService) GetCatalog(ctx context.Context) (*domain.ProductCatalog, error) {
+	s.mu.RLock()
+	if s.cached != nil && time.Since(s.fetchedAt) < s.refreshTTL {
+		defer s.mu.RUnlock()
+		return s.cached, nil
+	}
+	s.mu.RUnlock()
+
+	var overrides []domain.CatalogEntry
+	if s.repo != nil {
+		entries, err := s.repo.GetOverrides(ctx)
+		if err != nil {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			if s.cached != nil {
+				// Keep serving the last known catalog rather than dropping purchases
+				s.logger.Warn().Err(err).Msg("Failed to refresh catalog overrides; using cached catalog")
+				return s.cached, nil
+			}
+			return nil, err
+		}
+		for _, e := range entries {
+			if err := s.validate.Struct(e); err != nil {
+				s.logger.Warn().Err(err).Str("external_id", e.ExternalID).Msg("Skipping invalid catalog override")
+				continue
+			}
+			e.Source = "override"
+			overrides = append(overrides, e)
+		}
+	}
+
+	catalog := domain.NewProductCatalog(s.base, overrides)
+
+	s.mu.Lock()
+	s.cached = catalog
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+	return catalog, nil
+}
+
+// Resolve returns the catalog match for an event's product and entitlement IDs, or nil if nothing matches
+func (s *CatalogService) Resolve(ctx context.Context, productID string, entitlementIDs []string) (*domain.CatalogMatch, error) {
+	catalog, err := s.GetCatalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	match, ok := catalog.Resolve(productID, entitlementIDs)
+	if !ok {
+		return nil, nil
+	}
+	return match, nil
+}
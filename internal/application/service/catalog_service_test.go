@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"nihongo-api/internal/domain"
+)
+
+type mockCatalogRepo struct {
+	mock.Mock
+}
+
+func (m *mockCatalogRepo) GetOverrides(ctx context.Context) ([]domain.CatalogEntry, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]domain.CatalogEntry), args.Error(1)
+}
+
+// testCatalog mirrors the default catalog shipped in config.yml
+func testCatalog() *CatalogService {
+	return NewCatalogService([]domain.CatalogEntry{
+		{Kind: domain.CatalogProduct, ExternalID: "premium_monthly", Entitlements: []string{"premium"}, DefaultDurationDays: 30},
+		{Kind: domain.CatalogProduct, ExternalID: "premium_yearly", Entitlements: []string{"premium"}, DefaultDurationDays: 365},
+		{Kind: domain.CatalogEntitlement, ExternalID: "premium", Entitlements: []string{"premium"}},
+		{Kind: domain.CatalogProduct, ExternalID: "jlpt_n2_pack", Entitlements: []string{"jlpt_n2"}, Lifetime: true},
+		{Kind: domain.CatalogEntitlement, ExternalID: "jlpt_n2", Entitlements: []string{"jlpt_n2"}},
+	}, nil, time.Minute, zerolog.Nop())
+}
+
+func TestCatalogService_Resolve(t *testing.T) {
+	tests := []struct {
+		name             string
+		productID        string
+		entitlementIDs   []string
+		wantMatch        bool
+		wantEntitlements []string
+		wantDuration     time.Duration
+	}{
+		{"premium product", "premium_monthly", nil, true, []string{"premium"}, 30 * 24 * time.Hour},
+		{"premium entitlement", "", []string{"premium"}, true, []string{"premium"}, 0},
+		{"product and entitlement are merged", "premium_yearly", []string{"premium"}, true, []string{"premium"}, 365 * 24 * time.Hour},
+		{"unknown product", "basic", nil, false, nil, 0},
+	}
+
+	s := testCatalog()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := s.Resolve(context.Background(), tt.productID, tt.entitlementIDs)
+			assert.NoError(t, err)
+			if !tt.wantMatch {
+				assert.Nil(t, match)
+				return
+			}
+			assert.Equal(t, tt.wantEntitlements, match.Entitlements)
+			assert.Equal(t, tt.wantDuration, match.DefaultDuration)
+		})
+	}
+}
+
+func TestCatalogService_Overrides(t *testing.T) {
+	repo := new(mockCatalogRepo)
+	repo.On("GetOverrides", mock.Anything).Return([]domain.CatalogEntry{
+		// Disable a configured product
+		{Kind: domain.CatalogProduct, ExternalID: "premium_monthly", Entitlements: []string{"premium"}, Disabled: true},
+		// Launch a new product without a redeploy
+		{Kind: domain.CatalogProduct, ExternalID: "premium_lifetime", Entitlements: []string{"premium", "kanji_pack_n1"}, Lifetime: true},
+		// Invalid entries are skipped
+		{Kind: domain.CatalogProduct, ExternalID: "broken"},
+	}, nil).Once()
+
+	s := NewCatalogService([]domain.CatalogEntry{
+		{Kind: domain.CatalogProduct, ExternalID: "premium_monthly", Entitlements: []string{"premium"}, DefaultDurationDays: 30},
+	}, repo, time.Minute, zerolog.Nop())
+
+	match, err := s.Resolve(context.Background(), "premium_monthly", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, match)
+
+	match, err = s.Resolve(context.Background(), "premium_lifetime", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"premium", "kanji_pack_n1"}, match.Entitlements)
+	assert.Zero(t, match.DefaultDuration)
+	assert.True(t, match.Lifetime)
+
+	match, err = s.Resolve(context.Background(), "broken", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, match)
+
+	catalog, err := s.GetCatalog(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, catalog.Entries, 2)
+	assert.Equal(t, "override", catalog.Entries[0].Source)
+
+	// Overrides are cached, so the repository is only hit once
+	repo.AssertExpectations(t)
+}
+
+func TestCatalogService_KeepsCachedCatalogOnError(t *testing.T) {
+	repo := new(mockCatalogRepo)
+	repo.On("GetOverrides", mock.Anything).Return([]domain.CatalogEntry{}, nil).Once()
+	repo.On("GetOverrides", mock.Anything).Return([]domain.CatalogEntry{}, errors.New("mongo down"))
+
+	s := NewCatalogService([]domain.CatalogEntry{
+		{Kind: domain.CatalogProduct, ExternalID: "premium_monthly", Entitlements: []string{"premium"}},
+	}, repo, 0, zerolog.Nop())
+
+	_, err := s.GetCatalog(context.Background())
+	assert.NoError(t, err)
+
+	match, err := s.Resolve(context.Background(), "premium_monthly", nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, match)
+}
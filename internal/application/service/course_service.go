@@ -2,19 +2,40 @@ package service
 
 import (
 	"context"
+	"errors"
 	"nihongo-api/internal/domain"
 	"nihongo-api/internal/ports"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ErrInvalidCourseID is returned for a course ID that is not a valid ObjectID
+var ErrInvalidCourseID = errors.New("invalid course ID")
+
+// EntitlementProvider returns the entitlements currently granted to a user
+type EntitlementProvider interface {
+	GetUserEntitlements(ctx context.Context, userID string) (map[string]bool, error)
+}
+
+// ProgressSummaryProvider returns a learner's progress across courses and JLPT levels
+type ProgressSummaryProvider interface {
+	GetSummary(ctx context.Context, userID string) (*domain.ProgressSummary, error)
+}
+
 // CourseService handles course business logic
 type CourseService struct {
-	courseRepo ports.CourseRepository
+	courseRepo   ports.CourseRepository
+	entitlements EntitlementProvider
+	progress     ProgressSummaryProvider
 }
 
-// NewCourseService creates a new course service
-func NewCourseService(courseRepo ports.CourseRepository) *CourseService {
+// NewCourseService creates a new course service. progress is used to work out which
+// lessons the user has unlocked.
+func NewCourseService(courseRepo ports.CourseRepository, entitlements EntitlementProvider, progress ProgressSummaryProvider) *CourseService {
 	return &CourseService{
-		courseRepo: courseRepo,
+		courseRepo:   courseRepo,
+		entitlements: entitlements,
+		progress:     progress,
 	}
 }
 
@@ -33,14 +54,79 @@ func (s *CourseService) GetCoursesByLevel(ctx context.Context, level domain.JLPT
 	return s.courseRepo.GetByLevel(ctx, level)
 }
 
-// GetPremiumCourses retrieves premium courses
+// GetPremiumCourses retrieves courses that require at least one entitlement
 func (s *CourseService) GetPremiumCourses(ctx context.Context) ([]domain.Course, error) {
 	return s.courseRepo.GetPremium(ctx)
 }
 
-// CheckPremiumAccess checks if user has access to premium course
-func (s *CourseService) CheckPremiumAccess(ctx context.Context, courseID string, userRevenueCatID string) (bool, error) {
-	// This would integrate with RevenueCat API
-	// For now, return true for demonstration
-	return true, nil
+// GetCoursesForUser retrieves all courses with their locked state for the user
+func (s *CourseService) GetCoursesForUser(ctx context.Context, userID string) ([]domain.CourseWithAccess, error) {
+	courses, err := s.courseRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := s.entitlements.GetUserEntitlements(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := s.progress.GetSummary(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]domain.CourseWithAccess, 0, len(courses))
+	for _, course := range courses {
+		result = append(result, withAccess(course, granted, progress))
+	}
+	return result, nil
+}
+
+// GetCourseForUser retrieves a course with its locked state for the user
+func (s *CourseService) GetCourseForUser(ctx context.Context, courseID, userID string) (*domain.CourseWithAccess, error) {
+	if _, err := primitive.ObjectIDFromHex(courseID); err != nil {
+		return nil, ErrInvalidCourseID
+	}
+	course, err := s.courseRepo.GetByID(ctx, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := s.entitlements.GetUserEntitlements(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := s.progress.GetSummary(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := withAccess(*course, granted, progress)
+	return &result, nil
+}
+
+// CheckCourseAccess checks if the user holds every entitlement the course requires
+func (s *CourseService) CheckCourseAccess(ctx context.Context, courseID, userID string) (bool, error) {
+	course, err := s.courseRepo.GetByID(ctx, courseID)
+	if err != nil {
+		return false, err
+	}
+
+	granted, err := s.entitlements.GetUserEntitlements(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return course.IsUnlockedBy(granted), nil
+}
+
+// withAccess pairs a course with its locked state and the state of each lesson; locked
+// courses only expose their outline
+func withAccess(course domain.Course, granted map[string]bool, progress *domain.ProgressSummary) domain.CourseWithAccess {
+	if !course.IsUnlockedBy(granted) {
+		course = course.Preview()
+		course.Sequence(progress, false)
+		return domain.CourseWithAccess{Course: course, Locked: true}
+	}
+	course.Sequence(progress, true)
+	return domain.CourseWithAccess{Course: course}
 }
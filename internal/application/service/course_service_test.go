@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+type mockCourseRepo struct {
+	mock.Mock
+}
+
+func (m *mockCourseRepo) Create(ctx context.Context, course *domain.Course) error {
+	args := m.Called(ctx, course)
+	return args.Error(0)
+}
+
+func (m *mockCourseRepo) GetByID(ctx context.Context, id string) (*domain.Course, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*domain.Course), args.Error(1)
+}
+
+func (m *mockCourseRepo) GetByLessonID(ctx context.Context, lessonID string) (*domain.Course, error) {
+	args := m.Called(ctx, lessonID)
+	return args.Get(0).(*domain.Course), args.Error(1)
+}
+
+func (m *mockCourseRepo) GetByExerciseID(ctx context.Context, exerciseID string) (*domain.Course, error) {
+	args := m.Called(ctx, exerciseID)
+	return args.Get(0).(*domain.Course), args.Error(1)
+}
+
+func (m *mockCourseRepo) GetAll(ctx context.Context) ([]domain.Course, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]domain.Course), args.Error(1)
+}
+
+func (m *mockCourseRepo) GetByLevel(ctx context.Context, level domain.JLPTLevel) ([]domain.Course, error) {
+	args := m.Called(ctx, level)
+	return args.Get(0).([]domain.Course), args.Error(1)
+}
+
+func (m *mockCourseRepo) GetPremium(ctx context.Context) ([]domain.Course, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]domain.Course), args.Error(1)
+}
+
+func (m *mockCourseRepo) Update(ctx context.Context, course *domain.Course) error {
+	args := m.Called(ctx, course)
+	return args.Error(0)
+}
+
+func (m *mockCourseRepo) Delete(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type stubEntitlements map[string]bool
+
+func (s stubEntitlements) GetUserEntitlements(ctx context.Context, userID string) (map[string]bool, error) {
+	return s, nil
+}
+
+// stubSummary is a ProgressSummaryProvider returning a fixed summary
+type stubSummary domain.ProgressSummary
+
+func (s *stubSummary) GetSummary(ctx context.Context, userID string) (*domain.ProgressSummary, error) {
+	return (*domain.ProgressSummary)(s), nil
+}
+
+func TestCourseService_GetCoursesForUser(t *testing.T) {
+	lesson := domain.Lesson{ID: primitive.NewObjectID(), Title: "Intro", Content: "secret", Exercises: []domain.Exercise{{Answer: "a"}}}
+	free := domain.Course{Name: "Hiragana", Level: domain.N5, Lessons: []domain.Lesson{lesson}}
+	premium := domain.Course{Name: "Grammar", Level: domain.N4, IsPremium: true, Lessons: []domain.Lesson{lesson}}
+	n2Pack := domain.Course{Name: "N2 Kanji", Level: domain.N2, RequiredEntitlements: []string{"jlpt_n2"}, Lessons: []domain.Lesson{lesson}}
+
+	tests := []struct {
+		name        string
+		granted     stubEntitlements
+		wantLocked  []bool
+		wantContent []string
+	}{
+		{"no entitlements", stubEntitlements{}, []bool{false, true, true}, []string{"secret", "", ""}},
+		{"premium only", stubEntitlements{"premium": true}, []bool{false, false, true}, []string{"secret", "secret", ""}},
+		{"N2 pack only", stubEntitlements{"jlpt_n2": true}, []bool{false, true, false}, []string{"secret", "", "secret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := new(mockCourseRepo)
+			repo.On("GetAll", mock.Anything).Return([]domain.Course{free, premium, n2Pack}, nil)
+
+			s := NewCourseService(repo, tt.granted, &stubSummary{})
+			courses, err := s.GetCoursesForUser(context.Background(), primitive.NewObjectID().Hex())
+
+			assert.NoError(t, err)
+			assert.Len(t, courses, 3)
+			for i, c := range courses {
+				assert.Equal(t, tt.wantLocked[i], c.Locked, c.Name)
+				assert.Equal(t, tt.wantContent[i], c.Lessons[0].Content, c.Name)
+				assert.Equal(t, "Intro", c.Lessons[0].Title, c.Name)
+			}
+		})
+	}
+}
+
+func TestCourseService_LessonSequencing(t *testing.T) {
+	intro := domain.Lesson{ID: primitive.NewObjectID(), Title: "Intro", Content: "intro"}
+	vowels := domain.Lesson{ID: primitive.NewObjectID(), Title: "Vowels", Content: "vowels",
+		Prerequisites: &domain.LessonPrerequisites{PreviousLesson: true, MinScore: 70}}
+	kanji := domain.Lesson{ID: primitive.NewObjectID(), Title: "First kanji", Content: "kanji",
+		Prerequisites: &domain.LessonPrerequisites{Mastery: []domain.MasteryRequirement{{Level: domain.N5, Kana: 46}}}}
+	course := domain.Course{ID: primitive.NewObjectID(), Name: "Basics", Level: domain.N5, Lessons: []domain.Lesson{intro, vowels, kanji}}
+
+	score := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name      string
+		intro     domain.LessonCompletion
+		kana      int
+		wantState []domain.LessonState
+		wantUnmet [][]string
+	}{
+		{
+			name:      "nothing done",
+			wantState: []domain.LessonState{domain.LessonStateUnlocked, domain.LessonStateLocked, domain.LessonStateLocked},
+			wantUnmet: [][]string{nil, {domain.PrerequisitePreviousLesson, domain.PrerequisiteMinScore}, {domain.PrerequisiteMastery}},
+		},
+		{
+			name:      "previous completed with a low score",
+			intro:     domain.LessonCompletion{Status: domain.LessonCompleted, AverageScore: score(60)},
+			kana:      46,
+			wantState: []domain.LessonState{domain.LessonStateCompleted, domain.LessonStateLocked, domain.LessonStateUnlocked},
+			wantUnmet: [][]string{nil, {domain.PrerequisiteMinScore}, nil},
+		},
+		{
+			name:      "all prerequisites met",
+			intro:     domain.LessonCompletion{Status: domain.LessonCompleted, AverageScore: score(85)},
+			kana:      50,
+			wantState: []domain.LessonState{domain.LessonStateCompleted, domain.LessonStateUnlocked, domain.LessonStateUnlocked},
+			wantUnmet: [][]string{nil, nil, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.intro.LessonID = intro.ID
+			summary := &stubSummary{
+				Courses: []domain.CourseCompletion{{CourseID: course.ID, Lessons: []domain.LessonCompletion{tt.intro}}},
+				Levels:  []domain.LevelMastery{{Level: domain.N5, KanaMastered: tt.kana}},
+			}
+			repo := new(mockCourseRepo)
+			repo.On("GetByID", mock.Anything, course.ID.Hex()).Return(&course, nil)
+
+			s := NewCourseService(repo, stubEntitlements{}, summary)
+			got, err := s.GetCourseForUser(context.Background(), course.ID.Hex(), primitive.NewObjectID().Hex())
+
+			assert.NoError(t, err)
+			for i, l := range got.Lessons {
+				assert.Equal(t, tt.wantState[i], l.State, l.Title)
+				assert.Equal(t, tt.wantUnmet[i], l.UnmetPrerequisites, l.Title)
+				if l.State == domain.LessonStateLocked {
+					assert.Empty(t, l.Content, "locked lessons hide their content")
+				}
+			}
+			assert.Equal(t, "vowels", course.Lessons[1].Content, "the stored course is not modified")
+		})
+	}
+
+	t.Run("invalid and unknown course IDs", func(t *testing.T) {
+		missing := primitive.NewObjectID().Hex()
+		repo := new(mockCourseRepo)
+		repo.On("GetByID", mock.Anything, missing).Return((*domain.Course)(nil), ports.ErrCourseNotFound)
+
+		s := NewCourseService(repo, stubEntitlements{}, &stubSummary{})
+		_, err := s.GetCourseForUser(context.Background(), "not-an-id", primitive.NewObjectID().Hex())
+		assert.ErrorIs(t, err, ErrInvalidCourseID)
+		_, err = s.GetCourseForUser(context.Background(), missing, primitive.NewObjectID().Hex())
+		assert.ErrorIs(t, err, ports.ErrCourseNotFound)
+	})
+
+	t.Run("course without entitlement locks every lesson", func(t *testing.T) {
+		premium := course
+		premium.IsPremium = true
+		repo := new(mockCourseRepo)
+		repo.On("GetByID", mock.Anything, course.ID.Hex()).Return(&premium, nil)
+
+		s := NewCourseService(repo, stubEntitlements{}, &stubSummary{})
+		got, err := s.GetCourseForUser(context.Background(), course.ID.Hex(), primitive.NewObjectID().Hex())
+
+		assert.NoError(t, err)
+		assert.True(t, got.Locked)
+		for _, l := range got.Lessons {
+			assert.Equal(t, domain.LessonStateLocked, l.State)
+			assert.Equal(t, []string{domain.PrerequisiteEntitlement}, l.UnmetPrerequisites)
+		}
+	})
+}
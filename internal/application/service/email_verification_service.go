@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailAlreadyVerified     = errors.New("email already verified")
+	ErrEmailNotVerified         = errors.New("email not verified")
+	ErrEmailTaken               = errors.New("email is already in use")
+)
+
+// UnverifiedAccess decides what a user whose email is not verified yet may do
+type UnverifiedAccess string
+
+const (
+	// UnverifiedFullAccess does not restrict unverified users
+	UnverifiedFullAccess UnverifiedAccess = "full"
+	// UnverifiedFreeAccess lets unverified users log in but locks premium content
+	UnverifiedFreeAccess UnverifiedAccess = "free"
+	// UnverifiedNoAccess refuses logins until the email is verified
+	UnverifiedNoAccess UnverifiedAccess = "none"
+)
+
+// EmailVerificationService sends and redeems email verification links
+type EmailVerificationService struct {
+	userRepo  ports.UserRepository
+	tokenRepo ports.UserTokenRepository
+	mailer    ports.Mailer
+	verifyURL string
+	tokenTTL  time.Duration
+	access    UnverifiedAccess
+	logger    zerolog.Logger
+}
+
+// NewEmailVerificationService creates a new email verification service. verifyURL is the page
+// or app deep link the email points to; the token is appended as the "token" query parameter.
+func NewEmailVerificationService(userRepo ports.UserRepository, tokenRepo ports.UserTokenRepository, mailer ports.Mailer, verifyURL string, tokenTTL time.Duration, access UnverifiedAccess, logger zerolog.Logger) *EmailVerificationService {
+	return &EmailVerificationService{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		mailer:    mailer,
+		verifyURL: verifyURL,
+		tokenTTL:  tokenTTL,
+		access:    access,
+		logger:    logger,
+	}
+}
+
+// SendVerification emails a fresh verification link to user, invalidating earlier ones
+func (s *EmailVerificationService) SendVerification(ctx context.Context, user *domain.User) error {
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	if err := s.tokenRepo.DeleteByUser(ctx, user.ID.Hex(), domain.EmailVerificationPurpose); err != nil {
+		return err
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := s.tokenRepo.Create(ctx, &domain.UserToken{
+		UserID:    user.ID,
+		Purpose:   domain.EmailVerificationPurpose,
+		TokenHash: hash,
+		ExpiresAt: now.Add(s.tokenTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
+
+	link, err := withToken(s.verifyURL, token)
+	if err != nil {
+		return err
+	}
+	err = s.mailer.Send(ctx, ports.Email{
+		To:      user.Email,
+		Subject: "Confirm your Nihongo email address",
+		Body: fmt.Sprintf("Hi %s,\n\nWelcome to Nihongo! Open the link below to confirm your email address:\n\n%s\n\nThe link expires in %s.\n",
+			user.Name, link, s.tokenTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Msg("Verification email sent")
+	return nil
+}
+
+// ResendVerification sends a new verification link to the user with userID
+func (s *EmailVerificationService) ResendVerification(ctx context.Context, userID string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// RequestEmailChange records newEmail as pending on user and sends a confirmation link to it.
+// The current address stays in use until the link is opened; the caller persists user.
+func (s *EmailVerificationService) RequestEmailChange(ctx context.Context, user *domain.User, newEmail string) error {
+	if err := s.tokenRepo.DeleteByUser(ctx, user.ID.Hex(), domain.EmailChangePurpose); err != nil {
+		return err
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := s.tokenRepo.Create(ctx, &domain.UserToken{
+		UserID:    user.ID,
+		Purpose:   domain.EmailChangePurpose,
+		TokenHash: hash,
+		ExpiresAt: now.Add(s.tokenTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
+	user.PendingEmail = newEmail
+
+	link, err := withToken(s.verifyURL, token)
+	if err != nil {
+		return err
+	}
+	if err := s.mailer.Send(ctx, ports.Email{
+		To:      newEmail,
+		Subject: "Confirm your new Nihongo email address",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to use this address for your Nihongo account:\n\n%s\n\nThe link expires in %s.\n",
+			user.Name, link, s.tokenTTL),
+	}); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	// Let the current address know, in case someone else is taking over the account
+	if err := s.mailer.Send(ctx, ports.Email{
+		To:      user.Email,
+		Subject: "Your Nihongo email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to change the email address of your Nihongo account to %s. If this was not you, reset your password right away.\n",
+			user.Name, newEmail),
+	}); err != nil {
+		s.logger.Warn().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to notify current address of email change")
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Msg("Email change requested")
+	return nil
+}
+
+// VerifyEmail redeems a verification token, either for the sign-up address or for a
+// pending email change, and marks the resulting address as verified
+func (s *EmailVerificationService) VerifyEmail(ctx context.Context, token string) (*domain.User, error) {
+	now := time.Now()
+	verifyToken, err := s.tokenRepo.Consume(ctx, domain.EmailVerificationPurpose, hashToken(token), now)
+	if errors.Is(err, ports.ErrTokenInvalid) {
+		verifyToken, err = s.tokenRepo.Consume(ctx, domain.EmailChangePurpose, hashToken(token), now)
+	}
+	if err != nil {
+		if errors.Is(err, ports.ErrTokenInvalid) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, verifyToken.UserID.Hex())
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if verifyToken.Purpose == domain.EmailChangePurpose {
+		if user.PendingEmail == "" {
+			return nil, ErrInvalidVerificationToken
+		}
+		// The address may have been registered by someone else since the change was requested
+		if existing, err := s.userRepo.GetByEmail(ctx, user.PendingEmail); err == nil && existing.ID != user.ID {
+			return nil, ErrEmailTaken
+		}
+		user.Email = user.PendingEmail
+		user.PendingEmail = ""
+	} else if user.EmailVerified {
+		return user, nil
+	}
+
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+	user.UpdatedAt = now
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Str("purpose", string(verifyToken.Purpose)).Msg("Email verified")
+	return user, nil
+}
+
+// RestrictEntitlements wraps provider so that unverified users get no entitlements
+// when the access policy only allows them free content. Users created from a store
+// purchase keep the entitlements of their RevenueCat ID, which the purchase proves.
+func (s *EmailVerificationService) RestrictEntitlements(provider EntitlementProvider) EntitlementProvider {
+	if s.access != UnverifiedFreeAccess {
+		return provider
+	}
+	return &verifiedEntitlements{provider: provider, userRepo: s.userRepo}
+}
+
+// verifiedEntitlements hides the entitlements of users whose email is not verified
+type verifiedEntitlements struct {
+	provider EntitlementProvider
+	userRepo ports.UserRepository
+}
+
+func (v *verifiedEntitlements) GetUserEntitlements(ctx context.Context, userID string) (map[string]bool, error) {
+	user, err := v.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified && user.RevenueCatUserID == "" {
+		return map[string]bool{}, nil
+	}
+	return v.provider.GetUserEntitlements(ctx, userID)
+}
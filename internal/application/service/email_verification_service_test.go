@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+)
+
+func TestEmailVerificationService_Flow(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID(), Name: "Aiko", Email: "aiko@example.com"}
+
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("Update", mock.Anything, user).Return(nil).Once()
+
+	mails := &outbox{}
+	s := NewEmailVerificationService(userRepo, &memoryTokenRepo{}, mails, "https://nihongo.app/verify", time.Hour, UnverifiedFreeAccess, zerolog.Nop())
+
+	require.NoError(t, s.SendVerification(context.Background(), user))
+	require.NoError(t, s.ResendVerification(context.Background(), user.ID.Hex()))
+	require.Len(t, mails.sent, 2)
+	first, latest := linkToken(t, mails.sent[0].Body), linkToken(t, mails.sent[1].Body)
+
+	_, err := s.VerifyEmail(context.Background(), first)
+	assert.ErrorIs(t, err, ErrInvalidVerificationToken, "resending invalidates earlier links")
+
+	verified, err := s.VerifyEmail(context.Background(), latest)
+	require.NoError(t, err)
+	assert.True(t, verified.EmailVerified)
+	assert.NotNil(t, verified.EmailVerifiedAt)
+
+	_, err = s.VerifyEmail(context.Background(), latest)
+	assert.ErrorIs(t, err, ErrInvalidVerificationToken)
+	assert.ErrorIs(t, s.SendVerification(context.Background(), user), ErrEmailAlreadyVerified)
+	userRepo.AssertExpectations(t)
+}
+
+func TestEmailVerificationService_RestrictEntitlements(t *testing.T) {
+	verified := &domain.User{ID: primitive.NewObjectID(), EmailVerified: true}
+	unverified := &domain.User{ID: primitive.NewObjectID()}
+	buyer := &domain.User{ID: primitive.NewObjectID(), RevenueCatUserID: "rc_123"}
+
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, verified.ID.Hex()).Return(verified, nil)
+	userRepo.On("GetByID", mock.Anything, unverified.ID.Hex()).Return(unverified, nil)
+	userRepo.On("GetByID", mock.Anything, buyer.ID.Hex()).Return(buyer, nil)
+	premium := stubEntitlements{domain.PremiumEntitlement: true}
+
+	free := NewEmailVerificationService(userRepo, &memoryTokenRepo{}, &outbox{}, "nihongo://verify-email", time.Hour, UnverifiedFreeAccess, zerolog.Nop())
+	provider := free.RestrictEntitlements(premium)
+
+	got, err := provider.GetUserEntitlements(context.Background(), unverified.ID.Hex())
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	got, err = provider.GetUserEntitlements(context.Background(), verified.ID.Hex())
+	require.NoError(t, err)
+	assert.True(t, got[domain.PremiumEntitlement])
+	got, err = provider.GetUserEntitlements(context.Background(), buyer.ID.Hex())
+	require.NoError(t, err)
+	assert.True(t, got[domain.PremiumEntitlement], "store buyers keep what they paid for")
+
+	full := NewEmailVerificationService(userRepo, &memoryTokenRepo{}, &outbox{}, "nihongo://verify-email", time.Hour, UnverifiedFullAccess, zerolog.Nop())
+	got, err = full.RestrictEntitlements(premium).GetUserEntitlements(context.Background(), unverified.ID.Hex())
+	require.NoError(t, err)
+	assert.True(t, got[domain.PremiumEntitlement])
+}
+
+func TestEmailVerificationService_EmailChange(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID(), Name: "Aiko", Email: "aiko@example.com", EmailVerified: true}
+
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("GetByEmail", mock.Anything, "aiko@new.example.com").Return((*domain.User)(nil), errors.New("not found"))
+	userRepo.On("Update", mock.Anything, user).Return(nil).Once()
+
+	mails := &outbox{}
+	s := NewEmailVerificationService(userRepo, &memoryTokenRepo{}, mails, "https://nihongo.app/verify", time.Hour, UnverifiedFreeAccess, zerolog.Nop())
+
+	require.NoError(t, s.RequestEmailChange(context.Background(), user, "aiko@new.example.com"))
+	assert.Equal(t, "aiko@new.example.com", user.PendingEmail)
+	assert.Equal(t, "aiko@example.com", user.Email, "the current address stays in use until confirmed")
+	require.Len(t, mails.sent, 2)
+	assert.Equal(t, "aiko@new.example.com", mails.sent[0].To)
+	assert.Equal(t, "aiko@example.com", mails.sent[1].To, "the current address is told about the change")
+
+	changed, err := s.VerifyEmail(context.Background(), linkToken(t, mails.sent[0].Body))
+	require.NoError(t, err)
+	assert.Equal(t, "aiko@new.example.com", changed.Email)
+	assert.Empty(t, changed.PendingEmail)
+	assert.True(t, changed.EmailVerified)
+	userRepo.AssertExpectations(t)
+}
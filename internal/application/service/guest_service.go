@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// anonymousRevenueCatPrefix starts the app_user_id RevenueCat generates for anonymous devices
+	anonymousRevenueCatPrefix = "$RCAnonymousID:"
+)
+
+var (
+	ErrInvalidGuestCredential = errors.New("invalid guest credential")
+	ErrGuestMergeTarget       = errors.New("a guest can only be merged into a registered account")
+	ErrInvalidRevenueCatID    = errors.New("revenuecat_app_user_id must be an unclaimed anonymous RevenueCat ID")
+)
+
+// GuestMerge summarises what an upgrade moved from a guest into a registered account
+type GuestMerge struct {
+	ProgressMoved            int   `json:"progress_moved"`
+	ProgressMerged           int   `json:"progress_merged"` // Entities both accounts had progress on
+	SubscriptionsTransferred int64 `json:"subscriptions_transferred"`
+}
+
+// GuestDataMerger moves data a feature keeps per user from a guest into the account it is
+// merged into. It must be safe to repeat, since a failed merge is retried.
+type GuestDataMerger interface {
+	MergeUserData(ctx context.Context, guestID, targetID string) error
+}
+
+// GuestService manages anonymous guest accounts and their upgrade into registered ones
+type GuestService struct {
+	userRepo     ports.UserRepository
+	progressRepo ports.ProgressRepository
+	subRepo      ports.SubscriptionRepository
+	sessionRepo  ports.SessionRepository
+	subscribers  ports.SubscriberProvider
+	mergers      []GuestDataMerger
+	logger       zerolog.Logger
+}
+
+// NewGuestService creates a new guest service. subscribers confirms the RevenueCat IDs
+// guests are created with.
+func NewGuestService(userRepo ports.UserRepository, progressRepo ports.ProgressRepository, subRepo ports.SubscriptionRepository, sessionRepo ports.SessionRepository, subscribers ports.SubscriberProvider, logger zerolog.Logger) *GuestService {
+	return &GuestService{
+		userRepo:     userRepo,
+		progressRepo: progressRepo,
+		subRepo:      subRepo,
+		sessionRepo:  sessionRepo,
+		subscribers:  subscribers,
+		logger:       logger,
+	}
+}
+
+// AddMerger registers a merger for data outside the core collections; call it before
+// serving requests
+func (s *GuestService) AddMerger(merger GuestDataMerger) {
+	s.mergers = append(s.mergers, merger)
+}
+
+// Create makes a guest account and returns it with its device credential, which is only
+// shown once. revenueCatUserID is the anonymous RevenueCat app_user_id of the device, if any;
+// it returns ErrInvalidRevenueCatID unless that is an anonymous ID RevenueCat knows and no
+// user has yet.
+func (s *GuestService) Create(ctx context.Context, revenueCatUserID string) (*domain.User, string, error) {
+	if revenueCatUserID != "" {
+		if err := s.checkRevenueCatID(ctx, revenueCatUserID); err != nil {
+			return nil, "", err
+		}
+	}
+
+	secret, hash, err := newOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	user := &domain.User{
+		Name:             "Guest",
+		Role:             domain.RoleGuest,
+		GuestSecretHash:  hash,
+		RevenueCatUserID: revenueCatUserID,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, "", err
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Msg("Guest account created")
+	return user, user.ID.Hex() + "." + secret, nil
+}
+
+// Authenticate returns the guest a device credential belongs to
+func (s *GuestService) Authenticate(ctx context.Context, credential string) (*domain.User, error) {
+	userID, secret, ok := strings.Cut(credential, ".")
+	if !ok || secret == "" {
+		return nil, ErrInvalidGuestCredential
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, ErrInvalidGuestCredential
+	}
+	if !user.IsGuest() || subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(user.GuestSecretHash)) != 1 {
+		return nil, ErrInvalidGuestCredential
+	}
+	return user, nil
+}
+
+// Merge moves everything a guest did into target, which has just registered or logged in,
+// and deletes the guest. Progress on the same entity is merged keeping the best score and
+// the earliest completion. Every step can be repeated, so a failed merge can be retried
+// with the same credential.
+func (s *GuestService) Merge(ctx context.Context, credential string, target *domain.User) (*GuestMerge, error) {
+	guest, err := s.Authenticate(ctx, credential)
+	if err != nil {
+		return nil, err
+	}
+	if target.IsGuest() || target.ID == guest.ID {
+		return nil, ErrGuestMergeTarget
+	}
+	guestID, targetID := guest.ID.Hex(), target.ID.Hex()
+
+	result := &GuestMerge{}
+	guestProgress, err := s.progressRepo.GetByUserID(ctx, guestID)
+	if err != nil {
+		return nil, err
+	}
+	for _, gp := range guestProgress {
+		existing, err := s.progressRepo.GetByUserAndEntity(ctx, targetID, gp.EntityID.Hex(), gp.EntityType)
+		if errors.Is(err, ports.ErrProgressNotFound) {
+			// Not tracked by the account yet, so the record simply changes owner
+			gp.UserID = target.ID
+			if err := s.progressRepo.Update(ctx, &gp); err != nil {
+				return nil, err
+			}
+			result.ProgressMoved++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		existing.Merge(gp)
+		if err := s.progressRepo.Update(ctx, existing); err != nil {
+			return nil, err
+		}
+		if err := s.progressRepo.Delete(ctx, gp.ID.Hex()); err != nil {
+			return nil, err
+		}
+		result.ProgressMerged++
+	}
+
+	// Purchases made with the device's anonymous RevenueCat ID follow the guest
+	result.SubscriptionsTransferred, err = s.subRepo.ReassignInternalUserID(ctx, guestID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if guest.RevenueCatUserID != "" && target.RevenueCatUserID == "" && s.ownsRevenueCatID(ctx, guest) {
+		if err := s.userRepo.LinkRevenueCatUserID(ctx, targetID, guest.RevenueCatUserID); err != nil {
+			return nil, err
+		}
+		target.RevenueCatUserID = guest.RevenueCatUserID
+	}
+
+	for _, m := range s.mergers {
+		if err := m.MergeUserData(ctx, guestID, targetID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := s.sessionRepo.DeleteByUser(ctx, guestID); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.Delete(ctx, guestID); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("guest_id", guestID).
+		Str("user_id", targetID).
+		Int("progress_moved", result.ProgressMoved).
+		Int("progress_merged", result.ProgressMerged).
+		Int64("subscriptions_transferred", result.SubscriptionsTransferred).
+		Msg("Guest merged into account")
+	return result, nil
+}
+
+// checkRevenueCatID accepts an ID for a new guest. The ID comes from the client, so it is
+// only trusted once it looks anonymous, is not linked to anyone yet, and RevenueCat knows
+// it as a customer of its own rather than an alias of an identified one; otherwise a guest
+// could take over someone else's purchases.
+func (s *GuestService) checkRevenueCatID(ctx context.Context, revenueCatUserID string) error {
+	if !strings.HasPrefix(revenueCatUserID, anonymousRevenueCatPrefix) {
+		return ErrInvalidRevenueCatID
+	}
+	if _, err := s.userRepo.GetByRevenueCatID(ctx, revenueCatUserID); err == nil {
+		s.logger.Warn().Str("revenue_cat_user_id", revenueCatUserID).Msg("Guest asked for a RevenueCat ID that is already linked")
+		return ErrInvalidRevenueCatID
+	}
+
+	subscriber, err := s.subscribers.GetSubscriber(ctx, revenueCatUserID)
+	if errors.Is(err, ports.ErrSubscriberNotFound) {
+		return ErrInvalidRevenueCatID
+	}
+	if err != nil {
+		return err
+	}
+	if subscriber.OriginalAppUserID != revenueCatUserID {
+		return ErrInvalidRevenueCatID
+	}
+	return nil
+}
+
+// ownsRevenueCatID reports whether the guest is still the only user linked to its
+// RevenueCat ID, so it can be handed on to the account it merges into
+func (s *GuestService) ownsRevenueCatID(ctx context.Context, guest *domain.User) bool {
+	owner, err := s.userRepo.GetByRevenueCatID(ctx, guest.RevenueCatUserID)
+	if err != nil || owner.ID != guest.ID {
+		s.logger.Warn().Str("user_id", guest.ID.Hex()).Msg("Guest RevenueCat ID is linked elsewhere, not moving it")
+		return false
+	}
+	return true
+}
+
+// RestrictEntitlements wraps provider so that guests only get free content
+func (s *GuestService) RestrictEntitlements(provider EntitlementProvider) EntitlementProvider {
+	return &guestEntitlements{provider: provider, userRepo: s.userRepo}
+}
+
+// guestEntitlements hides the entitlements of guest accounts
+type guestEntitlements struct {
+	provider EntitlementProvider
+	userRepo ports.UserRepository
+}
+
+func (g *guestEntitlements) GetUserEntitlements(ctx context.Context, userID string) (map[string]bool, error) {
+	user, err := g.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsGuest() {
+		return map[string]bool{}, nil
+	}
+	return g.provider.GetUserEntitlements(ctx, userID)
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/adapters/revenuecat"
+	"nihongo-api/internal/adapters/revenuecat/revenuecattest"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// anonymousSubscribers is a RevenueCat API that knows the given anonymous app user IDs
+func anonymousSubscribers(t *testing.T, appUserIDs ...string) ports.SubscriberProvider {
+	server := revenuecattest.NewServer("sk_test")
+	t.Cleanup(server.Close)
+	for _, id := range appUserIDs {
+		server.SetSubscriber(id, fmt.Sprintf(`{"original_app_user_id": %q}`, id))
+	}
+	return revenuecat.NewClient(server.URL, server.APIKey, time.Second, 0, zerolog.Nop())
+}
+
+// newTestGuest creates a guest through the service and returns it with its credential
+func newTestGuest(t *testing.T, s *GuestService, userRepo *mockUserRepo, revenueCatUserID string) (*domain.User, string) {
+	if revenueCatUserID != "" {
+		userRepo.On("GetByRevenueCatID", mock.Anything, revenueCatUserID).Return((*domain.User)(nil), errors.New("user not found")).Once()
+	}
+	var created *domain.User
+	userRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Run(func(args mock.Arguments) {
+		created = args.Get(1).(*domain.User)
+		created.ID = primitive.NewObjectID()
+	}).Return(nil).Once()
+
+	guest, credential, err := s.Create(context.Background(), revenueCatUserID)
+	require.NoError(t, err)
+	require.Same(t, created, guest)
+	userRepo.On("GetByID", mock.Anything, guest.ID.Hex()).Return(guest, nil)
+	return guest, credential
+}
+
+func TestGuestService_CreateAndAuthenticate(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	s := NewGuestService(userRepo, &memoryProgressRepo{}, new(mockSubRepo), newMemorySessionRepo(), anonymousSubscribers(t, "$RCAnonymousID:abc"), zerolog.Nop())
+
+	guest, credential := newTestGuest(t, s, userRepo, "$RCAnonymousID:abc")
+	assert.True(t, guest.IsGuest())
+	assert.Equal(t, "$RCAnonymousID:abc", guest.RevenueCatUserID)
+	assert.NotContains(t, guest.GuestSecretHash, credential, "only a hash of the credential is stored")
+
+	authenticated, err := s.Authenticate(context.Background(), credential)
+	require.NoError(t, err)
+	assert.Equal(t, guest.ID, authenticated.ID)
+
+	userRepo.On("GetByID", mock.Anything, "not-an-id").Return((*domain.User)(nil), errors.New("user not found"))
+	for _, bad := range []string{"", guest.ID.Hex(), guest.ID.Hex() + ".wrong", "not-an-id.secret"} {
+		_, err := s.Authenticate(context.Background(), bad)
+		assert.ErrorIs(t, err, ErrInvalidGuestCredential, "credential %q", bad)
+	}
+
+	// A registered user cannot be logged into with a guest credential
+	guest.Role = domain.RoleStudent
+	_, err = s.Authenticate(context.Background(), credential)
+	assert.ErrorIs(t, err, ErrInvalidGuestCredential)
+}
+
+func TestGuestService_CreateChecksRevenueCatID(t *testing.T) {
+	server := revenuecattest.NewServer("sk_test")
+	defer server.Close()
+	server.SetSubscriber("$RCAnonymousID:taken", `{"original_app_user_id": "$RCAnonymousID:taken"}`)
+	// An anonymous ID that was later aliased to an identified customer
+	server.SetSubscriber("$RCAnonymousID:alias", `{"original_app_user_id": "user_9"}`)
+
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByRevenueCatID", mock.Anything, "$RCAnonymousID:taken").Return(&domain.User{ID: primitive.NewObjectID()}, nil)
+	userRepo.On("GetByRevenueCatID", mock.Anything, mock.Anything).Return((*domain.User)(nil), errors.New("user not found"))
+	client := revenuecat.NewClient(server.URL, server.APIKey, time.Second, 0, zerolog.Nop())
+	s := NewGuestService(userRepo, &memoryProgressRepo{}, new(mockSubRepo), newMemorySessionRepo(), client, zerolog.Nop())
+
+	for _, id := range []string{"user_123", "$RCAnonymousID:taken", "$RCAnonymousID:unknown", "$RCAnonymousID:alias"} {
+		_, _, err := s.Create(context.Background(), id)
+		assert.ErrorIs(t, err, ErrInvalidRevenueCatID, id)
+	}
+	userRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestGuestService_Merge(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	subRepo := new(mockSubRepo)
+	progress := &memoryProgressRepo{}
+	sessions := newMemorySessionRepo()
+	s := NewGuestService(userRepo, progress, subRepo, sessions, anonymousSubscribers(t, "$RCAnonymousID:abc"), zerolog.Nop())
+	ctx := context.Background()
+
+	guest, credential := newTestGuest(t, s, userRepo, "$RCAnonymousID:abc")
+	target := &domain.User{ID: primitive.NewObjectID(), Role: domain.RoleStudent, Email: "aiko@example.com"}
+
+	early, late := time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour)
+	onlyGuest, shared := primitive.NewObjectID(), primitive.NewObjectID()
+	require.NoError(t, progress.Create(ctx, &domain.Progress{UserID: guest.ID, EntityID: onlyGuest, EntityType: domain.SyllableEntity, Score: 70}))
+	require.NoError(t, progress.Create(ctx, &domain.Progress{UserID: guest.ID, EntityID: shared, EntityType: domain.LessonEntity, Score: 90, Completed: true, CompletedAt: &early}))
+	require.NoError(t, progress.Create(ctx, &domain.Progress{UserID: target.ID, EntityID: shared, EntityType: domain.LessonEntity, Score: 60, Completed: true, CompletedAt: &late}))
+	require.NoError(t, sessions.Create(ctx, &domain.Session{UserID: guest.ID, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	subRepo.On("ReassignInternalUserID", mock.Anything, guest.ID.Hex(), target.ID.Hex()).Return(int64(1), nil).Once()
+	userRepo.On("GetByRevenueCatID", mock.Anything, "$RCAnonymousID:abc").Return(guest, nil).Once()
+	userRepo.On("LinkRevenueCatUserID", mock.Anything, target.ID.Hex(), "$RCAnonymousID:abc").Return(nil).Once()
+	userRepo.On("Delete", mock.Anything, guest.ID.Hex()).Return(nil).Once()
+
+	merge, err := s.Merge(ctx, credential, target)
+	require.NoError(t, err)
+	assert.Equal(t, &GuestMerge{ProgressMoved: 1, ProgressMerged: 1, SubscriptionsTransferred: 1}, merge)
+	assert.Equal(t, "$RCAnonymousID:abc", target.RevenueCatUserID)
+
+	records, err := progress.GetByUserID(ctx, target.ID.Hex())
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	lesson, err := progress.GetByUserAndEntity(ctx, target.ID.Hex(), shared.Hex(), domain.LessonEntity)
+	require.NoError(t, err)
+	assert.Equal(t, 90, lesson.Score, "the best score is kept")
+	assert.True(t, lesson.CompletedAt.Equal(early), "the earliest completion is kept")
+	guestRecords, err := progress.GetByUserID(ctx, guest.ID.Hex())
+	require.NoError(t, err)
+	assert.Empty(t, guestRecords)
+	assert.Empty(t, sessions.sessions, "the guest's sessions end")
+
+	userRepo.AssertExpectations(t)
+	subRepo.AssertExpectations(t)
+}
+
+func TestGuestService_MergeRejectsGuestTarget(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	s := NewGuestService(userRepo, &memoryProgressRepo{}, new(mockSubRepo), newMemorySessionRepo(), nil, zerolog.Nop())
+
+	guest, credential := newTestGuest(t, s, userRepo, "")
+	_, err := s.Merge(context.Background(), credential, guest)
+	assert.ErrorIs(t, err, ErrGuestMergeTarget)
+	_, err = s.Merge(context.Background(), credential, &domain.User{ID: primitive.NewObjectID(), Role: domain.RoleGuest})
+	assert.ErrorIs(t, err, ErrGuestMergeTarget)
+}
+
+func TestGuestService_RestrictEntitlements(t *testing.T) {
+	guest := &domain.User{ID: primitive.NewObjectID(), Role: domain.RoleGuest}
+	student := &domain.User{ID: primitive.NewObjectID(), Role: domain.RoleStudent}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, guest.ID.Hex()).Return(guest, nil)
+	userRepo.On("GetByID", mock.Anything, student.ID.Hex()).Return(student, nil)
+	s := NewGuestService(userRepo, &memoryProgressRepo{}, new(mockSubRepo), newMemorySessionRepo(), nil, zerolog.Nop())
+
+	provider := s.RestrictEntitlements(stubEntitlements{domain.PremiumEntitlement: true})
+	got, err := provider.GetUserEntitlements(context.Background(), guest.ID.Hex())
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	got, err = provider.GetUserEntitlements(context.Background(), student.ID.Hex())
+	require.NoError(t, err)
+	assert.True(t, got[domain.PremiumEntitlement])
+}
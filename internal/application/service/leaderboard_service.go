@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+)
+
+// weeklyBoardRetention keeps a finished week's board in the store long enough for the
+// archive job to pick it up
+const weeklyBoardRetention = 7 * 24 * time.Hour
+
+// ErrInvalidLeaderboardSize is returned when more entries are asked for than a board shows
+var ErrInvalidLeaderboardSize = errors.New("invalid leaderboard size")
+
+// LeaderboardPolicy tunes leaderboard scoring and what is shown
+type LeaderboardPolicy struct {
+	CompletionPoints int64 // For every completed entity
+	MaxScorePoints   int64 // Added for an exercise scored 100, proportionally less below
+	MaxTop           int   // Largest top N that can be asked for
+	Neighbours       int   // Entries shown above and below the caller
+	ArchiveSize      int   // Entries kept when a week is archived
+}
+
+// LeaderboardService ranks learners on weekly and all-time boards, globally and per JLPT
+// level. Guests and users who opted out are never put on a board.
+type LeaderboardService struct {
+	store       ports.LeaderboardStore
+	archiveRepo ports.LeaderboardArchiveRepository
+	userRepo    ports.UserRepository
+	kanjiRepo   ports.KanjiRepository
+	courseRepo  ports.CourseRepository
+	policy      LeaderboardPolicy
+	logger      zerolog.Logger
+}
+
+// NewLeaderboardService creates a new leaderboard service. The content repositories put
+// entities on the board of their JLPT level.
+func NewLeaderboardService(store ports.LeaderboardStore, archiveRepo ports.LeaderboardArchiveRepository, userRepo ports.UserRepository, kanjiRepo ports.KanjiRepository, courseRepo ports.CourseRepository, policy LeaderboardPolicy, logger zerolog.Logger) *LeaderboardService {
+	return &LeaderboardService{
+		store:       store,
+		archiveRepo: archiveRepo,
+		userRepo:    userRepo,
+		kanjiRepo:   kanjiRepo,
+		courseRepo:  courseRepo,
+		policy:      policy,
+		logger:      logger,
+	}
+}
+
+// ProgressRecorded scores a progress write
+func (s *LeaderboardService) ProgressRecorded(ctx context.Context, userID string, progress *domain.Progress) {
+	if err := s.Submit(ctx, userID, progress, time.Now()); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msg("Failed to update leaderboards")
+	}
+}
+
+// Submit scores progress made at the given time. An entity counts once per board, with
+// its best score; completing it again adds nothing.
+func (s *LeaderboardService) Submit(ctx context.Context, userID string, progress *domain.Progress, at time.Time) error {
+	points := s.points(progress)
+	if points == 0 {
+		return nil
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.IsGuest() || user.LeaderboardOptOut {
+		return nil
+	}
+	level, err := entityLevel(ctx, s.kanjiRepo, s.courseRepo, progress.EntityID, progress.EntityType)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.SetName(ctx, userID, user.Name); err != nil {
+		return err
+	}
+	week := domain.WeekOf(at)
+	weeklyTTL := domain.WeekEnd(at).Sub(at) + weeklyBoardRetention
+	for _, b := range []domain.Leaderboard{
+		{Period: domain.LeaderboardWeekly},
+		{Period: domain.LeaderboardWeekly, Level: level},
+		{Period: domain.LeaderboardAllTime},
+		{Period: domain.LeaderboardAllTime, Level: level},
+	} {
+		ttl := time.Duration(0)
+		if b.Period == domain.LeaderboardWeekly {
+			ttl = weeklyTTL
+		}
+		if err := s.store.Submit(ctx, boardKey(b, week), userID, progress.EntityID.Hex(), points, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// points returns what progress is worth: completed entities score, and exercises score
+// more the better they were answered
+func (s *LeaderboardService) points(progress *domain.Progress) int64 {
+	if !progress.Completed {
+		return 0
+	}
+	points := s.policy.CompletionPoints
+	if progress.EntityType == domain.ExerciseEntity {
+		points += int64(progress.Score) * s.policy.MaxScorePoints / 100
+	}
+	return points
+}
+
+// Get returns the top n of a board with the caller's rank and neighbours. For weekly boards
+// week picks a past week, served from the archive; it defaults to the current week.
+func (s *LeaderboardService) Get(ctx context.Context, userID, name, week string, n int) (*domain.LeaderboardStanding, error) {
+	board, err := domain.ParseLeaderboard(name)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > s.policy.MaxTop {
+		return nil, ErrInvalidLeaderboardSize
+	}
+
+	standing := &domain.LeaderboardStanding{Board: board.String()}
+	if board.Period == domain.LeaderboardWeekly {
+		current := domain.WeekOf(time.Now())
+		if week == "" {
+			week = current
+		}
+		standing.Week = week
+		if week != current {
+			return s.archived(ctx, standing, userID, n)
+		}
+	}
+
+	key := boardKey(board, week)
+	if standing.Top, err = s.store.Top(ctx, key, n); err != nil {
+		return nil, err
+	}
+	if standing.Neighbours, err = s.store.Around(ctx, key, userID, s.policy.Neighbours); err != nil {
+		return nil, err
+	}
+	standing.Me = findEntry(standing.Neighbours, userID)
+	return standing, nil
+}
+
+// archived fills a standing of a past week from its archive
+func (s *LeaderboardService) archived(ctx context.Context, standing *domain.LeaderboardStanding, userID string, n int) (*domain.LeaderboardStanding, error) {
+	archive, err := s.archiveRepo.Get(ctx, standing.Board, standing.Week)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := archive.Entries
+	standing.Archived = true
+	standing.Top = entries[:min(n, len(entries))]
+	standing.Neighbours = []domain.LeaderboardEntry{}
+	for i, e := range entries {
+		if e.UserID == userID {
+			standing.Neighbours = entries[max(0, i-s.policy.Neighbours):min(len(entries), i+s.policy.Neighbours+1)]
+			break
+		}
+	}
+	standing.Me = findEntry(standing.Neighbours, userID)
+	return standing, nil
+}
+
+// ArchiveWeek archives the weekly boards of the week before now and removes them from the
+// store. Boards already archived are skipped, so it can run any number of times. It
+// returns how many boards were archived.
+func (s *LeaderboardService) ArchiveWeek(ctx context.Context, now time.Time) (int, error) {
+	week := domain.WeekOf(now.AddDate(0, 0, -7))
+	archived := 0
+	for _, b := range domain.Leaderboards(domain.LeaderboardWeekly) {
+		_, err := s.archiveRepo.Get(ctx, b.String(), week)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ports.ErrLeaderboardArchiveNotFound) {
+			return archived, err
+		}
+
+		key := boardKey(b, week)
+		entries, err := s.store.Top(ctx, key, s.policy.ArchiveSize)
+		if err != nil {
+			return archived, err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		archive := &domain.LeaderboardArchive{Board: b.String(), Week: week, Entries: entries, ArchivedAt: time.Now()}
+		if err := s.archiveRepo.Save(ctx, archive); err != nil {
+			return archived, err
+		}
+		if err := s.store.Delete(ctx, key); err != nil {
+			return archived, err
+		}
+		archived++
+		s.logger.Info().Str("board", b.String()).Str("week", week).Int("entries", len(entries)).Msg("Leaderboard archived")
+	}
+	return archived, nil
+}
+
+// RemoveUser takes the user off every live board, e.g. when they opt out
+func (s *LeaderboardService) RemoveUser(ctx context.Context, userID string) (int64, error) {
+	return s.store.Remove(ctx, liveBoardKeys(time.Now()), userID)
+}
+
+// PersonalDataName implements PersonalDataStore
+func (s *LeaderboardService) PersonalDataName() string {
+	return "leaderboards"
+}
+
+// ExportUserData implements PersonalDataStore
+func (s *LeaderboardService) ExportUserData(ctx context.Context, userID string) (any, error) {
+	entries := map[string]domain.LeaderboardEntry{}
+	for _, key := range liveBoardKeys(time.Now()) {
+		around, err := s.store.Around(ctx, key, userID, 0)
+		if err != nil {
+			return nil, err
+		}
+		if me := findEntry(around, userID); me != nil {
+			entries[key] = *me
+		}
+	}
+	return entries, nil
+}
+
+// EraseUserData implements PersonalDataStore; the user is also taken out of the archives
+func (s *LeaderboardService) EraseUserData(ctx context.Context, userID string) (int64, error) {
+	live, err := s.RemoveUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	archived, err := s.archiveRepo.RemoveUser(ctx, userID)
+	return live + archived, err
+}
+
+// boardKey names a board in the store; weekly boards get one per week
+func boardKey(b domain.Leaderboard, week string) string {
+	if b.Period == domain.LeaderboardWeekly {
+		return b.String() + ":" + week
+	}
+	return b.String()
+}
+
+// liveBoardKeys lists the boards in the store at now: all-time, this week and last week,
+// which may not be archived yet
+func liveBoardKeys(now time.Time) []string {
+	var keys []string
+	for _, b := range domain.Leaderboards(domain.LeaderboardAllTime) {
+		keys = append(keys, boardKey(b, ""))
+	}
+	for _, week := range []string{domain.WeekOf(now), domain.WeekOf(now.AddDate(0, 0, -7))} {
+		for _, b := range domain.Leaderboards(domain.LeaderboardWeekly) {
+			keys = append(keys, boardKey(b, week))
+		}
+	}
+	return keys
+}
+
+// findEntry returns the user's entry, or nil
+func findEntry(entries []domain.LeaderboardEntry, userID string) *domain.LeaderboardEntry {
+	for i := range entries {
+		if entries[i].UserID == userID {
+			return &entries[i]
+		}
+	}
+	return nil
+}
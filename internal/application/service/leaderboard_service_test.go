@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// memoryLeaderboardStore is an in-memory ports.LeaderboardStore ranking like Redis: by
+// score, then by user ID, both descending
+type memoryLeaderboardStore struct {
+	points map[string]map[string]map[string]int64 // board, user, entity
+	names  map[string]string
+	ttls   map[string]time.Duration
+}
+
+func newMemoryLeaderboardStore() *memoryLeaderboardStore {
+	return &memoryLeaderboardStore{
+		points: map[string]map[string]map[string]int64{},
+		names:  map[string]string{},
+		ttls:   map[string]time.Duration{},
+	}
+}
+
+func (s *memoryLeaderboardStore) Submit(ctx context.Context, board, userID, entityID string, points int64, ttl time.Duration) error {
+	if s.points[board] == nil {
+		s.points[board] = map[string]map[string]int64{}
+	}
+	if s.points[board][userID] == nil {
+		s.points[board][userID] = map[string]int64{}
+	}
+	s.points[board][userID][entityID] = max(s.points[board][userID][entityID], points)
+	s.ttls[board] = ttl
+	return nil
+}
+
+func (s *memoryLeaderboardStore) SetName(ctx context.Context, userID, name string) error {
+	s.names[userID] = name
+	return nil
+}
+
+func (s *memoryLeaderboardStore) ranked(board string) []domain.LeaderboardEntry {
+	entries := []domain.LeaderboardEntry{}
+	for userID, entities := range s.points[board] {
+		e := domain.LeaderboardEntry{UserID: userID, Name: s.names[userID]}
+		for _, p := range entities {
+			e.Score += p
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		return entries[i].UserID > entries[j].UserID
+	})
+	for i := range entries {
+		entries[i].Rank = int64(i + 1)
+	}
+	return entries
+}
+
+func (s *memoryLeaderboardStore) Top(ctx context.Context, board string, n int) ([]domain.LeaderboardEntry, error) {
+	entries := s.ranked(board)
+	return entries[:min(n, len(entries))], nil
+}
+
+func (s *memoryLeaderboardStore) Around(ctx context.Context, board, userID string, radius int) ([]domain.LeaderboardEntry, error) {
+	entries := s.ranked(board)
+	for i, e := range entries {
+		if e.UserID == userID {
+			return entries[max(0, i-radius):min(len(entries), i+radius+1)], nil
+		}
+	}
+	return []domain.LeaderboardEntry{}, nil
+}
+
+func (s *memoryLeaderboardStore) Remove(ctx context.Context, boards []string, userID string) (int64, error) {
+	var removed int64
+	for _, board := range boards {
+		if _, ok := s.points[board][userID]; ok {
+			delete(s.points[board], userID)
+			removed++
+		}
+	}
+	delete(s.names, userID)
+	return removed, nil
+}
+
+func (s *memoryLeaderboardStore) Delete(ctx context.Context, board string) error {
+	delete(s.points, board)
+	return nil
+}
+
+// memoryLeaderboardArchiveRepo is an in-memory ports.LeaderboardArchiveRepository
+type memoryLeaderboardArchiveRepo struct {
+	archives map[string]*domain.LeaderboardArchive // by board and week
+}
+
+func (r *memoryLeaderboardArchiveRepo) Save(ctx context.Context, archive *domain.LeaderboardArchive) error {
+	if r.archives == nil {
+		r.archives = map[string]*domain.LeaderboardArchive{}
+	}
+	r.archives[archive.Board+":"+archive.Week] = archive
+	return nil
+}
+
+func (r *memoryLeaderboardArchiveRepo) Get(ctx context.Context, board, week string) (*domain.LeaderboardArchive, error) {
+	archive, ok := r.archives[board+":"+week]
+	if !ok {
+		return nil, ports.ErrLeaderboardArchiveNotFound
+	}
+	return archive, nil
+}
+
+func (r *memoryLeaderboardArchiveRepo) RemoveUser(ctx context.Context, userID string) (int64, error) {
+	var removed int64
+	for _, archive := range r.archives {
+		kept := archive.Entries[:0]
+		for _, e := range archive.Entries {
+			if e.UserID != userID {
+				kept = append(kept, e)
+			}
+		}
+		if len(kept) < len(archive.Entries) {
+			removed++
+		}
+		archive.Entries = kept
+	}
+	return removed, nil
+}
+
+var testLeaderboardPolicy = LeaderboardPolicy{CompletionPoints: 10, MaxScorePoints: 10, MaxTop: 50, Neighbours: 1, ArchiveSize: 3}
+
+type leaderboardFixture struct {
+	store    *memoryLeaderboardStore
+	archives *memoryLeaderboardArchiveRepo
+	userRepo *mockUserRepo
+	courses  *mockCourseRepo
+	service  *LeaderboardService
+	n3       primitive.ObjectID // An exercise of an N3 course
+}
+
+func newLeaderboardFixture() *leaderboardFixture {
+	f := &leaderboardFixture{
+		store:    newMemoryLeaderboardStore(),
+		archives: &memoryLeaderboardArchiveRepo{},
+		userRepo: new(mockUserRepo),
+		courses:  new(mockCourseRepo),
+		n3:       primitive.NewObjectID(),
+	}
+	f.courses.On("GetByExerciseID", mock.Anything, f.n3.Hex()).Return(&domain.Course{Level: domain.N3}, nil)
+	f.service = NewLeaderboardService(f.store, f.archives, f.userRepo, &stubKanjiRepo{}, f.courses, testLeaderboardPolicy, zerolog.Nop())
+	return f
+}
+
+func (f *leaderboardFixture) user(name string) *domain.User {
+	user := &domain.User{ID: primitive.NewObjectID(), Name: name, Role: domain.RoleStudent}
+	f.userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	return user
+}
+
+// complete submits n completed syllables for the user
+func (f *leaderboardFixture) complete(t *testing.T, user *domain.User, n int, at time.Time) {
+	for i := 0; i < n; i++ {
+		progress := &domain.Progress{EntityID: primitive.NewObjectID(), EntityType: domain.SyllableEntity, Completed: true}
+		require.NoError(t, f.service.Submit(context.Background(), user.ID.Hex(), progress, at))
+	}
+}
+
+func TestLeaderboardService_Submit(t *testing.T) {
+	f := newLeaderboardFixture()
+	ctx := context.Background()
+	aiko := f.user("Aiko")
+	at := at(t, "2024-05-08T12:00:00Z") // Wednesday of 2024-W19
+
+	exercise := &domain.Progress{EntityID: f.n3, EntityType: domain.ExerciseEntity, Completed: true, Score: 60}
+	require.NoError(t, f.service.Submit(ctx, aiko.ID.Hex(), exercise, at))
+	exercise.Score = 90
+	require.NoError(t, f.service.Submit(ctx, aiko.ID.Hex(), exercise, at))
+	exercise.Score = 40
+	require.NoError(t, f.service.Submit(ctx, aiko.ID.Hex(), exercise, at))
+	f.complete(t, aiko, 1, at)
+
+	for _, board := range []string{"weekly:2024-W19", "all-time"} {
+		top, _ := f.store.Top(ctx, board, 10)
+		require.Len(t, top, 1, board)
+		assert.Equal(t, int64(29), top[0].Score, "the exercise counts once with its best score, plus a syllable")
+		assert.Equal(t, "Aiko", top[0].Name)
+	}
+	n3, _ := f.store.Top(ctx, "all-time-n3", 10)
+	assert.Equal(t, int64(19), n3[0].Score)
+	n5, _ := f.store.Top(ctx, "weekly-n5:2024-W19", 10)
+	assert.Equal(t, int64(10), n5[0].Score)
+
+	assert.Equal(t, (11*24+12)*time.Hour, f.store.ttls["weekly:2024-W19"], "kept until a week after the week ends")
+	assert.Zero(t, f.store.ttls["all-time"])
+
+	// Incomplete progress, guests and users who opted out score nothing
+	require.NoError(t, f.service.Submit(ctx, aiko.ID.Hex(), &domain.Progress{EntityID: primitive.NewObjectID(), EntityType: domain.SyllableEntity}, at))
+	guest := f.user("Guest")
+	guest.Role = domain.RoleGuest
+	f.complete(t, guest, 1, at)
+	private := f.user("Private")
+	private.LeaderboardOptOut = true
+	f.complete(t, private, 1, at)
+
+	top, _ := f.store.Top(ctx, "all-time", 10)
+	assert.Len(t, top, 1)
+	assert.Equal(t, int64(29), top[0].Score)
+}
+
+func TestLeaderboardService_Get(t *testing.T) {
+	f := newLeaderboardFixture()
+	ctx := context.Background()
+	now := time.Now()
+	var users []*domain.User
+	for i, name := range []string{"A", "B", "C", "D", "E"} {
+		user := f.user(name)
+		f.complete(t, user, 5-i, now) // A leads with 50 points
+		users = append(users, user)
+	}
+	outsider := f.user("F")
+
+	standing, err := f.service.Get(ctx, users[3].ID.Hex(), "WEEKLY", "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "weekly", standing.Board)
+	assert.Equal(t, domain.WeekOf(now), standing.Week)
+	assert.False(t, standing.Archived)
+	require.Len(t, standing.Top, 2)
+	assert.Equal(t, "A", standing.Top[0].Name)
+	assert.Equal(t, int64(50), standing.Top[0].Score)
+	require.NotNil(t, standing.Me)
+	assert.Equal(t, int64(4), standing.Me.Rank)
+	assert.Equal(t, []string{"C", "D", "E"}, entryNames(standing.Neighbours))
+
+	standing, err = f.service.Get(ctx, outsider.ID.Hex(), "all-time", "", 10)
+	require.NoError(t, err)
+	assert.Len(t, standing.Top, 5)
+	assert.Nil(t, standing.Me)
+	assert.Empty(t, standing.Neighbours)
+
+	_, err = f.service.Get(ctx, outsider.ID.Hex(), "monthly", "", 10)
+	assert.ErrorIs(t, err, domain.ErrUnknownLeaderboard)
+	_, err = f.service.Get(ctx, outsider.ID.Hex(), "weekly", "", 51)
+	assert.ErrorIs(t, err, ErrInvalidLeaderboardSize)
+	_, err = f.service.Get(ctx, outsider.ID.Hex(), "weekly", "2020-W01", 10)
+	assert.ErrorIs(t, err, ports.ErrLeaderboardArchiveNotFound)
+
+	// Opting out takes the user off every board
+	_, err = f.service.RemoveUser(ctx, users[0].ID.Hex())
+	require.NoError(t, err)
+	standing, err = f.service.Get(ctx, users[1].ID.Hex(), "all-time", "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), standing.Me.Rank)
+}
+
+func TestLeaderboardService_ArchiveWeek(t *testing.T) {
+	f := newLeaderboardFixture()
+	ctx := context.Background()
+	lastWeek := time.Now().AddDate(0, 0, -7)
+	week := domain.WeekOf(lastWeek)
+	var users []*domain.User
+	for i, name := range []string{"A", "B", "C", "D", "E"} {
+		user := f.user(name)
+		f.complete(t, user, 5-i, lastWeek)
+		users = append(users, user)
+	}
+	f.complete(t, users[4], 1, time.Now())
+
+	archived, err := f.service.ArchiveWeek(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, archived, "the global and N5 boards had entries")
+	assert.NotContains(t, f.store.points, "weekly:"+week)
+	assert.Contains(t, f.store.points, "weekly:"+domain.WeekOf(time.Now()), "the current week is left alone")
+	assert.Contains(t, f.store.points, "all-time")
+
+	archived, err = f.service.ArchiveWeek(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, archived)
+
+	// The archive keeps the top 3; those further down see no rank
+	standing, err := f.service.Get(ctx, users[1].ID.Hex(), "weekly", week, 10)
+	require.NoError(t, err)
+	assert.True(t, standing.Archived)
+	assert.Equal(t, []string{"A", "B", "C"}, entryNames(standing.Top))
+	assert.Equal(t, int64(2), standing.Me.Rank)
+	assert.Equal(t, []string{"A", "B", "C"}, entryNames(standing.Neighbours))
+
+	standing, err = f.service.Get(ctx, users[4].ID.Hex(), "weekly", week, 10)
+	require.NoError(t, err)
+	assert.Nil(t, standing.Me)
+
+	// Erasure also removes the user from archives
+	removed, err := f.service.EraseUserData(ctx, users[0].ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), removed, "all-time, all-time-n5 and two archives")
+	standing, _ = f.service.Get(ctx, users[1].ID.Hex(), "weekly", week, 10)
+	assert.Equal(t, []string{"B", "C"}, entryNames(standing.Top))
+}
+
+func entryNames(entries []domain.LeaderboardEntry) []string {
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestLeaderboardWeeks(t *testing.T) {
+	tests := []struct {
+		at      string
+		week    string
+		weekEnd string
+	}{
+		{"2024-05-08T12:00:00Z", "2024-W19", "2024-05-13T00:00:00Z"},
+		{"2024-05-12T23:59:59Z", "2024-W19", "2024-05-13T00:00:00Z"},
+		{"2024-05-13T00:00:00Z", "2024-W20", "2024-05-20T00:00:00Z"},
+		{"2024-05-13T01:00:00+09:00", "2024-W19", "2024-05-13T00:00:00Z"}, // Still Sunday in UTC
+		{"2024-12-30T10:00:00Z", "2025-W01", "2025-01-06T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		ts := at(t, tt.at)
+		assert.Equal(t, tt.week, domain.WeekOf(ts), tt.at)
+		assert.Equal(t, at(t, tt.weekEnd), domain.WeekEnd(ts), tt.at)
+	}
+
+	for name, want := range map[string]domain.Leaderboard{
+		"weekly":      {Period: domain.LeaderboardWeekly},
+		"all-time-N3": {Period: domain.LeaderboardAllTime, Level: domain.N3},
+		"weekly-n1":   {Period: domain.LeaderboardWeekly, Level: domain.N1},
+	} {
+		got, err := domain.ParseLeaderboard(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got, name)
+	}
+	for _, name := range []string{"", "weekly-n6", "weeklyn3", "all-time-"} {
+		_, err := domain.ParseLeaderboard(name)
+		assert.ErrorIs(t, err, domain.ErrUnknownLeaderboard, name)
+	}
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrInvalidUnlockToken = errors.New("invalid or expired unlock token")
+)
+
+// LoginThrottledError is returned while an account or client must wait before trying again
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	// Locked is true for a lockout (N failures reached), false for a progressive delay
+	Locked bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.Locked {
+		return "too many failed login attempts, try again later"
+	}
+	return "too many failed login attempts, slow down"
+}
+
+// LockoutPolicy tunes brute-force protection on password login
+type LockoutPolicy struct {
+	MaxAccountFailures int           // Failures on one account before it is locked
+	MaxIPFailures      int           // Failures from one IP, across accounts, before it is locked
+	FailureWindow      time.Duration // How long failures are remembered
+	LockoutDuration    time.Duration
+	DelayAfter         int           // Failures on one account before delays kick in
+	BaseDelay          time.Duration // First delay, doubled on each further failure
+	MaxDelay           time.Duration
+}
+
+// LoginGuard tracks failed password logins per account and per IP, delays and locks out
+// repeated failures, and lets users unlock their account through an emailed link
+type LoginGuard struct {
+	store     ports.AttemptStore
+	audit     ports.AuditLog
+	userRepo  ports.UserRepository
+	tokenRepo ports.UserTokenRepository
+	mailer    ports.Mailer
+	unlockURL string
+	policy    LockoutPolicy
+	logger    zerolog.Logger
+}
+
+// NewLoginGuard creates a new login guard. unlockURL is the page or app deep link sent in
+// lockout emails; the token is appended as the "token" query parameter.
+func NewLoginGuard(store ports.AttemptStore, audit ports.AuditLog, userRepo ports.UserRepository, tokenRepo ports.UserTokenRepository, mailer ports.Mailer, unlockURL string, policy LockoutPolicy, logger zerolog.Logger) *LoginGuard {
+	return &LoginGuard{
+		store:     store,
+		audit:     audit,
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		mailer:    mailer,
+		unlockURL: unlockURL,
+		policy:    policy,
+		logger:    logger,
+	}
+}
+
+func accountKey(email string) string {
+	return "login:account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// delayKey holds the short progressive delay, separate from the account lockout
+func delayKey(email string) string {
+	return "login:delay:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+// Check returns a *LoginThrottledError if the account or IP may not attempt a login right now.
+// It must be called before checking the password, so locked accounts cannot be brute-forced.
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) error {
+	for _, key := range []string{accountKey(email), ipKey(ip), delayKey(email)} {
+		wait, err := g.store.LockedFor(ctx, key)
+		if err != nil {
+			return err
+		}
+		if wait > 0 {
+			return &LoginThrottledError{RetryAfter: wait, Locked: key != delayKey(email)}
+		}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login and applies the resulting delay or lockout
+func (g *LoginGuard) RecordFailure(ctx context.Context, email, ip string) error {
+	accountFailures, err := g.store.Increment(ctx, accountKey(email), g.policy.FailureWindow)
+	if err != nil {
+		return err
+	}
+	ipFailures, err := g.store.Increment(ctx, ipKey(ip), g.policy.FailureWindow)
+	if err != nil {
+		return err
+	}
+
+	if ipFailures == int64(g.policy.MaxIPFailures) {
+		if err := g.store.Lock(ctx, ipKey(ip), g.policy.LockoutDuration); err != nil {
+			return err
+		}
+		g.logger.Warn().Str("ip", ip).Int64("failures", ipFailures).Msg("IP locked out after failed logins")
+		g.record(ctx, &domain.AuditEvent{
+			Type:    domain.AuditIPLocked,
+			IP:      ip,
+			Details: map[string]string{"failures": strconv.FormatInt(ipFailures, 10), "duration": g.policy.LockoutDuration.String()},
+		})
+	}
+
+	switch {
+	case accountFailures >= int64(g.policy.MaxAccountFailures):
+		if err := g.store.Lock(ctx, accountKey(email), g.policy.LockoutDuration); err != nil {
+			return err
+		}
+		if accountFailures == int64(g.policy.MaxAccountFailures) {
+			g.lockedOut(ctx, email, ip, accountFailures)
+		}
+	case accountFailures > int64(g.policy.DelayAfter):
+		if err := g.store.Lock(ctx, delayKey(email), g.delay(int(accountFailures))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordSuccess clears the account's failure counters after a successful login. The IP
+// counter only expires with its window, or logging into an own account between guesses
+// would keep an IP under its limit forever.
+func (g *LoginGuard) RecordSuccess(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountKey(email), delayKey(email))
+}
+
+// Unlock redeems an unlock token and clears the account's lockout
+func (g *LoginGuard) Unlock(ctx context.Context, token string) error {
+	unlockToken, err := g.tokenRepo.Consume(ctx, domain.AccountUnlockPurpose, hashToken(token), time.Now())
+	if err != nil {
+		if errors.Is(err, ports.ErrTokenInvalid) {
+			return ErrInvalidUnlockToken
+		}
+		return err
+	}
+
+	user, err := g.userRepo.GetByID(ctx, unlockToken.UserID.Hex())
+	if err != nil {
+		return ErrInvalidUnlockToken
+	}
+	if err := g.store.Reset(ctx, accountKey(user.Email), delayKey(user.Email)); err != nil {
+		return err
+	}
+
+	g.logger.Info().Str("user_id", user.ID.Hex()).Msg("Account unlocked by email")
+	g.record(ctx, &domain.AuditEvent{Type: domain.AuditAccountUnlocked, UserID: &user.ID, Email: user.Email})
+	return nil
+}
+
+// delay is the wait imposed after the given number of failures on one account
+func (g *LoginGuard) delay(failures int) time.Duration {
+	d := g.policy.BaseDelay
+	for i := g.policy.DelayAfter + 1; i < failures && d < g.policy.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, g.policy.MaxDelay)
+}
+
+// lockedOut audits a new account lockout and emails the owner an unlock link
+func (g *LoginGuard) lockedOut(ctx context.Context, email, ip string, failures int64) {
+	event := &domain.AuditEvent{
+		Type:    domain.AuditAccountLocked,
+		Email:   email,
+		IP:      ip,
+		Details: map[string]string{"failures": strconv.FormatInt(failures, 10), "duration": g.policy.LockoutDuration.String()},
+	}
+
+	// Unknown emails are locked too, so lockouts do not reveal which accounts exist
+	user, err := g.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		g.logger.Warn().Str("ip", ip).Msg("Unknown account locked out after failed logins")
+		g.record(ctx, event)
+		return
+	}
+	event.UserID = &user.ID
+	g.logger.Warn().Str("user_id", user.ID.Hex()).Str("ip", ip).Msg("Account locked out after failed logins")
+	g.record(ctx, event)
+
+	if err := g.sendUnlockEmail(ctx, user); err != nil {
+		g.logger.Error().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to send unlock email")
+	}
+}
+
+func (g *LoginGuard) sendUnlockEmail(ctx context.Context, user *domain.User) error {
+	if err := g.tokenRepo.DeleteByUser(ctx, user.ID.Hex(), domain.AccountUnlockPurpose); err != nil {
+		return err
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := g.tokenRepo.Create(ctx, &domain.UserToken{
+		UserID:    user.ID,
+		Purpose:   domain.AccountUnlockPurpose,
+		TokenHash: hash,
+		ExpiresAt: now.Add(g.policy.LockoutDuration),
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
+
+	link, err := withToken(g.unlockURL, token)
+	if err != nil {
+		return err
+	}
+	return g.mailer.Send(ctx, ports.Email{
+		To:      user.Email,
+		Subject: "Your Nihongo account has been locked",
+		Body: fmt.Sprintf("Hi %s,\n\nWe locked your account for %s after several failed sign-in attempts. If this was you, open the link below to unlock it now:\n\n%s\n\nIf it was not you, consider resetting your password.\n",
+			user.Name, g.policy.LockoutDuration, link),
+	})
+}
+
+// record writes an audit event; failures are logged rather than failing the login
+func (g *LoginGuard) record(ctx context.Context, event *domain.AuditEvent) {
+	event.CreatedAt = time.Now()
+	if err := g.audit.Record(ctx, event); err != nil {
+		g.logger.Error().Err(err).Str("type", string(event.Type)).Msg("Failed to write audit event")
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+)
+
+// memoryAttemptStore is an in-memory ports.AttemptStore with a controllable clock
+type memoryAttemptStore struct {
+	mu       sync.Mutex
+	now      time.Time
+	counters map[string]int64
+	locks    map[string]time.Time
+}
+
+func newMemoryAttemptStore() *memoryAttemptStore {
+	return &memoryAttemptStore{now: time.Now(), counters: map[string]int64{}, locks: map[string]time.Time{}}
+}
+
+func (s *memoryAttemptStore) Increment(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[key]++
+	return s.counters[key], nil
+}
+
+func (s *memoryAttemptStore) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks[key] = s.now.Add(ttl)
+	return nil
+}
+
+func (s *memoryAttemptStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until, ok := s.locks[key]; ok && until.After(s.now) {
+		return until.Sub(s.now), nil
+	}
+	return 0, nil
+}
+
+func (s *memoryAttemptStore) Reset(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.counters, key)
+		delete(s.locks, key)
+	}
+	return nil
+}
+
+func (s *memoryAttemptStore) advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+// memoryAuditLog records audit events in memory
+type memoryAuditLog struct {
+	mu     sync.Mutex
+	events []*domain.AuditEvent
+}
+
+func (l *memoryAuditLog) Record(ctx context.Context, event *domain.AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+	return nil
+}
+
+func (l *memoryAuditLog) ListByUser(ctx context.Context, userID string) ([]*domain.AuditEvent, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var events []*domain.AuditEvent
+	for _, e := range l.events {
+		if e.UserID != nil && e.UserID.Hex() == userID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (l *memoryAuditLog) AnonymizeUser(ctx context.Context, userID string) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var n int64
+	for _, e := range l.events {
+		if e.UserID != nil && e.UserID.Hex() == userID {
+			e.UserID, e.Email, e.IP = nil, "", ""
+			n++
+		}
+	}
+	return n, nil
+}
+
+func testLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxAccountFailures: 5,
+		MaxIPFailures:      8,
+		FailureWindow:      15 * time.Minute,
+		LockoutDuration:    30 * time.Minute,
+		DelayAfter:         2,
+		BaseDelay:          time.Second,
+		MaxDelay:           4 * time.Second,
+	}
+}
+
+func TestLoginGuard_ProgressiveDelayThenLockout(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID(), Name: "Aiko", Email: "aiko@example.com"}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByEmail", mock.Anything, "aiko@example.com").Return(user, nil)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+
+	store := newMemoryAttemptStore()
+	audit := &memoryAuditLog{}
+	mails := &outbox{}
+	g := NewLoginGuard(store, audit, userRepo, &memoryTokenRepo{}, mails, "https://nihongo.app/unlock", testLockoutPolicy(), zerolog.Nop())
+	ctx := context.Background()
+
+	var delays []time.Duration
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, g.Check(ctx, "Aiko@example.com", "10.0.0.1"), "attempt %d", i)
+		require.NoError(t, g.RecordFailure(ctx, "aiko@example.com", "10.0.0.1"))
+
+		var throttled *LoginThrottledError
+		if err := g.Check(ctx, "aiko@example.com", "10.0.0.1"); errors.As(err, &throttled) {
+			delays = append(delays, throttled.RetryAfter)
+			if i < 5 {
+				assert.False(t, throttled.Locked)
+				store.advance(throttled.RetryAfter)
+			} else {
+				assert.True(t, throttled.Locked)
+			}
+		}
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 30 * time.Minute}, delays)
+
+	// The lockout is audited and the owner gets an unlock link
+	require.Len(t, audit.events, 1)
+	assert.Equal(t, domain.AuditAccountLocked, audit.events[0].Type)
+	assert.Equal(t, user.ID, *audit.events[0].UserID)
+	assert.Equal(t, "10.0.0.1", audit.events[0].IP)
+	require.Len(t, mails.sent, 1)
+
+	// Another IP is locked out of this account as well
+	assert.Error(t, g.Check(ctx, "aiko@example.com", "10.0.0.2"))
+
+	assert.ErrorIs(t, g.Unlock(ctx, "bogus"), ErrInvalidUnlockToken)
+	require.NoError(t, g.Unlock(ctx, linkToken(t, mails.sent[0].Body)))
+	assert.NoError(t, g.Check(ctx, "aiko@example.com", "10.0.0.2"))
+	assert.Equal(t, domain.AuditAccountUnlocked, audit.events[1].Type)
+}
+
+func TestLoginGuard_IPLockoutAcrossAccounts(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByEmail", mock.Anything, mock.Anything).Return((*domain.User)(nil), errors.New("user not found"))
+
+	store := newMemoryAttemptStore()
+	audit := &memoryAuditLog{}
+	g := NewLoginGuard(store, audit, userRepo, &memoryTokenRepo{}, &outbox{}, "https://nihongo.app/unlock", testLockoutPolicy(), zerolog.Nop())
+	ctx := context.Background()
+
+	// Spraying one password over many accounts never trips the per-account limit
+	for i := 0; i < 8; i++ {
+		email := string(rune('a'+i)) + "@example.com"
+		require.NoError(t, g.Check(ctx, email, "10.0.0.9"))
+		require.NoError(t, g.RecordFailure(ctx, email, "10.0.0.9"))
+	}
+
+	var throttled *LoginThrottledError
+	require.ErrorAs(t, g.Check(ctx, "z@example.com", "10.0.0.9"), &throttled)
+	assert.True(t, throttled.Locked)
+	assert.NoError(t, g.Check(ctx, "z@example.com", "10.0.0.10"))
+	require.Len(t, audit.events, 1)
+	assert.Equal(t, domain.AuditIPLocked, audit.events[0].Type)
+}
+
+func TestLoginGuard_SuccessResetsCounters(t *testing.T) {
+	store := newMemoryAttemptStore()
+	g := NewLoginGuard(store, &memoryAuditLog{}, new(mockUserRepo), &memoryTokenRepo{}, &outbox{}, "https://nihongo.app/unlock", testLockoutPolicy(), zerolog.Nop())
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, g.RecordFailure(ctx, "aiko@example.com", "10.0.0.1"))
+	}
+	require.NoError(t, g.RecordSuccess(ctx, "aiko@example.com"))
+
+	// Two more failures are again below the delay threshold
+	for i := 0; i < 2; i++ {
+		require.NoError(t, g.RecordFailure(ctx, "aiko@example.com", "10.0.0.1"))
+	}
+	assert.NoError(t, g.Check(ctx, "aiko@example.com", "10.0.0.1"))
+}
+
+func TestLoginGuard_SuccessKeepsIPCounter(t *testing.T) {
+	store := newMemoryAttemptStore()
+	g := NewLoginGuard(store, &memoryAuditLog{}, new(mockUserRepo), &memoryTokenRepo{}, &outbox{}, "https://nihongo.app/unlock", testLockoutPolicy(), zerolog.Nop())
+	ctx := context.Background()
+
+	// Guessing other accounts' passwords while logging into an own account in between
+	for i := 0; i < testLockoutPolicy().MaxIPFailures; i++ {
+		require.NoError(t, g.RecordFailure(ctx, fmt.Sprintf("victim%d@example.com", i), "10.0.0.1"))
+		require.NoError(t, g.RecordSuccess(ctx, "attacker@example.com"))
+	}
+
+	var throttled *LoginThrottledError
+	require.ErrorAs(t, g.Check(ctx, "victim@example.com", "10.0.0.1"), &throttled)
+	assert.True(t, throttled.Locked)
+}
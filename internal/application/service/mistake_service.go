@@ -0,0 +1,136 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrInvalidWeakItemsSize is returned when more weak items are asked for than are shown
+var ErrInvalidWeakItemsSize = errors.New("invalid number of weak items")
+
+// MistakePolicy tunes which items count as weak
+type MistakePolicy struct {
+	Window        time.Duration // Attempts older than this are not analysed
+	LeechFailures int           // Failures within the window that make an item a leech
+	WeakAccuracy  float64       // Items answered correctly less often than this are weak
+	MinConfusions int           // Times two answers must be mixed up to count as a pair
+	MaxItems      int           // Largest number of items and pairs that can be asked for
+}
+
+// MistakeService keeps every answer learners give and finds what they struggle with:
+// leeches, items failed again and again, weak items and answers they confuse
+type MistakeService struct {
+	attemptLog ports.AttemptLog
+	policy     MistakePolicy
+	logger     zerolog.Logger
+}
+
+// NewMistakeService creates a new mistake service
+func NewMistakeService(attemptLog ports.AttemptLog, policy MistakePolicy, logger zerolog.Logger) *MistakeService {
+	return &MistakeService{
+		attemptLog: attemptLog,
+		policy:     policy,
+		logger:     logger,
+	}
+}
+
+// RecordAttempts logs the answers reported with a progress write
+func (s *MistakeService) RecordAttempts(ctx context.Context, progress *domain.Progress, reports []AttemptReport) error {
+	if len(reports) == 0 {
+		return nil
+	}
+	now := time.Now()
+	attempts := make([]domain.Attempt, len(reports))
+	for i, r := range reports {
+		attempts[i] = domain.Attempt{
+			UserID:         progress.UserID,
+			EntityID:       progress.EntityID,
+			EntityType:     progress.EntityType,
+			Answer:         strings.TrimSpace(r.Answer),
+			Expected:       strings.TrimSpace(r.Expected),
+			Correct:        r.Correct,
+			ResponseTimeMs: r.ResponseTimeMs,
+			CreatedAt:      now,
+		}
+	}
+	return s.attemptLog.Record(ctx, attempts)
+}
+
+// WeakItems returns up to limit of the user's weakest items, leeches first, and the
+// answers they confuse most, of one entity type or of all if it is empty
+func (s *MistakeService) WeakItems(ctx context.Context, userID string, entityType domain.EntityType, limit int) (*domain.WeakItems, error) {
+	if entityType != "" && !entityType.Valid() {
+		return nil, ErrUnknownEntityType
+	}
+	if limit < 1 || limit > s.policy.MaxItems {
+		return nil, ErrInvalidWeakItemsSize
+	}
+
+	since := time.Now().Add(-s.policy.Window)
+	stats, err := s.attemptLog.ItemStats(ctx, userID, entityType, since)
+	if err != nil {
+		return nil, err
+	}
+	confusions, err := s.attemptLog.Confusions(ctx, userID, entityType, since, s.policy.MinConfusions, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []domain.WeakItem{}
+	for _, st := range stats {
+		item := domain.WeakItem{ItemAttempts: st, Accuracy: st.Accuracy(), Leech: st.Failures >= s.policy.LeechFailures}
+		if item.Leech || item.Accuracy < s.policy.WeakAccuracy {
+			items = append(items, item)
+		}
+	}
+	slices.SortFunc(items, func(a, b domain.WeakItem) int {
+		switch {
+		case a.Leech != b.Leech:
+			if a.Leech {
+				return -1
+			}
+			return 1
+		case a.Failures != b.Failures:
+			return cmp.Compare(b.Failures, a.Failures)
+		case a.Accuracy != b.Accuracy:
+			return cmp.Compare(a.Accuracy, b.Accuracy)
+		}
+		return b.LastAttemptAt.Compare(a.LastAttemptAt)
+	})
+
+	return &domain.WeakItems{
+		Items:      items[:min(limit, len(items))],
+		Confusions: confusions,
+		Since:      since,
+	}, nil
+}
+
+// PersonalDataName implements PersonalDataStore
+func (s *MistakeService) PersonalDataName() string {
+	return "attempts"
+}
+
+// ExportUserData implements PersonalDataStore
+func (s *MistakeService) ExportUserData(ctx context.Context, userID string) (any, error) {
+	return s.attemptLog.ListByUser(ctx, userID)
+}
+
+// EraseUserData implements PersonalDataStore
+func (s *MistakeService) EraseUserData(ctx context.Context, userID string) (int64, error) {
+	return s.attemptLog.DeleteByUser(ctx, userID)
+}
+
+// MergeUserData implements GuestDataMerger: the guest's attempts move to the account
+func (s *MistakeService) MergeUserData(ctx context.Context, guestID, targetID string) error {
+	_, err := s.attemptLog.Reassign(ctx, guestID, targetID)
+	return err
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+)
+
+// memoryAttemptLog is an in-memory ports.AttemptLog with the same analyses
+type memoryAttemptLog struct {
+	attempts []domain.Attempt
+}
+
+func (l *memoryAttemptLog) Record(ctx context.Context, attempts []domain.Attempt) error {
+	for _, a := range attempts {
+		a.ID = primitive.NewObjectID()
+		l.attempts = append(l.attempts, a)
+	}
+	return nil
+}
+
+func (l *memoryAttemptLog) since(userID string, entityType domain.EntityType, since time.Time) []domain.Attempt {
+	var attempts []domain.Attempt
+	for _, a := range l.attempts {
+		if a.UserID.Hex() == userID && (entityType == "" || a.EntityType == entityType) && !a.CreatedAt.Before(since) {
+			attempts = append(attempts, a)
+		}
+	}
+	return attempts
+}
+
+func (l *memoryAttemptLog) ItemStats(ctx context.Context, userID string, entityType domain.EntityType, since time.Time) ([]domain.ItemAttempts, error) {
+	byEntity := map[primitive.ObjectID]*domain.ItemAttempts{}
+	totalTime := map[primitive.ObjectID]int{}
+	for _, a := range l.since(userID, entityType, since) {
+		st, ok := byEntity[a.EntityID]
+		if !ok {
+			st = &domain.ItemAttempts{EntityID: a.EntityID, EntityType: a.EntityType}
+			byEntity[a.EntityID] = st
+		}
+		st.Attempts++
+		if !a.Correct {
+			st.Failures++
+		}
+		st.Expected = a.Expected
+		st.LastCorrect = a.Correct
+		st.LastAttemptAt = a.CreatedAt
+		totalTime[a.EntityID] += a.ResponseTimeMs
+	}
+
+	stats := []domain.ItemAttempts{}
+	for id, st := range byEntity {
+		if st.Failures > 0 {
+			st.AvgResponseTimeMs = totalTime[id] / st.Attempts
+			stats = append(stats, *st)
+		}
+	}
+	return stats, nil
+}
+
+func (l *memoryAttemptLog) Confusions(ctx context.Context, userID string, entityType domain.EntityType, since time.Time, minCount, limit int) ([]domain.ConfusionPair, error) {
+	counts := map[domain.ConfusionPair]int{}
+	for _, a := range l.since(userID, entityType, since) {
+		if a.Correct || a.Answer == "" || a.Answer == a.Expected {
+			continue
+		}
+		pair := domain.ConfusionPair{EntityType: a.EntityType, A: min(a.Answer, a.Expected), B: max(a.Answer, a.Expected)}
+		counts[pair]++
+	}
+
+	pairs := []domain.ConfusionPair{}
+	for pair, count := range counts {
+		if count >= minCount {
+			pair.Count = count
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Count != pairs[j].Count {
+			return pairs[i].Count > pairs[j].Count
+		}
+		return pairs[i].A < pairs[j].A
+	})
+	return pairs[:min(limit, len(pairs))], nil
+}
+
+func (l *memoryAttemptLog) DailyStats(ctx context.Context, userID string, loc *time.Location, from, to string) ([]domain.AttemptDay, error) {
+	attempts := l.since(userID, "", time.Time{})
+	sort.SliceStable(attempts, func(i, j int) bool { return attempts[i].CreatedAt.Before(attempts[j].CreatedAt) })
+
+	firstDay := map[primitive.ObjectID]string{}
+	answeredOn := map[string]map[primitive.ObjectID]bool{}
+	byDay := map[string]*domain.AttemptDay{}
+	for _, a := range attempts {
+		day := domain.DayIn(a.CreatedAt, loc)
+		if day > to {
+			continue
+		}
+		if _, ok := firstDay[a.EntityID]; !ok {
+			firstDay[a.EntityID] = day
+		}
+		if day < from {
+			continue
+		}
+		d, ok := byDay[day]
+		if !ok {
+			d = &domain.AttemptDay{Day: day}
+			byDay[day] = d
+			answeredOn[day] = map[primitive.ObjectID]bool{}
+		}
+		d.Attempts++
+		if a.Correct {
+			d.Correct++
+		}
+		if firstDay[a.EntityID] < day && !answeredOn[day][a.EntityID] {
+			d.Reviews++
+			if a.Correct {
+				d.Retained++
+			}
+		}
+		answeredOn[day][a.EntityID] = true
+	}
+
+	days := []domain.AttemptDay{}
+	for _, d := range byDay {
+		days = append(days, *d)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+	return days, nil
+}
+
+func (l *memoryAttemptLog) ListByUser(ctx context.Context, userID string) ([]domain.Attempt, error) {
+	return l.since(userID, "", time.Time{}), nil
+}
+
+func (l *memoryAttemptLog) Reassign(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	to, _ := primitive.ObjectIDFromHex(toUserID)
+	var moved int64
+	for i, a := range l.attempts {
+		if a.UserID.Hex() == fromUserID {
+			l.attempts[i].UserID = to
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+func (l *memoryAttemptLog) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	kept := l.attempts[:0]
+	for _, a := range l.attempts {
+		if a.UserID.Hex() != userID {
+			kept = append(kept, a)
+		}
+	}
+	removed := int64(len(l.attempts) - len(kept))
+	l.attempts = kept
+	return removed, nil
+}
+
+var testMistakePolicy = MistakePolicy{Window: 30 * 24 * time.Hour, LeechFailures: 4, WeakAccuracy: 0.8, MinConfusions: 2, MaxItems: 10}
+
+// answer records one attempt per answer given on the syllable; an answer equal to the
+// expected one is correct
+func answer(t *testing.T, s *MistakeService, userID, syllableID primitive.ObjectID, expected string, answers ...string) {
+	progress := &domain.Progress{UserID: userID, EntityID: syllableID, EntityType: domain.SyllableEntity}
+	for _, a := range answers {
+		report := AttemptReport{Answer: a, Expected: expected, Correct: a == expected, ResponseTimeMs: 1200}
+		require.NoError(t, s.RecordAttempts(context.Background(), progress, []AttemptReport{report}))
+	}
+}
+
+func TestMistakeService_WeakItems(t *testing.T) {
+	log := &memoryAttemptLog{}
+	s := NewMistakeService(log, testMistakePolicy, zerolog.Nop())
+	ctx := context.Background()
+	userID := primitive.NewObjectID()
+	shi, tsu, so, n, a, ka := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	answer(t, s, userID, shi, "シ", "ツ", "ツ", "シ", "ツ", "ツ", "シ")              // Failed 4 times: a leech
+	answer(t, s, userID, tsu, "ツ", "シ", "ツ")                                  // Half right
+	answer(t, s, userID, so, "ソ", "ン", "ソ", "ソ", "ソ", "ソ")                    // 80% right: not weak
+	answer(t, s, userID, n, "ン", "ソ", "ソ", "ン")                               // A third right
+	answer(t, s, userID, a, "ア", "ア", "ア")                                    // Never failed
+	answer(t, s, userID, ka, "カ", "", "カ", "カ", "カ", "カ", "カ", "カ", "カ", "カ") // Skipped once, 90% right
+
+	// An old failure falls outside the window
+	log.attempts = append(log.attempts, domain.Attempt{UserID: userID, EntityID: a, EntityType: domain.SyllableEntity, Answer: "マ", Expected: "ア", CreatedAt: time.Now().AddDate(0, -2, 0)})
+
+	weak, err := s.WeakItems(ctx, userID.Hex(), "", 10)
+	require.NoError(t, err)
+	require.Len(t, weak.Items, 3)
+	assert.Equal(t, shi, weak.Items[0].EntityID)
+	assert.True(t, weak.Items[0].Leech)
+	assert.Equal(t, 4, weak.Items[0].Failures)
+	assert.Equal(t, 6, weak.Items[0].Attempts)
+	assert.InDelta(t, 1.0/3, weak.Items[0].Accuracy, 0.001)
+	assert.True(t, weak.Items[0].LastCorrect)
+	assert.Equal(t, "シ", weak.Items[0].Expected)
+	assert.Equal(t, 1200, weak.Items[0].AvgResponseTimeMs)
+	assert.Equal(t, n, weak.Items[1].EntityID, "two failures rank above one")
+	assert.False(t, weak.Items[1].Leech)
+	assert.Equal(t, tsu, weak.Items[2].EntityID)
+
+	// シ/ツ is confused in both directions; a blank answer is no confusion
+	require.Len(t, weak.Confusions, 2)
+	assert.Equal(t, domain.ConfusionPair{EntityType: domain.SyllableEntity, A: "シ", B: "ツ", Count: 5}, weak.Confusions[0])
+	assert.Equal(t, domain.ConfusionPair{EntityType: domain.SyllableEntity, A: "ソ", B: "ン", Count: 3}, weak.Confusions[1])
+
+	weak, err = s.WeakItems(ctx, userID.Hex(), domain.SyllableEntity, 1)
+	require.NoError(t, err)
+	assert.Len(t, weak.Items, 1)
+	assert.Len(t, weak.Confusions, 1)
+
+	weak, err = s.WeakItems(ctx, userID.Hex(), domain.KanjiEntity, 10)
+	require.NoError(t, err)
+	assert.Empty(t, weak.Items)
+	assert.Empty(t, weak.Confusions)
+
+	_, err = s.WeakItems(ctx, userID.Hex(), "verb", 10)
+	assert.ErrorIs(t, err, ErrUnknownEntityType)
+	_, err = s.WeakItems(ctx, userID.Hex(), "", 11)
+	assert.ErrorIs(t, err, ErrInvalidWeakItemsSize)
+}
+
+func TestMistakeService_UserData(t *testing.T) {
+	log := &memoryAttemptLog{}
+	s := NewMistakeService(log, testMistakePolicy, zerolog.Nop())
+	ctx := context.Background()
+	guestID, userID := primitive.NewObjectID(), primitive.NewObjectID()
+	answer(t, s, guestID, primitive.NewObjectID(), "シ", "ツ", " シ ")
+
+	require.NoError(t, s.MergeUserData(ctx, guestID.Hex(), userID.Hex()))
+	require.NoError(t, s.MergeUserData(ctx, guestID.Hex(), userID.Hex()))
+	exported, err := s.ExportUserData(ctx, userID.Hex())
+	require.NoError(t, err)
+	attempts := exported.([]domain.Attempt)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, "シ", attempts[1].Answer, "answers are trimmed")
+
+	removed, err := s.EraseUserData(ctx, userID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), removed)
+}
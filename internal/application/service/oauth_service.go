@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// reauthMaxAge is how recently an ID token must have been issued to confirm a sensitive change
+	reauthMaxAge = 10 * time.Minute
+)
+
+var (
+	ErrUnknownProvider         = errors.New("unknown identity provider")
+	ErrIdentityEmailUnverified = errors.New("identity provider did not share a verified email")
+	ErrReauthenticationFailed  = errors.New("could not confirm your identity, sign in again")
+)
+
+// OAuthService signs users in with ID tokens from external identity providers
+type OAuthService struct {
+	userRepo   ports.UserRepository
+	verifiers  map[string]ports.IdentityVerifier
+	unverified UnverifiedAccess
+	logger     zerolog.Logger
+}
+
+// NewOAuthService creates a new OAuth service; verifiers are keyed by provider name
+func NewOAuthService(userRepo ports.UserRepository, verifiers map[string]ports.IdentityVerifier, unverified UnverifiedAccess, logger zerolog.Logger) *OAuthService {
+	return &OAuthService{
+		userRepo:   userRepo,
+		verifiers:  verifiers,
+		unverified: unverified,
+		logger:     logger,
+	}
+}
+
+// SignIn verifies idToken and returns the user linked to that provider account. Unknown
+// accounts are linked to the user with the same verified email, or get a new user. name
+// is only used for new users, since Apple sends the name to the app but not in the token.
+func (s *OAuthService) SignIn(ctx context.Context, provider, idToken, name string) (*domain.User, error) {
+	verifier, ok := s.verifiers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	identity, err := verifier.Verify(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByIdentity(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		user, err = s.linkOrCreate(ctx, identity, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !user.EmailVerified && s.unverified == UnverifiedNoAccess {
+		return nil, ErrEmailNotVerified
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Str("provider", provider).Msg("User signed in with identity provider")
+	return user, nil
+}
+
+// Reauthenticate checks that idToken was just issued for a provider account linked to
+// user. It lets accounts that sign in through a provider, and so have no password they
+// know, confirm sensitive changes.
+func (s *OAuthService) Reauthenticate(ctx context.Context, user *domain.User, provider, idToken string) error {
+	verifier, ok := s.verifiers[provider]
+	if !ok {
+		return ErrReauthenticationFailed
+	}
+
+	identity, err := verifier.Verify(ctx, idToken)
+	if err != nil {
+		if errors.Is(err, ports.ErrInvalidIDToken) {
+			return ErrReauthenticationFailed
+		}
+		return err
+	}
+	if !user.HasIdentity(identity.Provider, identity.Subject) {
+		s.logger.Warn().Str("user_id", user.ID.Hex()).Str("provider", provider).Msg("Reauthentication with an identity that is not linked")
+		return ErrReauthenticationFailed
+	}
+	// A token kept from an earlier sign-in does not prove the owner is here now
+	if time.Since(identity.IssuedAt) > reauthMaxAge {
+		return ErrReauthenticationFailed
+	}
+	return nil
+}
+
+func (s *OAuthService) linkOrCreate(ctx context.Context, identity *ports.VerifiedIdentity, name string) (*domain.User, error) {
+	// Only a verified email proves the provider account and ours belong to the same person
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrIdentityEmailUnverified
+	}
+
+	now := time.Now()
+	linked := domain.Identity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		LinkedAt: now,
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, identity.Email)
+	if err == nil {
+		if !user.EmailVerified {
+			// Whoever set the current password never proved they own this email, so it
+			// must not keep working once the real owner signs in
+			password, err := randomPasswordHash()
+			if err != nil {
+				return nil, err
+			}
+			user.Password = password
+			user.EmailVerified = true
+			user.EmailVerifiedAt = &now
+		}
+		user.Identities = append(user.Identities, linked)
+		user.UpdatedAt = now
+		if err := s.userRepo.Update(ctx, user); err != nil {
+			return nil, err
+		}
+		s.logger.Info().Str("user_id", user.ID.Hex()).Str("provider", identity.Provider).Msg("Identity linked to existing user")
+		return user, nil
+	}
+
+	password, err := randomPasswordHash()
+	if err != nil {
+		return nil, err
+	}
+	user = &domain.User{
+		Name:            displayName(name, identity),
+		Email:           identity.Email,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+		Password:        password,
+		Role:            domain.RoleStudent,
+		Identities:      []domain.Identity{linked},
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	s.logger.Info().Str("user_id", user.ID.Hex()).Str("provider", identity.Provider).Msg("User created from identity provider")
+	return user, nil
+}
+
+// randomPasswordHash returns the hash of a password nobody knows, for accounts that sign in
+// through a provider; the owner can still set one with the password reset flow
+func randomPasswordHash() (string, error) {
+	password, _, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func displayName(name string, identity *ports.VerifiedIdentity) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+	if identity.Name != "" {
+		return identity.Name
+	}
+	return strings.SplitN(identity.Email, "@", 2)[0]
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// stubVerifier accepts a fixed token and returns a fixed identity
+type stubVerifier struct {
+	token    string
+	identity ports.VerifiedIdentity
+}
+
+func (v stubVerifier) Verify(ctx context.Context, idToken string) (*ports.VerifiedIdentity, error) {
+	if idToken != v.token {
+		return nil, ports.ErrInvalidIDToken
+	}
+	identity := v.identity
+	return &identity, nil
+}
+
+func googleVerifier(email string, verified bool) map[string]ports.IdentityVerifier {
+	return map[string]ports.IdentityVerifier{
+		"google": stubVerifier{token: "good", identity: ports.VerifiedIdentity{
+			Provider: "google", Subject: "g-123", Email: email, EmailVerified: verified, Name: "Aiko Tanaka",
+		}},
+	}
+}
+
+func TestOAuthService_SignIn_LinkedIdentity(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID(), EmailVerified: true}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByIdentity", mock.Anything, "google", "g-123").Return(user, nil)
+
+	s := NewOAuthService(userRepo, googleVerifier("aiko@example.com", true), UnverifiedNoAccess, zerolog.Nop())
+
+	got, err := s.SignIn(context.Background(), "google", "good", "")
+	require.NoError(t, err)
+	assert.Same(t, user, got)
+
+	_, err = s.SignIn(context.Background(), "google", "forged", "")
+	assert.ErrorIs(t, err, ports.ErrInvalidIDToken)
+	_, err = s.SignIn(context.Background(), "github", "good", "")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestOAuthService_SignIn_LinksByVerifiedEmail(t *testing.T) {
+	existing := &domain.User{
+		ID:         primitive.NewObjectID(),
+		Email:      "aiko@example.com",
+		Password:   "set-by-someone-else",
+		Identities: []domain.Identity{{Provider: "apple", Subject: "a-1"}},
+	}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByIdentity", mock.Anything, "google", "g-123").Return((*domain.User)(nil), errors.New("user not found"))
+	userRepo.On("GetByEmail", mock.Anything, "aiko@example.com").Return(existing, nil)
+	userRepo.On("Update", mock.Anything, existing).Return(nil).Once()
+
+	s := NewOAuthService(userRepo, googleVerifier("aiko@example.com", true), UnverifiedFreeAccess, zerolog.Nop())
+
+	got, err := s.SignIn(context.Background(), "google", "good", "")
+	require.NoError(t, err)
+	assert.True(t, got.HasIdentity("apple", "a-1"))
+	assert.True(t, got.HasIdentity("google", "g-123"))
+	assert.True(t, got.EmailVerified)
+	assert.NotEqual(t, "set-by-someone-else", got.Password, "an unproven password must stop working")
+	userRepo.AssertExpectations(t)
+}
+
+func TestOAuthService_SignIn_CreatesUser(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByIdentity", mock.Anything, "google", "g-123").Return((*domain.User)(nil), errors.New("user not found"))
+	userRepo.On("GetByEmail", mock.Anything, "aiko@example.com").Return((*domain.User)(nil), errors.New("user not found"))
+	userRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(nil).Once()
+
+	s := NewOAuthService(userRepo, googleVerifier("aiko@example.com", true), UnverifiedNoAccess, zerolog.Nop())
+
+	got, err := s.SignIn(context.Background(), "google", "good", "")
+	require.NoError(t, err)
+	assert.Equal(t, "Aiko Tanaka", got.Name)
+	assert.Equal(t, domain.RoleStudent, got.Role)
+	assert.True(t, got.EmailVerified)
+	assert.True(t, got.HasIdentity("google", "g-123"))
+	userRepo.AssertExpectations(t)
+}
+
+func TestOAuthService_SignIn_RequiresVerifiedEmail(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByIdentity", mock.Anything, "google", "g-123").Return((*domain.User)(nil), errors.New("user not found"))
+
+	s := NewOAuthService(userRepo, googleVerifier("aiko@example.com", false), UnverifiedFreeAccess, zerolog.Nop())
+
+	_, err := s.SignIn(context.Background(), "google", "good", "")
+	assert.ErrorIs(t, err, ErrIdentityEmailUnverified)
+	userRepo.AssertNotCalled(t, "GetByEmail", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrWeakPassword      = errors.New("password must be at least 8 characters")
+)
+
+// minPasswordLength matches the validate tag on domain.User.Password
+const minPasswordLength = 8
+
+// PasswordResetService handles the forgot/reset password flow
+type PasswordResetService struct {
+	userRepo  ports.UserRepository
+	tokenRepo ports.UserTokenRepository
+	mailer    ports.Mailer
+	sessions  SessionRevoker
+	resetURL  string
+	tokenTTL  time.Duration
+	cooldown  time.Duration
+	logger    zerolog.Logger
+}
+
+// NewPasswordResetService creates a new password reset service. resetURL is the page or
+// app deep link the email points to; the token is appended as the "token" query parameter.
+// No new link is sent while one issued less than cooldown ago is unused. A reset logs the
+// user out of every device.
+func NewPasswordResetService(userRepo ports.UserRepository, tokenRepo ports.UserTokenRepository, mailer ports.Mailer, sessions SessionRevoker, resetURL string, tokenTTL, cooldown time.Duration, logger zerolog.Logger) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		mailer:    mailer,
+		sessions:  sessions,
+		resetURL:  resetURL,
+		tokenTTL:  tokenTTL,
+		cooldown:  cooldown,
+		logger:    logger,
+	}
+}
+
+// RequestReset emails a reset link if an account exists for email. It reports success
+// either way so callers cannot use it to discover registered emails.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		s.logger.Info().Msg("Password reset requested for unknown email")
+		return nil
+	}
+
+	// Repeated requests must not flood the inbox; the link already sent still works
+	now := time.Now()
+	recent, err := s.tokenRepo.IssuedSince(ctx, user.ID.Hex(), domain.PasswordResetPurpose, now.Add(-s.cooldown))
+	if err != nil {
+		return err
+	}
+	if recent {
+		s.logger.Info().Str("user_id", user.ID.Hex()).Msg("Password reset requested again within cooldown")
+		return nil
+	}
+
+	// Only the most recent link stays valid
+	if err := s.tokenRepo.DeleteByUser(ctx, user.ID.Hex(), domain.PasswordResetPurpose); err != nil {
+		return err
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	if err := s.tokenRepo.Create(ctx, &domain.UserToken{
+		UserID:    user.ID,
+		Purpose:   domain.PasswordResetPurpose,
+		TokenHash: hash,
+		ExpiresAt: now.Add(s.tokenTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return err
+	}
+
+	link, err := withToken(s.resetURL, token)
+	if err != nil {
+		return err
+	}
+	err = s.mailer.Send(ctx, ports.Email{
+		To:      user.Email,
+		Subject: "Reset your Nihongo password",
+		Body: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your password. Open the link below to choose a new one:\n\n%s\n\nThe link expires in %s and can only be used once. If you did not ask for this, you can ignore this email.\n",
+			user.Name, link, s.tokenTTL),
+	})
+	if err != nil {
+		// Not surfaced to the client: the response must look the same for unknown emails
+		s.logger.Error().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to send password reset email")
+		return nil
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Msg("Password reset email sent")
+	return nil
+}
+
+// ResetPassword exchanges a reset token for a new password
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if len(newPassword) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	resetToken, err := s.tokenRepo.Consume(ctx, domain.PasswordResetPurpose, hashToken(token), time.Now())
+	if err != nil {
+		if errors.Is(err, ports.ErrTokenInvalid) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, resetToken.UserID.Hex())
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user.Password = string(hashedPassword)
+	// The reset link was sent to the address, so using it proves the user owns it
+	if !user.EmailVerified {
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+	}
+	user.UpdatedAt = now
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+	// Whoever knew the old password may still be logged in somewhere
+	if err := s.sessions.RevokeAll(ctx, user.ID.Hex(), ""); err != nil {
+		return err
+	}
+
+	if err := s.tokenRepo.DeleteByUser(ctx, user.ID.Hex(), domain.PasswordResetPurpose); err != nil {
+		s.logger.Warn().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to clean up reset tokens")
+	}
+	s.logger.Info().Str("user_id", user.ID.Hex()).Msg("Password reset")
+	return nil
+}
+
+// withToken appends the token as a query parameter to base
+func withToken(base, token string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid link base URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
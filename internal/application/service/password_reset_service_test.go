@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// memoryTokenRepo is an in-memory ports.UserTokenRepository
+type memoryTokenRepo struct {
+	mu     sync.Mutex
+	tokens []*domain.UserToken
+}
+
+func (r *memoryTokenRepo) Create(ctx context.Context, token *domain.UserToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token.ID = primitive.NewObjectID()
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *memoryTokenRepo) Consume(ctx context.Context, purpose domain.TokenPurpose, tokenHash string, now time.Time) (*domain.UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.Purpose == purpose && t.TokenHash == tokenHash && t.UsedAt == nil && now.Before(t.ExpiresAt) {
+			t.UsedAt = &now
+			return t, nil
+		}
+	}
+	return nil, ports.ErrTokenInvalid
+}
+
+func (r *memoryTokenRepo) DeleteByUser(ctx context.Context, userID string, purpose domain.TokenPurpose) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.tokens[:0]
+	for _, t := range r.tokens {
+		if t.UserID.Hex() != userID || t.Purpose != purpose {
+			kept = append(kept, t)
+		}
+	}
+	r.tokens = kept
+	return nil
+}
+
+func (r *memoryTokenRepo) IssuedSince(ctx context.Context, userID string, purpose domain.TokenPurpose, since time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.tokens {
+		if t.UserID.Hex() == userID && t.Purpose == purpose && t.UsedAt == nil && !t.CreatedAt.Before(since) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// outbox is a ports.Mailer that records sent emails
+type outbox struct {
+	mu   sync.Mutex
+	sent []ports.Email
+	err  error
+}
+
+func (o *outbox) Send(ctx context.Context, email ports.Email) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return o.err
+	}
+	o.sent = append(o.sent, email)
+	return nil
+}
+
+// linkToken extracts the token query parameter from the first link in an email body
+func linkToken(t *testing.T, body string) string {
+	t.Helper()
+	link := regexp.MustCompile(`\S+\?token=\S+`).FindString(body)
+	require.NotEmpty(t, link, "email has no link")
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	return u.Query().Get("token")
+}
+
+func TestPasswordResetService_Flow(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID(), Name: "Aiko", Email: "aiko@example.com", Password: "old-hash"}
+
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByEmail", mock.Anything, "aiko@example.com").Return(user, nil)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("Update", mock.Anything, user).Return(nil).Once()
+
+	tokens := &memoryTokenRepo{}
+	mails := &outbox{}
+	sessions := NewSessionService(newMemorySessionRepo(), time.Hour, zerolog.Nop())
+	loggedInTwice(t, sessions, user)
+	s := NewPasswordResetService(userRepo, tokens, mails, sessions, "https://nihongo.app/reset", time.Hour, 0, zerolog.Nop())
+
+	// Requesting twice only keeps the latest link valid
+	require.NoError(t, s.RequestReset(context.Background(), "aiko@example.com"))
+	require.NoError(t, s.RequestReset(context.Background(), "aiko@example.com"))
+	require.Len(t, mails.sent, 2)
+	assert.Equal(t, "aiko@example.com", mails.sent[1].To)
+	first, latest := linkToken(t, mails.sent[0].Body), linkToken(t, mails.sent[1].Body)
+	require.Len(t, tokens.tokens, 1)
+	assert.NotEqual(t, latest, tokens.tokens[0].TokenHash, "only the hash may be stored")
+
+	assert.ErrorIs(t, s.ResetPassword(context.Background(), first, "new-password"), ErrInvalidResetToken)
+	assert.ErrorIs(t, s.ResetPassword(context.Background(), latest, "short"), ErrWeakPassword)
+
+	require.NoError(t, s.ResetPassword(context.Background(), latest, "new-password"))
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("new-password")))
+	assert.Empty(t, activeSessionIDs(t, sessions, user.ID.Hex()), "a reset logs out every device")
+	// Following the emailed link proves the address
+	assert.True(t, user.EmailVerified)
+	assert.NotNil(t, user.EmailVerifiedAt)
+
+	// Tokens are single use
+	assert.ErrorIs(t, s.ResetPassword(context.Background(), latest, "another-password"), ErrInvalidResetToken)
+	userRepo.AssertExpectations(t)
+}
+
+func TestPasswordResetService_Cooldown(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID(), Email: "aiko@example.com"}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+
+	tokens := &memoryTokenRepo{}
+	mails := &outbox{}
+	s := NewPasswordResetService(userRepo, tokens, mails, nil, "https://nihongo.app/reset", time.Hour, 5*time.Minute, zerolog.Nop())
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.RequestReset(context.Background(), user.Email))
+	}
+	require.Len(t, mails.sent, 1, "repeated requests send a single email")
+
+	tokens.tokens[0].CreatedAt = tokens.tokens[0].CreatedAt.Add(-6 * time.Minute)
+	require.NoError(t, s.RequestReset(context.Background(), user.Email))
+	assert.Len(t, mails.sent, 2)
+}
+
+func TestPasswordResetService_DoesNotRevealUnknownEmails(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByEmail", mock.Anything, "ghost@example.com").Return((*domain.User)(nil), errors.New("user not found"))
+
+	mails := &outbox{}
+	s := NewPasswordResetService(userRepo, &memoryTokenRepo{}, mails, nil, "https://nihongo.app/reset", time.Hour, 0, zerolog.Nop())
+
+	assert.NoError(t, s.RequestReset(context.Background(), "ghost@example.com"))
+	assert.Empty(t, mails.sent)
+}
+
+func TestPasswordResetService_ExpiredToken(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID(), Email: "aiko@example.com"}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+
+	tokens := &memoryTokenRepo{}
+	mails := &outbox{}
+	s := NewPasswordResetService(userRepo, tokens, mails, nil, "nihongo://reset-password", -time.Minute, 0, zerolog.Nop())
+
+	require.NoError(t, s.RequestReset(context.Background(), user.Email))
+	assert.ErrorIs(t, s.ResetPassword(context.Background(), linkToken(t, mails.sent[0].Body), "new-password"), ErrInvalidResetToken)
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+)
+
+// ReceiptChainStatus is the result of checking the erasure receipt chain
+type ReceiptChainStatus struct {
+	Valid    bool `json:"valid"`
+	Receipts int  `json:"receipts"`
+	// BrokenAt is the sequence of the first receipt that does not match its hash or link
+	BrokenAt int64 `json:"broken_at,omitempty"`
+}
+
+// PersonalDataStore is personal data kept by a feature outside the core collections. Stores
+// are included in data exports and erased with the account.
+type PersonalDataStore interface {
+	// PersonalDataName names the store in exports (<name>.json) and erasure receipts
+	PersonalDataName() string
+	ExportUserData(ctx context.Context, userID string) (any, error)
+	// EraseUserData removes the user's data and returns how many records were removed
+	EraseUserData(ctx context.Context, userID string) (int64, error)
+}
+
+// PrivacyService answers data protection requests: it exports everything stored about a
+// user and erases it when their account is deleted
+type PrivacyService struct {
+	userRepo     ports.UserRepository
+	progressRepo ports.ProgressRepository
+	subRepo      ports.SubscriptionRepository
+	sessionRepo  ports.SessionRepository
+	audit        ports.AuditLog
+	receipts     ports.ErasureReceiptRepository
+	stores       []PersonalDataStore
+	logger       zerolog.Logger
+}
+
+// NewPrivacyService creates a new privacy service
+func NewPrivacyService(userRepo ports.UserRepository, progressRepo ports.ProgressRepository, subRepo ports.SubscriptionRepository, sessionRepo ports.SessionRepository, audit ports.AuditLog, receipts ports.ErasureReceiptRepository, logger zerolog.Logger) *PrivacyService {
+	return &PrivacyService{
+		userRepo:     userRepo,
+		progressRepo: progressRepo,
+		subRepo:      subRepo,
+		sessionRepo:  sessionRepo,
+		audit:        audit,
+		receipts:     receipts,
+		logger:       logger,
+	}
+}
+
+// AddStore registers another personal data store; call it before serving requests
+func (s *PrivacyService) AddStore(store PersonalDataStore) {
+	s.stores = append(s.stores, store)
+}
+
+// Export writes a ZIP archive with one JSON file per kind of data held about the user
+func (s *PrivacyService) Export(ctx context.Context, userID string, w io.Writer) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	progress, err := s.progressRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	subs, err := s.subRepo.GetByInternalUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	sessions, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	events, err := s.audit.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"export.json", map[string]any{"user_id": userID, "exported_at": time.Now().UTC()}},
+		{"user.json", user},
+		{"progress.json", progress},
+		{"subscriptions.json", subs},
+		{"sessions.json", sessions},
+		{"security_events.json", events},
+	}
+	for _, store := range s.stores {
+		data, err := store.ExportUserData(ctx, userID)
+		if err != nil {
+			return err
+		}
+		files = append(files, struct {
+			name string
+			data any
+		}{store.PersonalDataName() + ".json", data})
+	}
+	for _, f := range files {
+		fw, err := archive.Create(f.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	s.logger.Info().Str("user_id", userID).Msg("Personal data exported")
+	return nil
+}
+
+// Erase removes a user's personal data: progress is deleted, subscriptions are kept as
+// financial records but unlinked from the user, sessions are deleted, security events are
+// anonymised, registered stores are erased and the account itself is deleted. A receipt is added to the erasure chain
+// before the account goes, so an interrupted erasure is retried rather than lost.
+func (s *PrivacyService) Erase(ctx context.Context, user *domain.User) (*domain.ErasureReceipt, error) {
+	userID := user.ID.Hex()
+
+	progressDeleted, err := s.progressRepo.DeleteByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	detached, err := s.subRepo.DetachInternalUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.sessionRepo.DeleteByUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	anonymized, err := s.audit.AnonymizeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var otherDeleted map[string]int64
+	for _, store := range s.stores {
+		deleted, err := store.EraseUserData(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if otherDeleted == nil {
+			otherDeleted = make(map[string]int64, len(s.stores))
+		}
+		otherDeleted[store.PersonalDataName()] = deleted
+	}
+
+	// A previous run may have sealed the receipt and then failed to delete the user; the
+	// subject keeps that one receipt
+	receipt, err := s.receipts.GetBySubject(ctx, domain.SubjectHash(userID))
+	if err != nil {
+		return nil, err
+	}
+	if receipt == nil {
+		prev, err := s.receipts.Last(ctx)
+		if err != nil {
+			return nil, err
+		}
+		receipt = &domain.ErasureReceipt{
+			SubjectHash:           domain.SubjectHash(userID),
+			DueAt:                 user.DeletionScheduledAt,
+			ErasedAt:              time.Now().UTC().Truncate(time.Millisecond),
+			ProgressDeleted:       progressDeleted,
+			SubscriptionsDetached: detached,
+			AuditEventsAnonymized: anonymized,
+			OtherDeleted:          otherDeleted,
+		}
+		receipt.Seal(prev)
+		if err := s.receipts.Append(ctx, receipt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.userRepo.Delete(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("subject_hash", receipt.SubjectHash).
+		Int64("sequence", receipt.Sequence).
+		Int64("progress_deleted", progressDeleted).
+		Int64("subscriptions_detached", detached).
+		Msg("User data erased")
+	return receipt, nil
+}
+
+// VerifyReceipts recomputes the erasure receipt chain and reports the first broken link
+func (s *PrivacyService) VerifyReceipts(ctx context.Context) (*ReceiptChainStatus, error) {
+	receipts, err := s.receipts.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ReceiptChainStatus{Valid: true, Receipts: len(receipts)}
+	prevHash := ""
+	for i, r := range receipts {
+		if r.Sequence != int64(i+1) || r.PrevHash != prevHash || r.Hash != r.ComputeHash() {
+			status.Valid = false
+			status.BrokenAt = int64(i + 1)
+			s.logger.Error().Int64("sequence", status.BrokenAt).Msg("Erasure receipt chain is broken")
+			break
+		}
+		prevHash = r.Hash
+	}
+	return status, nil
+}
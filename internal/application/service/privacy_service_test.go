@@ -0,0 +1,310 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// memoryProgressRepo is an in-memory ports.ProgressRepository
+type memoryProgressRepo struct {
+	mu      sync.Mutex
+	records []*domain.Progress
+	// Canned aggregation results
+	lessonStats []domain.LessonProgressStats
+	mastery     []domain.LevelMastery
+	aggregated  int
+}
+
+func (r *memoryProgressRepo) Create(ctx context.Context, progress *domain.Progress) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.records {
+		if p.UserID == progress.UserID && p.EntityID == progress.EntityID && p.EntityType == progress.EntityType {
+			return ports.ErrProgressExists
+		}
+	}
+	progress.ID = primitive.NewObjectID()
+	r.records = append(r.records, progress)
+	return nil
+}
+
+func (r *memoryProgressRepo) GetByID(ctx context.Context, id string) (*domain.Progress, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.records {
+		if p.ID.Hex() == id {
+			return p, nil
+		}
+	}
+	return nil, ports.ErrProgressNotFound
+}
+
+func (r *memoryProgressRepo) GetByUserID(ctx context.Context, userID string) ([]domain.Progress, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []domain.Progress
+	for _, p := range r.records {
+		if p.UserID.Hex() == userID {
+			out = append(out, *p)
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryProgressRepo) GetByUserAndEntity(ctx context.Context, userID, entityID string, entityType domain.EntityType) (*domain.Progress, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.records {
+		if p.UserID.Hex() == userID && p.EntityID.Hex() == entityID && p.EntityType == entityType {
+			return p, nil
+		}
+	}
+	return nil, ports.ErrProgressNotFound
+}
+
+func (r *memoryProgressRepo) GetByUserAndEntities(ctx context.Context, userID string, entityIDs []string) ([]domain.Progress, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []domain.Progress
+	for _, p := range r.records {
+		if p.UserID.Hex() == userID && slices.Contains(entityIDs, p.EntityID.Hex()) {
+			out = append(out, *p)
+		}
+	}
+	return out, nil
+}
+
+func (r *memoryProgressRepo) Update(ctx context.Context, progress *domain.Progress) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, p := range r.records {
+		if p.ID == progress.ID {
+			stored := *progress
+			r.records[i] = &stored
+			return nil
+		}
+	}
+	return errors.New("progress not found")
+}
+
+func (r *memoryProgressRepo) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, p := range r.records {
+		if p.ID.Hex() == id {
+			r.records = append(r.records[:i], r.records[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *memoryProgressRepo) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.records[:0]
+	for _, p := range r.records {
+		if p.UserID.Hex() != userID {
+			kept = append(kept, p)
+		}
+	}
+	deleted := int64(len(r.records) - len(kept))
+	r.records = kept
+	return deleted, nil
+}
+
+func (r *memoryProgressRepo) LessonStats(ctx context.Context, userID string) ([]domain.LessonProgressStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.aggregated++
+	return r.lessonStats, nil
+}
+
+func (r *memoryProgressRepo) MasteryByLevel(ctx context.Context, userID string) ([]domain.LevelMastery, error) {
+	return r.mastery, nil
+}
+
+// memoryReceiptRepo is an in-memory ports.ErasureReceiptRepository
+type memoryReceiptRepo struct {
+	receipts []*domain.ErasureReceipt
+}
+
+func (r *memoryReceiptRepo) Append(ctx context.Context, receipt *domain.ErasureReceipt) error {
+	for _, existing := range r.receipts {
+		if existing.Sequence == receipt.Sequence {
+			return errors.New("duplicate sequence")
+		}
+	}
+	r.receipts = append(r.receipts, receipt)
+	return nil
+}
+
+func (r *memoryReceiptRepo) Last(ctx context.Context) (*domain.ErasureReceipt, error) {
+	if len(r.receipts) == 0 {
+		return nil, nil
+	}
+	return r.receipts[len(r.receipts)-1], nil
+}
+
+func (r *memoryReceiptRepo) GetBySubject(ctx context.Context, subjectHash string) (*domain.ErasureReceipt, error) {
+	for _, receipt := range r.receipts {
+		if receipt.SubjectHash == subjectHash {
+			return receipt, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryReceiptRepo) List(ctx context.Context) ([]*domain.ErasureReceipt, error) {
+	return r.receipts, nil
+}
+
+func TestPrivacyService_Export(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID(), Name: "Aiko", Email: "aiko@example.com", Password: "secret-hash"}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	subRepo := new(mockSubRepo)
+	subRepo.On("GetByInternalUserID", mock.Anything, user.ID.Hex()).Return([]*domain.Subscription{{ProductID: "premium_monthly"}}, nil)
+	progress := &memoryProgressRepo{}
+	require.NoError(t, progress.Create(context.Background(), &domain.Progress{UserID: user.ID, EntityType: domain.KanjiEntity, Score: 80}))
+	audit := &memoryAuditLog{}
+	require.NoError(t, audit.Record(context.Background(), &domain.AuditEvent{Type: domain.AuditAccountLocked, UserID: &user.ID}))
+	sessions := newMemorySessionRepo()
+	require.NoError(t, sessions.Create(context.Background(), &domain.Session{UserID: user.ID, DeviceName: "Pixel 8"}))
+
+	s := NewPrivacyService(userRepo, progress, subRepo, sessions, audit, &memoryReceiptRepo{}, zerolog.Nop())
+	var buf bytes.Buffer
+	require.NoError(t, s.Export(context.Background(), user.ID.Hex(), &buf))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := map[string][]any{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		var content any
+		require.NoError(t, json.NewDecoder(rc).Decode(&content))
+		rc.Close()
+		if list, ok := content.([]any); ok {
+			files[f.Name] = list
+		} else {
+			files[f.Name] = []any{content}
+		}
+	}
+
+	assert.Len(t, files["progress.json"], 1)
+	assert.Len(t, files["subscriptions.json"], 1)
+	assert.Len(t, files["sessions.json"], 1)
+	assert.Len(t, files["security_events.json"], 1)
+	require.Len(t, files["user.json"], 1)
+	exportedUser := files["user.json"][0].(map[string]any)
+	assert.Equal(t, "aiko@example.com", exportedUser["email"])
+	assert.NotContains(t, exportedUser, "password")
+}
+
+func TestPrivacyService_Erase(t *testing.T) {
+	dueAt := time.Now().Add(-time.Hour)
+	user := &domain.User{ID: primitive.NewObjectID(), Email: "aiko@example.com", DeletionScheduledAt: &dueAt}
+	other := primitive.NewObjectID()
+
+	userRepo := new(mockUserRepo)
+	userRepo.On("Delete", mock.Anything, user.ID.Hex()).Return(nil).Once()
+	subRepo := new(mockSubRepo)
+	subRepo.On("DetachInternalUserID", mock.Anything, user.ID.Hex()).Return(int64(2), nil)
+	progress := &memoryProgressRepo{}
+	for _, id := range []primitive.ObjectID{user.ID, user.ID, other} {
+		require.NoError(t, progress.Create(context.Background(), &domain.Progress{UserID: id, EntityID: primitive.NewObjectID()}))
+	}
+	audit := &memoryAuditLog{}
+	require.NoError(t, audit.Record(context.Background(), &domain.AuditEvent{Type: domain.AuditAccountLocked, UserID: &user.ID, Email: user.Email, IP: "10.0.0.1"}))
+	receipts := &memoryReceiptRepo{}
+	sessions := newMemorySessionRepo()
+	require.NoError(t, sessions.Create(context.Background(), &domain.Session{UserID: user.ID}))
+
+	s := NewPrivacyService(userRepo, progress, subRepo, sessions, audit, receipts, zerolog.Nop())
+	receipt, err := s.Erase(context.Background(), user)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), receipt.Sequence)
+	assert.Equal(t, domain.SubjectHash(user.ID.Hex()), receipt.SubjectHash)
+	assert.Equal(t, int64(2), receipt.ProgressDeleted)
+	assert.Equal(t, int64(2), receipt.SubscriptionsDetached)
+	assert.Equal(t, int64(1), receipt.AuditEventsAnonymized)
+	assert.Len(t, progress.records, 1, "other users' progress is kept")
+	assert.Empty(t, sessions.sessions)
+	assert.Nil(t, audit.events[0].UserID)
+	assert.Empty(t, audit.events[0].Email)
+	assert.Empty(t, audit.events[0].IP)
+	userRepo.AssertExpectations(t)
+	subRepo.AssertExpectations(t)
+}
+
+func TestPrivacyService_EraseRetryKeepsOneReceipt(t *testing.T) {
+	user, other := &domain.User{ID: primitive.NewObjectID()}, &domain.User{ID: primitive.NewObjectID()}
+	userRepo := new(mockUserRepo)
+	userRepo.On("Delete", mock.Anything, user.ID.Hex()).Return(errors.New("write conflict")).Once()
+	userRepo.On("Delete", mock.Anything, other.ID.Hex()).Return(nil).Once()
+	userRepo.On("Delete", mock.Anything, user.ID.Hex()).Return(nil).Once()
+	subRepo := new(mockSubRepo)
+	subRepo.On("DetachInternalUserID", mock.Anything, mock.Anything).Return(int64(0), nil)
+	receipts := &memoryReceiptRepo{}
+	s := NewPrivacyService(userRepo, &memoryProgressRepo{}, subRepo, newMemorySessionRepo(), &memoryAuditLog{}, receipts, zerolog.Nop())
+
+	_, err := s.Erase(context.Background(), user)
+	require.Error(t, err)
+	// Another account is erased before the retry
+	_, err = s.Erase(context.Background(), other)
+	require.NoError(t, err)
+
+	receipt, err := s.Erase(context.Background(), user)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), receipt.Sequence)
+	assert.Len(t, receipts.receipts, 2, "one receipt per subject")
+	userRepo.AssertExpectations(t)
+}
+
+func TestPrivacyService_VerifyReceipts(t *testing.T) {
+	receipts := &memoryReceiptRepo{}
+	var prev *domain.ErasureReceipt
+	for i := 0; i < 3; i++ {
+		r := &domain.ErasureReceipt{SubjectHash: domain.SubjectHash(primitive.NewObjectID().Hex()), ErasedAt: time.Now(), ProgressDeleted: int64(i)}
+		r.Seal(prev)
+		require.NoError(t, receipts.Append(context.Background(), r))
+		prev = r
+	}
+	s := NewPrivacyService(nil, nil, nil, nil, nil, receipts, zerolog.Nop())
+
+	status, err := s.VerifyReceipts(context.Background())
+	require.NoError(t, err)
+	assert.True(t, status.Valid)
+	assert.Equal(t, 3, status.Receipts)
+
+	receipts.receipts[1].ProgressDeleted = 0
+	status, err = s.VerifyReceipts(context.Background())
+	require.NoError(t, err)
+	assert.False(t, status.Valid)
+	assert.Equal(t, int64(2), status.BrokenAt, "an edited receipt no longer matches its hash")
+
+	receipts.receipts[1].ProgressDeleted = 1
+	receipts.receipts = append(receipts.receipts[:1], receipts.receipts[2:]...)
+	status, err = s.VerifyReceipts(context.Background())
+	require.NoError(t, err)
+	assert.False(t, status.Valid)
+	assert.Equal(t, int64(2), status.BrokenAt, "a removed receipt breaks the chain")
+}
@@ -2,66 +2,428 @@ package service
 
 import (
 	"context"
+	"errors"
+	"math"
 	"nihongo-api/internal/domain"
 	"nihongo-api/internal/ports"
+	"slices"
 	"time"
 
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// summaryTTL bounds how long a cached summary lives without progress writes, so course
+// content changes eventually show up
+const summaryTTL = 24 * time.Hour
+
+var (
+	ErrUnknownEntityType = errors.New("unknown entity type")
+	ErrInvalidEntityID   = errors.New("invalid entity ID")
+	ErrEntityNotFound    = errors.New("entity not found")
+)
+
+// LessonLockedError is returned when progress is recorded on a lesson, or an exercise of
+// a lesson, the learner has not unlocked yet
+type LessonLockedError struct {
+	LessonID           primitive.ObjectID
+	UnmetPrerequisites []string
+}
+
+func (e *LessonLockedError) Error() string {
+	return "lesson is locked"
+}
+
+// ProgressUpdate is the result a learner reports for an entity
+type ProgressUpdate struct {
+	Completed bool `json:"completed"`
+	Score     int  `json:"score" validate:"min=0,max=100"`
+	// Attempts are the answers given on the way, logged for mistake analysis
+	Attempts []AttemptReport `json:"attempts" validate:"max=50,dive"`
+}
+
+// AttemptReport is one answer given on an entity
+type AttemptReport struct {
+	Answer         string `json:"answer" validate:"max=200"`
+	Expected       string `json:"expected" validate:"required,max=200"`
+	Correct        bool   `json:"correct"`
+	ResponseTimeMs int    `json:"response_time_ms" validate:"min=0,max=3600000"`
+}
+
+// ProgressObserver is told about every progress write, e.g. to track daily activity.
+// Observers handle their own errors: the progress is already saved.
+type ProgressObserver interface {
+	ProgressRecorded(ctx context.Context, userID string, progress *domain.Progress)
+}
+
+// AttemptRecorder logs the answers sent with a progress write for mistake analysis
+type AttemptRecorder interface {
+	RecordAttempts(ctx context.Context, progress *domain.Progress, reports []AttemptReport) error
+}
+
 // ProgressService handles progress business logic
 type ProgressService struct {
 	progressRepo ports.ProgressRepository
+	syllableRepo ports.SyllableRepository
+	kanjiRepo    ports.KanjiRepository
+	courseRepo   ports.CourseRepository
+	entitlements EntitlementProvider
+	summaryCache ports.ProgressSummaryCache
+	observers    []ProgressObserver
+	attempts     AttemptRecorder
+	validate     *validator.Validate
+	logger       zerolog.Logger
 }
 
-// NewProgressService creates a new progress service
-func NewProgressService(progressRepo ports.ProgressRepository) *ProgressService {
+// NewProgressService creates a new progress service. The content repositories are used to
+// check that progress is only recorded for entities that exist, and entitlements to check
+// that lessons are unlocked.
+func NewProgressService(progressRepo ports.ProgressRepository, syllableRepo ports.SyllableRepository, kanjiRepo ports.KanjiRepository, courseRepo ports.CourseRepository, entitlements EntitlementProvider, summaryCache ports.ProgressSummaryCache, logger zerolog.Logger) *ProgressService {
 	return &ProgressService{
 		progressRepo: progressRepo,
+		syllableRepo: syllableRepo,
+		kanjiRepo:    kanjiRepo,
+		courseRepo:   courseRepo,
+		entitlements: entitlements,
+		summaryCache: summaryCache,
+		validate:     newValidator(),
+		logger:       logger,
 	}
 }
 
-// GetUserProgress retrieves all progress for a user
-func (s *ProgressService) GetUserProgress(ctx context.Context, userID string) ([]domain.Progress, error) {
-	return s.progressRepo.GetByUserID(ctx, userID)
+// AddObserver registers an observer for progress writes; call it before serving requests
+func (s *ProgressService) AddObserver(observer ProgressObserver) {
+	s.observers = append(s.observers, observer)
 }
 
-// UpdateProgress updates or creates progress for a user
-func (s *ProgressService) UpdateProgress(ctx context.Context, userID, entityID string, entityType domain.EntityType, completed bool, score int) error {
-	progress, err := s.progressRepo.GetByUserAndEntity(ctx, userID, entityID, entityType)
+// SetAttemptRecorder sets where the attempts sent with progress writes are logged; call it
+// before serving requests. Without one the attempts are dropped.
+func (s *ProgressService) SetAttemptRecorder(recorder AttemptRecorder) {
+	s.attempts = recorder
+}
+
+// GetUserProgress retrieves all progress for a user, optionally only for one entity type
+func (s *ProgressService) GetUserProgress(ctx context.Context, userID string, entityType domain.EntityType) ([]domain.Progress, error) {
+	if entityType != "" && !entityType.Valid() {
+		return nil, ErrUnknownEntityType
+	}
+
+	all, err := s.progressRepo.GetByUserID(ctx, userID)
 	if err != nil {
-		// Create new progress
-		userObjID, _ := primitive.ObjectIDFromHex(userID)
-		entityObjID, _ := primitive.ObjectIDFromHex(entityID)
+		return nil, err
+	}
 
-		newProgress := &domain.Progress{
+	progress := make([]domain.Progress, 0, len(all))
+	for _, p := range all {
+		if entityType == "" || p.EntityType == entityType {
+			progress = append(progress, p)
+		}
+	}
+	return progress, nil
+}
+
+// UpdateProgress updates or creates progress for a user on an existing entity. Lessons and
+// exercises can only be recorded once the lesson is unlocked.
+func (s *ProgressService) UpdateProgress(ctx context.Context, userID, entityID string, entityType domain.EntityType, update ProgressUpdate) (*domain.Progress, error) {
+	if err := s.validate.Struct(update); err != nil {
+		return nil, validationError(err)
+	}
+	entityObjID, err := parseEntity(entityID, entityType)
+	if err != nil {
+		return nil, err
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkEntity(ctx, userID, entityObjID, entityType); err != nil {
+		return nil, err
+	}
+
+	progress, err := s.progressRepo.GetByUserAndEntity(ctx, userID, entityID, entityType)
+	if errors.Is(err, ports.ErrProgressNotFound) {
+		progress = &domain.Progress{
 			UserID:     userObjID,
 			EntityID:   entityObjID,
 			EntityType: entityType,
-			Completed:  completed,
-			Score:      score,
+			Completed:  update.Completed,
+			Score:      update.Score,
 		}
-
-		if completed {
+		if update.Completed {
 			now := time.Now()
-			newProgress.CompletedAt = &now
+			progress.CompletedAt = &now
 		}
 
-		return s.progressRepo.Create(ctx, newProgress)
+		err = s.progressRepo.Create(ctx, progress)
+		if err == nil {
+			s.recorded(ctx, userID, progress, update.Attempts)
+			return progress, nil
+		}
+		if !errors.Is(err, ports.ErrProgressExists) {
+			return nil, err
+		}
+		// A concurrent first write created the record in the meantime; update that one instead
+		progress, err = s.progressRepo.GetByUserAndEntity(ctx, userID, entityID, entityType)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	// Update existing progress
-	progress.Completed = completed
-	progress.Score = score
-	if completed && progress.CompletedAt == nil {
+	progress.Completed = update.Completed
+	progress.Score = update.Score
+	if update.Completed && progress.CompletedAt == nil {
 		now := time.Now()
 		progress.CompletedAt = &now
 	}
 
-	return s.progressRepo.Update(ctx, progress)
+	if err := s.progressRepo.Update(ctx, progress); err != nil {
+		return nil, err
+	}
+	s.recorded(ctx, userID, progress, update.Attempts)
+	return progress, nil
 }
 
-// GetProgressByEntity retrieves progress for a specific entity
+// recorded runs after every progress write
+func (s *ProgressService) recorded(ctx context.Context, userID string, progress *domain.Progress, attempts []AttemptReport) {
+	s.InvalidateSummary(ctx, userID)
+	// The progress is saved either way; losing the attempts only weakens the analysis
+	if s.attempts != nil {
+		if err := s.attempts.RecordAttempts(ctx, progress, attempts); err != nil {
+			s.logger.Error().Err(err).Str("user_id", userID).Msg("Failed to record attempts")
+		}
+	}
+	for _, o := range s.observers {
+		o.ProgressRecorded(ctx, userID, progress)
+	}
+}
+
+// GetProgressByEntity retrieves progress for a specific entity; it returns
+// ports.ErrProgressNotFound if the user has none yet
 func (s *ProgressService) GetProgressByEntity(ctx context.Context, userID, entityID string, entityType domain.EntityType) (*domain.Progress, error) {
+	if _, err := parseEntity(entityID, entityType); err != nil {
+		return nil, err
+	}
 	return s.progressRepo.GetByUserAndEntity(ctx, userID, entityID, entityType)
 }
+
+// GetSummary returns the user's completion per course and mastery per JLPT level. It is
+// cached until the user's next progress write.
+func (s *ProgressService) GetSummary(ctx context.Context, userID string) (*domain.ProgressSummary, error) {
+	// The cache only speeds things up; if Redis is down the summary is computed every time
+	version, err := s.summaryCache.Version(ctx, userID)
+	cacheable := err == nil
+	if err != nil {
+		s.logger.Warn().Err(err).Str("user_id", userID).Msg("Progress summary cache unavailable")
+	} else if cached, err := s.summaryCache.Get(ctx, userID, version); err != nil {
+		s.logger.Warn().Err(err).Str("user_id", userID).Msg("Failed to read cached progress summary")
+	} else if cached != nil {
+		return cached, nil
+	}
+
+	lessons, err := s.progressRepo.LessonStats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := s.progressRepo.MasteryByLevel(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	summary := &domain.ProgressSummary{
+		Courses:     summarizeCourses(lessons),
+		Levels:      levels,
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	if cacheable {
+		if err := s.summaryCache.Set(ctx, userID, version, summary, summaryTTL); err != nil {
+			s.logger.Warn().Err(err).Str("user_id", userID).Msg("Failed to cache progress summary")
+		}
+	}
+	return summary, nil
+}
+
+// InvalidateSummary drops the user's cached summary after their progress changed
+func (s *ProgressService) InvalidateSummary(ctx context.Context, userID string) {
+	if err := s.summaryCache.Invalidate(ctx, userID); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msg("Failed to invalidate progress summary")
+	}
+}
+
+// summarizeCourses groups lesson stats, which arrive ordered by course, into courses
+func summarizeCourses(lessons []domain.LessonProgressStats) []domain.CourseCompletion {
+	courses := []domain.CourseCompletion{}
+	var scoreSum, attempted int
+	closeCourse := func() {
+		c := &courses[len(courses)-1]
+		if c.LessonsTotal > 0 {
+			c.PercentComplete = roundPercent(float64(c.LessonsCompleted) * 100 / float64(c.LessonsTotal))
+		}
+		c.AverageExerciseScore = averageScore(scoreSum, attempted)
+		scoreSum, attempted = 0, 0
+	}
+
+	for _, l := range lessons {
+		if len(courses) == 0 || courses[len(courses)-1].CourseID != l.CourseID {
+			if len(courses) > 0 {
+				closeCourse()
+			}
+			courses = append(courses, domain.CourseCompletion{
+				CourseID: l.CourseID,
+				Name:     l.CourseName,
+				Level:    l.CourseLevel,
+				Lessons:  []domain.LessonCompletion{},
+			})
+		}
+
+		c := &courses[len(courses)-1]
+		status := l.Status()
+		c.LessonsTotal++
+		if status == domain.LessonCompleted {
+			c.LessonsCompleted++
+		}
+		scoreSum += l.ScoreSum
+		attempted += l.ExercisesAttempted
+		c.Lessons = append(c.Lessons, domain.LessonCompletion{
+			LessonID:           l.LessonID,
+			Title:              l.LessonTitle,
+			Status:             status,
+			ExercisesCompleted: l.ExercisesCompleted,
+			ExercisesTotal:     l.ExercisesTotal,
+			AverageScore:       averageScore(l.ScoreSum, l.ExercisesAttempted),
+		})
+	}
+	if len(courses) > 0 {
+		closeCourse()
+	}
+	return courses
+}
+
+// averageScore returns nil when nothing was scored
+func averageScore(sum, count int) *float64 {
+	if count == 0 {
+		return nil
+	}
+	avg := roundPercent(float64(sum) / float64(count))
+	return &avg
+}
+
+// roundPercent rounds to one decimal place
+func roundPercent(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+// checkEntity makes sure the entity exists in the repository for its type and, for
+// lessons and exercises, that the user has unlocked the lesson. Lessons and exercises are
+// stored inside their course.
+func (s *ProgressService) checkEntity(ctx context.Context, userID string, entityID primitive.ObjectID, entityType domain.EntityType) error {
+	var course *domain.Course
+	var err error
+	switch entityType {
+	case domain.SyllableEntity:
+		_, err = s.syllableRepo.GetByID(ctx, entityID.Hex())
+	case domain.KanjiEntity:
+		_, err = s.kanjiRepo.GetByID(ctx, entityID.Hex())
+	case domain.LessonEntity:
+		course, err = s.courseRepo.GetByLessonID(ctx, entityID.Hex())
+	case domain.ExerciseEntity:
+		course, err = s.courseRepo.GetByExerciseID(ctx, entityID.Hex())
+	default:
+		return ErrUnknownEntityType
+	}
+
+	if errors.Is(err, ports.ErrSyllableNotFound) || errors.Is(err, ports.ErrKanjiNotFound) || errors.Is(err, ports.ErrCourseNotFound) {
+		return ErrEntityNotFound
+	}
+	if err != nil || course == nil {
+		return err
+	}
+
+	lesson, ok := course.LessonContaining(entityID)
+	if !ok {
+		return ErrEntityNotFound
+	}
+	return s.checkLessonUnlocked(ctx, userID, course, lesson.ID)
+}
+
+// checkLessonUnlocked returns a LessonLockedError unless the user can open the lesson.
+// Only the lesson, the one before it and, for mastery requirements, the user's level
+// mastery decide its state, so those are read instead of the full summary.
+func (s *ProgressService) checkLessonUnlocked(ctx context.Context, userID string, course *domain.Course, lessonID primitive.ObjectID) error {
+	index := slices.IndexFunc(course.Lessons, func(l domain.Lesson) bool { return l.ID == lessonID })
+	if index < 0 {
+		return nil
+	}
+	granted, err := s.entitlements.GetUserEntitlements(ctx, userID)
+	if err != nil {
+		return err
+	}
+	hasAccess := course.IsUnlockedBy(granted)
+	if hasAccess && course.Lessons[index].Prerequisites == nil {
+		return nil
+	}
+
+	lessons := course.Lessons[max(index-1, 0) : index+1]
+	var entityIDs []string
+	for _, l := range lessons {
+		entityIDs = append(entityIDs, l.ID.Hex())
+		for _, e := range l.Exercises {
+			entityIDs = append(entityIDs, e.ID.Hex())
+		}
+	}
+	records, err := s.progressRepo.GetByUserAndEntities(ctx, userID, entityIDs)
+	if err != nil {
+		return err
+	}
+	stats := make([]domain.LessonProgressStats, len(lessons))
+	for i, l := range lessons {
+		stats[i] = lessonStats(course.ID, l, records)
+	}
+	summary := &domain.ProgressSummary{Courses: summarizeCourses(stats)}
+	if p := course.Lessons[index].Prerequisites; p != nil && len(p.Mastery) > 0 {
+		if summary.Levels, err = s.progressRepo.MasteryByLevel(ctx, userID); err != nil {
+			return err
+		}
+	}
+
+	sequenced := domain.Course{ID: course.ID, Lessons: slices.Clone(lessons)}
+	sequenced.Sequence(summary, hasAccess)
+	if lesson := sequenced.Lessons[len(lessons)-1]; lesson.State == domain.LessonStateLocked {
+		return &LessonLockedError{LessonID: lessonID, UnmetPrerequisites: lesson.UnmetPrerequisites}
+	}
+	return nil
+}
+
+// lessonStats computes from the user's progress records what LessonStats reports for
+// one lesson
+func lessonStats(courseID primitive.ObjectID, lesson domain.Lesson, records []domain.Progress) domain.LessonProgressStats {
+	stats := domain.LessonProgressStats{CourseID: courseID, LessonID: lesson.ID, ExercisesTotal: len(lesson.Exercises)}
+	for _, p := range records {
+		switch {
+		case p.EntityType == domain.LessonEntity && p.EntityID == lesson.ID:
+			stats.Started = true
+			stats.LessonCompleted = p.Completed
+		case p.EntityType == domain.ExerciseEntity && slices.ContainsFunc(lesson.Exercises, func(e domain.Exercise) bool { return e.ID == p.EntityID }):
+			stats.Started = true
+			stats.ExercisesAttempted++
+			stats.ScoreSum += p.Score
+			if p.Completed {
+				stats.ExercisesCompleted++
+			}
+		}
+	}
+	return stats
+}
+
+// parseEntity checks the entity type and ID taken from a request
+func parseEntity(entityID string, entityType domain.EntityType) (primitive.ObjectID, error) {
+	if !entityType.Valid() {
+		return primitive.NilObjectID, ErrUnknownEntityType
+	}
+	id, err := primitive.ObjectIDFromHex(entityID)
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidEntityID
+	}
+	return id, nil
+}
@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// stubSyllableRepo is a ports.SyllableRepository that only knows the IDs it holds
+type stubSyllableRepo struct {
+	ports.SyllableRepository
+	ids map[string]bool
+}
+
+func (r *stubSyllableRepo) GetByID(ctx context.Context, id string) (*domain.Syllable, error) {
+	if !r.ids[id] {
+		return nil, ports.ErrSyllableNotFound
+	}
+	return &domain.Syllable{}, nil
+}
+
+// stubKanjiRepo is a ports.KanjiRepository that only knows the IDs it holds
+type stubKanjiRepo struct {
+	ports.KanjiRepository
+	ids map[string]bool
+}
+
+func (r *stubKanjiRepo) GetByID(ctx context.Context, id string) (*domain.Kanji, error) {
+	if !r.ids[id] {
+		return nil, ports.ErrKanjiNotFound
+	}
+	return &domain.Kanji{}, nil
+}
+
+// memorySummaryCache is an in-memory ports.ProgressSummaryCache
+type memorySummaryCache struct {
+	versions  map[string]int64
+	summaries map[string]*domain.ProgressSummary
+	down      bool
+}
+
+func newMemorySummaryCache() *memorySummaryCache {
+	return &memorySummaryCache{versions: map[string]int64{}, summaries: map[string]*domain.ProgressSummary{}}
+}
+
+func (c *memorySummaryCache) Version(ctx context.Context, userID string) (int64, error) {
+	if c.down {
+		return 0, errors.New("connection refused")
+	}
+	return c.versions[userID], nil
+}
+
+func (c *memorySummaryCache) Get(ctx context.Context, userID string, version int64) (*domain.ProgressSummary, error) {
+	return c.summaries[fmt.Sprint(userID, version)], nil
+}
+
+func (c *memorySummaryCache) Set(ctx context.Context, userID string, version int64, summary *domain.ProgressSummary, ttl time.Duration) error {
+	c.summaries[fmt.Sprint(userID, version)] = summary
+	return nil
+}
+
+func (c *memorySummaryCache) Invalidate(ctx context.Context, userID string) error {
+	if c.down {
+		return errors.New("connection refused")
+	}
+	c.versions[userID]++
+	return nil
+}
+
+func TestProgressService_UpdateProgress(t *testing.T) {
+	userID := primitive.NewObjectID().Hex()
+	kanjiID := primitive.NewObjectID().Hex()
+	lessonID := primitive.NewObjectID().Hex()
+	missing := primitive.NewObjectID().Hex()
+
+	lessonObjID, _ := primitive.ObjectIDFromHex(lessonID)
+	courses := new(mockCourseRepo)
+	courses.On("GetByLessonID", mock.Anything, lessonID).Return(&domain.Course{Lessons: []domain.Lesson{{ID: lessonObjID}}}, nil)
+	courses.On("GetByExerciseID", mock.Anything, missing).Return((*domain.Course)(nil), ports.ErrCourseNotFound)
+	progress := &memoryProgressRepo{}
+	s := NewProgressService(progress, &stubSyllableRepo{}, &stubKanjiRepo{ids: map[string]bool{kanjiID: true}}, courses, stubEntitlements{}, newMemorySummaryCache(), zerolog.Nop())
+	ctx := context.Background()
+
+	t.Run("creates then updates", func(t *testing.T) {
+		created, err := s.UpdateProgress(ctx, userID, kanjiID, domain.KanjiEntity, ProgressUpdate{Score: 40})
+		require.NoError(t, err)
+		assert.False(t, created.Completed)
+		assert.Nil(t, created.CompletedAt)
+
+		updated, err := s.UpdateProgress(ctx, userID, kanjiID, domain.KanjiEntity, ProgressUpdate{Completed: true, Score: 90})
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, updated.ID)
+		assert.Equal(t, 90, updated.Score)
+		assert.NotNil(t, updated.CompletedAt)
+		assert.Len(t, progress.records, 1)
+	})
+
+	t.Run("lessons are looked up in their course", func(t *testing.T) {
+		_, err := s.UpdateProgress(ctx, userID, lessonID, domain.LessonEntity, ProgressUpdate{Completed: true})
+		require.NoError(t, err)
+	})
+
+	tests := []struct {
+		name       string
+		entityID   string
+		entityType domain.EntityType
+		update     ProgressUpdate
+		wantErr    error
+	}{
+		{"malformed ID", "not-an-id", domain.KanjiEntity, ProgressUpdate{}, ErrInvalidEntityID},
+		{"unknown type", kanjiID, domain.EntityType("grammar"), ProgressUpdate{}, ErrUnknownEntityType},
+		{"missing syllable", missing, domain.SyllableEntity, ProgressUpdate{}, ErrEntityNotFound},
+		{"missing exercise", missing, domain.ExerciseEntity, ProgressUpdate{}, ErrEntityNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.UpdateProgress(ctx, userID, tt.entityID, tt.entityType, tt.update)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("score out of range", func(t *testing.T) {
+		_, err := s.UpdateProgress(ctx, userID, kanjiID, domain.KanjiEntity, ProgressUpdate{Score: 101})
+		var verr *ValidationError
+		require.ErrorAs(t, err, &verr)
+		assert.Contains(t, verr.Fields, "score")
+	})
+
+	t.Run("attempt without expected answer", func(t *testing.T) {
+		_, err := s.UpdateProgress(ctx, userID, kanjiID, domain.KanjiEntity, ProgressUpdate{Attempts: []AttemptReport{{Answer: "ツ"}}})
+		var verr *ValidationError
+		require.ErrorAs(t, err, &verr)
+		assert.Contains(t, verr.Fields, "expected")
+	})
+
+	for _, p := range progress.records {
+		assert.False(t, p.EntityID.IsZero(), "no progress is stored with a zero entity ID")
+	}
+}
+
+// racingProgressRepo misses the existing record on the first lookup, as when another
+// request creates it between the lookup and the insert
+type racingProgressRepo struct {
+	*memoryProgressRepo
+	missed bool
+}
+
+func (r *racingProgressRepo) GetByUserAndEntity(ctx context.Context, userID, entityID string, entityType domain.EntityType) (*domain.Progress, error) {
+	if !r.missed {
+		r.missed = true
+		return nil, ports.ErrProgressNotFound
+	}
+	return r.memoryProgressRepo.GetByUserAndEntity(ctx, userID, entityID, entityType)
+}
+
+func TestProgressService_UpdateProgressConcurrentFirstWrite(t *testing.T) {
+	userID, kanjiID := primitive.NewObjectID(), primitive.NewObjectID()
+	progress := &memoryProgressRepo{}
+	first := &domain.Progress{UserID: userID, EntityID: kanjiID, EntityType: domain.KanjiEntity, Score: 40}
+	require.NoError(t, progress.Create(context.Background(), first))
+	s := NewProgressService(&racingProgressRepo{memoryProgressRepo: progress}, nil, &stubKanjiRepo{ids: map[string]bool{kanjiID.Hex(): true}}, nil, nil, newMemorySummaryCache(), zerolog.Nop())
+
+	updated, err := s.UpdateProgress(context.Background(), userID.Hex(), kanjiID.Hex(), domain.KanjiEntity, ProgressUpdate{Completed: true, Score: 90})
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, updated.ID, "the losing write updates the record instead of adding a second one")
+	assert.Equal(t, 90, updated.Score)
+	assert.Len(t, progress.records, 1)
+}
+
+func TestProgressService_UpdateProgressRecordsAttempts(t *testing.T) {
+	userID, kanjiID := primitive.NewObjectID(), primitive.NewObjectID()
+	log := &memoryAttemptLog{}
+	s := NewProgressService(&memoryProgressRepo{}, nil, &stubKanjiRepo{ids: map[string]bool{kanjiID.Hex(): true}}, nil, nil, newMemorySummaryCache(), zerolog.Nop())
+	s.SetAttemptRecorder(NewMistakeService(log, testMistakePolicy, zerolog.Nop()))
+
+	attempts := []AttemptReport{{Answer: "みず", Expected: "みず", Correct: true, ResponseTimeMs: 900}}
+	_, err := s.UpdateProgress(context.Background(), userID.Hex(), kanjiID.Hex(), domain.KanjiEntity, ProgressUpdate{Score: 50, Attempts: attempts})
+	require.NoError(t, err)
+	_, err = s.UpdateProgress(context.Background(), userID.Hex(), kanjiID.Hex(), domain.KanjiEntity, ProgressUpdate{Completed: true, Score: 90, Attempts: attempts})
+	require.NoError(t, err)
+
+	require.Len(t, log.attempts, 2, "attempts are logged on both the first write and later updates")
+	assert.Equal(t, kanjiID, log.attempts[1].EntityID)
+	assert.Equal(t, userID, log.attempts[1].UserID)
+}
+
+func TestProgressService_GetUserProgress(t *testing.T) {
+	userID := primitive.NewObjectID()
+	progress := &memoryProgressRepo{}
+	for _, entityType := range []domain.EntityType{domain.KanjiEntity, domain.KanjiEntity, domain.SyllableEntity} {
+		require.NoError(t, progress.Create(context.Background(), &domain.Progress{UserID: userID, EntityID: primitive.NewObjectID(), EntityType: entityType}))
+	}
+	s := NewProgressService(progress, nil, nil, nil, nil, newMemorySummaryCache(), zerolog.Nop())
+
+	all, err := s.GetUserProgress(context.Background(), userID.Hex(), "")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	kanji, err := s.GetUserProgress(context.Background(), userID.Hex(), domain.KanjiEntity)
+	require.NoError(t, err)
+	assert.Len(t, kanji, 2)
+
+	_, err = s.GetUserProgress(context.Background(), userID.Hex(), domain.EntityType("grammar"))
+	assert.ErrorIs(t, err, ErrUnknownEntityType)
+
+	_, err = s.GetProgressByEntity(context.Background(), userID.Hex(), primitive.NewObjectID().Hex(), domain.KanjiEntity)
+	assert.ErrorIs(t, err, ports.ErrProgressNotFound)
+}
+
+func TestProgressService_GetSummary(t *testing.T) {
+	userID := primitive.NewObjectID().Hex()
+	kanjiID := primitive.NewObjectID().Hex()
+	courseA, courseB := primitive.NewObjectID(), primitive.NewObjectID()
+	progress := &memoryProgressRepo{
+		lessonStats: []domain.LessonProgressStats{
+			{CourseID: courseA, CourseName: "Kana", LessonID: primitive.NewObjectID(), Started: true, LessonCompleted: true, ExercisesTotal: 2, ExercisesCompleted: 1, ExercisesAttempted: 2, ScoreSum: 150},
+			{CourseID: courseA, CourseName: "Kana", LessonID: primitive.NewObjectID(), Started: true, ExercisesTotal: 2, ExercisesCompleted: 2, ExercisesAttempted: 2, ScoreSum: 180},
+			{CourseID: courseA, CourseName: "Kana", LessonID: primitive.NewObjectID(), Started: true, ExercisesTotal: 3, ExercisesCompleted: 1, ExercisesAttempted: 1, ScoreSum: 70},
+			{CourseID: courseB, CourseName: "Greetings", LessonID: primitive.NewObjectID(), ExercisesTotal: 1},
+		},
+		mastery: []domain.LevelMastery{{Level: domain.N5, KanaMastered: 46, KanaTotal: 92, KanjiMastered: 10, KanjiTotal: 80}},
+	}
+	cache := newMemorySummaryCache()
+	s := NewProgressService(progress, nil, &stubKanjiRepo{ids: map[string]bool{kanjiID: true}}, nil, nil, cache, zerolog.Nop())
+	ctx := context.Background()
+
+	summary, err := s.GetSummary(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, summary.Courses, 2)
+
+	kana := summary.Courses[0]
+	assert.Equal(t, 3, kana.LessonsTotal)
+	assert.Equal(t, 2, kana.LessonsCompleted, "a lesson with all exercises completed counts as completed")
+	assert.Equal(t, 66.7, kana.PercentComplete)
+	require.NotNil(t, kana.AverageExerciseScore)
+	assert.Equal(t, 80.0, *kana.AverageExerciseScore)
+	assert.Equal(t, []domain.LessonStatus{domain.LessonCompleted, domain.LessonCompleted, domain.LessonInProgress},
+		[]domain.LessonStatus{kana.Lessons[0].Status, kana.Lessons[1].Status, kana.Lessons[2].Status})
+	assert.Equal(t, 75.0, *kana.Lessons[0].AverageScore)
+
+	greetings := summary.Courses[1]
+	assert.Equal(t, domain.LessonNotStarted, greetings.Lessons[0].Status)
+	assert.Zero(t, greetings.PercentComplete)
+	assert.Nil(t, greetings.AverageExerciseScore)
+	assert.Equal(t, 46, summary.Levels[0].KanaMastered)
+
+	t.Run("cached until the next write", func(t *testing.T) {
+		_, err := s.GetSummary(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, progress.aggregated)
+
+		_, err = s.UpdateProgress(ctx, userID, kanjiID, domain.KanjiEntity, ProgressUpdate{Completed: true})
+		require.NoError(t, err)
+		_, err = s.GetSummary(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, progress.aggregated)
+	})
+
+	t.Run("computed without the cache when it is down", func(t *testing.T) {
+		cache.down = true
+		defer func() { cache.down = false }()
+
+		summary, err := s.GetSummary(ctx, userID)
+		require.NoError(t, err)
+		assert.Len(t, summary.Courses, 2)
+		assert.Equal(t, 3, progress.aggregated)
+	})
+}
+
+func TestProgressService_UpdateProgressLockedLesson(t *testing.T) {
+	userID := primitive.NewObjectID().Hex()
+	first := domain.Lesson{ID: primitive.NewObjectID(), Exercises: []domain.Exercise{{ID: primitive.NewObjectID()}}}
+	second := domain.Lesson{ID: primitive.NewObjectID(), Exercises: []domain.Exercise{{ID: primitive.NewObjectID()}},
+		Prerequisites: &domain.LessonPrerequisites{PreviousLesson: true}}
+	course := &domain.Course{ID: primitive.NewObjectID(), Lessons: []domain.Lesson{first, second}}
+	exerciseID := second.Exercises[0].ID.Hex()
+
+	courses := new(mockCourseRepo)
+	courses.On("GetByExerciseID", mock.Anything, exerciseID).Return(course, nil)
+	courses.On("GetByLessonID", mock.Anything, first.ID.Hex()).Return(course, nil)
+	progress := &memoryProgressRepo{}
+	s := NewProgressService(progress, nil, nil, courses, stubEntitlements{}, newMemorySummaryCache(), zerolog.Nop())
+	ctx := context.Background()
+
+	_, err := s.UpdateProgress(ctx, userID, exerciseID, domain.ExerciseEntity, ProgressUpdate{Completed: true, Score: 90})
+	var locked *LessonLockedError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, second.ID, locked.LessonID)
+	assert.Equal(t, []string{domain.PrerequisitePreviousLesson}, locked.UnmetPrerequisites)
+	assert.Empty(t, progress.records)
+
+	// Completing the first lesson unlocks the second
+	_, err = s.UpdateProgress(ctx, userID, first.ID.Hex(), domain.LessonEntity, ProgressUpdate{Completed: true})
+	require.NoError(t, err)
+
+	_, err = s.UpdateProgress(ctx, userID, exerciseID, domain.ExerciseEntity, ProgressUpdate{Completed: true, Score: 90})
+	assert.NoError(t, err)
+	assert.Zero(t, progress.aggregated, "writes do not compute the summary")
+}
+
+func TestProgressService_UpdateProgressMinScore(t *testing.T) {
+	userID := primitive.NewObjectID().Hex()
+	first := domain.Lesson{ID: primitive.NewObjectID(), Exercises: []domain.Exercise{{ID: primitive.NewObjectID()}, {ID: primitive.NewObjectID()}}}
+	second := domain.Lesson{ID: primitive.NewObjectID(), Prerequisites: &domain.LessonPrerequisites{MinScore: 70}}
+	course := &domain.Course{ID: primitive.NewObjectID(), Lessons: []domain.Lesson{first, second}}
+
+	courses := new(mockCourseRepo)
+	courses.On("GetByExerciseID", mock.Anything, mock.Anything).Return(course, nil)
+	courses.On("GetByLessonID", mock.Anything, second.ID.Hex()).Return(course, nil)
+	progress := &memoryProgressRepo{}
+	s := NewProgressService(progress, nil, nil, courses, stubEntitlements{}, newMemorySummaryCache(), zerolog.Nop())
+	ctx := context.Background()
+
+	_, err := s.UpdateProgress(ctx, userID, first.Exercises[0].ID.Hex(), domain.ExerciseEntity, ProgressUpdate{Completed: true, Score: 100})
+	require.NoError(t, err)
+	_, err = s.UpdateProgress(ctx, userID, first.Exercises[1].ID.Hex(), domain.ExerciseEntity, ProgressUpdate{Completed: true, Score: 30})
+	require.NoError(t, err)
+
+	_, err = s.UpdateProgress(ctx, userID, second.ID.Hex(), domain.LessonEntity, ProgressUpdate{Completed: true})
+	var locked *LessonLockedError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, []string{domain.PrerequisiteMinScore}, locked.UnmetPrerequisites)
+
+	_, err = s.UpdateProgress(ctx, userID, first.Exercises[1].ID.Hex(), domain.ExerciseEntity, ProgressUpdate{Completed: true, Score: 60})
+	require.NoError(t, err)
+	_, err = s.UpdateProgress(ctx, userID, second.ID.Hex(), domain.LessonEntity, ProgressUpdate{Completed: true})
+	assert.NoError(t, err)
+	assert.Zero(t, progress.aggregated)
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ReconciliationEventType marks subscription records written by reconciliation rather than a webhook
+const ReconciliationEventType = "RECONCILIATION"
+
+// ReconciliationResult lists, by product ID, what reconciliation changed for a subscriber
+type ReconciliationResult struct {
+	AppUserID string   `json:"app_user_id"`
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Expired   []string `json:"expired"`
+	Unchanged []string `json:"unchanged"`
+}
+
+// HasDrift reports whether reconciliation had to fix anything
+func (r *ReconciliationResult) HasDrift() bool {
+	return len(r.Created)+len(r.Updated)+len(r.Expired) > 0
+}
+
+// ReconciliationService compares the billing provider's view of a subscriber with the
+// stored subscriptions and fixes drift caused by lost or out-of-order webhooks
+type ReconciliationService struct {
+	provider ports.SubscriberProvider
+	subRepo  ports.SubscriptionRepository
+	userRepo ports.UserRepository
+	catalog  EntitlementResolver
+	logger   zerolog.Logger
+}
+
+// NewReconciliationService creates a new reconciliation service
+func NewReconciliationService(provider ports.SubscriberProvider, subRepo ports.SubscriptionRepository, userRepo ports.UserRepository, catalog EntitlementResolver, logger zerolog.Logger) *ReconciliationService {
+	return &ReconciliationService{
+		provider: provider,
+		subRepo:  subRepo,
+		userRepo: userRepo,
+		catalog:  catalog,
+		logger:   logger,
+	}
+}
+
+// desiredSubscription is the state a stored record should have according to the provider
+type desiredSubscription struct {
+	productID            string
+	status               domain.SubscriptionStatus
+	expiresAt            time.Time
+	billingIssueAt       *time.Time
+	gracePeriodExpiresAt *time.Time
+	entitlements         []string
+}
+
+// ReconcileUser fetches the subscriber from the provider and brings stored subscriptions in line
+func (s *ReconciliationService) ReconcileUser(ctx context.Context, appUserID string) (*ReconciliationResult, error) {
+	subscriber, err := s.provider.GetSubscriber(ctx, appUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.subRepo.GetByExternalUserID(ctx, appUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stored subscriptions: %w", err)
+	}
+
+	now := time.Now()
+	desired, err := s.desiredState(ctx, subscriber, now)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReconciliationResult{AppUserID: appUserID, Created: []string{}, Updated: []string{}, Expired: []string{}, Unchanged: []string{}}
+	internalUserID := s.internalUserID(ctx, appUserID, stored)
+
+	for _, d := range desired {
+		var sub *domain.Subscription
+		for _, st := range stored {
+			if st.ProductID == d.productID {
+				sub = st
+				break
+			}
+		}
+
+		if sub == nil {
+			sub = domain.NewSubscription(appUserID, d.productID, reconciliationEventID(), ReconciliationEventType, d.expiresAt)
+			sub.InternalUserID = internalUserID
+			applyDesired(sub, d)
+			if err := s.subRepo.Create(ctx, sub); err != nil {
+				return nil, fmt.Errorf("failed to create subscription for %s: %w", d.productID, err)
+			}
+			result.Created = append(result.Created, d.productID)
+			continue
+		}
+
+		if !applyDesired(sub, d) {
+			result.Unchanged = append(result.Unchanged, d.productID)
+			continue
+		}
+		sub.EventID = reconciliationEventID()
+		sub.EventType = ReconciliationEventType
+		if err := s.subRepo.Update(ctx, sub); err != nil {
+			return nil, fmt.Errorf("failed to update subscription for %s: %w", d.productID, err)
+		}
+		result.Updated = append(result.Updated, d.productID)
+	}
+
+	// Stored records the provider no longer knows about must not keep granting access
+	for _, st := range stored {
+		if slices.ContainsFunc(desired, func(d desiredSubscription) bool { return d.productID == st.ProductID }) {
+			continue
+		}
+		if !st.HasAccess(now) {
+			continue
+		}
+		st.UpdateStatus(domain.SubscriptionExpired, time.Time{})
+		st.EventID = reconciliationEventID()
+		st.EventType = ReconciliationEventType
+		if err := s.subRepo.Update(ctx, st); err != nil {
+			return nil, fmt.Errorf("failed to expire subscription for %s: %w", st.ProductID, err)
+		}
+		result.Expired = append(result.Expired, st.ProductID)
+	}
+
+	event := s.logger.Info()
+	if result.HasDrift() {
+		event = s.logger.Warn()
+	}
+	event.Str("app_user_id", appUserID).
+		Strs("created", result.Created).
+		Strs("updated", result.Updated).
+		Strs("expired", result.Expired).
+		Msg("Subscriber reconciled")
+	return result, nil
+}
+
+// ReconcileStale reconciles up to limit subscribers with an active or grace period
+// subscription that were not reconciled within maxAge, so drift from a lost webhook is
+// fixed without anyone noticing it first. It returns how many subscribers had drift.
+func (s *ReconciliationService) ReconcileStale(ctx context.Context, maxAge time.Duration, limit int) (int, error) {
+	now := time.Now()
+	appUserIDs, err := s.subRepo.FindUnreconciled(ctx, now.Add(-maxAge), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find subscribers to reconcile: %w", err)
+	}
+
+	drifted, failed := 0, 0
+	for _, appUserID := range appUserIDs {
+		if err := ctx.Err(); err != nil {
+			return drifted, err
+		}
+		result, err := s.ReconcileUser(ctx, appUserID)
+		switch {
+		case err != nil:
+			failed++
+			s.logger.Error().Err(err).Str("app_user_id", appUserID).Msg("Failed to reconcile subscriber")
+		case result.HasDrift():
+			drifted++
+		}
+		// Marked even after a failure, so one broken subscriber cannot hold up the rest;
+		// it is tried again once maxAge has passed
+		if err := s.subRepo.MarkReconciled(ctx, appUserID, now); err != nil {
+			s.logger.Error().Err(err).Str("app_user_id", appUserID).Msg("Failed to mark subscriber reconciled")
+		}
+	}
+
+	if failed > 0 && failed == len(appUserIDs) {
+		return drifted, fmt.Errorf("failed to reconcile all %d subscribers", failed)
+	}
+	if drifted > 0 {
+		s.logger.Warn().Int("drifted", drifted).Int("checked", len(appUserIDs)).Msg("Reconciliation sweep fixed drifted subscribers")
+	}
+	return drifted, nil
+}
+
+// desiredState derives the expected subscription records from the provider's subscriber.
+// Products that are not in the catalog and sandbox purchases are ignored, as in webhooks.
+func (s *ReconciliationService) desiredState(ctx context.Context, subscriber *ports.Subscriber, now time.Time) ([]desiredSubscription, error) {
+	entitlementsFor := func(productID string) []string {
+		var ids []string
+		for id, e := range subscriber.Entitlements {
+			if e.ProductID == productID {
+				ids = append(ids, id)
+			}
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	var desired []desiredSubscription
+	for productID, p := range subscriber.Subscriptions {
+		if p.IsSandbox {
+			continue
+		}
+		match, err := s.catalog.Resolve(ctx, productID, entitlementsFor(productID))
+		if err != nil {
+			return nil, err
+		}
+		if match == nil {
+			continue
+		}
+
+		d := desiredSubscription{productID: productID, entitlements: match.Entitlements, status: domain.SubscriptionActive}
+		if p.ExpiresAt != nil {
+			d.expiresAt = *p.ExpiresAt
+		}
+		switch {
+		case p.RefundedAt != nil:
+			d.status = domain.SubscriptionExpired
+		case p.BillingIssuesDetectedAt != nil:
+			graceEnds := d.expiresAt
+			if p.GracePeriodExpiresAt != nil {
+				graceEnds = *p.GracePeriodExpiresAt
+			}
+			if now.Before(graceEnds) {
+				d.status = domain.SubscriptionGracePeriod
+				d.billingIssueAt = p.BillingIssuesDetectedAt
+				d.gracePeriodExpiresAt = &graceEnds
+			} else {
+				d.status = domain.SubscriptionExpired
+			}
+		case p.ExpiresAt != nil && !now.Before(*p.ExpiresAt):
+			d.status = domain.SubscriptionExpired
+		case p.UnsubscribeDetectedAt != nil:
+			d.status = domain.SubscriptionCancelled
+		}
+		desired = append(desired, d)
+	}
+
+	for productID, purchases := range subscriber.NonSubscriptions {
+		if !slices.ContainsFunc(purchases, func(p ports.SubscriberPurchase) bool { return !p.IsSandbox }) {
+			continue
+		}
+		match, err := s.catalog.Resolve(ctx, productID, entitlementsFor(productID))
+		if err != nil {
+			return nil, err
+		}
+		if match == nil {
+			continue
+		}
+		desired = append(desired, desiredSubscription{productID: productID, entitlements: match.Entitlements, status: domain.SubscriptionActive})
+	}
+
+	// Map iteration order is random; keep results stable
+	slices.SortFunc(desired, func(a, b desiredSubscription) int {
+		if a.productID < b.productID {
+			return -1
+		}
+		if a.productID > b.productID {
+			return 1
+		}
+		return 0
+	})
+	return desired, nil
+}
+
+// internalUserID finds the internal user linked to the subscriber, if any
+func (s *ReconciliationService) internalUserID(ctx context.Context, appUserID string, stored []*domain.Subscription) *primitive.ObjectID {
+	for _, st := range stored {
+		if st.InternalUserID != nil {
+			return st.InternalUserID
+		}
+	}
+	user, err := s.userRepo.GetByRevenueCatID(ctx, appUserID)
+	if err != nil || user == nil {
+		return nil
+	}
+	return &user.ID
+}
+
+// applyDesired copies the desired state onto sub and reports whether anything changed
+func applyDesired(sub *domain.Subscription, d desiredSubscription) bool {
+	changed := sub.Status != d.status ||
+		!sub.ExpiresAt.Equal(d.expiresAt) ||
+		!slices.Equal(sub.Entitlements, d.entitlements) ||
+		!equalTimePtr(sub.GracePeriodExpiresAt, d.gracePeriodExpiresAt)
+	if !changed {
+		return false
+	}
+
+	sub.Status = d.status
+	sub.ExpiresAt = d.expiresAt
+	sub.Entitlements = d.entitlements
+	sub.BillingIssueAt = d.billingIssueAt
+	sub.GracePeriodExpiresAt = d.gracePeriodExpiresAt
+	sub.UpdatedAt = time.Now()
+	// The provider state is current, so webhooks sent before now that arrive later are stale
+	sub.LastEventAt = sub.UpdatedAt
+	return true
+}
+
+func equalTimePtr(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// reconciliationEventID returns a unique event ID; event_id is uniquely indexed
+func reconciliationEventID() string {
+	return "reconcile-" + primitive.NewObjectID().Hex()
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/adapters/revenuecat"
+	"nihongo-api/internal/adapters/revenuecat/revenuecattest"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+func TestReconciliationService_ReconcileUser(t *testing.T) {
+	server := revenuecattest.NewServer("sk_test")
+	defer server.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	expires := now.Add(-time.Hour)
+	graceEnds := now.Add(48 * time.Hour)
+	server.SetSubscriber("user1", fmt.Sprintf(`{
+		"entitlements": {
+			"premium": {"product_identifier": "premium_monthly", "purchase_date": %[1]q, "expires_date": %[2]q},
+			"jlpt_n2": {"product_identifier": "jlpt_n2_pack", "purchase_date": %[1]q, "expires_date": null}
+		},
+		"subscriptions": {
+			"premium_monthly": {
+				"purchase_date": %[1]q,
+				"expires_date": %[2]q,
+				"billing_issues_detected_at": %[2]q,
+				"grace_period_expires_date": %[3]q
+			},
+			"premium_weekly": {"purchase_date": %[1]q, "expires_date": %[3]q, "is_sandbox": true}
+		},
+		"non_subscriptions": {
+			"jlpt_n2_pack": [{"id": "p1", "store": "play_store", "purchase_date": %[1]q}]
+		}
+	}`, now.Add(-30*24*time.Hour).Format(time.RFC3339), expires.Format(time.RFC3339), graceEnds.Format(time.RFC3339)))
+
+	userID := primitive.NewObjectID()
+	future := now.Add(24 * time.Hour)
+	monthly := &domain.Subscription{ID: primitive.NewObjectID(), InternalUserID: &userID, ExternalUserID: "user1", ProductID: "premium_monthly", Status: domain.SubscriptionActive, ExpiresAt: expires, Entitlements: []string{"premium"}}
+	yearly := &domain.Subscription{ID: primitive.NewObjectID(), InternalUserID: &userID, ExternalUserID: "user1", ProductID: "premium_yearly", Status: domain.SubscriptionActive, ExpiresAt: future, Entitlements: []string{"premium"}}
+
+	subRepo := new(mockSubRepo)
+	subRepo.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{monthly, yearly}, nil)
+	subRepo.On("Update", mock.Anything, mock.MatchedBy(func(s *domain.Subscription) bool {
+		return s.ProductID == "premium_monthly" && s.Status == domain.SubscriptionGracePeriod &&
+			s.GracePeriodExpiresAt != nil && s.GracePeriodExpiresAt.Equal(graceEnds) &&
+			s.EventType == ReconciliationEventType
+	})).Return(nil).Once()
+	subRepo.On("Update", mock.Anything, mock.MatchedBy(func(s *domain.Subscription) bool {
+		return s.ProductID == "premium_yearly" && s.Status == domain.SubscriptionExpired
+	})).Return(nil).Once()
+	subRepo.On("Create", mock.Anything, mock.MatchedBy(func(s *domain.Subscription) bool {
+		return s.ProductID == "jlpt_n2_pack" && s.Status == domain.SubscriptionActive &&
+			s.InternalUserID != nil && *s.InternalUserID == userID &&
+			assert.ObjectsAreEqual([]string{"jlpt_n2"}, s.Entitlements)
+	})).Return(nil).Once()
+
+	client := revenuecat.NewClient(server.URL, server.APIKey, time.Second, 0, zerolog.Nop())
+	s := NewReconciliationService(client, subRepo, new(mockUserRepo), testCatalog(), zerolog.Nop())
+
+	result, err := s.ReconcileUser(context.Background(), "user1")
+	require.NoError(t, err)
+
+	assert.True(t, result.HasDrift())
+	assert.Equal(t, []string{"jlpt_n2_pack"}, result.Created)
+	assert.Equal(t, []string{"premium_monthly"}, result.Updated)
+	assert.Equal(t, []string{"premium_yearly"}, result.Expired)
+	subRepo.AssertExpectations(t)
+}
+
+func TestReconciliationService_NoDrift(t *testing.T) {
+	server := revenuecattest.NewServer("sk_test")
+	defer server.Close()
+
+	expires := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second)
+	server.SetSubscriber("user1", fmt.Sprintf(`{
+		"entitlements": {"premium": {"product_identifier": "premium_monthly", "purchase_date": %[1]q, "expires_date": %[1]q}},
+		"subscriptions": {"premium_monthly": {"purchase_date": %[1]q, "expires_date": %[1]q}}
+	}`, expires.Format(time.RFC3339)))
+
+	subRepo := new(mockSubRepo)
+	subRepo.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{
+		{ID: primitive.NewObjectID(), ExternalUserID: "user1", ProductID: "premium_monthly", Status: domain.SubscriptionActive, ExpiresAt: expires, Entitlements: []string{"premium"}},
+	}, nil)
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByRevenueCatID", mock.Anything, "user1").Return((*domain.User)(nil), fmt.Errorf("user not found"))
+
+	client := revenuecat.NewClient(server.URL, server.APIKey, time.Second, 0, zerolog.Nop())
+	s := NewReconciliationService(client, subRepo, userRepo, testCatalog(), zerolog.Nop())
+
+	result, err := s.ReconcileUser(context.Background(), "user1")
+	require.NoError(t, err)
+	assert.False(t, result.HasDrift())
+	assert.Equal(t, []string{"premium_monthly"}, result.Unchanged)
+	subRepo.AssertExpectations(t)
+}
+
+func TestReconciliationService_UnknownSubscriber(t *testing.T) {
+	server := revenuecattest.NewServer("sk_test")
+	defer server.Close()
+
+	client := revenuecat.NewClient(server.URL, server.APIKey, time.Second, 0, zerolog.Nop())
+	s := NewReconciliationService(client, new(mockSubRepo), new(mockUserRepo), testCatalog(), zerolog.Nop())
+
+	_, err := s.ReconcileUser(context.Background(), "ghost")
+	assert.ErrorIs(t, err, ports.ErrSubscriberNotFound)
+}
+
+func TestReconciliationService_ReconcileStale(t *testing.T) {
+	server := revenuecattest.NewServer("sk_test")
+	defer server.Close()
+
+	expires := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second)
+	server.SetSubscriber("user1", fmt.Sprintf(`{
+		"entitlements": {"premium": {"product_identifier": "premium_monthly", "purchase_date": %[1]q, "expires_date": %[1]q}},
+		"subscriptions": {"premium_monthly": {"purchase_date": %[1]q, "expires_date": %[1]q}}
+	}`, expires.Format(time.RFC3339)))
+
+	// The renewal webhook for user1 was lost; ghost is unknown to RevenueCat
+	userID := primitive.NewObjectID()
+	subRepo := new(mockSubRepo)
+	subRepo.On("FindUnreconciled", mock.Anything, mock.MatchedBy(func(before time.Time) bool {
+		return time.Since(before) > 23*time.Hour
+	}), 10).Return([]string{"ghost", "user1"}, nil)
+	subRepo.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{
+		{ID: primitive.NewObjectID(), InternalUserID: &userID, ExternalUserID: "user1", ProductID: "premium_monthly", Status: domain.SubscriptionActive, ExpiresAt: time.Now().Add(-time.Minute), Entitlements: []string{"premium"}},
+	}, nil)
+	subRepo.On("Update", mock.Anything, mock.MatchedBy(func(s *domain.Subscription) bool {
+		return s.ExpiresAt.Equal(expires)
+	})).Return(nil).Once()
+	subRepo.On("MarkReconciled", mock.Anything, "ghost", mock.Anything).Return(nil).Once()
+	subRepo.On("MarkReconciled", mock.Anything, "user1", mock.Anything).Return(nil).Once()
+
+	client := revenuecat.NewClient(server.URL, server.APIKey, time.Second, 0, zerolog.Nop())
+	s := NewReconciliationService(client, subRepo, new(mockUserRepo), testCatalog(), zerolog.Nop())
+
+	drifted, err := s.ReconcileStale(context.Background(), 24*time.Hour, 10)
+	require.NoError(t, err, "one failing subscriber does not fail the sweep")
+	assert.Equal(t, 1, drifted)
+	subRepo.AssertExpectations(t)
+
+	// When every subscriber fails, e.g. RevenueCat is down, the run fails
+	subRepo = new(mockSubRepo)
+	subRepo.On("FindUnreconciled", mock.Anything, mock.Anything, 10).Return([]string{"ghost"}, nil)
+	subRepo.On("MarkReconciled", mock.Anything, "ghost", mock.Anything).Return(nil).Once()
+	s = NewReconciliationService(client, subRepo, new(mockUserRepo), testCatalog(), zerolog.Nop())
+	_, err = s.ReconcileStale(context.Background(), 24*time.Hour, 10)
+	assert.Error(t, err)
+	subRepo.AssertExpectations(t)
+}
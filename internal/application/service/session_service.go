@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// lastSeenResolution limits last-seen writes to one per session per minute
+	lastSeenResolution = time.Minute
+	// maxDeviceFieldLength truncates client-supplied device details
+	maxDeviceFieldLength = 100
+)
+
+// DeviceInfo describes the device a user logs in from, as reported by the app
+type DeviceInfo struct {
+	Name       string
+	Platform   string
+	AppVersion string
+}
+
+// SessionRevoker ends a user's other sessions after their credentials change
+type SessionRevoker interface {
+	RevokeAll(ctx context.Context, userID, exceptSessionID string) error
+}
+
+// SessionService records a session per login so users can see and revoke their devices
+type SessionService struct {
+	sessionRepo ports.SessionRepository
+	ttl         time.Duration
+	logger      zerolog.Logger
+}
+
+// NewSessionService creates a new session service. ttl should match the access token
+// lifetime, since a session ends when its token expires.
+func NewSessionService(sessionRepo ports.SessionRepository, ttl time.Duration, logger zerolog.Logger) *SessionService {
+	return &SessionService{
+		sessionRepo: sessionRepo,
+		ttl:         ttl,
+		logger:      logger,
+	}
+}
+
+// Start records a new session for a user who has just logged in
+func (s *SessionService) Start(ctx context.Context, user *domain.User, device DeviceInfo, ip string) (*domain.Session, error) {
+	now := time.Now()
+	session := &domain.Session{
+		UserID:     user.ID,
+		DeviceName: truncate(device.Name, maxDeviceFieldLength),
+		Platform:   truncate(device.Platform, maxDeviceFieldLength),
+		AppVersion: truncate(device.AppVersion, maxDeviceFieldLength),
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.ttl),
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// List returns the user's active sessions, most recently used first
+func (s *SessionService) List(ctx context.Context, userID string) ([]*domain.Session, error) {
+	sessions, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := make([]*domain.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if session.Active(now) {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+// Revoke ends one of the user's sessions; its token stops working immediately
+func (s *SessionService) Revoke(ctx context.Context, userID, sessionID string) error {
+	if err := s.sessionRepo.Revoke(ctx, userID, sessionID, time.Now()); err != nil {
+		return err
+	}
+	s.logger.Info().Str("user_id", userID).Str("session_id", sessionID).Msg("Session revoked")
+	return nil
+}
+
+// RevokeAll ends all of the user's sessions except exceptSessionID, the one making the
+// change (empty to end every session). Tokens of the ended sessions stop working immediately.
+func (s *SessionService) RevokeAll(ctx context.Context, userID, exceptSessionID string) error {
+	revoked, err := s.sessionRepo.RevokeAllByUser(ctx, userID, exceptSessionID, time.Now())
+	if err != nil {
+		return err
+	}
+	s.logger.Info().Str("user_id", userID).Int64("revoked", revoked).Msg("Sessions revoked")
+	return nil
+}
+
+// Validate reports whether the session behind a token is still active, and records that
+// it was seen from ip
+func (s *SessionService) Validate(ctx context.Context, sessionID, userID, ip string) (bool, error) {
+	session, err := s.sessionRepo.GetByID(ctx, sessionID)
+	if errors.Is(err, ports.ErrSessionNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	if session.UserID.Hex() != userID || !session.Active(now) {
+		return false, nil
+	}
+
+	if now.Sub(session.LastSeenAt) >= lastSeenResolution || session.IP != ip {
+		if err := s.sessionRepo.Touch(ctx, sessionID, ip, now); err != nil {
+			s.logger.Warn().Err(err).Str("session_id", sessionID).Msg("Failed to update session last seen")
+		}
+	}
+	return true, nil
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// memorySessionRepo is an in-memory ports.SessionRepository
+type memorySessionRepo struct {
+	mu       sync.Mutex
+	sessions map[string]*domain.Session
+	touches  int
+}
+
+func newMemorySessionRepo() *memorySessionRepo {
+	return &memorySessionRepo{sessions: map[string]*domain.Session{}}
+}
+
+func (r *memorySessionRepo) Create(ctx context.Context, session *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session.ID = primitive.NewObjectID()
+	stored := *session
+	r.sessions[session.ID.Hex()] = &stored
+	return nil
+}
+
+func (r *memorySessionRepo) GetByID(ctx context.Context, id string) (*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, ports.ErrSessionNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (r *memorySessionRepo) ListByUser(ctx context.Context, userID string) ([]*domain.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*domain.Session
+	for _, session := range r.sessions {
+		if session.UserID.Hex() == userID {
+			copied := *session
+			out = append(out, &copied)
+		}
+	}
+	return out, nil
+}
+
+func (r *memorySessionRepo) Touch(ctx context.Context, id, ip string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if session, ok := r.sessions[id]; ok {
+		session.IP, session.LastSeenAt = ip, now
+		r.touches++
+	}
+	return nil
+}
+
+func (r *memorySessionRepo) Revoke(ctx context.Context, userID, id string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok || session.UserID.Hex() != userID || !session.Active(now) {
+		return ports.ErrSessionNotFound
+	}
+	session.RevokedAt = &now
+	return nil
+}
+
+func (r *memorySessionRepo) RevokeAllByUser(ctx context.Context, userID, exceptID string, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, session := range r.sessions {
+		if session.UserID.Hex() == userID && id != exceptID && session.Active(now) {
+			session.RevokedAt = &now
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *memorySessionRepo) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, session := range r.sessions {
+		if session.UserID.Hex() == userID {
+			delete(r.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestSessionService_StartListRevoke(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID()}
+	repo := newMemorySessionRepo()
+	s := NewSessionService(repo, time.Hour, zerolog.Nop())
+	ctx := context.Background()
+
+	phone, err := s.Start(ctx, user, DeviceInfo{Name: "Aiko's iPhone", Platform: "ios", AppVersion: "2.4.0"}, "10.0.0.1")
+	require.NoError(t, err)
+	tablet, err := s.Start(ctx, user, DeviceInfo{Name: "iPad", Platform: "ipados", AppVersion: "2.4.0"}, "10.0.0.2")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), phone.ExpiresAt, time.Minute)
+
+	sessions, err := s.List(ctx, user.ID.Hex())
+	require.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	assert.ErrorIs(t, s.Revoke(ctx, primitive.NewObjectID().Hex(), tablet.ID.Hex()), ports.ErrSessionNotFound, "users cannot revoke other users' sessions")
+	require.NoError(t, s.Revoke(ctx, user.ID.Hex(), tablet.ID.Hex()))
+	assert.ErrorIs(t, s.Revoke(ctx, user.ID.Hex(), tablet.ID.Hex()), ports.ErrSessionNotFound)
+
+	sessions, err = s.List(ctx, user.ID.Hex())
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, phone.ID, sessions[0].ID)
+
+	active, err := s.Validate(ctx, tablet.ID.Hex(), user.ID.Hex(), "10.0.0.2")
+	require.NoError(t, err)
+	assert.False(t, active, "tokens of revoked sessions are rejected")
+	active, err = s.Validate(ctx, phone.ID.Hex(), user.ID.Hex(), "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, active)
+}
+
+// loggedInTwice starts two sessions for user and returns them
+func loggedInTwice(t *testing.T, s *SessionService, user *domain.User) (current, other *domain.Session) {
+	t.Helper()
+	current, err := s.Start(context.Background(), user, DeviceInfo{Name: "phone"}, "10.0.0.1")
+	require.NoError(t, err)
+	other, err = s.Start(context.Background(), user, DeviceInfo{Name: "tablet"}, "10.0.0.2")
+	require.NoError(t, err)
+	return current, other
+}
+
+// activeSessionIDs lists the IDs of the user's active sessions
+func activeSessionIDs(t *testing.T, s *SessionService, userID string) []primitive.ObjectID {
+	t.Helper()
+	sessions, err := s.List(context.Background(), userID)
+	require.NoError(t, err)
+	ids := []primitive.ObjectID{}
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	return ids
+}
+
+func TestSessionService_RevokeAll(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID()}
+	someoneElse := &domain.User{ID: primitive.NewObjectID()}
+	s := NewSessionService(newMemorySessionRepo(), time.Hour, zerolog.Nop())
+	ctx := context.Background()
+
+	current, _ := loggedInTwice(t, s, user)
+	theirs, _ := loggedInTwice(t, s, someoneElse)
+
+	require.NoError(t, s.RevokeAll(ctx, user.ID.Hex(), current.ID.Hex()))
+	assert.Equal(t, []primitive.ObjectID{current.ID}, activeSessionIDs(t, s, user.ID.Hex()))
+	assert.Len(t, activeSessionIDs(t, s, someoneElse.ID.Hex()), 2)
+
+	require.NoError(t, s.RevokeAll(ctx, user.ID.Hex(), ""))
+	assert.Empty(t, activeSessionIDs(t, s, user.ID.Hex()))
+	active, err := s.Validate(ctx, theirs.ID.Hex(), someoneElse.ID.Hex(), "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, active)
+}
+
+func TestSessionService_Validate(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID()}
+	repo := newMemorySessionRepo()
+	s := NewSessionService(repo, time.Hour, zerolog.Nop())
+	ctx := context.Background()
+
+	session, err := s.Start(ctx, user, DeviceInfo{}, "10.0.0.1")
+	require.NoError(t, err)
+
+	active, err := s.Validate(ctx, session.ID.Hex(), primitive.NewObjectID().Hex(), "10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, active, "a session only validates for its own user")
+	active, err = s.Validate(ctx, primitive.NewObjectID().Hex(), user.ID.Hex(), "10.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	active, err = s.Validate(ctx, session.ID.Hex(), user.ID.Hex(), "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, active)
+	assert.Equal(t, 0, repo.touches, "last seen is not rewritten on every request")
+
+	active, err = s.Validate(ctx, session.ID.Hex(), user.ID.Hex(), "10.0.0.9")
+	require.NoError(t, err)
+	assert.True(t, active)
+	assert.Equal(t, 1, repo.touches)
+	stored, _ := repo.GetByID(ctx, session.ID.Hex())
+	assert.Equal(t, "10.0.0.9", stored.IP)
+
+	repo.sessions[session.ID.Hex()].ExpiresAt = time.Now().Add(-time.Second)
+	active, err = s.Validate(ctx, session.ID.Hex(), user.ID.Hex(), "10.0.0.9")
+	require.NoError(t, err)
+	assert.False(t, active, "expired sessions are rejected")
+}
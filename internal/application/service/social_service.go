@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrCannotFollowSelf  = errors.New("users cannot follow themselves")
+	ErrGuestCannotFollow = errors.New("guests cannot follow or be followed")
+	ErrFolloweeNotFound  = errors.New("user not found")
+	ErrFollowLimit       = errors.New("following too many users")
+	ErrInvalidFeedSize   = errors.New("invalid feed size")
+	ErrInvalidFeedCursor = errors.New("invalid feed cursor")
+)
+
+// SocialPolicy tunes follows and the activity feed
+type SocialPolicy struct {
+	MaxFollowing     int   // Follows a user can have, pending ones included
+	MaxFeedPage      int   // Largest feed page that can be asked for
+	StreakMilestones []int // Streak lengths, in days, shown in feeds
+	LevelBase        int   // XP from level 1 to 2, as in XPPolicy
+}
+
+// SocialService lets learners follow each other and shows them the milestones of those
+// they follow. Following a user who approves follows sends a request; two users
+// following each other are friends.
+type SocialService struct {
+	followRepo   ports.FollowRepository
+	activityRepo ports.ActivityRepository
+	userRepo     ports.UserRepository
+	courseRepo   ports.CourseRepository
+	streakRepo   ports.StreakRepository
+	xpRepo       ports.XPRepository
+	policy       SocialPolicy
+	logger       zerolog.Logger
+}
+
+// NewSocialService creates a new social service. Milestones are read from the streak and XP
+// repositories, so it observes progress after the streak and XP services.
+func NewSocialService(followRepo ports.FollowRepository, activityRepo ports.ActivityRepository, userRepo ports.UserRepository, courseRepo ports.CourseRepository, streakRepo ports.StreakRepository, xpRepo ports.XPRepository, policy SocialPolicy, logger zerolog.Logger) *SocialService {
+	return &SocialService{
+		followRepo:   followRepo,
+		activityRepo: activityRepo,
+		userRepo:     userRepo,
+		courseRepo:   courseRepo,
+		streakRepo:   streakRepo,
+		xpRepo:       xpRepo,
+		policy:       policy,
+		logger:       logger,
+	}
+}
+
+// Follow makes the follower follow the followee, or asks to if the followee approves
+// follows. Following again returns the existing follow.
+func (s *SocialService) Follow(ctx context.Context, followerID, followeeID string) (*domain.Follow, error) {
+	if followerID == followeeID {
+		return nil, ErrCannotFollowSelf
+	}
+	follower, err := s.userRepo.GetByID(ctx, followerID)
+	if err != nil {
+		return nil, err
+	}
+	followee, err := s.userRepo.GetByID(ctx, followeeID)
+	if err != nil {
+		return nil, ErrFolloweeNotFound
+	}
+	if follower.IsGuest() || followee.IsGuest() {
+		return nil, ErrGuestCannotFollow
+	}
+
+	existing, err := s.followRepo.Get(ctx, followerID, followeeID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, ports.ErrFollowNotFound) {
+		return nil, err
+	}
+	following, err := s.followRepo.CountFollowing(ctx, followerID)
+	if err != nil {
+		return nil, err
+	}
+	if following >= int64(s.policy.MaxFollowing) {
+		return nil, ErrFollowLimit
+	}
+
+	now := time.Now()
+	follow := &domain.Follow{FollowerID: follower.ID, FolloweeID: followee.ID, Status: domain.FollowPending, CreatedAt: now}
+	if !followee.FollowApproval {
+		follow.Status = domain.FollowAccepted
+		follow.AcceptedAt = &now
+	}
+	err = s.followRepo.Create(ctx, follow)
+	if errors.Is(err, ports.ErrFollowExists) {
+		// Followed concurrently
+		return s.followRepo.Get(ctx, followerID, followeeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return follow, nil
+}
+
+// Unfollow stops following the followee, or withdraws the request to
+func (s *SocialService) Unfollow(ctx context.Context, followerID, followeeID string) error {
+	return s.followRepo.Delete(ctx, followerID, followeeID)
+}
+
+// Accept approves a follow request
+func (s *SocialService) Accept(ctx context.Context, userID, followerID string) error {
+	return s.followRepo.Accept(ctx, followerID, userID, time.Now())
+}
+
+// RemoveFollower removes a follower, or declines their request
+func (s *SocialService) RemoveFollower(ctx context.Context, userID, followerID string) error {
+	return s.followRepo.Delete(ctx, followerID, userID)
+}
+
+// Following lists who the user follows, with requests still pending
+func (s *SocialService) Following(ctx context.Context, userID string) ([]domain.Connection, error) {
+	accepted, err := s.followRepo.Following(ctx, userID, domain.FollowAccepted)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := s.followRepo.Following(ctx, userID, domain.FollowPending)
+	if err != nil {
+		return nil, err
+	}
+	return s.connections(ctx, userID, append(pending, accepted...), func(f domain.Follow) primitive.ObjectID { return f.FolloweeID })
+}
+
+// Followers lists who follows the user
+func (s *SocialService) Followers(ctx context.Context, userID string) ([]domain.Connection, error) {
+	follows, err := s.followRepo.Followers(ctx, userID, domain.FollowAccepted)
+	if err != nil {
+		return nil, err
+	}
+	return s.connections(ctx, userID, follows, func(f domain.Follow) primitive.ObjectID { return f.FollowerID })
+}
+
+// Requests lists the follow requests waiting for the user's approval
+func (s *SocialService) Requests(ctx context.Context, userID string) ([]domain.Connection, error) {
+	follows, err := s.followRepo.Followers(ctx, userID, domain.FollowPending)
+	if err != nil {
+		return nil, err
+	}
+	return s.connections(ctx, userID, follows, func(f domain.Follow) primitive.ObjectID { return f.FollowerID })
+}
+
+// connections turns the user's follows into the other users they connect with, by name,
+// marking the ones who follow each other
+func (s *SocialService) connections(ctx context.Context, userID string, follows []domain.Follow, other func(domain.Follow) primitive.ObjectID) ([]domain.Connection, error) {
+	connections := []domain.Connection{}
+	if len(follows) == 0 {
+		return connections, nil
+	}
+
+	ids := make([]string, len(follows))
+	for i, f := range follows {
+		ids[i] = other(f).Hex()
+	}
+	names, err := s.names(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	followers, err := s.followRepo.FollowersAmong(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	followed, err := s.followed(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range follows {
+		id := other(f)
+		if _, ok := names[id.Hex()]; !ok {
+			continue // Erased in the meantime
+		}
+		connections = append(connections, domain.Connection{
+			UserID: id,
+			Name:   names[id.Hex()],
+			Status: f.Status,
+			Mutual: slices.Contains(followers, id.Hex()) && followed[id.Hex()],
+			Since:  f.CreatedAt,
+		})
+	}
+	return connections, nil
+}
+
+// followed returns which of ids the user follows, accepted follows only
+func (s *SocialService) followed(ctx context.Context, userID string, ids []string) (map[string]bool, error) {
+	follows, err := s.followRepo.Following(ctx, userID, domain.FollowAccepted)
+	if err != nil {
+		return nil, err
+	}
+	followed := make(map[string]bool, len(follows))
+	for _, f := range follows {
+		if slices.Contains(ids, f.FolloweeID.Hex()) {
+			followed[f.FolloweeID.Hex()] = true
+		}
+	}
+	return followed, nil
+}
+
+// Feed returns a page of the milestones of the users the user follows, newest first.
+// Activities of a user visible to friends only are included if they follow back. before
+// is the NextCursor of the previous page, empty for the first one.
+func (s *SocialService) Feed(ctx context.Context, userID, before string, limit int) (*domain.FeedPage, error) {
+	if limit < 1 || limit > s.policy.MaxFeedPage {
+		return nil, ErrInvalidFeedSize
+	}
+	if before != "" && !primitive.IsValidObjectID(before) {
+		return nil, ErrInvalidFeedCursor
+	}
+
+	page := &domain.FeedPage{Items: []domain.FeedItem{}}
+	following, err := s.followRepo.Following(ctx, userID, domain.FollowAccepted)
+	if err != nil || len(following) == 0 {
+		return page, err
+	}
+	ids := make([]string, len(following))
+	for i, f := range following {
+		ids[i] = f.FolloweeID.Hex()
+	}
+	friends, err := s.followRepo.FollowersAmong(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	var followers []string
+	for _, id := range ids {
+		if !slices.Contains(friends, id) {
+			followers = append(followers, id)
+		}
+	}
+
+	// One more than asked for tells whether there is a next page
+	activities, err := s.activityRepo.Feed(ctx, followers, friends, before, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(activities) > limit {
+		activities = activities[:limit]
+		page.NextCursor = activities[limit-1].ID.Hex()
+	}
+
+	authors := make([]string, 0, len(activities))
+	for _, a := range activities {
+		if !slices.Contains(authors, a.UserID.Hex()) {
+			authors = append(authors, a.UserID.Hex())
+		}
+	}
+	names, err := s.names(ctx, authors)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range activities {
+		page.Items = append(page.Items, domain.FeedItem{Activity: a, Name: names[a.UserID.Hex()]})
+	}
+	return page, nil
+}
+
+// names returns the names of the users by ID
+func (s *SocialService) names(ctx context.Context, ids []string) (map[string]string, error) {
+	names := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+	users, err := s.userRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		names[u.ID.Hex()] = u.Name
+	}
+	return names, nil
+}
+
+// SettingsChanged applies the user's privacy settings: their activities get the current
+// visibility, and pending requests are accepted once follows no longer need approval
+func (s *SocialService) SettingsChanged(ctx context.Context, user *domain.User) error {
+	if err := s.activityRepo.SetVisibility(ctx, user.ID.Hex(), user.Visibility()); err != nil {
+		return err
+	}
+	if !user.FollowApproval {
+		if _, err := s.followRepo.AcceptAll(ctx, user.ID.Hex(), time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProgressRecorded records the milestones a progress write reached
+func (s *SocialService) ProgressRecorded(ctx context.Context, userID string, progress *domain.Progress) {
+	if err := s.RecordMilestones(ctx, userID, progress); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msg("Failed to record milestones")
+	}
+}
+
+// RecordMilestones records the milestones reached with the progress: a completed lesson,
+// a streak reaching one of the milestone lengths and a new XP level. Milestones already
+// recorded are skipped. Guests have no followers, so nothing is recorded for them.
+func (s *SocialService) RecordMilestones(ctx context.Context, userID string, progress *domain.Progress) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.IsGuest() {
+		return nil
+	}
+
+	var activities []domain.Activity
+	if progress.Completed && progress.EntityType == domain.LessonEntity {
+		course, err := s.courseRepo.GetByLessonID(ctx, progress.EntityID.Hex())
+		if err != nil {
+			return err
+		}
+		a := domain.Activity{Kind: domain.ActivityLessonCompleted, Key: progress.EntityID.Hex(), LessonID: &progress.EntityID, CourseName: course.Name}
+		for _, l := range course.Lessons {
+			if l.ID == progress.EntityID {
+				a.LessonTitle = l.Title
+			}
+		}
+		activities = append(activities, a)
+	}
+
+	streak, err := s.streakRepo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if streak != nil && slices.Contains(s.policy.StreakMilestones, streak.Current) {
+		// Keyed by day, so a milestone reached again after losing the streak shows again
+		activities = append(activities, domain.Activity{Kind: domain.ActivityStreakMilestone, Key: strconv.Itoa(streak.Current) + "@" + streak.LastActiveDay, Value: streak.Current})
+	}
+
+	if progress.Completed {
+		total, err := s.xpRepo.Total(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if level := domain.LevelFor(total, s.policy.LevelBase).Level; level > 1 {
+			activities = append(activities, domain.Activity{Kind: domain.ActivityLevelReached, Key: strconv.Itoa(level), Value: level})
+		}
+	}
+
+	for _, a := range activities {
+		a.UserID = user.ID
+		a.Visibility = user.Visibility()
+		a.CreatedAt = time.Now()
+		err := s.activityRepo.Record(ctx, &a)
+		if errors.Is(err, ports.ErrActivityExists) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PersonalDataName implements PersonalDataStore
+func (s *SocialService) PersonalDataName() string {
+	return "social"
+}
+
+// ExportUserData implements PersonalDataStore
+func (s *SocialService) ExportUserData(ctx context.Context, userID string) (any, error) {
+	following, err := s.Following(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	followers, err := s.Followers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	requests, err := s.Requests(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	activities, err := s.activityRepo.ByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Following  []domain.Connection `json:"following"`
+		Followers  []domain.Connection `json:"followers"`
+		Requests   []domain.Connection `json:"requests"`
+		Activities []domain.Activity   `json:"activities"`
+	}{following, followers, requests, activities}, nil
+}
+
+// EraseUserData implements PersonalDataStore; follows to and from the user are removed
+func (s *SocialService) EraseUserData(ctx context.Context, userID string) (int64, error) {
+	follows, err := s.followRepo.DeleteByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	activities, err := s.activityRepo.DeleteByUser(ctx, userID)
+	return follows + activities, err
+}
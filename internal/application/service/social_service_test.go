@@ -0,0 +1,432 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// memoryFollowRepo is an in-memory ports.FollowRepository
+type memoryFollowRepo struct {
+	follows []domain.Follow
+}
+
+func (r *memoryFollowRepo) find(followerID, followeeID string) int {
+	return slices.IndexFunc(r.follows, func(f domain.Follow) bool {
+		return f.FollowerID.Hex() == followerID && f.FolloweeID.Hex() == followeeID
+	})
+}
+
+func (r *memoryFollowRepo) Create(ctx context.Context, follow *domain.Follow) error {
+	if r.find(follow.FollowerID.Hex(), follow.FolloweeID.Hex()) >= 0 {
+		return ports.ErrFollowExists
+	}
+	follow.ID = primitive.NewObjectID()
+	r.follows = append(r.follows, *follow)
+	return nil
+}
+
+func (r *memoryFollowRepo) Get(ctx context.Context, followerID, followeeID string) (*domain.Follow, error) {
+	i := r.find(followerID, followeeID)
+	if i < 0 {
+		return nil, ports.ErrFollowNotFound
+	}
+	follow := r.follows[i]
+	return &follow, nil
+}
+
+func (r *memoryFollowRepo) Accept(ctx context.Context, followerID, followeeID string, at time.Time) error {
+	i := r.find(followerID, followeeID)
+	if i < 0 || r.follows[i].Status != domain.FollowPending {
+		return ports.ErrFollowNotFound
+	}
+	r.follows[i].Status = domain.FollowAccepted
+	r.follows[i].AcceptedAt = &at
+	return nil
+}
+
+func (r *memoryFollowRepo) AcceptAll(ctx context.Context, followeeID string, at time.Time) (int64, error) {
+	var accepted int64
+	for i, f := range r.follows {
+		if f.FolloweeID.Hex() == followeeID && f.Status == domain.FollowPending {
+			r.follows[i].Status = domain.FollowAccepted
+			r.follows[i].AcceptedAt = &at
+			accepted++
+		}
+	}
+	return accepted, nil
+}
+
+func (r *memoryFollowRepo) Delete(ctx context.Context, followerID, followeeID string) error {
+	i := r.find(followerID, followeeID)
+	if i < 0 {
+		return ports.ErrFollowNotFound
+	}
+	r.follows = slices.Delete(r.follows, i, i+1)
+	return nil
+}
+
+func (r *memoryFollowRepo) list(match func(domain.Follow) bool) []domain.Follow {
+	follows := []domain.Follow{}
+	for i := len(r.follows) - 1; i >= 0; i-- {
+		if match(r.follows[i]) {
+			follows = append(follows, r.follows[i])
+		}
+	}
+	return follows
+}
+
+func (r *memoryFollowRepo) Following(ctx context.Context, followerID string, status domain.FollowStatus) ([]domain.Follow, error) {
+	return r.list(func(f domain.Follow) bool { return f.FollowerID.Hex() == followerID && f.Status == status }), nil
+}
+
+func (r *memoryFollowRepo) Followers(ctx context.Context, followeeID string, status domain.FollowStatus) ([]domain.Follow, error) {
+	return r.list(func(f domain.Follow) bool { return f.FolloweeID.Hex() == followeeID && f.Status == status }), nil
+}
+
+func (r *memoryFollowRepo) CountFollowing(ctx context.Context, followerID string) (int64, error) {
+	return int64(len(r.list(func(f domain.Follow) bool { return f.FollowerID.Hex() == followerID }))), nil
+}
+
+func (r *memoryFollowRepo) FollowersAmong(ctx context.Context, followeeID string, userIDs []string) ([]string, error) {
+	var followers []string
+	for _, f := range r.list(func(f domain.Follow) bool {
+		return f.FolloweeID.Hex() == followeeID && f.Status == domain.FollowAccepted
+	}) {
+		if slices.Contains(userIDs, f.FollowerID.Hex()) {
+			followers = append(followers, f.FollowerID.Hex())
+		}
+	}
+	return followers, nil
+}
+
+func (r *memoryFollowRepo) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	before := len(r.follows)
+	r.follows = slices.DeleteFunc(r.follows, func(f domain.Follow) bool {
+		return f.FollowerID.Hex() == userID || f.FolloweeID.Hex() == userID
+	})
+	return int64(before - len(r.follows)), nil
+}
+
+// memoryActivityRepo is an in-memory ports.ActivityRepository
+type memoryActivityRepo struct {
+	activities []domain.Activity
+}
+
+func (r *memoryActivityRepo) Record(ctx context.Context, activity *domain.Activity) error {
+	for _, a := range r.activities {
+		if a.UserID == activity.UserID && a.Kind == activity.Kind && a.Key == activity.Key {
+			return ports.ErrActivityExists
+		}
+	}
+	activity.ID = primitive.NewObjectID()
+	r.activities = append(r.activities, *activity)
+	return nil
+}
+
+func (r *memoryActivityRepo) Feed(ctx context.Context, followers, friends []string, before string, limit int) ([]domain.Activity, error) {
+	feed := []domain.Activity{}
+	for i := len(r.activities) - 1; i >= 0 && len(feed) < limit; i-- {
+		a := r.activities[i]
+		if before != "" && a.ID.Hex() >= before {
+			continue
+		}
+		author := a.UserID.Hex()
+		if (slices.Contains(followers, author) && a.Visibility == domain.VisibleToFollowers) ||
+			(slices.Contains(friends, author) && a.Visibility != domain.VisibleToNobody) {
+			feed = append(feed, a)
+		}
+	}
+	return feed, nil
+}
+
+func (r *memoryActivityRepo) ByUser(ctx context.Context, userID string) ([]domain.Activity, error) {
+	activities := []domain.Activity{}
+	for _, a := range r.activities {
+		if a.UserID.Hex() == userID {
+			activities = append(activities, a)
+		}
+	}
+	return activities, nil
+}
+
+func (r *memoryActivityRepo) SetVisibility(ctx context.Context, userID string, visibility domain.ActivityVisibility) error {
+	for i, a := range r.activities {
+		if a.UserID.Hex() == userID {
+			r.activities[i].Visibility = visibility
+		}
+	}
+	return nil
+}
+
+func (r *memoryActivityRepo) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	before := len(r.activities)
+	r.activities = slices.DeleteFunc(r.activities, func(a domain.Activity) bool { return a.UserID.Hex() == userID })
+	return int64(before - len(r.activities)), nil
+}
+
+// memoryUserDirectory answers user lookups from a list of users
+type memoryUserDirectory struct {
+	mockUserRepo
+	users []*domain.User
+}
+
+func (r *memoryUserDirectory) GetByID(ctx context.Context, id string) (*domain.User, error) {
+	for _, u := range r.users {
+		if u.ID.Hex() == id {
+			return u, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *memoryUserDirectory) GetByIDs(ctx context.Context, ids []string) ([]*domain.User, error) {
+	var users []*domain.User
+	for _, u := range r.users {
+		if slices.Contains(ids, u.ID.Hex()) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+type socialFixture struct {
+	follows    *memoryFollowRepo
+	activities *memoryActivityRepo
+	users      *memoryUserDirectory
+	courses    *mockCourseRepo
+	streaks    *memoryStreakRepo
+	xp         *memoryXPRepo
+	service    *SocialService
+}
+
+func newSocialFixture() *socialFixture {
+	f := &socialFixture{
+		follows:    &memoryFollowRepo{},
+		activities: &memoryActivityRepo{},
+		users:      &memoryUserDirectory{},
+		courses:    new(mockCourseRepo),
+		streaks:    newMemoryStreakRepo(),
+		xp:         newMemoryXPRepo(),
+	}
+	policy := SocialPolicy{MaxFollowing: 3, MaxFeedPage: 20, StreakMilestones: []int{7, 30}, LevelBase: 100}
+	f.service = NewSocialService(f.follows, f.activities, f.users, f.courses, f.streaks, f.xp, policy, zerolog.Nop())
+	return f
+}
+
+func (f *socialFixture) user(name string) *domain.User {
+	user := &domain.User{ID: primitive.NewObjectID(), Name: name, Role: domain.RoleStudent}
+	f.users.users = append(f.users.users, user)
+	return user
+}
+
+func (f *socialFixture) follow(t *testing.T, follower, followee *domain.User) *domain.Follow {
+	follow, err := f.service.Follow(context.Background(), follower.ID.Hex(), followee.ID.Hex())
+	require.NoError(t, err)
+	return follow
+}
+
+// milestone records a streak milestone for the user, one per call
+func (f *socialFixture) milestone(t *testing.T, user *domain.User, days int) {
+	f.streaks.streaks[user.ID.Hex()] = domain.Streak{UserID: user.ID, Current: days, LastActiveDay: domain.AddDays("2024-05-01", len(f.activities.activities))}
+	require.NoError(t, f.service.RecordMilestones(context.Background(), user.ID.Hex(), &domain.Progress{EntityID: primitive.NewObjectID(), EntityType: domain.SyllableEntity}))
+}
+
+func connectionNames(connections []domain.Connection) []string {
+	names := []string{}
+	for _, c := range connections {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestSocialService_Follow(t *testing.T) {
+	f := newSocialFixture()
+	ctx := context.Background()
+	aiko, kenji, yui := f.user("Aiko"), f.user("Kenji"), f.user("Yui")
+	yui.FollowApproval = true
+
+	follow := f.follow(t, aiko, kenji)
+	assert.Equal(t, domain.FollowAccepted, follow.Status)
+	assert.NotNil(t, follow.AcceptedAt)
+	again := f.follow(t, aiko, kenji)
+	assert.Equal(t, follow.ID, again.ID, "following again changes nothing")
+
+	// Yui approves her followers
+	follow = f.follow(t, aiko, yui)
+	assert.Equal(t, domain.FollowPending, follow.Status)
+	requests, err := f.service.Requests(ctx, yui.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Aiko"}, connectionNames(requests))
+	followers, _ := f.service.Followers(ctx, yui.ID.Hex())
+	assert.Empty(t, followers)
+
+	require.NoError(t, f.service.Accept(ctx, yui.ID.Hex(), aiko.ID.Hex()))
+	assert.ErrorIs(t, f.service.Accept(ctx, yui.ID.Hex(), aiko.ID.Hex()), ports.ErrFollowNotFound)
+	followers, _ = f.service.Followers(ctx, yui.ID.Hex())
+	assert.Equal(t, []string{"Aiko"}, connectionNames(followers))
+	assert.False(t, followers[0].Mutual)
+
+	// Following back makes them friends
+	f.follow(t, yui, aiko)
+	following, err := f.service.Following(ctx, aiko.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Yui", "Kenji"}, connectionNames(following))
+	assert.True(t, following[0].Mutual)
+	assert.False(t, following[1].Mutual)
+
+	_, err = f.service.Follow(ctx, aiko.ID.Hex(), aiko.ID.Hex())
+	assert.ErrorIs(t, err, ErrCannotFollowSelf)
+	_, err = f.service.Follow(ctx, aiko.ID.Hex(), primitive.NewObjectID().Hex())
+	assert.ErrorIs(t, err, ErrFolloweeNotFound)
+	guest := f.user("Guest")
+	guest.Role = domain.RoleGuest
+	_, err = f.service.Follow(ctx, aiko.ID.Hex(), guest.ID.Hex())
+	assert.ErrorIs(t, err, ErrGuestCannotFollow)
+	f.follow(t, aiko, f.user("Ren"))
+	_, err = f.service.Follow(ctx, aiko.ID.Hex(), f.user("Sora").ID.Hex())
+	assert.ErrorIs(t, err, ErrFollowLimit)
+
+	// Removing a follower, and unfollowing, end the friendship
+	require.NoError(t, f.service.RemoveFollower(ctx, aiko.ID.Hex(), yui.ID.Hex()))
+	require.NoError(t, f.service.Unfollow(ctx, aiko.ID.Hex(), kenji.ID.Hex()))
+	assert.ErrorIs(t, f.service.Unfollow(ctx, aiko.ID.Hex(), kenji.ID.Hex()), ports.ErrFollowNotFound)
+	following, _ = f.service.Following(ctx, aiko.ID.Hex())
+	assert.Equal(t, []string{"Ren", "Yui"}, connectionNames(following))
+	assert.False(t, following[1].Mutual)
+
+	// Turning approval off lets pending requests in
+	f.follow(t, kenji, yui)
+	yui.FollowApproval = false
+	require.NoError(t, f.service.SettingsChanged(ctx, yui))
+	followers, _ = f.service.Followers(ctx, yui.ID.Hex())
+	assert.Equal(t, []string{"Kenji", "Aiko"}, connectionNames(followers))
+}
+
+func TestSocialService_RecordMilestones(t *testing.T) {
+	f := newSocialFixture()
+	ctx := context.Background()
+	aiko := f.user("Aiko")
+	lessonID := primitive.NewObjectID()
+	f.courses.On("GetByLessonID", mock.Anything, lessonID.Hex()).Return(&domain.Course{
+		Name:    "Hiragana Basics",
+		Lessons: []domain.Lesson{{ID: primitive.NewObjectID(), Title: "Vowels"}, {ID: lessonID, Title: "K-row"}},
+	}, nil)
+	lesson := &domain.Progress{EntityID: lessonID, EntityType: domain.LessonEntity, Completed: true}
+
+	_, _ = f.xp.AddToDay(ctx, aiko.ID.Hex(), "2024-05-01", 250, 30) // Level 2
+	f.streaks.streaks[aiko.ID.Hex()] = domain.Streak{UserID: aiko.ID, Current: 7, LastActiveDay: "2024-05-01"}
+	require.NoError(t, f.service.RecordMilestones(ctx, aiko.ID.Hex(), lesson))
+	require.NoError(t, f.service.RecordMilestones(ctx, aiko.ID.Hex(), lesson))
+
+	activities, _ := f.activities.ByUser(ctx, aiko.ID.Hex())
+	require.Len(t, activities, 3, "each milestone is recorded once")
+	assert.Equal(t, domain.ActivityLessonCompleted, activities[0].Kind)
+	assert.Equal(t, "K-row", activities[0].LessonTitle)
+	assert.Equal(t, "Hiragana Basics", activities[0].CourseName)
+	assert.Equal(t, domain.ActivityStreakMilestone, activities[1].Kind)
+	assert.Equal(t, 7, activities[1].Value)
+	assert.Equal(t, domain.ActivityLevelReached, activities[2].Kind)
+	assert.Equal(t, 2, activities[2].Value)
+	assert.Equal(t, domain.VisibleToFollowers, activities[2].Visibility)
+
+	// Reaching 7 days again after losing the streak shows again; incomplete progress and
+	// days between milestones add nothing
+	f.streaks.streaks[aiko.ID.Hex()] = domain.Streak{UserID: aiko.ID, Current: 8, LastActiveDay: "2024-05-02"}
+	require.NoError(t, f.service.RecordMilestones(ctx, aiko.ID.Hex(), &domain.Progress{EntityID: lessonID, EntityType: domain.LessonEntity}))
+	f.streaks.streaks[aiko.ID.Hex()] = domain.Streak{UserID: aiko.ID, Current: 7, LastActiveDay: "2024-06-01"}
+	require.NoError(t, f.service.RecordMilestones(ctx, aiko.ID.Hex(), &domain.Progress{EntityID: lessonID, EntityType: domain.LessonEntity}))
+	activities, _ = f.activities.ByUser(ctx, aiko.ID.Hex())
+	assert.Len(t, activities, 4)
+
+	guest := f.user("Guest")
+	guest.Role = domain.RoleGuest
+	f.streaks.streaks[guest.ID.Hex()] = domain.Streak{UserID: guest.ID, Current: 7, LastActiveDay: "2024-05-01"}
+	require.NoError(t, f.service.RecordMilestones(ctx, guest.ID.Hex(), lesson))
+	activities, _ = f.activities.ByUser(ctx, guest.ID.Hex())
+	assert.Empty(t, activities)
+}
+
+func TestSocialService_Feed(t *testing.T) {
+	f := newSocialFixture()
+	ctx := context.Background()
+	aiko, kenji, yui, ren, sora := f.user("Aiko"), f.user("Kenji"), f.user("Yui"), f.user("Ren"), f.user("Sora")
+	kenji.ActivityVisibility = domain.VisibleToFriends
+	yui.ActivityVisibility = domain.VisibleToFriends
+	ren.ActivityVisibility = domain.VisibleToNobody
+	sora.FollowApproval = true
+
+	f.follow(t, aiko, kenji) // Kenji shares with friends, but does not follow back
+	f.follow(t, aiko, yui)   // Yui shares with friends and follows back
+	f.follow(t, yui, aiko)
+	f.follow(t, aiko, ren)   // Ren shares with nobody
+	f.follow(t, kenji, sora) // Sora has not accepted Kenji
+	for i := 0; i < 3; i++ {
+		for _, user := range []*domain.User{kenji, yui, ren, sora} {
+			f.milestone(t, user, 7)
+		}
+	}
+	f.milestone(t, aiko, 30) // Aiko's own are not in her feed
+
+	page, err := f.service.Feed(ctx, aiko.ID.Hex(), "", 2)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, "Yui", page.Items[0].Name)
+	assert.NotEmpty(t, page.NextCursor)
+	page, err = f.service.Feed(ctx, aiko.ID.Hex(), page.NextCursor, 2)
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	assert.Empty(t, page.NextCursor)
+	assert.Equal(t, "Yui", page.Items[0].Name)
+
+	// Kenji sees nothing until Sora accepts, then sees everything she shares
+	page, _ = f.service.Feed(ctx, kenji.ID.Hex(), "", 20)
+	assert.Empty(t, page.Items)
+	require.NoError(t, f.service.Accept(ctx, sora.ID.Hex(), kenji.ID.Hex()))
+	page, _ = f.service.Feed(ctx, kenji.ID.Hex(), "", 20)
+	assert.Len(t, page.Items, 3)
+
+	// Kenji opening up to followers applies to past milestones
+	kenji.ActivityVisibility = domain.VisibleToFollowers
+	require.NoError(t, f.service.SettingsChanged(ctx, kenji))
+	page, _ = f.service.Feed(ctx, aiko.ID.Hex(), "", 20)
+	assert.Len(t, page.Items, 6)
+
+	_, err = f.service.Feed(ctx, aiko.ID.Hex(), "", 21)
+	assert.ErrorIs(t, err, ErrInvalidFeedSize)
+	_, err = f.service.Feed(ctx, aiko.ID.Hex(), "not-a-cursor", 20)
+	assert.ErrorIs(t, err, ErrInvalidFeedCursor)
+}
+
+func TestSocialService_EraseUserData(t *testing.T) {
+	f := newSocialFixture()
+	ctx := context.Background()
+	aiko, kenji, yui := f.user("Aiko"), f.user("Kenji"), f.user("Yui")
+	f.follow(t, aiko, kenji)
+	f.follow(t, yui, aiko)
+	f.follow(t, kenji, yui)
+	f.milestone(t, aiko, 7)
+
+	exported, err := f.service.ExportUserData(ctx, aiko.ID.Hex())
+	require.NoError(t, err)
+	assert.NotNil(t, exported)
+
+	removed, err := f.service.EraseUserData(ctx, aiko.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), removed, "two follows and a milestone")
+	followers, _ := f.service.Followers(ctx, kenji.ID.Hex())
+	assert.Empty(t, followers)
+	following, _ := f.service.Following(ctx, kenji.ID.Hex())
+	assert.Equal(t, []string{"Yui"}, connectionNames(following))
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// streakSaveAttempts bounds retries when concurrent writes race on the same streak
+const streakSaveAttempts = 3
+
+// StreakPolicy tunes streak freezes
+type StreakPolicy struct {
+	MaxFreezes      int // Earned freezes stop accumulating at this many
+	EarnFreezeEvery int // Streak days per earned freeze; 0 disables earning
+	// FreezeProducts are the consumable store products that each grant one freeze
+	FreezeProducts []string
+}
+
+// StreakService tracks daily learning streaks. Every progress write counts as activity on
+// that day in the user's timezone.
+type StreakService struct {
+	streakRepo  ports.StreakRepository
+	userRepo    ports.UserRepository
+	subscribers ports.SubscriberProvider
+	policy      StreakPolicy
+	logger      zerolog.Logger
+}
+
+// NewStreakService creates a new streak service. subscribers is used to verify freeze
+// purchases with the billing provider.
+func NewStreakService(streakRepo ports.StreakRepository, userRepo ports.UserRepository, subscribers ports.SubscriberProvider, policy StreakPolicy, logger zerolog.Logger) *StreakService {
+	return &StreakService{
+		streakRepo:  streakRepo,
+		userRepo:    userRepo,
+		subscribers: subscribers,
+		policy:      policy,
+		logger:      logger,
+	}
+}
+
+// ProgressRecorded counts a progress write as activity today
+func (s *StreakService) ProgressRecorded(ctx context.Context, userID string, progress *domain.Progress) {
+	if _, err := s.RecordActivity(ctx, userID, time.Now()); err != nil {
+		s.logger.Error().Err(err).Str("user_id", userID).Msg("Failed to record streak activity")
+	}
+}
+
+// RecordActivity counts the day at falls on, in the user's timezone, as active
+func (s *StreakService) RecordActivity(ctx context.Context, userID string, at time.Time) (*domain.Streak, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	day := domain.DayIn(at, userLocation(user))
+	rules := domain.StreakRules{MaxFreezes: s.policy.MaxFreezes, EarnFreezeEvery: s.policy.EarnFreezeEvery}
+	return s.update(ctx, userID, func(streak *domain.Streak) bool {
+		return streak.RecordActivity(day, rules)
+	})
+}
+
+// GetStreak returns the user's streak as of today in their timezone
+func (s *StreakService) GetStreak(ctx context.Context, user *domain.User) (*domain.StreakStatus, error) {
+	streak, err := s.streakRepo.Get(ctx, user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	status := streak.StatusOn(domain.DayIn(time.Now(), userLocation(user)))
+	return &status, nil
+}
+
+// ClaimFreezes credits the freezes the user bought in the app store. Purchases are checked
+// with the billing provider and each one is only credited once, so the app can call this
+// after every purchase or restore. It returns how many freezes were added.
+func (s *StreakService) ClaimFreezes(ctx context.Context, user *domain.User) (int, *domain.StreakStatus, error) {
+	purchases, err := s.freezePurchases(ctx, user)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	credited := 0
+	if len(purchases) > 0 {
+		_, err = s.update(ctx, user.ID.Hex(), func(streak *domain.Streak) bool {
+			credited = 0
+			for _, id := range purchases {
+				if !slices.Contains(streak.CreditedPurchases, id) {
+					streak.CreditedPurchases = append(streak.CreditedPurchases, id)
+					streak.Freezes++
+					credited++
+				}
+			}
+			return credited > 0
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	if credited > 0 {
+		s.logger.Info().Str("user_id", user.ID.Hex()).Int("freezes", credited).Msg("Streak freezes purchased")
+	}
+
+	status, err := s.GetStreak(ctx, user)
+	if err != nil {
+		return 0, nil, err
+	}
+	return credited, status, nil
+}
+
+// freezePurchases returns the IDs of the user's production purchases of freeze products
+func (s *StreakService) freezePurchases(ctx context.Context, user *domain.User) ([]string, error) {
+	if user.RevenueCatUserID == "" || len(s.policy.FreezeProducts) == 0 {
+		return nil, nil
+	}
+
+	subscriber, err := s.subscribers.GetSubscriber(ctx, user.RevenueCatUserID)
+	if errors.Is(err, ports.ErrSubscriberNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, product := range s.policy.FreezeProducts {
+		for _, p := range subscriber.NonSubscriptions[product] {
+			if !p.IsSandbox {
+				ids = append(ids, p.ID)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// PersonalDataName implements PersonalDataStore
+func (s *StreakService) PersonalDataName() string {
+	return "streak"
+}
+
+// ExportUserData implements PersonalDataStore
+func (s *StreakService) ExportUserData(ctx context.Context, userID string) (any, error) {
+	return s.streakRepo.Get(ctx, userID)
+}
+
+// EraseUserData implements PersonalDataStore
+func (s *StreakService) EraseUserData(ctx context.Context, userID string) (int64, error) {
+	return s.streakRepo.Delete(ctx, userID)
+}
+
+// MergeUserData implements GuestDataMerger: the account keeps its own streak, or takes
+// over the guest's if it has none
+func (s *StreakService) MergeUserData(ctx context.Context, guestID, targetID string) error {
+	guest, err := s.streakRepo.Get(ctx, guestID)
+	if err != nil || guest == nil {
+		return err
+	}
+
+	target, err := s.streakRepo.Get(ctx, targetID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		adopted := *guest
+		adopted.UserID, err = primitive.ObjectIDFromHex(targetID)
+		if err != nil {
+			return err
+		}
+		adopted.Version = 0
+		adopted.UpdatedAt = time.Now()
+		if err := s.streakRepo.Save(ctx, &adopted); err != nil && !errors.Is(err, ports.ErrStreakConflict) {
+			return err
+		}
+	}
+
+	_, err = s.streakRepo.Delete(ctx, guestID)
+	return err
+}
+
+// update applies change to the user's streak and saves it, starting over when a
+// concurrent write saved the streak first. change returns false if there is nothing to save.
+func (s *StreakService) update(ctx context.Context, userID string, change func(*domain.Streak) bool) (*domain.Streak, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < streakSaveAttempts; attempt++ {
+		streak, err := s.streakRepo.Get(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if streak == nil {
+			streak = &domain.Streak{UserID: objID}
+		}
+		if !change(streak) {
+			return streak, nil
+		}
+
+		streak.UpdatedAt = time.Now()
+		err = s.streakRepo.Save(ctx, streak)
+		if errors.Is(err, ports.ErrStreakConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return streak, nil
+	}
+	return nil, ports.ErrStreakConflict
+}
+
+// userLocation returns the user's timezone, UTC if they have not set a valid one
+func userLocation(user *domain.User) *time.Location {
+	if user.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
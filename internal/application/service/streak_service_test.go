@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/adapters/revenuecat"
+	"nihongo-api/internal/adapters/revenuecat/revenuecattest"
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// memoryStreakRepo is an in-memory ports.StreakRepository with the same versioning rules
+type memoryStreakRepo struct {
+	streaks map[string]domain.Streak
+}
+
+func newMemoryStreakRepo() *memoryStreakRepo {
+	return &memoryStreakRepo{streaks: map[string]domain.Streak{}}
+}
+
+func (r *memoryStreakRepo) Get(ctx context.Context, userID string) (*domain.Streak, error) {
+	streak, ok := r.streaks[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &streak, nil
+}
+
+func (r *memoryStreakRepo) Save(ctx context.Context, streak *domain.Streak) error {
+	if r.streaks[streak.UserID.Hex()].Version != streak.Version {
+		return ports.ErrStreakConflict
+	}
+	streak.Version++
+	r.streaks[streak.UserID.Hex()] = *streak
+	return nil
+}
+
+func (r *memoryStreakRepo) Delete(ctx context.Context, userID string) (int64, error) {
+	if _, ok := r.streaks[userID]; !ok {
+		return 0, nil
+	}
+	delete(r.streaks, userID)
+	return 1, nil
+}
+
+func streakUser(t *testing.T, userRepo *mockUserRepo, timezone string) *domain.User {
+	user := &domain.User{ID: primitive.NewObjectID(), Timezone: timezone}
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	return user
+}
+
+func at(t *testing.T, value string) time.Time {
+	ts, err := time.Parse(time.RFC3339, value)
+	require.NoError(t, err)
+	return ts
+}
+
+func TestStreakService_DayBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		activity []string
+		want     int
+		wantDay  string
+	}{
+		{
+			// 23h25m apart across spring forward, but on consecutive New York days
+			name:     "spring forward, consecutive days",
+			timezone: "America/New_York",
+			activity: []string{"2024-03-09T23:30:00-05:00", "2024-03-10T23:55:00-04:00"},
+			want:     2,
+			wantDay:  "2024-03-10",
+		},
+		{
+			// The 23 hour day still counts once
+			name:     "spring forward, same day",
+			timezone: "America/New_York",
+			activity: []string{"2024-03-10T00:10:00-05:00", "2024-03-10T23:50:00-04:00"},
+			want:     1,
+			wantDay:  "2024-03-10",
+		},
+		{
+			// 24h50m apart inside the 25 hour day when clocks fall back
+			name:     "fall back, same day",
+			timezone: "America/New_York",
+			activity: []string{"2024-11-03T00:05:00-04:00", "2024-11-03T23:55:00-05:00"},
+			want:     1,
+			wantDay:  "2024-11-03",
+		},
+		{
+			name:     "fall back, the hour that repeats",
+			timezone: "America/New_York",
+			activity: []string{"2024-11-02T12:00:00-04:00", "2024-11-03T01:30:00-04:00", "2024-11-03T01:30:00-05:00", "2024-11-04T00:00:00-05:00"},
+			want:     3,
+			wantDay:  "2024-11-04",
+		},
+		{
+			// Half-hour DST shift in Lord Howe Island
+			name:     "half-hour DST shift",
+			timezone: "Australia/Lord_Howe",
+			activity: []string{"2024-10-05T23:45:00+10:30", "2024-10-06T23:45:00+11:00"},
+			want:     2,
+			wantDay:  "2024-10-06",
+		},
+		{
+			// Same instants as above in UTC would be one day apart; in Tokyo they are the same day
+			name:     "timezone decides the day",
+			timezone: "Asia/Tokyo",
+			activity: []string{"2024-05-01T15:30:00Z", "2024-05-02T14:30:00Z"},
+			want:     1,
+			wantDay:  "2024-05-02",
+		},
+		{
+			name:     "missing timezone uses UTC",
+			timezone: "",
+			activity: []string{"2024-05-01T15:30:00Z", "2024-05-02T14:30:00Z"},
+			want:     2,
+			wantDay:  "2024-05-02",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userRepo := new(mockUserRepo)
+			user := streakUser(t, userRepo, tt.timezone)
+			s := NewStreakService(newMemoryStreakRepo(), userRepo, nil, StreakPolicy{}, zerolog.Nop())
+
+			var streak *domain.Streak
+			for _, a := range tt.activity {
+				var err error
+				streak, err = s.RecordActivity(context.Background(), user.ID.Hex(), at(t, a))
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, streak.Current)
+			assert.Equal(t, tt.wantDay, streak.LastActiveDay)
+		})
+	}
+}
+
+func TestStreak_Freezes(t *testing.T) {
+	rules := domain.StreakRules{MaxFreezes: 2, EarnFreezeEvery: 3}
+	streak := &domain.Streak{}
+	day := "2024-01-01"
+	for i := 0; i < 6; i++ {
+		streak.RecordActivity(domain.AddDays(day, i), rules)
+	}
+	require.Equal(t, 6, streak.Current)
+	require.Equal(t, 2, streak.Freezes, "a freeze every 3 days")
+
+	// One missed day is covered by a freeze
+	streak.RecordActivity("2024-01-08", rules)
+	assert.Equal(t, 7, streak.Current)
+	assert.Equal(t, 1, streak.Freezes)
+	assert.Equal(t, []string{"2024-01-07"}, streak.FrozenDays)
+
+	// While missed days can still be covered the streak shows as alive
+	assert.Equal(t, 7, streak.StatusOn("2024-01-10").Current)
+	assert.False(t, streak.StatusOn("2024-01-10").ActiveToday)
+	assert.Equal(t, 0, streak.StatusOn("2024-01-11").Current)
+
+	// Two missed days with one freeze left start the streak again
+	streak.RecordActivity("2024-01-11", rules)
+	assert.Equal(t, 1, streak.Current)
+	assert.Equal(t, 1, streak.Freezes, "freezes are kept when they cannot save the streak")
+	assert.Equal(t, 7, streak.Longest)
+
+	assert.False(t, streak.RecordActivity("2024-01-10", rules), "an earlier day after a timezone change is ignored")
+	assert.True(t, streak.StatusOn("2024-01-11").ActiveToday)
+}
+
+func TestStreakService_ClaimFreezes(t *testing.T) {
+	server := revenuecattest.NewServer("sk_test")
+	defer server.Close()
+	server.SetSubscriber("rc1", `{
+		"non_subscriptions": {
+			"streak_freeze": [
+				{"id": "t1", "store": "app_store", "purchase_date": "2024-05-01T10:00:00Z"},
+				{"id": "t2", "store": "app_store", "purchase_date": "2024-05-02T10:00:00Z"},
+				{"id": "t3", "store": "app_store", "purchase_date": "2024-05-02T11:00:00Z", "is_sandbox": true}
+			],
+			"jlpt_n2_pack": [{"id": "p1", "store": "app_store", "purchase_date": "2024-05-01T10:00:00Z"}]
+		}
+	}`)
+	client := revenuecat.NewClient(server.URL, server.APIKey, time.Second, 0, zerolog.Nop())
+
+	userRepo := new(mockUserRepo)
+	user := streakUser(t, userRepo, "Europe/Madrid")
+	user.RevenueCatUserID = "rc1"
+	repo := newMemoryStreakRepo()
+	s := NewStreakService(repo, userRepo, client, StreakPolicy{MaxFreezes: 2, FreezeProducts: []string{"streak_freeze"}}, zerolog.Nop())
+
+	credited, status, err := s.ClaimFreezes(context.Background(), user)
+	require.NoError(t, err)
+	assert.Equal(t, 2, credited, "sandbox and other products are not credited")
+	assert.Equal(t, 2, repo.streaks[user.ID.Hex()].Freezes)
+	assert.Equal(t, 0, status.Current)
+
+	credited, _, err = s.ClaimFreezes(context.Background(), user)
+	require.NoError(t, err)
+	assert.Zero(t, credited, "purchases are only credited once")
+	assert.Equal(t, 2, repo.streaks[user.ID.Hex()].Freezes)
+}
+
+func TestStreakService_UserData(t *testing.T) {
+	ctx := context.Background()
+	userRepo := new(mockUserRepo)
+	guest := streakUser(t, userRepo, "")
+	target := streakUser(t, userRepo, "")
+	repo := newMemoryStreakRepo()
+	s := NewStreakService(repo, userRepo, nil, StreakPolicy{}, zerolog.Nop())
+
+	for i := 0; i < 3; i++ {
+		_, err := s.RecordActivity(ctx, guest.ID.Hex(), time.Now().AddDate(0, 0, i-2))
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.MergeUserData(ctx, guest.ID.Hex(), target.ID.Hex()))
+	assert.Equal(t, 3, repo.streaks[target.ID.Hex()].Current, "an account without a streak takes the guest's")
+	assert.NotContains(t, repo.streaks, guest.ID.Hex())
+
+	// The streak is erased and recorded on the receipt with the account
+	userRepo.On("Delete", mock.Anything, target.ID.Hex()).Return(nil)
+	subRepo := new(mockSubRepo)
+	subRepo.On("DetachInternalUserID", mock.Anything, target.ID.Hex()).Return(int64(0), nil)
+	privacy := NewPrivacyService(userRepo, &memoryProgressRepo{}, subRepo, newMemorySessionRepo(), &memoryAuditLog{}, &memoryReceiptRepo{}, zerolog.Nop())
+	privacy.AddStore(s)
+
+	receipt, err := privacy.Erase(ctx, target)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"streak": 1}, receipt.OtherDeleted)
+	assert.Empty(t, repo.streaks)
+}
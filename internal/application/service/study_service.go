@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidStatsRange is returned when stats are asked for a malformed, reversed or too
+// long range of days
+var ErrInvalidStatsRange = errors.New("invalid stats range")
+
+const (
+	// studyClockSkew is how far in the future a session may end, for devices whose clock
+	// runs ahead
+	studyClockSkew = 5 * time.Minute
+	// defaultStudyStatsDays is the range stats cover when none is given
+	defaultStudyStatsDays = 30
+)
+
+// StudyPolicy bounds what study sessions are accepted and how much stats are computed
+type StudyPolicy struct {
+	MaxSessionLength time.Duration // Longer sessions are rejected as the app's error
+	MaxRangeDays     int           // Largest number of days stats can be asked for
+}
+
+// StudySessionUpload is a batch of completed study sessions sent by the app
+type StudySessionUpload struct {
+	Sessions []StudySessionReport `json:"sessions" validate:"required,min=1,max=100,dive"`
+}
+
+// StudySessionReport is one completed study session
+type StudySessionReport struct {
+	ClientID     string    `json:"client_id" validate:"required,max=64"`
+	StartedAt    time.Time `json:"started_at" validate:"required"`
+	EndedAt      time.Time `json:"ended_at" validate:"required"`
+	ItemsSeen    int       `json:"items_seen" validate:"min=0,max=10000"`
+	ItemsCorrect int       `json:"items_correct" validate:"min=0,max=10000"`
+	Device       string    `json:"device" validate:"max=100"`
+}
+
+// StudyUploadResult tells how many sessions of a batch were new
+type StudyUploadResult struct {
+	Received int   `json:"received"`
+	Recorded int64 `json:"recorded"`
+}
+
+// StudyService records study sessions and sums up the study done per day, from the
+// sessions and the attempts logged with progress writes
+type StudyService struct {
+	studyRepo  ports.StudySessionRepository
+	attemptLog ports.AttemptLog
+	policy     StudyPolicy
+	validate   *validator.Validate
+	logger     zerolog.Logger
+}
+
+// NewStudyService creates a new study service
+func NewStudyService(studyRepo ports.StudySessionRepository, attemptLog ports.AttemptLog, policy StudyPolicy, logger zerolog.Logger) *StudyService {
+	return &StudyService{
+		studyRepo:  studyRepo,
+		attemptLog: attemptLog,
+		policy:     policy,
+		validate:   newValidator(),
+		logger:     logger,
+	}
+}
+
+// RecordSessions saves a batch of sessions. Sessions already uploaded, by client ID, are
+// skipped, so a batch whose response was lost can be sent again.
+func (s *StudyService) RecordSessions(ctx context.Context, userID string, upload StudySessionUpload) (*StudyUploadResult, error) {
+	if err := s.validate.Struct(upload); err != nil {
+		return nil, validationError(err)
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := make([]domain.StudySession, len(upload.Sessions))
+	for i, r := range upload.Sessions {
+		if fields := s.checkSession(r, now); len(fields) > 0 {
+			return nil, &ValidationError{Fields: fields}
+		}
+		sessions[i] = domain.StudySession{
+			UserID:       userObjID,
+			ClientID:     r.ClientID,
+			StartedAt:    r.StartedAt,
+			EndedAt:      r.EndedAt,
+			ItemsSeen:    r.ItemsSeen,
+			ItemsCorrect: r.ItemsCorrect,
+			Device:       strings.TrimSpace(r.Device),
+			CreatedAt:    now,
+		}
+	}
+
+	recorded, err := s.studyRepo.Save(ctx, sessions)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Debug().Str("user_id", userID).Int("received", len(sessions)).Int64("recorded", recorded).Msg("Study sessions recorded")
+	return &StudyUploadResult{Received: len(sessions), Recorded: recorded}, nil
+}
+
+// checkSession returns what is wrong with a session beyond its single fields, keyed like
+// validation errors
+func (s *StudyService) checkSession(r StudySessionReport, now time.Time) map[string]string {
+	fields := map[string]string{}
+	switch {
+	case !r.EndedAt.After(r.StartedAt):
+		fields["ended_at"] = "must be after started_at"
+	case r.EndedAt.Sub(r.StartedAt) > s.policy.MaxSessionLength:
+		fields["ended_at"] = "must be at most " + s.policy.MaxSessionLength.String() + " after started_at"
+	case r.EndedAt.After(now.Add(studyClockSkew)):
+		fields["ended_at"] = "must not be in the future"
+	}
+	if r.ItemsCorrect > r.ItemsSeen {
+		fields["items_correct"] = "must be at most items_seen"
+	}
+	return fields
+}
+
+// Stats sums up the study done on each day from one day to another, inclusive, in the
+// user's timezone. An empty to means today, and an empty from the 30 days up to to.
+func (s *StudyService) Stats(ctx context.Context, user *domain.User, from, to string) (*domain.StudyStats, error) {
+	loc := userLocation(user)
+	if to == "" {
+		to = domain.DayIn(time.Now(), loc)
+	}
+	if from == "" {
+		from = domain.AddDays(to, -(min(defaultStudyStatsDays, s.policy.MaxRangeDays) - 1))
+	}
+	if !validDay(from) || !validDay(to) {
+		return nil, ErrInvalidStatsRange
+	}
+	span := domain.DaysBetween(from, to) + 1
+	if span < 1 || span > s.policy.MaxRangeDays {
+		return nil, ErrInvalidStatsRange
+	}
+
+	userID := user.ID.Hex()
+	sessionDays, err := s.studyRepo.DailyStats(ctx, userID, loc, from, to)
+	if err != nil {
+		return nil, err
+	}
+	attemptDays, err := s.attemptLog.DailyStats(ctx, userID, loc, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionsByDay := make(map[string]domain.SessionDay, len(sessionDays))
+	for _, d := range sessionDays {
+		sessionsByDay[d.Day] = d
+	}
+	attemptsByDay := make(map[string]domain.AttemptDay, len(attemptDays))
+	for _, d := range attemptDays {
+		attemptsByDay[d.Day] = d
+	}
+
+	stats := &domain.StudyStats{From: from, To: to, Timezone: loc.String(), Days: make([]domain.StudyDay, span)}
+	var total domain.SessionDay
+	var totalAttempts domain.AttemptDay
+	for i := range span {
+		day := domain.AddDays(from, i)
+		sd, ad := sessionsByDay[day], attemptsByDay[day]
+		stats.Days[i] = studyDay(day, sd, ad)
+
+		total.Sessions += sd.Sessions
+		total.Seconds += sd.Seconds
+		total.ItemsSeen += sd.ItemsSeen
+		total.ItemsCorrect += sd.ItemsCorrect
+		totalAttempts.Attempts += ad.Attempts
+		totalAttempts.Correct += ad.Correct
+		totalAttempts.Reviews += ad.Reviews
+		totalAttempts.Retained += ad.Retained
+	}
+	stats.Totals = studyDay("", total, totalAttempts)
+	return stats, nil
+}
+
+// studyDay combines the sessions and attempts of a day, or of a whole range
+func studyDay(day string, sd domain.SessionDay, ad domain.AttemptDay) domain.StudyDay {
+	d := domain.StudyDay{
+		Day:       day,
+		Sessions:  sd.Sessions,
+		Minutes:   int(math.Round(float64(sd.Seconds) / 60)),
+		ItemsSeen: sd.ItemsSeen,
+		Attempts:  ad.Attempts,
+		Reviews:   ad.Reviews,
+		Retained:  ad.Retained,
+	}
+	if ad.Attempts > 0 {
+		d.Accuracy = ratio(ad.Correct, ad.Attempts)
+	} else if sd.ItemsSeen > 0 {
+		d.Accuracy = ratio(sd.ItemsCorrect, sd.ItemsSeen)
+	}
+	if ad.Reviews > 0 {
+		d.RetentionRate = ratio(ad.Retained, ad.Reviews)
+	}
+	return d
+}
+
+func ratio(n, of int) *float64 {
+	r := float64(n) / float64(of)
+	return &r
+}
+
+// validDay reports whether day is a calendar day such as 2024-03-10
+func validDay(day string) bool {
+	_, err := time.Parse(domain.DayLayout, day)
+	return err == nil
+}
+
+// PersonalDataName implements PersonalDataStore
+func (s *StudyService) PersonalDataName() string {
+	return "study_sessions"
+}
+
+// ExportUserData implements PersonalDataStore
+func (s *StudyService) ExportUserData(ctx context.Context, userID string) (any, error) {
+	return s.studyRepo.ListByUser(ctx, userID)
+}
+
+// EraseUserData implements PersonalDataStore
+func (s *StudyService) EraseUserData(ctx context.Context, userID string) (int64, error) {
+	return s.studyRepo.DeleteByUser(ctx, userID)
+}
+
+// MergeUserData implements GuestDataMerger: the guest's sessions move to the account
+func (s *StudyService) MergeUserData(ctx context.Context, guestID, targetID string) error {
+	_, err := s.studyRepo.Reassign(ctx, guestID, targetID)
+	return err
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+)
+
+// memoryStudySessionRepo is an in-memory ports.StudySessionRepository
+type memoryStudySessionRepo struct {
+	sessions []domain.StudySession
+}
+
+func (r *memoryStudySessionRepo) has(userID primitive.ObjectID, clientID string) bool {
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.ClientID == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryStudySessionRepo) Save(ctx context.Context, sessions []domain.StudySession) (int64, error) {
+	var saved int64
+	for _, s := range sessions {
+		if r.has(s.UserID, s.ClientID) {
+			continue
+		}
+		s.ID = primitive.NewObjectID()
+		r.sessions = append(r.sessions, s)
+		saved++
+	}
+	return saved, nil
+}
+
+func (r *memoryStudySessionRepo) DailyStats(ctx context.Context, userID string, loc *time.Location, from, to string) ([]domain.SessionDay, error) {
+	byDay := map[string]*domain.SessionDay{}
+	for _, s := range r.sessions {
+		day := domain.DayIn(s.StartedAt, loc)
+		if s.UserID.Hex() != userID || day < from || day > to {
+			continue
+		}
+		d, ok := byDay[day]
+		if !ok {
+			d = &domain.SessionDay{Day: day}
+			byDay[day] = d
+		}
+		d.Sessions++
+		d.Seconds += int(s.Duration().Seconds())
+		d.ItemsSeen += s.ItemsSeen
+		d.ItemsCorrect += s.ItemsCorrect
+	}
+
+	days := []domain.SessionDay{}
+	for _, d := range byDay {
+		days = append(days, *d)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+	return days, nil
+}
+
+func (r *memoryStudySessionRepo) ListByUser(ctx context.Context, userID string) ([]domain.StudySession, error) {
+	sessions := []domain.StudySession{}
+	for _, s := range r.sessions {
+		if s.UserID.Hex() == userID {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *memoryStudySessionRepo) Reassign(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	to, _ := primitive.ObjectIDFromHex(toUserID)
+	kept := r.sessions[:0]
+	var moved int64
+	for _, s := range r.sessions {
+		if s.UserID.Hex() == fromUserID {
+			if r.has(to, s.ClientID) {
+				continue
+			}
+			s.UserID = to
+			moved++
+		}
+		kept = append(kept, s)
+	}
+	r.sessions = kept
+	return moved, nil
+}
+
+func (r *memoryStudySessionRepo) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	kept := r.sessions[:0]
+	for _, s := range r.sessions {
+		if s.UserID.Hex() != userID {
+			kept = append(kept, s)
+		}
+	}
+	removed := int64(len(r.sessions) - len(kept))
+	r.sessions = kept
+	return removed, nil
+}
+
+var testStudyPolicy = StudyPolicy{MaxSessionLength: 12 * time.Hour, MaxRangeDays: 31}
+
+func studySession(t *testing.T, clientID, startedAt string, minutes, seen, correct int) StudySessionReport {
+	start := at(t, startedAt)
+	return StudySessionReport{ClientID: clientID, StartedAt: start, EndedAt: start.Add(time.Duration(minutes) * time.Minute), ItemsSeen: seen, ItemsCorrect: correct, Device: " iPhone 15 "}
+}
+
+func TestStudyService_RecordSessions(t *testing.T) {
+	repo := &memoryStudySessionRepo{}
+	s := NewStudyService(repo, &memoryAttemptLog{}, testStudyPolicy, zerolog.Nop())
+	ctx := context.Background()
+	userID := primitive.NewObjectID().Hex()
+
+	first := studySession(t, "a", "2024-05-01T08:00:00Z", 20, 40, 30)
+	second := studySession(t, "b", "2024-05-01T19:00:00Z", 10, 15, 15)
+	result, err := s.RecordSessions(ctx, userID, StudySessionUpload{Sessions: []StudySessionReport{first, second}})
+	require.NoError(t, err)
+	assert.Equal(t, &StudyUploadResult{Received: 2, Recorded: 2}, result)
+	assert.Equal(t, "iPhone 15", repo.sessions[0].Device)
+
+	// A batch sent again only records the sessions not seen before
+	third := studySession(t, "c", "2024-05-02T08:00:00Z", 5, 10, 5)
+	result, err = s.RecordSessions(ctx, userID, StudySessionUpload{Sessions: []StudySessionReport{first, second, third}})
+	require.NoError(t, err)
+	assert.Equal(t, &StudyUploadResult{Received: 3, Recorded: 1}, result)
+	assert.Len(t, repo.sessions, 3)
+
+	backwards := studySession(t, "d", "2024-05-02T08:00:00Z", -5, 10, 5)
+	tooLong := studySession(t, "e", "2024-05-02T08:00:00Z", 13*60, 10, 5)
+	future := studySession(t, "f", time.Now().Add(time.Hour).Format(time.RFC3339), 5, 10, 5)
+	overCorrect := studySession(t, "g", "2024-05-02T08:00:00Z", 5, 10, 11)
+	noID := studySession(t, "", "2024-05-02T08:00:00Z", 5, 10, 5)
+	tests := []struct {
+		name   string
+		upload StudySessionUpload
+		field  string
+	}{
+		{"empty batch", StudySessionUpload{}, "sessions"},
+		{"ends before it starts", StudySessionUpload{Sessions: []StudySessionReport{backwards}}, "ended_at"},
+		{"too long", StudySessionUpload{Sessions: []StudySessionReport{tooLong}}, "ended_at"},
+		{"ends in the future", StudySessionUpload{Sessions: []StudySessionReport{future}}, "ended_at"},
+		{"more correct than seen", StudySessionUpload{Sessions: []StudySessionReport{overCorrect}}, "items_correct"},
+		{"no client ID", StudySessionUpload{Sessions: []StudySessionReport{noID}}, "client_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.RecordSessions(ctx, userID, tt.upload)
+			var verr *ValidationError
+			require.ErrorAs(t, err, &verr)
+			assert.Contains(t, verr.Fields, tt.field)
+		})
+	}
+	assert.Len(t, repo.sessions, 3, "invalid batches are not saved")
+}
+
+func TestStudyService_Stats(t *testing.T) {
+	repo := &memoryStudySessionRepo{}
+	log := &memoryAttemptLog{}
+	s := NewStudyService(repo, log, testStudyPolicy, zerolog.Nop())
+	ctx := context.Background()
+	user := &domain.User{ID: primitive.NewObjectID(), Timezone: "Asia/Tokyo"}
+
+	// 23:30 UTC is already the next morning in Tokyo
+	_, err := s.RecordSessions(ctx, user.ID.Hex(), StudySessionUpload{Sessions: []StudySessionReport{
+		studySession(t, "a", "2024-05-01T23:30:00Z", 20, 40, 30),
+		studySession(t, "b", "2024-05-02T10:00:00Z", 10, 10, 10),
+		studySession(t, "c", "2024-05-03T23:00:00Z", 15, 20, 15),
+	}})
+	require.NoError(t, err)
+
+	shi, tsu := primitive.NewObjectID(), primitive.NewObjectID()
+	attempt := func(entityID primitive.ObjectID, createdAt string, correct bool) {
+		log.attempts = append(log.attempts, domain.Attempt{UserID: user.ID, EntityID: entityID, EntityType: domain.SyllableEntity, Correct: correct, CreatedAt: at(t, createdAt)})
+	}
+	attempt(shi, "2024-04-30T03:00:00Z", false) // Before the range: shi is first seen on 04-30
+	attempt(shi, "2024-05-02T00:00:00Z", true)  // 05-02 in Tokyo: a review, retained
+	attempt(shi, "2024-05-02T00:05:00Z", false) // Not the first answer of the day
+	attempt(tsu, "2024-05-02T00:10:00Z", true)  // First seen: no review
+	attempt(tsu, "2024-05-02T16:00:00Z", false) // 05-03 in Tokyo: a review, forgotten
+	attempt(tsu, "2024-05-02T16:01:00Z", true)
+
+	stats, err := s.Stats(ctx, user, "2024-05-01", "2024-05-04")
+	require.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", stats.Timezone)
+	require.Len(t, stats.Days, 4)
+
+	empty := stats.Days[0]
+	assert.Equal(t, "2024-05-01", empty.Day)
+	assert.Zero(t, empty.Sessions)
+	assert.Nil(t, empty.Accuracy)
+	assert.Nil(t, empty.RetentionRate)
+
+	may2 := stats.Days[1]
+	assert.Equal(t, "2024-05-02", may2.Day)
+	assert.Equal(t, 2, may2.Sessions)
+	assert.Equal(t, 30, may2.Minutes)
+	assert.Equal(t, 50, may2.ItemsSeen)
+	assert.Equal(t, 3, may2.Attempts)
+	require.NotNil(t, may2.Accuracy)
+	assert.InDelta(t, 2.0/3, *may2.Accuracy, 0.001, "accuracy comes from attempts")
+	assert.Equal(t, 1, may2.Reviews)
+	assert.Equal(t, 1, may2.Retained)
+	require.NotNil(t, may2.RetentionRate)
+	assert.InDelta(t, 1.0, *may2.RetentionRate, 0.001)
+
+	may3 := stats.Days[2]
+	assert.Equal(t, 1, may3.Reviews)
+	assert.Equal(t, 0, may3.Retained)
+	require.NotNil(t, may3.RetentionRate)
+	assert.Zero(t, *may3.RetentionRate)
+
+	may4 := stats.Days[3]
+	assert.Equal(t, 1, may4.Sessions)
+	assert.Zero(t, may4.Attempts)
+	require.NotNil(t, may4.Accuracy)
+	assert.InDelta(t, 0.75, *may4.Accuracy, 0.001, "without attempts accuracy comes from sessions")
+
+	assert.Empty(t, stats.Totals.Day)
+	assert.Equal(t, 3, stats.Totals.Sessions)
+	assert.Equal(t, 45, stats.Totals.Minutes)
+	assert.Equal(t, 5, stats.Totals.Attempts)
+	assert.Equal(t, 2, stats.Totals.Reviews)
+	require.NotNil(t, stats.Totals.RetentionRate)
+	assert.InDelta(t, 0.5, *stats.Totals.RetentionRate, 0.001)
+
+	stats, err = s.Stats(ctx, user, "", "2024-05-04")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-04-05", stats.From)
+	assert.Len(t, stats.Days, 30)
+
+	for _, r := range [][2]string{{"2024-05-04", "2024-05-01"}, {"2024-04-01", "2024-05-04"}, {"May 1", "2024-05-04"}} {
+		_, err := s.Stats(ctx, user, r[0], r[1])
+		assert.ErrorIs(t, err, ErrInvalidStatsRange, r)
+	}
+}
+
+func TestStudyService_UserData(t *testing.T) {
+	repo := &memoryStudySessionRepo{}
+	s := NewStudyService(repo, &memoryAttemptLog{}, testStudyPolicy, zerolog.Nop())
+	ctx := context.Background()
+	guestID, userID := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+
+	_, err := s.RecordSessions(ctx, guestID, StudySessionUpload{Sessions: []StudySessionReport{
+		studySession(t, "a", "2024-05-01T08:00:00Z", 20, 40, 30),
+		studySession(t, "b", "2024-05-01T19:00:00Z", 10, 15, 15),
+	}})
+	require.NoError(t, err)
+	// The app uploaded one of the guest's sessions again after logging in
+	_, err = s.RecordSessions(ctx, userID, StudySessionUpload{Sessions: []StudySessionReport{studySession(t, "b", "2024-05-01T19:00:00Z", 10, 15, 15)}})
+	require.NoError(t, err)
+
+	require.NoError(t, s.MergeUserData(ctx, guestID, userID))
+	require.NoError(t, s.MergeUserData(ctx, guestID, userID))
+	exported, err := s.ExportUserData(ctx, userID)
+	require.NoError(t, err)
+	assert.Len(t, exported.([]domain.StudySession), 2)
+
+	removed, err := s.EraseUserData(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), removed)
+}
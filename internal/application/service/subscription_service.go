@@ -5,32 +5,49 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"expvar"
+	"fmt"
+	"slices"
 	"time"
 
 	"nihongo-api/internal/domain"
 	"nihongo-api/internal/ports"
 
 	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type UserSyncer interface {
 	SyncRevenueCatUser(ctx context.Context, revenueCatUserID, name, email, password string) (*domain.User, error)
 }
 
+// EntitlementResolver maps purchased products to internal entitlements
+type EntitlementResolver interface {
+	Resolve(ctx context.Context, productID string, entitlementIDs []string) (*domain.CatalogMatch, error)
+}
+
 type SubscriptionService struct {
-	subRepo  ports.SubscriptionRepository
-	userRepo ports.UserRepository
-	userSvc  UserSyncer
-	logger   zerolog.Logger
+	subRepo     ports.SubscriptionRepository
+	events      ports.ProcessedEventRepository
+	userRepo    ports.UserRepository
+	userSvc     UserSyncer
+	catalog     EntitlementResolver
+	gracePeriod time.Duration
+	logger      zerolog.Logger
 	// Opcional: progressService ports.ProgressService para actualizar acceso premium
 }
 
-func NewSubscriptionService(subRepo ports.SubscriptionRepository, userRepo ports.UserRepository, userSvc UserSyncer, logger zerolog.Logger) *SubscriptionService {
+// NewSubscriptionService creates a subscription service. gracePeriod is how long
+// access is retained after a BILLING_ISSUE before the subscription expires.
+func NewSubscriptionService(subRepo ports.SubscriptionRepository, events ports.ProcessedEventRepository, userRepo ports.UserRepository, userSvc UserSyncer, catalog EntitlementResolver, gracePeriod time.Duration, logger zerolog.Logger) *SubscriptionService {
 	return &SubscriptionService{
-		subRepo:  subRepo,
-		userRepo: userRepo,
-		userSvc:  userSvc,
-		logger:   logger,
+		subRepo:     subRepo,
+		events:      events,
+		userRepo:    userRepo,
+		userSvc:     userSvc,
+		catalog:     catalog,
+		gracePeriod: gracePeriod,
+		logger:      logger,
 	}
 }
 
@@ -53,26 +70,43 @@ func (s *SubscriptionService) ProcessEvent(ctx context.Context, event *ports.Rev
 		return nil
 	}
 
-	// Verificar si es producto premium (ejemplo: product_id contiene "premium" o entitlement)
-	if !isPremiumProduct(event.ProductID, event.EntitlementID) {
-		s.logger.Debug().Str("product_id", event.ProductID).Msg("Ignoring non-premium event")
-		return nil // Ignorar eventos no premium
+	// Resolver el producto contra el catálogo configurado
+	match, err := s.catalog.Resolve(ctx, event.ProductID, eventEntitlementIDs(event))
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Error resolving product catalog")
+		return ErrTransient
+	}
+	if match == nil {
+		s.logger.Warn().
+			Str("product_id", event.ProductID).
+			Strs("entitlement_ids", eventEntitlementIDs(event)).
+			Msg("Product not in catalog; ignoring event")
+		return nil // Ack so RevenueCat does not retry; add the product to the catalog to handle it
 	}
 
-	// Check idempotencia
-	existingSub, err := s.subRepo.GetByEventID(ctx, event.ID)
+	// Check idempotencia. Events applied before the processed event log existed are only
+	// known from the event_id of their subscription
+	processed, err := s.events.Exists(ctx, event.ID)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Error checking idempotency")
 		return ErrTransient
 	}
-	if existingSub != nil {
+	var existingSub *domain.Subscription
+	if !processed {
+		existingSub, err = s.subRepo.GetByEventID(ctx, event.ID)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Error checking idempotency")
+			return ErrTransient
+		}
+	}
+	if processed || existingSub != nil {
 		s.logger.Info().Str("event_id", event.ID).Msg("Event already processed (idempotent)")
 		return nil // Ya procesado (idempotent)
 	}
 
 	// If event type is unsupported, return early to avoid unnecessary repo calls
 	switch event.Type {
-	case "INITIAL_PURCHASE", "RENEWAL", "UNCANCELLATION", "CANCELLATION", "REFUND", "TRANSFER", "BILLING_ISSUE", "EXPIRATION", "PRODUCT_CHANGE":
+	case "INITIAL_PURCHASE", "NON_RENEWING_PURCHASE", "RENEWAL", "UNCANCELLATION", "CANCELLATION", "REFUND", "TRANSFER", "BILLING_ISSUE", "EXPIRATION", "PRODUCT_CHANGE":
 		// supported types
 	default:
 		s.logger.Warn().Str("type", event.Type).Msg("Unsupported event type")
@@ -86,27 +120,56 @@ func (s *SubscriptionService) ProcessEvent(ctx context.Context, event *ports.Rev
 		return err
 	}
 
-	var sub *domain.Subscription
-	var isNew bool
-	if len(subs) > 0 {
-		sub = subs[0] // Asumir principal; mejorar si multiple
-		isNew = false
-	} else {
-		isNew = true
+	// Un usuario puede tener varias compras (suscripción + packs), una por producto
+	sub := findSubscription(subs, event, match.Entitlements)
+	isNew := sub == nil
+
+	// Changes to a purchase never fall back to another one, which could cancel the wrong
+	// record; the event is rejected instead
+	switch event.Type {
+	case "CANCELLATION", "REFUND", "BILLING_ISSUE":
+		if sub == nil {
+			s.logger.Warn().
+				Str("app_user_id", event.AppUserID).
+				Str("product_id", event.ProductID).
+				Str("type", event.Type).
+				Msg("No subscription matches event product or entitlements")
+			return ErrSubscriptionNotFound
+		}
+	}
+
+	// Events can arrive late; one older than the last applied to the purchase would undo
+	// a newer change, e.g. a cancellation revoking a renewal
+	if sub != nil && event.Timestamp.Before(sub.LastEventAt) {
+		s.logger.Info().
+			Str("event_id", event.ID).
+			Time("last_event_at", sub.LastEventAt).
+			Msg("Event older than the last applied one; ignoring")
+		s.recordProcessed(ctx, event.ID)
+		return nil
 	}
 
 	// ... user sync moved into purchase handling below
 
 	switch event.Type {
-	case "INITIAL_PURCHASE", "RENEWAL", "UNCANCELLATION", "PRODUCT_CHANGE":
+	case "INITIAL_PURCHASE", "NON_RENEWING_PURCHASE", "RENEWAL", "UNCANCELLATION", "PRODUCT_CHANGE":
 		var expiresAt time.Time
-		if event.ExpiresAtMs != nil {
+		switch {
+		case event.ExpiresAtMs != nil:
 			expiresAt = time.UnixMilli(*event.ExpiresAtMs)
-		} else {
-			// Fallback basado en product/entitlement (simplificado)
-			expiresAt = event.Timestamp.Add(12 * 30 * 24 * time.Hour) // Anual default
+		case match.DefaultDuration > 0:
+			// Fallback basado en la duración del catálogo
+			expiresAt = event.Timestamp.Add(match.DefaultDuration)
+		case !match.Lifetime:
+			// Otherwise a product only matched through its entitlement would never expire
+			s.logger.Warn().
+				Str("product_id", event.ProductID).
+				Msg("Event has no expiration and the product is not lifetime in the catalog")
+			return ErrNoExpiration
 		}
+		// A zero expiresAt means the product never expires (lifetime)
 		// If new subscription or existing without linked user, sync/reconcile user
+		var internalUserID *primitive.ObjectID
 		if isNew || (sub != nil && sub.InternalUserID == nil) {
 			name, okName := event.SubscriberAttributes["name"].(string)
 			email, okEmail := event.SubscriberAttributes["email"].(string)
@@ -116,16 +179,17 @@ func (s *SubscriptionService) ProcessEvent(ctx context.Context, event *ports.Rev
 				email = "unknown@example.com"
 			}
 			password := generateSecurePassword()
-			_, syncErr := s.userSvc.SyncRevenueCatUser(ctx, event.AppUserID, name, email, password)
+			user, syncErr := s.userSvc.SyncRevenueCatUser(ctx, event.AppUserID, name, email, password)
 			if syncErr != nil {
 				s.logger.Error().Err(syncErr).Msg("Failed to sync user")
 				return ErrTransient
 			}
 			s.logger.Info().Str("app_user_id", event.AppUserID).Msg("User synced successfully")
+			internalUserID = &user.ID
 			// Re-fetch sub para link
 			subs, _ = s.subRepo.GetByExternalUserID(ctx, event.AppUserID)
-			if len(subs) > 0 {
-				sub = subs[0]
+			if found := findSubscription(subs, event, match.Entitlements); found != nil {
+				sub = found
 				isNew = false
 			}
 		}
@@ -139,17 +203,15 @@ func (s *SubscriptionService) ProcessEvent(ctx context.Context, event *ports.Rev
 			}
 			sub.UpdateStatus(domain.SubscriptionActive, expiresAt)
 		}
+		if sub.InternalUserID == nil {
+			sub.InternalUserID = internalUserID
+		}
+		sub.Entitlements = match.Entitlements
 		sub.EventType = event.Type
 	case "CANCELLATION":
-		if sub == nil {
-			return errors.New("no subscription found for cancellation")
-		}
 		sub.UpdateStatus(domain.SubscriptionCancelled, time.Time{})
 		sub.EventType = event.Type
 	case "REFUND":
-		if sub == nil {
-			return errors.New("no subscription found for refund")
-		}
 		sub.UpdateStatus(domain.SubscriptionExpired, time.Time{})
 		sub.EventType = event.Type
 		s.logger.Info().Str("refund_reason", event.RefundReason).Msg("Subscription refunded")
@@ -157,12 +219,26 @@ func (s *SubscriptionService) ProcessEvent(ctx context.Context, event *ports.Rev
 		// Log transfer; link si new attributes
 		s.logger.Info().Str("app_user_id", event.AppUserID).Msg("Subscription transferred; check linking")
 		return nil // No update sub, solo log
-	case "BILLING_ISSUE", "EXPIRATION":
-		if sub != nil {
-			sub.UpdateStatus(domain.SubscriptionExpired, time.Time{})
-			sub.EventType = event.Type
+	case "BILLING_ISSUE":
+		detectedAt := event.Timestamp
+		if event.BillingIssueDetectedAtMs != nil {
+			detectedAt = time.UnixMilli(*event.BillingIssueDetectedAtMs)
+		}
+		sub.EnterGracePeriod(detectedAt, s.gracePeriod)
+		sub.EventType = event.Type
+		s.logger.Warn().
+			Str("app_user_id", event.AppUserID).
+			Time("grace_period_expires_at", *sub.GracePeriodExpiresAt).
+			Msg("Billing issue detected; subscription in grace period")
+	case "EXPIRATION":
+		if sub == nil {
+			// Nothing to expire; the expiry sweep covers records this event should have matched
+			s.logger.Warn().Str("app_user_id", event.AppUserID).Str("product_id", event.ProductID).Msg("No subscription matches expiration; ignoring event")
+			return nil
 		}
-		s.logger.Warn().Str("type", event.Type).Msg("Billing issue or expiration handled")
+		sub.UpdateStatus(domain.SubscriptionExpired, time.Time{})
+		sub.EventType = event.Type
+		s.logger.Warn().Str("type", event.Type).Msg("Expiration handled")
 	default:
 		s.logger.Warn().Str("type", event.Type).Msg("Unsupported event type")
 		return errors.New("unsupported event type")
@@ -175,11 +251,13 @@ func (s *SubscriptionService) ProcessEvent(ctx context.Context, event *ports.Rev
 	}
 
 	// Persistir con retry simple (3 attempts)
+	sub.EventID = event.ID
+	sub.LastEventAt = event.Timestamp
 	err = retryDBOp(3, func() error {
 		if isNew || sub.ID.IsZero() {
 			return s.subRepo.Create(ctx, sub)
 		}
-		return s.subRepo.UpdateByEventID(ctx, event.ID, sub)
+		return s.subRepo.Update(ctx, sub)
 	})
 	if err != nil {
 		s.logger.Error().Err(err).Msg("Failed to persist subscription")
@@ -190,24 +268,176 @@ func (s *SubscriptionService) ProcessEvent(ctx context.Context, event *ports.Rev
 		return ErrTransient
 	}
 
+	s.recordProcessed(ctx, event.ID)
 	s.logger.Info().Str("event_id", event.ID).Str("status", string(sub.Status)).Msg("Event processed successfully")
 	return nil
 }
 
+// recordProcessed adds the event to the processed event log. The event is already
+// applied, so a failure is only logged; a redelivery of it would be applied once more,
+// while older events are still rejected through LastEventAt.
+func (s *SubscriptionService) recordProcessed(ctx context.Context, eventID string) {
+	if err := s.events.Record(ctx, eventID, time.Now()); err != nil && !errors.Is(err, ports.ErrDuplicateEvent) {
+		s.logger.Error().Err(err).Str("event_id", eventID).Msg("Failed to record processed event")
+	}
+}
+
+// GetAccess resolves the premium access of an internal user. Subscriptions whose
+// grace period has ended without a renewal are expired and persisted on the way.
+func (s *SubscriptionService) GetAccess(ctx context.Context, userID string) (*domain.SubscriptionAccess, error) {
+	subs, err := s.subRepo.GetByInternalUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	access := &domain.SubscriptionAccess{Entitlements: []string{}}
+	for _, sub := range subs {
+		if sub.ExpireIfGraceEnded(now) {
+			s.logger.Info().Str("subscription_id", sub.ID.Hex()).Msg("Grace period ended without renewal; subscription expired")
+			if err := s.subRepo.Update(ctx, sub); err != nil {
+				s.logger.Error().Err(err).Str("subscription_id", sub.ID.Hex()).Msg("Failed to persist expired subscription")
+			}
+		}
+
+		if access.Status == "" {
+			// Subscriptions come most recently updated first
+			access.Status = sub.Status
+			expiresAt := sub.ExpiresAt
+			access.ExpiresAt = &expiresAt
+		}
+		if !sub.HasAccess(now) {
+			continue
+		}
+		for _, e := range sub.GrantedEntitlements() {
+			if !slices.Contains(access.Entitlements, e) {
+				access.Entitlements = append(access.Entitlements, e)
+			}
+		}
+		if !slices.Contains(sub.GrantedEntitlements(), domain.PremiumEntitlement) {
+			// Packs grant access to their own courses only
+			continue
+		}
+		access.HasPremium = true
+		access.Status = sub.Status
+		expiresAt := sub.ExpiresAt
+		access.ExpiresAt = &expiresAt
+		if sub.Status == domain.SubscriptionGracePeriod {
+			access.BillingIssue = true
+			access.GracePeriodExpiresAt = sub.GracePeriodExpiresAt
+		}
+	}
+	return access, nil
+}
+
+// GetUserEntitlements returns the set of entitlements currently granted to a user
+func (s *SubscriptionService) GetUserEntitlements(ctx context.Context, userID string) (map[string]bool, error) {
+	access, err := s.GetAccess(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	granted := make(map[string]bool, len(access.Entitlements))
+	for _, e := range access.Entitlements {
+		granted[e] = true
+	}
+	return granted, nil
+}
+
+// ExpiryEventType marks subscriptions expired by the sweeper rather than by a webhook
+const ExpiryEventType = "EXPIRATION_SWEEP"
+
+var expiredBySweeper = expvar.NewInt("subscriptions_expired_by_sweeper")
+
+// ExpireOverdue marks subscriptions whose paid or grace period ended more than tolerance
+// ago as expired. It covers EXPIRATION webhooks that never arrived and returns how many
+// subscriptions were expired.
+func (s *SubscriptionService) ExpireOverdue(ctx context.Context, tolerance time.Duration) (int, error) {
+	const batchSize = 100
+	cutoff := time.Now().Add(-tolerance)
+
+	expired := 0
+	for {
+		subs, err := s.subRepo.FindOverdue(ctx, cutoff, batchSize)
+		if err != nil {
+			return expired, fmt.Errorf("failed to find overdue subscriptions: %w", err)
+		}
+
+		batchExpired := 0
+		for _, sub := range subs {
+			sub.UpdateStatus(domain.SubscriptionExpired, time.Time{})
+			sub.EventType = ExpiryEventType
+			if err := s.subRepo.Update(ctx, sub); err != nil {
+				s.logger.Error().Err(err).Str("subscription_id", sub.ID.Hex()).Msg("Failed to expire overdue subscription")
+				continue
+			}
+			batchExpired++
+			s.logger.Info().
+				Str("subscription_id", sub.ID.Hex()).
+				Str("external_user_id", sub.ExternalUserID).
+				Str("product_id", sub.ProductID).
+				Time("expires_at", sub.ExpiresAt).
+				Msg("Overdue subscription expired")
+		}
+		expired += batchExpired
+		expiredBySweeper.Add(int64(batchExpired))
+
+		// Stop on a short batch, or when nothing in a batch could be saved to avoid spinning
+		if len(subs) < batchSize || batchExpired == 0 {
+			break
+		}
+	}
+
+	if expired > 0 {
+		s.logger.Warn().Int("expired", expired).Msg("Expiry sweep expired subscriptions missed by webhooks")
+	}
+	return expired, nil
+}
+
 var (
 	ErrAlreadyProcessed = errors.New("already processed")
 	ErrTransient        = errors.New("transient error")
+	// ErrSubscriptionNotFound is returned when an event changes a purchase that is not stored
+	ErrSubscriptionNotFound = errors.New("no subscription matches event")
+	// ErrNoExpiration is returned for a purchase without an expiration whose product the
+	// catalog neither gives a default duration nor marks as lifetime
+	ErrNoExpiration = errors.New("event has no expiration and the product is not lifetime")
 )
 
-func isPremiumProduct(productID, entitlementID string) bool {
-	// Basado en product o entitlement
-	premiumProducts := []string{"premium_monthly", "premium_yearly"}
-	for _, p := range premiumProducts {
-		if productID == p || entitlementID == p {
-			return true
+// findSubscription picks the stored subscription an event applies to. Purchases are
+// tracked per product. An event for another product, e.g. after a product change,
+// applies to the one subscription granting any of the same entitlements; with none or
+// several, there is no match. New purchases always create their own record.
+func findSubscription(subs []*domain.Subscription, event *ports.RevenueCatEvent, entitlements []string) *domain.Subscription {
+	for _, sub := range subs {
+		if sub.ProductID == event.ProductID {
+			return sub
 		}
 	}
-	return false
+	switch event.Type {
+	case "INITIAL_PURCHASE", "NON_RENEWING_PURCHASE":
+		return nil
+	}
+
+	var found *domain.Subscription
+	for _, sub := range subs {
+		if !slices.ContainsFunc(sub.Entitlements, func(e string) bool { return slices.Contains(entitlements, e) }) {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = sub
+	}
+	return found
+}
+
+// eventEntitlementIDs collects the RevenueCat entitlement IDs carried by an event
+func eventEntitlementIDs(event *ports.RevenueCatEvent) []string {
+	ids := append([]string{}, event.EntitlementIds...)
+	if event.EntitlementID != "" {
+		ids = append(ids, event.EntitlementID)
+	}
+	return ids
 }
 
 // retryDBOp simple exponential backoff
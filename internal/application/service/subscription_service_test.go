@@ -4,11 +4,14 @@ package service
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"nihongo-api/internal/domain"
@@ -34,6 +37,16 @@ func (m *mockSubRepo) UpdateByEventID(ctx context.Context, eventID string, sub *
 	return args.Error(0)
 }
 
+func (m *mockSubRepo) Update(ctx context.Context, sub *domain.Subscription) error {
+	args := m.Called(ctx, sub)
+	return args.Error(0)
+}
+
+func (m *mockSubRepo) GetByInternalUserID(ctx context.Context, internalUserID string) ([]*domain.Subscription, error) {
+	args := m.Called(ctx, internalUserID)
+	return args.Get(0).([]*domain.Subscription), args.Error(1)
+}
+
 func (m *mockSubRepo) GetByExternalUserID(ctx context.Context, externalUserID string) ([]*domain.Subscription, error) {
 	args := m.Called(ctx, externalUserID)
 	return args.Get(0).([]*domain.Subscription), args.Error(1)
@@ -44,6 +57,61 @@ func (m *mockSubRepo) UpdateInternalUserID(ctx context.Context, externalUserID s
 	return args.Error(0)
 }
 
+func (m *mockSubRepo) FindOverdue(ctx context.Context, cutoff time.Time, limit int) ([]*domain.Subscription, error) {
+	args := m.Called(ctx, cutoff, limit)
+	return args.Get(0).([]*domain.Subscription), args.Error(1)
+}
+
+func (m *mockSubRepo) FindUnreconciled(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	args := m.Called(ctx, before, limit)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *mockSubRepo) MarkReconciled(ctx context.Context, externalUserID string, at time.Time) error {
+	args := m.Called(ctx, externalUserID, at)
+	return args.Error(0)
+}
+
+func (m *mockSubRepo) ReassignInternalUserID(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	args := m.Called(ctx, fromUserID, toUserID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *mockSubRepo) DetachInternalUserID(ctx context.Context, internalUserID string) (int64, error) {
+	args := m.Called(ctx, internalUserID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// memoryProcessedEvents is an in-memory ports.ProcessedEventRepository
+type memoryProcessedEvents struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func newMemoryProcessedEvents(ids ...string) *memoryProcessedEvents {
+	e := &memoryProcessedEvents{ids: map[string]bool{}}
+	for _, id := range ids {
+		e.ids[id] = true
+	}
+	return e
+}
+
+func (e *memoryProcessedEvents) Exists(ctx context.Context, eventID string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ids[eventID], nil
+}
+
+func (e *memoryProcessedEvents) Record(ctx context.Context, eventID string, processedAt time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ids[eventID] {
+		return ports.ErrDuplicateEvent
+	}
+	e.ids[eventID] = true
+	return nil
+}
+
 type mockUserRepo struct {
 	mock.Mock
 }
@@ -58,6 +126,11 @@ func (m *mockUserRepo) GetByID(ctx context.Context, id string) (*domain.User, er
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
+func (m *mockUserRepo) GetByIDs(ctx context.Context, ids []string) ([]*domain.User, error) {
+	args := m.Called(ctx, ids)
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
 func (m *mockUserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	args := m.Called(ctx, email)
 	return args.Get(0).(*domain.User), args.Error(1)
@@ -83,6 +156,16 @@ func (m *mockUserRepo) GetByRevenueCatID(ctx context.Context, revenueCatID strin
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
+func (m *mockUserRepo) GetByIdentity(ctx context.Context, provider, subject string) (*domain.User, error) {
+	args := m.Called(ctx, provider, subject)
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *mockUserRepo) FindDeletionDue(ctx context.Context, cutoff time.Time, limit int) ([]*domain.User, error) {
+	args := m.Called(ctx, cutoff, limit)
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
 type mockUserSvc struct {
 	mock.Mock
 }
@@ -163,6 +246,49 @@ func TestSubscriptionService_ProcessEvent(t *testing.T) {
 			expectError:    false,
 			expectedStatus: domain.SubscriptionActive,
 		},
+		{
+			name: "Pack purchase creates its own record next to the subscription",
+			event: &ports.RevenueCatEvent{
+				ID:               "pack_id",
+				Type:             "NON_RENEWING_PURCHASE",
+				AppUserID:        "user1",
+				ProductID:        "jlpt_n2_pack",
+				EntitlementIds:   []string{"jlpt_n2"},
+				Environment:      "PRODUCTION",
+				EventTimestampMs: 1234567890,
+			},
+			setupMocks: func(sub *mockSubRepo, user *mockUserRepo, usvc *mockUserSvc) {
+				linked := primitive.NewObjectID()
+				sub.On("GetByEventID", mock.Anything, "pack_id").Return((*domain.Subscription)(nil), nil)
+				sub.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{{ID: primitive.NewObjectID(), InternalUserID: &linked, ProductID: "premium_monthly", Status: domain.SubscriptionActive}}, nil)
+				usvc.On("SyncRevenueCatUser", mock.Anything, "user1", "Unknown", "unknown@example.com", mock.AnythingOfType("string")).Return(&domain.User{ID: linked}, nil)
+				sub.On("Create", mock.Anything, mock.MatchedBy(func(s *domain.Subscription) bool {
+					return s.ProductID == "jlpt_n2_pack" &&
+						s.InternalUserID != nil && *s.InternalUserID == linked &&
+						assert.ObjectsAreEqual([]string{"jlpt_n2"}, s.Entitlements) &&
+						s.ExpiresAt.IsZero()
+				})).Return(nil)
+			},
+			expectError:    false,
+			expectedStatus: domain.SubscriptionActive,
+		},
+		{
+			name: "Purchase without expiration of a product only matched by entitlement is rejected",
+			event: &ports.RevenueCatEvent{
+				ID:               "family_id",
+				Type:             "INITIAL_PURCHASE",
+				AppUserID:        "user1",
+				ProductID:        "premium_family",
+				EntitlementIds:   []string{"premium"},
+				Environment:      "PRODUCTION",
+				EventTimestampMs: 1234567890,
+			},
+			setupMocks: func(sub *mockSubRepo, user *mockUserRepo, usvc *mockUserSvc) {
+				sub.On("GetByEventID", mock.Anything, "family_id").Return((*domain.Subscription)(nil), nil)
+				sub.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{}, nil)
+			},
+			expectError: true,
+		},
 		{
 			name: "Cancellation, update status",
 			event: &ports.RevenueCatEvent{
@@ -175,12 +301,111 @@ func TestSubscriptionService_ProcessEvent(t *testing.T) {
 			},
 			setupMocks: func(sub *mockSubRepo, user *mockUserRepo, usvc *mockUserSvc) {
 				sub.On("GetByEventID", mock.Anything, "cancel_id").Return((*domain.Subscription)(nil), nil)
-				sub.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{&domain.Subscription{ID: primitive.NewObjectID(), Status: domain.SubscriptionActive}}, nil)
-				sub.On("UpdateByEventID", mock.Anything, "cancel_id", mock.AnythingOfType("*domain.Subscription")).Return(nil)
+				sub.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{{ID: primitive.NewObjectID(), ProductID: "premium_yearly", Entitlements: []string{"premium"}, Status: domain.SubscriptionActive}}, nil)
+				sub.On("Update", mock.Anything, mock.MatchedBy(func(s *domain.Subscription) bool {
+					return s.EventID == "cancel_id" && s.Status == domain.SubscriptionCancelled
+				})).Return(nil)
+			},
+			expectError:    false,
+			expectedStatus: domain.SubscriptionCancelled,
+		},
+		{
+			name: "Cancellation after a product change matches by entitlement",
+			event: &ports.RevenueCatEvent{
+				ID:               "cancel_changed_id",
+				Type:             "CANCELLATION",
+				AppUserID:        "user1",
+				ProductID:        "premium_yearly",
+				Environment:      "PRODUCTION",
+				EventTimestampMs: 1234567890,
+			},
+			setupMocks: func(sub *mockSubRepo, user *mockUserRepo, usvc *mockUserSvc) {
+				sub.On("GetByEventID", mock.Anything, "cancel_changed_id").Return((*domain.Subscription)(nil), nil)
+				sub.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{
+					{ID: primitive.NewObjectID(), ProductID: "jlpt_n2_pack", Entitlements: []string{"jlpt_n2"}, Status: domain.SubscriptionActive},
+					{ID: primitive.NewObjectID(), ProductID: "premium_monthly", Entitlements: []string{"premium"}, Status: domain.SubscriptionActive},
+				}, nil)
+				sub.On("Update", mock.Anything, mock.MatchedBy(func(s *domain.Subscription) bool {
+					return s.ProductID == "premium_monthly" && s.Status == domain.SubscriptionCancelled
+				})).Return(nil)
 			},
 			expectError:    false,
 			expectedStatus: domain.SubscriptionCancelled,
 		},
+		{
+			name: "Refund of a product never stored leaves other purchases alone",
+			event: &ports.RevenueCatEvent{
+				ID:               "refund_id",
+				Type:             "REFUND",
+				AppUserID:        "user1",
+				ProductID:        "premium_monthly",
+				Environment:      "PRODUCTION",
+				EventTimestampMs: 1234567890,
+			},
+			setupMocks: func(sub *mockSubRepo, user *mockUserRepo, usvc *mockUserSvc) {
+				sub.On("GetByEventID", mock.Anything, "refund_id").Return((*domain.Subscription)(nil), nil)
+				sub.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{{ID: primitive.NewObjectID(), ProductID: "jlpt_n2_pack", Entitlements: []string{"jlpt_n2"}, Status: domain.SubscriptionActive}}, nil)
+			},
+			expectError: true,
+		},
+		{
+			name: "Cancellation matching several purchases by entitlement is rejected",
+			event: &ports.RevenueCatEvent{
+				ID:               "cancel_ambiguous_id",
+				Type:             "CANCELLATION",
+				AppUserID:        "user1",
+				ProductID:        "premium_yearly",
+				Environment:      "PRODUCTION",
+				EventTimestampMs: 1234567890,
+			},
+			setupMocks: func(sub *mockSubRepo, user *mockUserRepo, usvc *mockUserSvc) {
+				sub.On("GetByEventID", mock.Anything, "cancel_ambiguous_id").Return((*domain.Subscription)(nil), nil)
+				sub.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{
+					{ID: primitive.NewObjectID(), ProductID: "premium_monthly", Entitlements: []string{"premium"}, Status: domain.SubscriptionActive},
+					{ID: primitive.NewObjectID(), ProductID: "premium_weekly", Entitlements: []string{"premium"}, Status: domain.SubscriptionExpired},
+				}, nil)
+			},
+			expectError: true,
+		},
+		{
+			name: "Expiration of a product never stored is ignored",
+			event: &ports.RevenueCatEvent{
+				ID:               "expiration_id",
+				Type:             "EXPIRATION",
+				AppUserID:        "user1",
+				ProductID:        "jlpt_n2_pack",
+				Environment:      "PRODUCTION",
+				EventTimestampMs: 1234567890,
+			},
+			setupMocks: func(sub *mockSubRepo, user *mockUserRepo, usvc *mockUserSvc) {
+				sub.On("GetByEventID", mock.Anything, "expiration_id").Return((*domain.Subscription)(nil), nil)
+				sub.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{}, nil)
+			},
+			expectError: false,
+		},
+		{
+			name: "Billing issue enters grace period",
+			event: &ports.RevenueCatEvent{
+				ID:                       "billing_id",
+				Type:                     "BILLING_ISSUE",
+				AppUserID:                "user1",
+				ProductID:                "premium_monthly",
+				Environment:              "PRODUCTION",
+				EventTimestampMs:         1234567890,
+				BillingIssueDetectedAtMs: ptr(1700000000000),
+			},
+			setupMocks: func(sub *mockSubRepo, user *mockUserRepo, usvc *mockUserSvc) {
+				sub.On("GetByEventID", mock.Anything, "billing_id").Return((*domain.Subscription)(nil), nil)
+				sub.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{{ID: primitive.NewObjectID(), ProductID: "premium_monthly", Status: domain.SubscriptionActive}}, nil)
+				sub.On("Update", mock.Anything, mock.MatchedBy(func(s *domain.Subscription) bool {
+					return s.Status == domain.SubscriptionGracePeriod &&
+						s.GracePeriodExpiresAt != nil &&
+						s.GracePeriodExpiresAt.Equal(time.UnixMilli(1700000000000).Add(72*time.Hour))
+				})).Return(nil)
+			},
+			expectError:    false,
+			expectedStatus: domain.SubscriptionGracePeriod,
+		},
 		{
 			name: "Invalid environment (sandbox)",
 			event: &ports.RevenueCatEvent{
@@ -217,7 +442,7 @@ func TestSubscriptionService_ProcessEvent(t *testing.T) {
 
 			tt.setupMocks(subRepo, userRepo, userSvc)
 
-			s := NewSubscriptionService(subRepo, userRepo, userSvc, logger)
+			s := NewSubscriptionService(subRepo, newMemoryProcessedEvents(), userRepo, userSvc, testCatalog(), 72*time.Hour, logger)
 
 			err := s.ProcessEvent(context.Background(), tt.event)
 
@@ -234,29 +459,154 @@ func TestSubscriptionService_ProcessEvent(t *testing.T) {
 	}
 }
 
-func ptr(i int64) *int64 {
-	return &i
+func TestSubscriptionService_ProcessEventOutOfOrder(t *testing.T) {
+	renewedAt := time.UnixMilli(1700000100000)
+	stored := &domain.Subscription{ID: primitive.NewObjectID(), ExternalUserID: "user1", ProductID: "premium_monthly", Entitlements: []string{"premium"},
+		EventID: "renewal_id", Status: domain.SubscriptionActive, LastEventAt: renewedAt}
+	subRepo := new(mockSubRepo)
+	subRepo.On("GetByEventID", mock.Anything, mock.Anything).Return((*domain.Subscription)(nil), nil)
+	subRepo.On("GetByExternalUserID", mock.Anything, "user1").Return([]*domain.Subscription{stored}, nil)
+	events := newMemoryProcessedEvents("initial_id")
+	s := NewSubscriptionService(subRepo, events, new(mockUserRepo), new(mockUserSvc), testCatalog(), 72*time.Hour, zerolog.Nop())
+	ctx := context.Background()
+
+	// A redelivered event is skipped although the subscription's event_id moved on
+	err := s.ProcessEvent(ctx, &ports.RevenueCatEvent{ID: "initial_id", Type: "INITIAL_PURCHASE", AppUserID: "user1", ProductID: "premium_monthly",
+		Environment: "PRODUCTION", EventTimestampMs: 1700000000000})
+	require.NoError(t, err)
+
+	// A cancellation sent before the renewal but delivered after it does not revoke it
+	err = s.ProcessEvent(ctx, &ports.RevenueCatEvent{ID: "late_cancel_id", Type: "CANCELLATION", AppUserID: "user1", ProductID: "premium_monthly",
+		Environment: "PRODUCTION", EventTimestampMs: 1700000050000})
+	require.NoError(t, err)
+	assert.Equal(t, domain.SubscriptionActive, stored.Status)
+	assert.True(t, events.ids["late_cancel_id"])
+	subRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+
+	// A newer one applies and moves LastEventAt forward
+	subRepo.On("Update", mock.Anything, stored).Return(nil).Once()
+	err = s.ProcessEvent(ctx, &ports.RevenueCatEvent{ID: "expiration_id", Type: "EXPIRATION", AppUserID: "user1", ProductID: "premium_monthly",
+		Environment: "PRODUCTION", EventTimestampMs: 1700000200000})
+	require.NoError(t, err)
+	assert.Equal(t, domain.SubscriptionExpired, stored.Status)
+	assert.Equal(t, time.UnixMilli(1700000200000), stored.LastEventAt)
+	assert.True(t, events.ids["expiration_id"])
+	subRepo.AssertExpectations(t)
 }
 
-func Test_isPremiumProduct(t *testing.T) {
+func TestSubscriptionService_GetAccess(t *testing.T) {
+	userID := primitive.NewObjectID()
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
 	tests := []struct {
-		name          string
-		productID     string
-		entitlementID string
-		want          bool
+		name             string
+		subs             []*domain.Subscription
+		expectPersist    bool
+		wantPremium      bool
+		wantBillingIssue bool
+		wantStatus       domain.SubscriptionStatus
+		wantEntitlements []string
 	}{
-		{"premium product", "premium_monthly", "", true},
-		{"premium entitlement", "", "premium_yearly", true},
-		{"non-premium", "basic", "", false},
+		{
+			name:       "No subscriptions",
+			subs:       []*domain.Subscription{},
+			wantStatus: "",
+		},
+		{
+			name:        "Active subscription",
+			subs:        []*domain.Subscription{{ID: primitive.NewObjectID(), Status: domain.SubscriptionActive, ExpiresAt: future}},
+			wantPremium: true,
+			wantStatus:  domain.SubscriptionActive,
+		},
+		{
+			name:             "Grace period keeps access and flags billing issue",
+			subs:             []*domain.Subscription{{ID: primitive.NewObjectID(), Status: domain.SubscriptionGracePeriod, GracePeriodExpiresAt: &future}},
+			wantPremium:      true,
+			wantBillingIssue: true,
+			wantStatus:       domain.SubscriptionGracePeriod,
+		},
+		{
+			name:             "Course pack grants its entitlement but not premium",
+			subs:             []*domain.Subscription{{ID: primitive.NewObjectID(), ProductID: "jlpt_n2_pack", Entitlements: []string{"jlpt_n2"}, Status: domain.SubscriptionActive}},
+			wantStatus:       domain.SubscriptionActive,
+			wantEntitlements: []string{"jlpt_n2"},
+		},
+		{
+			name: "Premium and pack entitlements are combined",
+			subs: []*domain.Subscription{
+				{ID: primitive.NewObjectID(), ProductID: "premium_monthly", Entitlements: []string{"premium"}, Status: domain.SubscriptionActive, ExpiresAt: future},
+				{ID: primitive.NewObjectID(), ProductID: "jlpt_n2_pack", Entitlements: []string{"jlpt_n2"}, Status: domain.SubscriptionActive},
+			},
+			wantPremium:      true,
+			wantStatus:       domain.SubscriptionActive,
+			wantEntitlements: []string{"premium", "jlpt_n2"},
+		},
+		{
+			name:          "Grace period ended expires subscription",
+			subs:          []*domain.Subscription{{ID: primitive.NewObjectID(), Status: domain.SubscriptionGracePeriod, GracePeriodExpiresAt: &past}},
+			expectPersist: true,
+			wantStatus:    domain.SubscriptionExpired,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.want, isPremiumProduct(tt.productID, tt.entitlementID))
+			subRepo := new(mockSubRepo)
+			subRepo.On("GetByInternalUserID", mock.Anything, userID.Hex()).Return(tt.subs, nil)
+			if tt.expectPersist {
+				subRepo.On("Update", mock.Anything, mock.MatchedBy(func(s *domain.Subscription) bool {
+					return s.Status == domain.SubscriptionExpired
+				})).Return(nil)
+			}
+
+			s := NewSubscriptionService(subRepo, newMemoryProcessedEvents(), new(mockUserRepo), new(mockUserSvc), testCatalog(), 72*time.Hour, zerolog.Nop())
+			access, err := s.GetAccess(context.Background(), userID.Hex())
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantPremium, access.HasPremium)
+			assert.Equal(t, tt.wantBillingIssue, access.BillingIssue)
+			assert.Equal(t, tt.wantStatus, access.Status)
+			if tt.wantEntitlements != nil {
+				assert.Equal(t, tt.wantEntitlements, access.Entitlements)
+			}
+			subRepo.AssertExpectations(t)
 		})
 	}
 }
 
+func TestSubscriptionService_ExpireOverdue(t *testing.T) {
+	overdue := []*domain.Subscription{
+		{ID: primitive.NewObjectID(), Status: domain.SubscriptionActive, ExpiresAt: time.Now().Add(-2 * time.Hour)},
+		{ID: primitive.NewObjectID(), Status: domain.SubscriptionCancelled, ExpiresAt: time.Now().Add(-3 * time.Hour)},
+		{ID: primitive.NewObjectID(), Status: domain.SubscriptionActive, ExpiresAt: time.Now().Add(-4 * time.Hour)},
+	}
+
+	subRepo := new(mockSubRepo)
+	subRepo.On("FindOverdue", mock.Anything, mock.MatchedBy(func(cutoff time.Time) bool {
+		// The tolerance moves the cutoff back
+		return cutoff.Before(time.Now().Add(-59 * time.Minute))
+	}), 100).Return(overdue, nil).Once()
+	subRepo.On("Update", mock.Anything, overdue[0]).Return(nil).Once()
+	subRepo.On("Update", mock.Anything, overdue[1]).Return(errors.New("write conflict")).Once()
+	subRepo.On("Update", mock.Anything, overdue[2]).Return(nil).Once()
+
+	s := NewSubscriptionService(subRepo, newMemoryProcessedEvents(), new(mockUserRepo), new(mockUserSvc), testCatalog(), 72*time.Hour, zerolog.Nop())
+	expired, err := s.ExpireOverdue(context.Background(), time.Hour)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, expired)
+	for _, sub := range overdue {
+		assert.Equal(t, domain.SubscriptionExpired, sub.Status)
+		assert.Equal(t, ExpiryEventType, sub.EventType)
+	}
+	subRepo.AssertExpectations(t)
+}
+
+func ptr(i int64) *int64 {
+	return &i
+}
+
 func Test_retryDBOp(t *testing.T) {
 	// Test successful on first try
 	successOp := func() error { return nil }
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+	"nihongo-api/pkg/totp"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// recoveryCodeCount is how many recovery codes are issued on enrolment
+	recoveryCodeCount = 10
+	// totpSkew accepts codes from one step before or after the current one
+	totpSkew = 1
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled    = errors.New("two-factor enrolment has not been started")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is mandatory for this account")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge        = errors.New("invalid or expired login challenge")
+)
+
+// TwoFactorEnrolment is what an authenticator app needs to add the account
+type TwoFactorEnrolment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI, render it as a QR code
+}
+
+// TwoFactorService manages TOTP enrolment and the second step of login
+type TwoFactorService struct {
+	userRepo      ports.UserRepository
+	tokenRepo     ports.UserTokenRepository
+	guard         *LoginGuard
+	sessions      SessionRevoker
+	issuer        string
+	requiredRoles []domain.UserRole
+	challengeTTL  time.Duration
+	logger        zerolog.Logger
+}
+
+// NewTwoFactorService creates a new two-factor service. issuer is the name shown in
+// authenticator apps; users with one of requiredRoles must use 2FA for privileged routes
+// and cannot disable it. Wrong login codes count as failed logins in guard. Turning 2FA on
+// or off logs the user out of their other sessions.
+func NewTwoFactorService(userRepo ports.UserRepository, tokenRepo ports.UserTokenRepository, guard *LoginGuard, sessions SessionRevoker, issuer string, requiredRoles []domain.UserRole, challengeTTL time.Duration, logger zerolog.Logger) *TwoFactorService {
+	return &TwoFactorService{
+		userRepo:      userRepo,
+		tokenRepo:     tokenRepo,
+		guard:         guard,
+		sessions:      sessions,
+		issuer:        issuer,
+		requiredRoles: requiredRoles,
+		challengeTTL:  challengeTTL,
+		logger:        logger,
+	}
+}
+
+// Required reports whether users with role must use two-factor authentication
+func (s *TwoFactorService) Required(role domain.UserRole) bool {
+	return slices.Contains(s.requiredRoles, role)
+}
+
+// Enroll starts enrolment with a new secret. It is not active until Confirm succeeds, and
+// calling Enroll again replaces a pending secret.
+func (s *TwoFactorService) Enroll(ctx context.Context, userID string) (*TwoFactorEnrolment, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.TwoFactor = &domain.TwoFactor{PendingSecret: secret}
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrolment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.issuer, user.Email, secret),
+	}, nil
+}
+
+// Confirm activates the pending secret once the user proves their app generates valid
+// codes, and ends the user's sessions other than sessionID, which were only protected by
+// a password. It returns the recovery codes, which are shown once and only stored hashed.
+func (s *TwoFactorService) Confirm(ctx context.Context, userID, sessionID, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TwoFactor == nil || user.TwoFactor.PendingSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	now := time.Now()
+	step, ok := totp.Validate(user.TwoFactor.PendingSecret, code, now, totpSkew)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.TwoFactor = &domain.TwoFactor{
+		Secret:        user.TwoFactor.PendingSecret,
+		RecoveryCodes: hashes,
+		EnabledAt:     &now,
+		LastUsedStep:  step,
+	}
+	user.UpdatedAt = now
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := s.sessions.RevokeAll(ctx, userID, sessionID); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Msg("Two-factor authentication enabled")
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off after checking a current code or recovery
+// code, and ends the user's sessions other than sessionID
+func (s *TwoFactorService) Disable(ctx context.Context, userID, sessionID, code string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+	if s.Required(user.Role) {
+		return ErrTwoFactorRequired
+	}
+	if !s.verifyCode(user, code, time.Now()) {
+		return ErrInvalidTwoFactorCode
+	}
+
+	// An empty value rather than nil, so the update overwrites the stored secret
+	user.TwoFactor = &domain.TwoFactor{}
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+	if err := s.sessions.RevokeAll(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	s.logger.Info().Str("user_id", user.ID.Hex()).Msg("Two-factor authentication disabled")
+	return nil
+}
+
+// StartChallenge is called after a correct password for a user with 2FA. It returns a
+// short-lived, single-use token to send back with the code in CompleteChallenge.
+func (s *TwoFactorService) StartChallenge(ctx context.Context, user *domain.User) (string, error) {
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if err := s.tokenRepo.Create(ctx, &domain.UserToken{
+		UserID:    user.ID,
+		Purpose:   domain.TwoFactorChallengePurpose,
+		TokenHash: hash,
+		ExpiresAt: now.Add(s.challengeTTL),
+		CreatedAt: now,
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CompleteChallenge finishes a login from ip with a TOTP or recovery code. The challenge is
+// used up even when the code is wrong, and a wrong code counts as a failed login for the
+// account and IP, so guesses lead to the same delays and lockout as wrong passwords. The
+// failure counters are only cleared here, once the second factor has passed. It returns a
+// *LoginThrottledError while the account or IP is locked out.
+func (s *TwoFactorService) CompleteChallenge(ctx context.Context, challenge, code, ip string) (*domain.User, error) {
+	token, err := s.tokenRepo.Consume(ctx, domain.TwoFactorChallengePurpose, hashToken(challenge), time.Now())
+	if err != nil {
+		if errors.Is(err, ports.ErrTokenInvalid) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, token.UserID.Hex())
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	if !user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	// Challenges issued before a lockout must not keep guessing through it
+	if err := s.guard.Check(ctx, user.Email, ip); err != nil {
+		return nil, err
+	}
+	if !s.verifyCode(user, code, time.Now()) {
+		s.logger.Warn().Str("user_id", user.ID.Hex()).Msg("Invalid two-factor code")
+		if err := s.guard.RecordFailure(ctx, user.Email, ip); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	user.UpdatedAt = time.Now()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := s.guard.RecordSuccess(ctx, user.Email); err != nil {
+		s.logger.Error().Err(err).Str("user_id", user.ID.Hex()).Msg("Failed to reset login attempts")
+	}
+	return user, nil
+}
+
+// verifyCode accepts a TOTP code newer than the last one used, or an unused recovery code,
+// and records its use on user. The caller persists user.
+func (s *TwoFactorService) verifyCode(user *domain.User, code string, now time.Time) bool {
+	tf := user.TwoFactor
+	if step, ok := totp.Validate(tf.Secret, code, now, totpSkew); ok {
+		if step <= tf.LastUsedStep {
+			return false
+		}
+		tf.LastUsedStep = step
+		return true
+	}
+
+	hash := hashToken(normalizeRecoveryCode(code))
+	if i := slices.Index(tf.RecoveryCodes, hash); i >= 0 {
+		tf.RecoveryCodes = slices.Delete(tf.RecoveryCodes, i, i+1)
+		s.logger.Info().Str("user_id", user.ID.Hex()).Int("remaining", len(tf.RecoveryCodes)).Msg("Recovery code used")
+		return true
+	}
+	return false
+}
+
+// newRecoveryCodes returns recovery codes formatted as xxxxx-xxxxx, and their hashes
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes in a typed recovery code
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
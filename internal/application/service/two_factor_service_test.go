@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/pkg/totp"
+)
+
+// testLoginGuard is a LoginGuard over store with the test lockout policy
+func testLoginGuard(store *memoryAttemptStore, userRepo *mockUserRepo) *LoginGuard {
+	return NewLoginGuard(store, &memoryAuditLog{}, userRepo, &memoryTokenRepo{}, &outbox{}, "https://nihongo.app/unlock", testLockoutPolicy(), zerolog.Nop())
+}
+
+func currentCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	require.NoError(t, err)
+	return code
+}
+
+func TestTwoFactorService_EnrollConfirmAndLogin(t *testing.T) {
+	user := &domain.User{ID: primitive.NewObjectID(), Email: "sensei@example.com", Role: domain.RoleTeacher}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("Update", mock.Anything, user).Return(nil)
+
+	sessions := NewSessionService(newMemorySessionRepo(), time.Hour, zerolog.Nop())
+	current, _ := loggedInTwice(t, sessions, user)
+	s := NewTwoFactorService(userRepo, &memoryTokenRepo{}, testLoginGuard(newMemoryAttemptStore(), userRepo), sessions, "Nihongo", []domain.UserRole{domain.RoleAdmin, domain.RoleTeacher}, 5*time.Minute, zerolog.Nop())
+	ctx := context.Background()
+
+	enrolment, err := s.Enroll(ctx, user.ID.Hex())
+	require.NoError(t, err)
+	assert.Contains(t, enrolment.ProvisioningURI, "otpauth://totp/Nihongo:sensei@example.com")
+	assert.False(t, user.TwoFactorEnabled(), "not active before confirmation")
+
+	_, err = s.Confirm(ctx, user.ID.Hex(), current.ID.Hex(), "000000")
+	assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+
+	// Confirm with the previous step's code, so the current one is still unused for login
+	codes, err := s.Confirm(ctx, user.ID.Hex(), current.ID.Hex(), currentCode(t, enrolment.Secret, -1))
+	require.NoError(t, err)
+	assert.Equal(t, []primitive.ObjectID{current.ID}, activeSessionIDs(t, sessions, user.ID.Hex()), "sessions opened with only a password end")
+	require.Len(t, codes, recoveryCodeCount)
+	assert.True(t, user.TwoFactorEnabled())
+	assert.NotContains(t, user.TwoFactor.RecoveryCodes, normalizeRecoveryCode(codes[0]), "recovery codes are stored hashed")
+
+	// Login with a TOTP code; replaying it fails
+	challenge, err := s.StartChallenge(ctx, user)
+	require.NoError(t, err)
+	code := currentCode(t, enrolment.Secret, 0)
+	got, err := s.CompleteChallenge(ctx, challenge, code, "203.0.113.7")
+	require.NoError(t, err)
+	assert.Same(t, user, got)
+
+	challenge, err = s.StartChallenge(ctx, user)
+	require.NoError(t, err)
+	_, err = s.CompleteChallenge(ctx, challenge, code, "203.0.113.7")
+	assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+
+	// A wrong guess uses up the challenge
+	_, err = s.CompleteChallenge(ctx, challenge, currentCode(t, enrolment.Secret, 1), "203.0.113.7")
+	assert.ErrorIs(t, err, ErrInvalidChallenge)
+
+	// Recovery codes work once, whatever the formatting
+	challenge, err = s.StartChallenge(ctx, user)
+	require.NoError(t, err)
+	_, err = s.CompleteChallenge(ctx, challenge, " "+codes[3][:5]+codes[3][6:]+" ", "203.0.113.7")
+	require.NoError(t, err)
+	assert.Len(t, user.TwoFactor.RecoveryCodes, recoveryCodeCount-1)
+
+	// Teachers cannot turn 2FA off
+	assert.ErrorIs(t, s.Disable(ctx, user.ID.Hex(), current.ID.Hex(), codes[4]), ErrTwoFactorRequired)
+}
+
+func TestTwoFactorService_Disable(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	user := &domain.User{ID: primitive.NewObjectID(), Role: domain.RoleStudent, TwoFactor: &domain.TwoFactor{Secret: secret}}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("Update", mock.Anything, user).Return(nil)
+
+	sessions := NewSessionService(newMemorySessionRepo(), time.Hour, zerolog.Nop())
+	current, _ := loggedInTwice(t, sessions, user)
+	s := NewTwoFactorService(userRepo, &memoryTokenRepo{}, testLoginGuard(newMemoryAttemptStore(), userRepo), sessions, "Nihongo", []domain.UserRole{domain.RoleAdmin}, 5*time.Minute, zerolog.Nop())
+
+	assert.ErrorIs(t, s.Disable(context.Background(), user.ID.Hex(), current.ID.Hex(), "000000"), ErrInvalidTwoFactorCode)
+	assert.Len(t, activeSessionIDs(t, sessions, user.ID.Hex()), 2)
+	require.NoError(t, s.Disable(context.Background(), user.ID.Hex(), current.ID.Hex(), currentCode(t, secret, 0)))
+	assert.False(t, user.TwoFactorEnabled())
+	assert.Equal(t, []primitive.ObjectID{current.ID}, activeSessionIDs(t, sessions, user.ID.Hex()))
+	assert.True(t, s.Required(domain.RoleAdmin))
+	assert.False(t, s.Required(domain.RoleStudent))
+}
+
+func TestTwoFactorService_WrongCodesAreThrottled(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	user := &domain.User{ID: primitive.NewObjectID(), Email: "aiko@example.com", TwoFactor: &domain.TwoFactor{Secret: secret}}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByID", mock.Anything, user.ID.Hex()).Return(user, nil)
+	userRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+	userRepo.On("Update", mock.Anything, user).Return(nil)
+
+	store := newMemoryAttemptStore()
+	s := NewTwoFactorService(userRepo, &memoryTokenRepo{}, testLoginGuard(store, userRepo), nil, "Nihongo", nil, 5*time.Minute, zerolog.Nop())
+	ctx := context.Background()
+	guess := func(code string) error {
+		// A leaked password gets a fresh challenge every time
+		challenge, err := s.StartChallenge(ctx, user)
+		require.NoError(t, err)
+		_, err = s.CompleteChallenge(ctx, challenge, code, "203.0.113.7")
+		return err
+	}
+
+	// Wrong codes count like wrong passwords: delays first, then a lockout
+	var throttled *LoginThrottledError
+	policy := testLockoutPolicy()
+	for i := 1; i <= policy.MaxAccountFailures; i++ {
+		require.ErrorIs(t, guess("000000"), ErrInvalidTwoFactorCode)
+		if i > policy.DelayAfter && i < policy.MaxAccountFailures {
+			require.ErrorAs(t, guess("000000"), &throttled)
+			assert.False(t, throttled.Locked)
+			store.advance(throttled.RetryAfter)
+		}
+	}
+	require.ErrorAs(t, guess(currentCode(t, secret, 0)), &throttled, "even the right code is refused while locked")
+	assert.True(t, throttled.Locked)
+
+	// The account counters are only cleared once the second factor passes
+	store.advance(policy.LockoutDuration)
+	require.NoError(t, guess(currentCode(t, secret, 0)))
+	assert.NotContains(t, store.counters, accountKey(user.Email))
+	assert.Contains(t, store.counters, ipKey("203.0.113.7"))
+}
@@ -5,27 +5,39 @@ import (
 	"errors"
 	"nihongo-api/internal/domain"
 	"nihongo-api/internal/ports"
+	"strings"
 	"time"
 
+	"github.com/go-playground/validator/v10"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/rs/zerolog"
 )
 
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
 // UserService handles user business logic
 type UserService struct {
 	userRepo ports.UserRepository
 	subRepo  ports.SubscriptionRepository
-	logger   zerolog.Logger
+	validate *validator.Validate
+	// unverified decides whether users with an unverified email may log in
+	unverified UnverifiedAccess
+	logger     zerolog.Logger
 }
 
 // NewUserService creates a new user service
-func NewUserService(userRepo ports.UserRepository, subRepo ports.SubscriptionRepository, logger zerolog.Logger) *UserService {
+func NewUserService(userRepo ports.UserRepository, subRepo ports.SubscriptionRepository, unverified UnverifiedAccess, logger zerolog.Logger) *UserService {
 	return &UserService{
-		userRepo: userRepo,
-		subRepo:  subRepo,
-		logger:   logger,
+		userRepo:   userRepo,
+		subRepo:    subRepo,
+		validate:   newValidator(),
+		unverified: unverified,
+		logger:     logger,
 	}
 }
 
@@ -33,6 +45,20 @@ func NewUserService(userRepo ports.UserRepository, subRepo ports.SubscriptionRep
 func (s *UserService) RegisterUser(ctx context.Context, name, email, password string) (*domain.User, error) {
 	s.logger.Info().Str("email", email).Msg("Registering new user")
 
+	user := &domain.User{
+		Name:      strings.TrimSpace(name),
+		Email:     strings.TrimSpace(email),
+		Password:  password,
+		Role:      domain.RoleStudent,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	// Validate before hashing so the password rules apply to the plain text
+	if err := s.validate.Struct(user); err != nil {
+		return nil, validationError(err)
+	}
+	email = user.Email
+
 	// Check if user already exists
 	existingUser, _ := s.userRepo.GetByEmail(ctx, email)
 	if existingUser != nil {
@@ -47,13 +73,7 @@ func (s *UserService) RegisterUser(ctx context.Context, name, email, password st
 		return nil, err
 	}
 
-	user := &domain.User{
-		Name:      name,
-		Email:     email,
-		Password:  string(hashedPassword),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
+	user.Password = string(hashedPassword)
 
 	err = s.userRepo.Create(ctx, user)
 	if err != nil {
@@ -72,13 +92,18 @@ func (s *UserService) AuthenticateUser(ctx context.Context, email, password stri
 	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
 		s.logger.Warn().Str("email", email).Msg("Invalid credentials")
-		return nil, errors.New("invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
 		s.logger.Warn().Str("email", email).Msg("Invalid credentials")
-		return nil, errors.New("invalid credentials")
+		return nil, ErrInvalidCredentials
+	}
+
+	if !user.EmailVerified && s.unverified == UnverifiedNoAccess {
+		s.logger.Warn().Str("user_id", user.ID.Hex()).Msg("Login refused, email not verified")
+		return nil, ErrEmailNotVerified
 	}
 
 	s.logger.Info().Str("user_id", user.ID.Hex()).Msg("User authenticated successfully")
@@ -111,12 +136,15 @@ func (s *UserService) SyncRevenueCatUser(ctx context.Context, revenueCatUserID,
 		return nil, err
 	}
 
+	// The email comes from subscriber attributes the app sets, so it stays unverified;
+	// paid access follows the RevenueCat ID instead (see RestrictEntitlements)
 	user = &domain.User{
 		ID:               primitive.NewObjectID(),
 		Name:             name,
 		Email:            email,
 		Password:         string(hashedPassword),
 		RevenueCatUserID: revenueCatUserID,
+		Role:             domain.RoleStudent,
 		CreatedAt:        time.Now(),
 		UpdatedAt:        time.Now(),
 	}
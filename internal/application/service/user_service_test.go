@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+
+	"nihongo-api/internal/domain"
+)
+
+func TestUserService_RegisterUser_Validates(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	s := NewUserService(userRepo, new(mockSubRepo), UnverifiedFreeAccess, zerolog.Nop())
+
+	_, err := s.RegisterUser(context.Background(), "A", "not-an-email", "short")
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, map[string]string{
+		"name":     "must be at least 2 characters",
+		"email":    "must be a valid email address",
+		"password": "must be at least 8 characters",
+	}, verr.Fields)
+	userRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestUserService_RegisterUser_StartsUnverified(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByEmail", mock.Anything, "aiko@example.com").Return((*domain.User)(nil), errors.New("user not found"))
+	userRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(nil)
+	s := NewUserService(userRepo, new(mockSubRepo), UnverifiedFreeAccess, zerolog.Nop())
+
+	user, err := s.RegisterUser(context.Background(), "Aiko", " aiko@example.com ", "long-enough")
+	require.NoError(t, err)
+	assert.Equal(t, "aiko@example.com", user.Email)
+	assert.False(t, user.EmailVerified)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("long-enough")))
+}
+
+func TestUserService_AuthenticateUser_UnverifiedAccess(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("long-enough"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &domain.User{ID: primitive.NewObjectID(), Email: "aiko@example.com", Password: string(hash)}
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByEmail", mock.Anything, user.Email).Return(user, nil)
+
+	_, err = NewUserService(userRepo, new(mockSubRepo), UnverifiedNoAccess, zerolog.Nop()).AuthenticateUser(context.Background(), user.Email, "long-enough")
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+
+	_, err = NewUserService(userRepo, new(mockSubRepo), UnverifiedFreeAccess, zerolog.Nop()).AuthenticateUser(context.Background(), user.Email, "long-enough")
+	assert.NoError(t, err)
+
+	user.EmailVerified = true
+	_, err = NewUserService(userRepo, new(mockSubRepo), UnverifiedNoAccess, zerolog.Nop()).AuthenticateUser(context.Background(), user.Email, "long-enough")
+	assert.NoError(t, err)
+}
+
+func TestUserService_SyncRevenueCatUser_CreatesUnverifiedUser(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	userRepo.On("GetByRevenueCatID", mock.Anything, "rc_123").Return((*domain.User)(nil), errors.New("user not found"))
+	userRepo.On("Create", mock.Anything, mock.AnythingOfType("*domain.User")).Return(nil)
+	subRepo := new(mockSubRepo)
+	subRepo.On("UpdateInternalUserID", mock.Anything, "rc_123", mock.Anything).Return(nil)
+	s := NewUserService(userRepo, subRepo, UnverifiedFreeAccess, zerolog.Nop())
+
+	user, err := s.SyncRevenueCatUser(context.Background(), "rc_123", "Buyer", "buyer@example.com", "generated-password")
+	require.NoError(t, err)
+	// The email is only a subscriber attribute set by the app
+	assert.False(t, user.EmailVerified)
+	assert.Equal(t, "rc_123", user.RevenueCatUserID)
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidHistoryDays is returned when more XP history is asked for than is kept available
+var ErrInvalidHistoryDays = errors.New("invalid number of history days")
+
+// XPPolicy tunes experience points, levels and daily goals
+type XPPolicy struct {
+	Rules            domain.XPRules
+	LevelBase        int // XP from level 1 to 2; each further level takes that much more
+	DefaultDailyGoal int // For users who have not set a daily goal
+	MaxHistoryDays   int
+}
+
+// XPService awards experience points for completed entities and tracks daily goals. XP is
+// earned for an entity at most once a day: the first time as a completion, later as a review.
+type XPService struct {
+	xpRepo     ports.XPRepository
+	userRepo   ports.UserRepository
+	kanjiRepo  ports.KanjiRepository
+	courseRepo ports.CourseRepository
+	policy     XPPolicy
+	logger     zerolog.Logger
+}
+
+// NewXPService creates a new XP service. The content repositories give entities their
+// difficulty, the JLPT level of the kanji or of the course of a lesson or exercise.
+func NewXPService(xpRepo ports.XPRepository, userRepo ports.UserRepository, kanjiRepo ports.KanjiRepository, courseRepo ports.CourseRepository, policy XPPolicy, logger zerolog.Logger) *XPService {
+	return &XPService{
+		xpRepo:     xpRepo,
+		userRepo:   userRepo,
+		kanjiRepo:  kanjiRepo,
+		courseRepo: courseRepo,
+		policy:     policy,
+		logger:     logger,
+	}
+}
+
+// ProgressRecorded awards XP when progress marks an entity completed
+func (s *XPService) ProgressRecorded(ctx context.Context, userID string, progress *domain.Progress) {
+	if !progress.Completed {
+		return
+	}
+	if _, err := s.Award(ctx, userID, progress.EntityID, progress.EntityType, time.Now()); err != nil && !errors.Is(err, ports.ErrXPAlreadyAwarded) {
+		s.logger.Error().Err(err).Str("user_id", userID).Str("entity_id", progress.EntityID.Hex()).Msg("Failed to award XP")
+	}
+}
+
+// Award credits the user with XP for completing an entity at the given time. It returns
+// ports.ErrXPAlreadyAwarded if the entity already earned XP that day in the user's
+// timezone, and a nil event if the entity is worth no XP.
+func (s *XPService) Award(ctx context.Context, userID string, entityID primitive.ObjectID, entityType domain.EntityType, at time.Time) (*domain.XPEvent, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	difficulty, err := entityLevel(ctx, s.kanjiRepo, s.courseRepo, entityID, entityType)
+	if err != nil {
+		return nil, err
+	}
+	reviewed, err := s.xpRepo.HasEvents(ctx, userID, entityID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	reason := domain.XPCompletion
+	if reviewed {
+		reason = domain.XPReview
+	}
+	xp := s.policy.Rules.Award(entityType, difficulty, reason)
+	if xp <= 0 {
+		return nil, nil
+	}
+
+	event := &domain.XPEvent{
+		UserID:     user.ID,
+		EntityID:   entityID,
+		EntityType: entityType,
+		Difficulty: difficulty,
+		Reason:     reason,
+		XP:         xp,
+		Day:        domain.DayIn(at, userLocation(user)),
+		CreatedAt:  time.Now(),
+	}
+	if err := s.xpRepo.Record(ctx, event); err != nil {
+		return nil, err
+	}
+
+	day, err := s.xpRepo.AddToDay(ctx, userID, event.Day, xp, s.dailyGoal(user))
+	if err != nil {
+		return nil, err
+	}
+	if day.GoalMetAt == nil && day.XP >= day.Goal {
+		met, err := s.xpRepo.MarkGoalMet(ctx, userID, event.Day)
+		if err != nil {
+			return nil, err
+		}
+		if met {
+			s.logger.Info().Str("user_id", userID).Str("day", event.Day).Int("goal", day.Goal).Msg("Daily XP goal met")
+		}
+	}
+	return event, nil
+}
+
+// GetXP returns the user's total XP, level, today's progress towards the daily goal and
+// the last days of history, including today
+func (s *XPService) GetXP(ctx context.Context, user *domain.User, days int) (*domain.XPStatus, error) {
+	if days < 1 || days > s.policy.MaxHistoryDays {
+		return nil, ErrInvalidHistoryDays
+	}
+
+	userID := user.ID.Hex()
+	total, err := s.xpRepo.Total(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	today := domain.DayIn(time.Now(), userLocation(user))
+	stored, err := s.xpRepo.Days(ctx, userID, domain.AddDays(today, -(days-1)), today)
+	if err != nil {
+		return nil, err
+	}
+
+	byDay := make(map[string]domain.XPDay, len(stored))
+	for _, d := range stored {
+		byDay[d.Day] = d
+	}
+	goal := s.dailyGoal(user)
+	history := make([]domain.XPDayStatus, days)
+	for i := range history {
+		day := domain.AddDays(today, i-(days-1))
+		d, ok := byDay[day]
+		status := domain.XPDayStatus{Day: day, XP: d.XP, Goal: d.Goal}
+		// Days without XP, and today, are measured against the current goal
+		if !ok || day == today {
+			status.Goal = goal
+		}
+		status.GoalMet = status.XP >= status.Goal
+		history[i] = status
+	}
+
+	return &domain.XPStatus{
+		XPLevel: domain.LevelFor(total, s.policy.LevelBase),
+		Today:   history[len(history)-1],
+		History: history,
+	}, nil
+}
+
+// dailyGoal returns the user's daily XP goal, or the default if they have not set one
+func (s *XPService) dailyGoal(user *domain.User) int {
+	if user.DailyGoal > 0 {
+		return user.DailyGoal
+	}
+	return s.policy.DefaultDailyGoal
+}
+
+// entityLevel returns the JLPT level of an entity: that of the kanji, or of the course of
+// a lesson or exercise. Kana count as N5.
+func entityLevel(ctx context.Context, kanjiRepo ports.KanjiRepository, courseRepo ports.CourseRepository, entityID primitive.ObjectID, entityType domain.EntityType) (domain.JLPTLevel, error) {
+	switch entityType {
+	case domain.KanjiEntity:
+		kanji, err := kanjiRepo.GetByID(ctx, entityID.Hex())
+		if err != nil {
+			return "", err
+		}
+		return kanji.Level, nil
+	case domain.LessonEntity:
+		course, err := courseRepo.GetByLessonID(ctx, entityID.Hex())
+		if err != nil {
+			return "", err
+		}
+		return course.Level, nil
+	case domain.ExerciseEntity:
+		course, err := courseRepo.GetByExerciseID(ctx, entityID.Hex())
+		if err != nil {
+			return "", err
+		}
+		return course.Level, nil
+	}
+	return domain.N5, nil
+}
+
+// PersonalDataName implements PersonalDataStore
+func (s *XPService) PersonalDataName() string {
+	return "xp"
+}
+
+// ExportUserData implements PersonalDataStore
+func (s *XPService) ExportUserData(ctx context.Context, userID string) (any, error) {
+	events, err := s.xpRepo.Events(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	days, err := s.xpRepo.Days(ctx, userID, "0000-01-01", "9999-12-31")
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Events []domain.XPEvent `json:"events"`
+		Days   []domain.XPDay   `json:"days"`
+	}{events, days}, nil
+}
+
+// EraseUserData implements PersonalDataStore
+func (s *XPService) EraseUserData(ctx context.Context, userID string) (int64, error) {
+	return s.xpRepo.DeleteByUser(ctx, userID)
+}
+
+// MergeUserData implements GuestDataMerger: the guest's XP moves to the account, except for
+// entities the account already earned XP for on the same day
+func (s *XPService) MergeUserData(ctx context.Context, guestID, targetID string) error {
+	events, err := s.xpRepo.Events(ctx, guestID)
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	target, err := s.userRepo.GetByID(ctx, targetID)
+	if err != nil {
+		return err
+	}
+
+	goal := s.dailyGoal(target)
+	for _, e := range events {
+		e.UserID = target.ID
+		err := s.xpRepo.Record(ctx, &e)
+		if errors.Is(err, ports.ErrXPAlreadyAwarded) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := s.xpRepo.AddToDay(ctx, targetID, e.Day, e.XP, goal); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.xpRepo.DeleteByUser(ctx, guestID)
+	return err
+}
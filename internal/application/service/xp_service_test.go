@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"nihongo-api/internal/domain"
+	"nihongo-api/internal/ports"
+)
+
+// memoryXPRepo is an in-memory ports.XPRepository
+type memoryXPRepo struct {
+	events []domain.XPEvent
+	days   map[string]*domain.XPDay // by user ID and day
+}
+
+func newMemoryXPRepo() *memoryXPRepo {
+	return &memoryXPRepo{days: map[string]*domain.XPDay{}}
+}
+
+func (r *memoryXPRepo) Record(ctx context.Context, event *domain.XPEvent) error {
+	for _, e := range r.events {
+		if e.UserID == event.UserID && e.EntityID == event.EntityID && e.Day == event.Day {
+			return ports.ErrXPAlreadyAwarded
+		}
+	}
+	event.ID = primitive.NewObjectID()
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *memoryXPRepo) HasEvents(ctx context.Context, userID, entityID string) (bool, error) {
+	for _, e := range r.events {
+		if e.UserID.Hex() == userID && e.EntityID.Hex() == entityID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryXPRepo) Events(ctx context.Context, userID string) ([]domain.XPEvent, error) {
+	var events []domain.XPEvent
+	for _, e := range r.events {
+		if e.UserID.Hex() == userID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *memoryXPRepo) Total(ctx context.Context, userID string) (int64, error) {
+	var total int64
+	for _, d := range r.days {
+		if d.UserID.Hex() == userID {
+			total += int64(d.XP)
+		}
+	}
+	return total, nil
+}
+
+func (r *memoryXPRepo) AddToDay(ctx context.Context, userID, day string, xp, goal int) (*domain.XPDay, error) {
+	d, ok := r.days[userID+day]
+	if !ok {
+		objID, _ := primitive.ObjectIDFromHex(userID)
+		d = &domain.XPDay{UserID: objID, Day: day}
+		r.days[userID+day] = d
+	}
+	d.XP += xp
+	d.Goal = goal
+	updated := *d
+	return &updated, nil
+}
+
+func (r *memoryXPRepo) MarkGoalMet(ctx context.Context, userID, day string) (bool, error) {
+	d, ok := r.days[userID+day]
+	if !ok || d.GoalMetAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	d.GoalMetAt = &now
+	return true, nil
+}
+
+func (r *memoryXPRepo) Days(ctx context.Context, userID, from, to string) ([]domain.XPDay, error) {
+	var days []domain.XPDay
+	for _, d := range r.days {
+		if d.UserID.Hex() == userID && d.Day >= from && d.Day <= to {
+			days = append(days, *d)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Day < days[j].Day })
+	return days, nil
+}
+
+func (r *memoryXPRepo) DeleteByUser(ctx context.Context, userID string) (int64, error) {
+	var deleted int64
+	kept := r.events[:0]
+	for _, e := range r.events {
+		if e.UserID.Hex() == userID {
+			deleted++
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	r.events = kept
+	for key, d := range r.days {
+		if d.UserID.Hex() == userID {
+			delete(r.days, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+var testXPPolicy = XPPolicy{
+	Rules: domain.XPRules{
+		ByEntityType: map[domain.EntityType]domain.XPRule{
+			domain.SyllableEntity: {Completion: 5, Review: 2},
+			domain.ExerciseEntity: {Completion: 10, Review: 5},
+		},
+		Difficulty: map[domain.JLPTLevel]float64{domain.N5: 1, domain.N3: 1.5},
+	},
+	LevelBase:        100,
+	DefaultDailyGoal: 20,
+	MaxHistoryDays:   30,
+}
+
+func TestXPService_Award(t *testing.T) {
+	ctx := context.Background()
+	userRepo := new(mockUserRepo)
+	user := streakUser(t, userRepo, "Asia/Tokyo")
+	exerciseID, kanjiID := primitive.NewObjectID(), primitive.NewObjectID()
+	courseRepo := new(mockCourseRepo)
+	courseRepo.On("GetByExerciseID", mock.Anything, exerciseID.Hex()).Return(&domain.Course{Level: domain.N3}, nil)
+	repo := newMemoryXPRepo()
+	s := NewXPService(repo, userRepo, &stubKanjiRepo{ids: map[string]bool{kanjiID.Hex(): true}}, courseRepo, testXPPolicy, zerolog.Nop())
+
+	// 2024-05-01 in Tokyo
+	day1 := at(t, "2024-05-01T10:00:00+09:00")
+	event, err := s.Award(ctx, user.ID.Hex(), exerciseID, domain.ExerciseEntity, day1)
+	require.NoError(t, err)
+	assert.Equal(t, domain.XPCompletion, event.Reason)
+	assert.Equal(t, 15, event.XP, "N3 exercises are worth 1.5x")
+	assert.Equal(t, "2024-05-01", event.Day)
+
+	_, err = s.Award(ctx, user.ID.Hex(), exerciseID, domain.ExerciseEntity, day1.Add(time.Hour))
+	assert.ErrorIs(t, err, ports.ErrXPAlreadyAwarded, "one award per entity and day")
+
+	event, err = s.Award(ctx, user.ID.Hex(), exerciseID, domain.ExerciseEntity, day1.Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, domain.XPReview, event.Reason)
+	assert.Equal(t, 8, event.XP)
+
+	event, err = s.Award(ctx, user.ID.Hex(), kanjiID, domain.KanjiEntity, day1)
+	require.NoError(t, err)
+	assert.Nil(t, event, "entity types without a rule earn nothing")
+
+	// 15 XP against the default goal of 20, then a syllable tips it over
+	assert.Nil(t, repo.days[user.ID.Hex()+"2024-05-01"].GoalMetAt)
+	_, err = s.Award(ctx, user.ID.Hex(), primitive.NewObjectID(), domain.SyllableEntity, day1)
+	require.NoError(t, err)
+	d := repo.days[user.ID.Hex()+"2024-05-01"]
+	assert.Equal(t, 20, d.XP)
+	assert.Equal(t, 20, d.Goal)
+	assert.NotNil(t, d.GoalMetAt)
+}
+
+func TestXPService_ProgressRecorded(t *testing.T) {
+	userRepo := new(mockUserRepo)
+	user := streakUser(t, userRepo, "")
+	repo := newMemoryXPRepo()
+	s := NewXPService(repo, userRepo, &stubKanjiRepo{}, new(mockCourseRepo), testXPPolicy, zerolog.Nop())
+
+	progress := &domain.Progress{EntityID: primitive.NewObjectID(), EntityType: domain.SyllableEntity, Score: 90}
+	s.ProgressRecorded(context.Background(), user.ID.Hex(), progress)
+	assert.Empty(t, repo.events, "only completions earn XP")
+
+	progress.Completed = true
+	s.ProgressRecorded(context.Background(), user.ID.Hex(), progress)
+	s.ProgressRecorded(context.Background(), user.ID.Hex(), progress)
+	assert.Len(t, repo.events, 1)
+}
+
+func TestXPService_GetXP(t *testing.T) {
+	ctx := context.Background()
+	user := &domain.User{ID: primitive.NewObjectID(), DailyGoal: 50}
+	userID := user.ID.Hex()
+	today := domain.DayIn(time.Now(), time.UTC)
+	repo := newMemoryXPRepo()
+	_, _ = repo.AddToDay(ctx, userID, domain.AddDays(today, -2), 40, 30)
+	_, _ = repo.AddToDay(ctx, userID, domain.AddDays(today, -1), 20, 30)
+	_, _ = repo.AddToDay(ctx, userID, today, 60, 50)
+	_, _ = repo.AddToDay(ctx, userID, domain.AddDays(today, -10), 300, 30)
+	s := NewXPService(repo, new(mockUserRepo), &stubKanjiRepo{}, new(mockCourseRepo), testXPPolicy, zerolog.Nop())
+
+	xp, err := s.GetXP(ctx, user, 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(420), xp.TotalXP)
+	assert.Equal(t, 3, xp.Level, "100 XP to level 2 and 200 more to level 3")
+	assert.Equal(t, int64(120), xp.LevelXP)
+	assert.Equal(t, int64(300), xp.NextLevelXP)
+	assert.Equal(t, domain.XPDayStatus{Day: today, XP: 60, Goal: 50, GoalMet: true}, xp.Today)
+	assert.Equal(t, []domain.XPDayStatus{
+		{Day: domain.AddDays(today, -3), XP: 0, Goal: 50},
+		{Day: domain.AddDays(today, -2), XP: 40, Goal: 30, GoalMet: true},
+		{Day: domain.AddDays(today, -1), XP: 20, Goal: 30},
+		{Day: today, XP: 60, Goal: 50, GoalMet: true},
+	}, xp.History)
+
+	_, err = s.GetXP(ctx, user, 0)
+	assert.ErrorIs(t, err, ErrInvalidHistoryDays)
+	_, err = s.GetXP(ctx, user, 31)
+	assert.ErrorIs(t, err, ErrInvalidHistoryDays)
+}
+
+func TestLevelFor(t *testing.T) {
+	tests := []struct {
+		total int64
+		want  domain.XPLevel
+	}{
+		{0, domain.XPLevel{Level: 1, TotalXP: 0, LevelXP: 0, NextLevelXP: 100}},
+		{99, domain.XPLevel{Level: 1, TotalXP: 99, LevelXP: 99, NextLevelXP: 100}},
+		{100, domain.XPLevel{Level: 2, TotalXP: 100, LevelXP: 0, NextLevelXP: 200}},
+		{600, domain.XPLevel{Level: 4, TotalXP: 600, LevelXP: 0, NextLevelXP: 400}},
+		{999, domain.XPLevel{Level: 4, TotalXP: 999, LevelXP: 399, NextLevelXP: 400}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, domain.LevelFor(tt.total, 100))
+	}
+}
+
+func TestXPService_MergeUserData(t *testing.T) {
+	ctx := context.Background()
+	userRepo := new(mockUserRepo)
+	guest := streakUser(t, userRepo, "")
+	target := streakUser(t, userRepo, "")
+	repo := newMemoryXPRepo()
+	s := NewXPService(repo, userRepo, &stubKanjiRepo{}, new(mockCourseRepo), testXPPolicy, zerolog.Nop())
+
+	shared, other := primitive.NewObjectID(), primitive.NewObjectID()
+	now := time.Now()
+	for _, award := range []struct {
+		user *domain.User
+		id   primitive.ObjectID
+	}{{guest, shared}, {guest, other}, {target, shared}} {
+		_, err := s.Award(ctx, award.user.ID.Hex(), award.id, domain.SyllableEntity, now)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, s.MergeUserData(ctx, guest.ID.Hex(), target.ID.Hex()))
+	total, _ := repo.Total(ctx, target.ID.Hex())
+	assert.Equal(t, int64(10), total, "XP for an entity the account already completed that day is dropped")
+	events, _ := repo.Events(ctx, guest.ID.Hex())
+	assert.Empty(t, events)
+
+	require.NoError(t, s.MergeUserData(ctx, guest.ID.Hex(), target.ID.Hex()), "merging again is a no-op")
+	total, _ = repo.Total(ctx, target.ID.Hex())
+	assert.Equal(t, int64(10), total)
+}
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AchievementMetric is what an achievement measures
+type AchievementMetric string
+
+const (
+	MetricKanaMastered     AchievementMetric = "kana_mastered"     // Completed kana, optionally of one Script
+	MetricKanjiMastered    AchievementMetric = "kanji_mastered"    // Completed kanji, optionally at one Level
+	MetricCoursesCompleted AchievementMetric = "courses_completed" // Optionally at one Level
+	MetricStreakDays       AchievementMetric = "streak_days"       // Longest streak
+	MetricTotalXP          AchievementMetric = "total_xp"
+)
+
+// AchievementDefinition is a badge and the rule that earns it. Definitions are data in the
+// achievements collection, so new badges need no deploy.
+type AchievementDefinition struct {
+	ID          string            `bson:"_id" json:"id"`
+	Name        string            `bson:"name" json:"name"`
+	Description string            `bson:"description" json:"description"`
+	Metric      AchievementMetric `bson:"metric" json:"metric"`
+	// Target is the value of Metric that earns the badge. For kana and kanji 0 means all of
+	// them, as many as there are when it is evaluated.
+	Target   int          `bson:"target" json:"-"`
+	Level    JLPTLevel    `bson:"level,omitempty" json:"level,omitempty"`
+	Script   SyllableType `bson:"script,omitempty" json:"script,omitempty"`
+	Order    int          `bson:"order" json:"-"`
+	Disabled bool         `bson:"disabled,omitempty" json:"-"`
+}
+
+// DefaultAchievements are added to the achievements collection when missing, so edits
+// made to them there are kept
+var DefaultAchievements = []AchievementDefinition{
+	{ID: "all_hiragana", Name: "Hiragana Master", Description: "Master every hiragana", Metric: MetricKanaMastered, Script: Hiragana, Order: 10},
+	{ID: "all_katakana", Name: "Katakana Master", Description: "Master every katakana", Metric: MetricKanaMastered, Script: Katakana, Order: 20},
+	{ID: "kanji_10", Name: "First Strokes", Description: "Master 10 kanji", Metric: MetricKanjiMastered, Target: 10, Order: 30},
+	{ID: "kanji_100", Name: "Kanji Collector", Description: "Master 100 kanji", Metric: MetricKanjiMastered, Target: 100, Order: 40},
+	{ID: "all_n5_kanji", Name: "N5 Kanji Complete", Description: "Master every N5 kanji", Metric: MetricKanjiMastered, Level: N5, Order: 50},
+	{ID: "first_course", Name: "Graduate", Description: "Complete a course", Metric: MetricCoursesCompleted, Target: 1, Order: 60},
+	{ID: "first_n3_course", Name: "Intermediate", Description: "Complete an N3 course", Metric: MetricCoursesCompleted, Level: N3, Target: 1, Order: 70},
+	{ID: "streak_7", Name: "On a Roll", Description: "Keep a 7-day streak", Metric: MetricStreakDays, Target: 7, Order: 80},
+	{ID: "streak_30", Name: "Unstoppable", Description: "Keep a 30-day streak", Metric: MetricStreakDays, Target: 30, Order: 90},
+	{ID: "xp_1000", Name: "Dedicated", Description: "Earn 1,000 XP", Metric: MetricTotalXP, Target: 1000, Order: 100},
+}
+
+// AchievementStats are the learner's numbers achievements are measured against
+type AchievementStats struct {
+	KanaMastered     map[SyllableType]int
+	KanaTotal        map[SyllableType]int
+	KanjiMastered    map[JLPTLevel]int
+	KanjiTotal       map[JLPTLevel]int
+	CoursesCompleted map[JLPTLevel]int
+	LongestStreak    int
+	TotalXP          int64
+}
+
+// Progress returns how far stats are towards the achievement and the value that earns it
+func (d *AchievementDefinition) Progress(stats *AchievementStats) (current, target int) {
+	target = d.Target
+	switch d.Metric {
+	case MetricKanaMastered:
+		current = sumWhere(stats.KanaMastered, d.Script)
+		if target == 0 {
+			target = sumWhere(stats.KanaTotal, d.Script)
+		}
+	case MetricKanjiMastered:
+		current = sumWhere(stats.KanjiMastered, d.Level)
+		if target == 0 {
+			target = sumWhere(stats.KanjiTotal, d.Level)
+		}
+	case MetricCoursesCompleted:
+		current = sumWhere(stats.CoursesCompleted, d.Level)
+	case MetricStreakDays:
+		current = stats.LongestStreak
+	case MetricTotalXP:
+		current = int(stats.TotalXP)
+	}
+	return min(current, target), target
+}
+
+// Earned reports whether stats meet the achievement. An achievement over content that
+// does not exist yet, such as all N1 kanji before any are added, cannot be earned.
+func (d *AchievementDefinition) Earned(stats *AchievementStats) bool {
+	current, target := d.Progress(stats)
+	return target > 0 && current >= target
+}
+
+// sumWhere returns counts[key], or the sum of all counts when key is empty
+func sumWhere[K ~string](counts map[K]int, key K) int {
+	if key != "" {
+		return counts[key]
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+// UserAchievement records that a user earned an achievement
+type UserAchievement struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID        primitive.ObjectID `bson:"user_id" json:"-"`
+	AchievementID string             `bson:"achievement_id" json:"achievement_id"`
+	EarnedAt      time.Time          `bson:"earned_at" json:"earned_at"`
+}
+
+// AchievementStatus is an achievement as seen by a learner
+type AchievementStatus struct {
+	AchievementDefinition
+	Earned   bool       `json:"earned"`
+	EarnedAt *time.Time `json:"earned_at,omitempty"`
+	Current  int        `json:"current"`
+	Target   int        `json:"target"`
+}
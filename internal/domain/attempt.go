@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Attempt is one answer a learner gave on an entity. Unlike Progress, which keeps the
+// latest result, every attempt is kept so mistakes can be analysed.
+type Attempt struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID         primitive.ObjectID `bson:"user_id" json:"user_id"`
+	EntityID       primitive.ObjectID `bson:"entity_id" json:"entity_id"`
+	EntityType     EntityType         `bson:"entity_type" json:"entity_type"`
+	Answer         string             `bson:"answer" json:"answer"`
+	Expected       string             `bson:"expected" json:"expected"`
+	Correct        bool               `bson:"correct" json:"correct"`
+	ResponseTimeMs int                `bson:"response_time_ms" json:"response_time_ms"`
+	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// ItemAttempts sums up the attempts on one entity
+type ItemAttempts struct {
+	EntityID          primitive.ObjectID `bson:"_id" json:"entity_id"`
+	EntityType        EntityType         `bson:"entity_type" json:"entity_type"`
+	Expected          string             `bson:"expected" json:"expected"` // Of the latest attempt
+	Attempts          int                `bson:"attempts" json:"attempts"`
+	Failures          int                `bson:"failures" json:"failures"`
+	AvgResponseTimeMs int                `bson:"avg_response_time_ms" json:"avg_response_time_ms"`
+	LastCorrect       bool               `bson:"last_correct" json:"last_correct"`
+	LastAttemptAt     time.Time          `bson:"last_attempt_at" json:"last_attempt_at"`
+}
+
+// Accuracy is the share of attempts answered correctly, from 0 to 1
+func (i ItemAttempts) Accuracy() float64 {
+	if i.Attempts == 0 {
+		return 0
+	}
+	return float64(i.Attempts-i.Failures) / float64(i.Attempts)
+}
+
+// WeakItem is an entity the learner gets wrong often enough to practise. Leeches are
+// those failed over and over.
+type WeakItem struct {
+	ItemAttempts
+	Accuracy float64 `json:"accuracy"`
+	Leech    bool    `json:"leech"`
+}
+
+// ConfusionPair is two answers a learner mixes up, counted in both directions: giving A
+// when B was expected and B when A was
+type ConfusionPair struct {
+	EntityType EntityType `bson:"entity_type" json:"entity_type"`
+	A          string     `bson:"a" json:"a"`
+	B          string     `bson:"b" json:"b"`
+	Count      int        `bson:"count" json:"count"`
+}
+
+// WeakItems is what a targeted practice session should focus on
+type WeakItems struct {
+	Items      []WeakItem      `json:"items"`
+	Confusions []ConfusionPair `json:"confusions"`
+	Since      time.Time       `json:"since"` // Start of the attempts considered
+}
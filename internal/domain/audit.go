@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEventType identifies a security-relevant event
+type AuditEventType string
+
+const (
+	AuditAccountLocked   AuditEventType = "account_locked"
+	AuditAccountUnlocked AuditEventType = "account_unlocked"
+	AuditIPLocked        AuditEventType = "ip_locked"
+)
+
+// AuditEvent is an append-only record of a security-relevant event
+type AuditEvent struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	Type      AuditEventType      `bson:"type" json:"type"`
+	UserID    *primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Email     string              `bson:"email,omitempty" json:"email,omitempty"`
+	IP        string              `bson:"ip,omitempty" json:"ip,omitempty"`
+	Details   map[string]string   `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+}
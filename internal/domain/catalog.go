@@ -0,0 +1,108 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CatalogKind tells which external identifier a catalog entry maps
+type CatalogKind string
+
+const (
+	CatalogProduct     CatalogKind = "product"     // Store product ID (App Store / Play Store)
+	CatalogEntitlement CatalogKind = "entitlement" // RevenueCat entitlement ID
+)
+
+// Internal entitlement granted by the base subscription products
+const PremiumEntitlement = "premium"
+
+// CatalogEntry maps a store product or RevenueCat entitlement to internal entitlements
+type CatalogEntry struct {
+	ID                  primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Kind                CatalogKind        `bson:"kind" json:"kind" validate:"required,oneof=product entitlement"`
+	ExternalID          string             `bson:"external_id" json:"external_id" validate:"required"`
+	Entitlements        []string           `bson:"entitlements" json:"entitlements" validate:"required,min=1"`
+	DefaultDurationDays int                `bson:"default_duration_days" json:"default_duration_days" validate:"gte=0"` // For events without an expiration
+	Lifetime            bool               `bson:"lifetime,omitempty" json:"lifetime,omitempty"`                        // Products only: purchases never expire
+	Disabled            bool               `bson:"disabled,omitempty" json:"disabled,omitempty"`
+	Source              string             `bson:"-" json:"source"` // "config" or "override"
+}
+
+// CatalogMatch is the result of resolving an event against the catalog
+type CatalogMatch struct {
+	Entitlements    []string
+	DefaultDuration time.Duration // Zero when the catalog gives none
+	Lifetime        bool          // The matched product is marked as never expiring
+}
+
+// ProductCatalog is the merged view of configured and overridden catalog entries
+type ProductCatalog struct {
+	Entries []CatalogEntry `json:"entries"`
+}
+
+// NewProductCatalog merges overrides on top of the base entries. An override
+// replaces the base entry with the same kind and external ID.
+func NewProductCatalog(base, overrides []CatalogEntry) *ProductCatalog {
+	type key struct {
+		kind CatalogKind
+		id   string
+	}
+
+	index := make(map[key]int, len(base)+len(overrides))
+	entries := make([]CatalogEntry, 0, len(base)+len(overrides))
+	for _, list := range [][]CatalogEntry{base, overrides} {
+		for _, e := range list {
+			k := key{e.Kind, e.ExternalID}
+			if i, ok := index[k]; ok {
+				entries[i] = e
+				continue
+			}
+			index[k] = len(entries)
+			entries = append(entries, e)
+		}
+	}
+	return &ProductCatalog{Entries: entries}
+}
+
+// Resolve finds the internal entitlements granted by a product and/or RevenueCat
+// entitlement IDs. The product entry decides the default duration, and only a product
+// entry can make the purchase lifetime.
+func (c *ProductCatalog) Resolve(productID string, entitlementIDs []string) (*CatalogMatch, bool) {
+	match := &CatalogMatch{}
+	found := false
+	seen := map[string]bool{}
+	add := func(e CatalogEntry) {
+		found = true
+		for _, ent := range e.Entitlements {
+			if !seen[ent] {
+				seen[ent] = true
+				match.Entitlements = append(match.Entitlements, ent)
+			}
+		}
+	}
+
+	for _, e := range c.Entries {
+		if e.Disabled {
+			continue
+		}
+		switch e.Kind {
+		case CatalogProduct:
+			if productID != "" && e.ExternalID == productID {
+				add(e)
+				match.DefaultDuration = time.Duration(e.DefaultDurationDays) * 24 * time.Hour
+				match.Lifetime = e.Lifetime
+			}
+		case CatalogEntitlement:
+			for _, id := range entitlementIDs {
+				if id != "" && e.ExternalID == id {
+					add(e)
+					if match.DefaultDuration == 0 {
+						match.DefaultDuration = time.Duration(e.DefaultDurationDays) * 24 * time.Hour
+					}
+				}
+			}
+		}
+	}
+	return match, found
+}
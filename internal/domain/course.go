@@ -10,6 +10,106 @@ type Course struct {
 	Name        string             `bson:"name" json:"name" validate:"required,min=1,max=200"`
 	Description string             `bson:"description" json:"description" validate:"required,min=1,max=1000"`
 	Level       JLPTLevel          `bson:"level" json:"level" validate:"required,oneof=N5 N4 N3 N2 N1"`
-	IsPremium   bool               `bson:"is_premium" json:"is_premium"`
-	Lessons     []Lesson           `bson:"lessons" json:"lessons"`
+	IsPremium   bool               `bson:"is_premium" json:"is_premium"` // Legacy flag; equivalent to requiring the premium entitlement
+	// RequiredEntitlements lists the entitlement IDs needed to open the course (all of them)
+	RequiredEntitlements []string `bson:"required_entitlements,omitempty" json:"required_entitlements,omitempty"`
+	Lessons              []Lesson `bson:"lessons" json:"lessons"`
+}
+
+// CourseWithAccess is a course as seen by a specific user
+type CourseWithAccess struct {
+	Course
+	Locked bool `json:"locked"`
+}
+
+// Entitlements returns the entitlement IDs required to open the course
+func (c *Course) Entitlements() []string {
+	if len(c.RequiredEntitlements) > 0 {
+		return c.RequiredEntitlements
+	}
+	if c.IsPremium {
+		return []string{PremiumEntitlement}
+	}
+	return nil
+}
+
+// IsUnlockedBy reports whether the granted entitlements cover every requirement of the course
+func (c *Course) IsUnlockedBy(granted map[string]bool) bool {
+	for _, e := range c.Entitlements() {
+		if !granted[e] {
+			return false
+		}
+	}
+	return true
+}
+
+// Preview strips lesson content and exercises so a locked course only exposes its outline
+func (c Course) Preview() Course {
+	lessons := make([]Lesson, len(c.Lessons))
+	for i, l := range c.Lessons {
+		lessons[i] = Lesson{ID: l.ID, Title: l.Title, Prerequisites: l.Prerequisites}
+	}
+	c.Lessons = lessons
+	return c
+}
+
+// Sequence sets the state of every lesson for a learner with the given progress. hasAccess
+// reports whether the learner holds the course's entitlements. Completed lessons stay
+// completed; locked lessons only keep their ID, title and prerequisites.
+func (c *Course) Sequence(progress *ProgressSummary, hasAccess bool) {
+	completions := make(map[primitive.ObjectID]LessonCompletion)
+	mastery := make(map[JLPTLevel]LevelMastery)
+	if progress != nil {
+		for _, course := range progress.Courses {
+			for _, l := range course.Lessons {
+				completions[l.LessonID] = l
+			}
+		}
+		for _, m := range progress.Levels {
+			mastery[m.Level] = m
+		}
+	}
+
+	lessons := make([]Lesson, len(c.Lessons))
+	for i, l := range c.Lessons {
+		var prev *LessonCompletion
+		if i > 0 {
+			completion := completions[c.Lessons[i-1].ID]
+			prev = &completion
+		}
+
+		var unmet []string
+		switch {
+		case !hasAccess:
+			unmet = []string{PrerequisiteEntitlement}
+		case completions[l.ID].Status == LessonCompleted:
+			l.State = LessonStateCompleted
+		default:
+			unmet = l.unmet(prev, mastery)
+		}
+
+		if len(unmet) > 0 {
+			l = Lesson{ID: l.ID, Title: l.Title, Prerequisites: l.Prerequisites, State: LessonStateLocked, UnmetPrerequisites: unmet}
+		} else if l.State == "" {
+			l.State = LessonStateUnlocked
+		}
+		lessons[i] = l
+	}
+	c.Lessons = lessons
+}
+
+// LessonContaining returns the lesson with the given ID or the one holding the exercise
+// with that ID
+func (c *Course) LessonContaining(id primitive.ObjectID) (*Lesson, bool) {
+	for i := range c.Lessons {
+		if c.Lessons[i].ID == id {
+			return &c.Lessons[i], true
+		}
+		for _, e := range c.Lessons[i].Exercises {
+			if e.ID == id {
+				return &c.Lessons[i], true
+			}
+		}
+	}
+	return nil, false
 }
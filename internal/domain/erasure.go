@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErasureReceipt records that a user's personal data was erased. Receipts form a hash
+// chain: each one includes the hash of the previous receipt, so editing or removing a
+// receipt breaks every hash after it.
+type ErasureReceipt struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Sequence int64              `bson:"sequence" json:"sequence"`
+	// SubjectHash is the SHA-256 of the erased user's ID, so a receipt can be matched
+	// to a request without keeping the ID itself
+	SubjectHash           string     `bson:"subject_hash" json:"subject_hash"`
+	DueAt                 *time.Time `bson:"due_at,omitempty" json:"due_at,omitempty"` // End of the deletion grace period
+	ErasedAt              time.Time  `bson:"erased_at" json:"erased_at"`
+	ProgressDeleted       int64      `bson:"progress_deleted" json:"progress_deleted"`
+	SubscriptionsDetached int64      `bson:"subscriptions_detached" json:"subscriptions_detached"`
+	AuditEventsAnonymized int64      `bson:"audit_events_anonymized" json:"audit_events_anonymized"`
+	// OtherDeleted counts records removed from other personal data stores, by store name
+	OtherDeleted map[string]int64 `bson:"other_deleted,omitempty" json:"other_deleted,omitempty"`
+	PrevHash     string           `bson:"prev_hash" json:"prev_hash"`
+	Hash         string           `bson:"hash" json:"hash"`
+}
+
+// SubjectHash returns the value stored in ErasureReceipt.SubjectHash for userID
+func SubjectHash(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:])
+}
+
+// Seal links the receipt after prev (nil for the first receipt) and computes its hash
+func (r *ErasureReceipt) Seal(prev *ErasureReceipt) {
+	r.Sequence, r.PrevHash = 1, ""
+	if prev != nil {
+		r.Sequence, r.PrevHash = prev.Sequence+1, prev.Hash
+	}
+	r.Hash = r.ComputeHash()
+}
+
+// ComputeHash hashes every field except ID and Hash
+func (r *ErasureReceipt) ComputeHash() string {
+	// Times are hashed in milliseconds, the precision Mongo stores them with
+	content := struct {
+		Sequence              int64  `json:"sequence"`
+		SubjectHash           string `json:"subject_hash"`
+		DueAt                 int64  `json:"due_at"`
+		ErasedAt              int64  `json:"erased_at"`
+		ProgressDeleted       int64  `json:"progress_deleted"`
+		SubscriptionsDetached int64  `json:"subscriptions_detached"`
+		AuditEventsAnonymized int64  `json:"audit_events_anonymized"`
+		// Omitted when empty so receipts from before it existed keep their hash
+		OtherDeleted map[string]int64 `json:"other_deleted,omitempty"`
+		PrevHash     string           `json:"prev_hash"`
+	}{
+		Sequence:              r.Sequence,
+		SubjectHash:           r.SubjectHash,
+		ErasedAt:              r.ErasedAt.UnixMilli(),
+		ProgressDeleted:       r.ProgressDeleted,
+		SubscriptionsDetached: r.SubscriptionsDetached,
+		AuditEventsAnonymized: r.AuditEventsAnonymized,
+		OtherDeleted:          r.OtherDeleted,
+		PrevHash:              r.PrevHash,
+	}
+	if r.DueAt != nil {
+		content.DueAt = r.DueAt.UnixMilli()
+	}
+	b, _ := json.Marshal(content)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -15,6 +15,9 @@ const (
 	N1 JLPTLevel = "N1"
 )
 
+// JLPTLevels lists the JLPT levels from easiest to hardest
+var JLPTLevels = []JLPTLevel{N5, N4, N3, N2, N1}
+
 // Kanji represents a kanji character
 type Kanji struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
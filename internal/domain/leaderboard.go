@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrUnknownLeaderboard is returned for a board name that is not a period, optionally
+// followed by a JLPT level
+var ErrUnknownLeaderboard = errors.New("unknown leaderboard")
+
+// LeaderboardPeriod is the time span a leaderboard ranks
+type LeaderboardPeriod string
+
+const (
+	LeaderboardWeekly  LeaderboardPeriod = "weekly" // Resets on Monday 00:00 UTC
+	LeaderboardAllTime LeaderboardPeriod = "all-time"
+)
+
+// Leaderboard identifies a board: a period, for every level or for one JLPT level
+type Leaderboard struct {
+	Period LeaderboardPeriod
+	Level  JLPTLevel // Empty for the global board
+}
+
+// ParseLeaderboard parses a board name such as "weekly", "all-time" or "weekly-n3"
+func ParseLeaderboard(name string) (Leaderboard, error) {
+	for _, period := range []LeaderboardPeriod{LeaderboardWeekly, LeaderboardAllTime} {
+		rest, ok := strings.CutPrefix(strings.ToLower(name), string(period))
+		if !ok {
+			continue
+		}
+		if rest == "" {
+			return Leaderboard{Period: period}, nil
+		}
+		for _, level := range JLPTLevels {
+			if rest == "-"+strings.ToLower(string(level)) {
+				return Leaderboard{Period: period, Level: level}, nil
+			}
+		}
+	}
+	return Leaderboard{}, ErrUnknownLeaderboard
+}
+
+// String returns the board name
+func (b Leaderboard) String() string {
+	if b.Level == "" {
+		return string(b.Period)
+	}
+	return string(b.Period) + "-" + strings.ToLower(string(b.Level))
+}
+
+// Leaderboards returns every board of a period: the global one, then one per JLPT level
+func Leaderboards(period LeaderboardPeriod) []Leaderboard {
+	boards := []Leaderboard{{Period: period}}
+	for _, level := range JLPTLevels {
+		boards = append(boards, Leaderboard{Period: period, Level: level})
+	}
+	return boards
+}
+
+// WeekOf returns the ISO week t falls in, in UTC, e.g. 2024-W19
+func WeekOf(t time.Time) string {
+	year, week := t.UTC().ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// WeekEnd returns when the ISO week containing t ends: the next Monday 00:00 UTC
+func WeekEnd(t time.Time) time.Time {
+	t = t.UTC()
+	daysToMonday := (8 - int(t.Weekday())) % 7
+	if daysToMonday == 0 {
+		daysToMonday = 7
+	}
+	return time.Date(t.Year(), t.Month(), t.Day()+daysToMonday, 0, 0, 0, 0, time.UTC)
+}
+
+// LeaderboardEntry is a learner's place on a board
+type LeaderboardEntry struct {
+	Rank   int64  `bson:"rank" json:"rank"` // 1 is the top
+	UserID string `bson:"user_id" json:"user_id"`
+	Name   string `bson:"name" json:"name"`
+	Score  int64  `bson:"score" json:"score"`
+}
+
+// LeaderboardStanding is a board as seen by one learner
+type LeaderboardStanding struct {
+	Board string             `json:"board"`
+	Week  string             `json:"week,omitempty"` // For weekly boards
+	Top   []LeaderboardEntry `json:"top"`
+	// Me is the caller's entry and Neighbours the entries around it, including it; both
+	// are empty when the caller is not on the board
+	Me         *LeaderboardEntry  `json:"me,omitempty"`
+	Neighbours []LeaderboardEntry `json:"neighbours"`
+	Archived   bool               `json:"archived"` // A past week, served from the archive
+}
+
+// LeaderboardArchive is the final top of a weekly board
+type LeaderboardArchive struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Board      string             `bson:"board" json:"board"`
+	Week       string             `bson:"week" json:"week"`
+	Entries    []LeaderboardEntry `bson:"entries" json:"entries"`
+	ArchivedAt time.Time          `bson:"archived_at" json:"archived_at"`
+}
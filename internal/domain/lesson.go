@@ -4,10 +4,73 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// LessonState is whether a learner can open a lesson
+type LessonState string
+
+const (
+	LessonStateLocked    LessonState = "locked"
+	LessonStateUnlocked  LessonState = "unlocked"
+	LessonStateCompleted LessonState = "completed"
+)
+
+// Reasons a lesson is locked, as listed in Lesson.UnmetPrerequisites
+const (
+	PrerequisiteEntitlement    = "entitlement" // The course needs an entitlement the learner lacks
+	PrerequisitePreviousLesson = "previous_lesson"
+	PrerequisiteMinScore       = "min_score"
+	PrerequisiteMastery        = "mastery"
+)
+
 // Lesson represents a lesson within a course
 type Lesson struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Title     string             `bson:"title" json:"title"`
-	Content   string             `bson:"content" json:"content"`
-	Exercises []Exercise         `bson:"exercises" json:"exercises"`
+	ID            primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Title         string               `bson:"title" json:"title"`
+	Content       string               `bson:"content" json:"content"`
+	Exercises     []Exercise           `bson:"exercises" json:"exercises"`
+	Prerequisites *LessonPrerequisites `bson:"prerequisites,omitempty" json:"prerequisites,omitempty"`
+
+	// State and UnmetPrerequisites are computed for the learner the course is served to
+	State              LessonState `bson:"-" json:"state,omitempty"`
+	UnmetPrerequisites []string    `bson:"-" json:"unmet_prerequisites,omitempty"`
+}
+
+// LessonPrerequisites are the conditions a learner must meet before opening a lesson
+type LessonPrerequisites struct {
+	// PreviousLesson requires the previous lesson of the course to be completed
+	PreviousLesson bool `bson:"previous_lesson,omitempty" json:"previous_lesson,omitempty"`
+	// MinScore is the average exercise score required on the previous lesson
+	MinScore int                  `bson:"min_score,omitempty" json:"min_score,omitempty"`
+	Mastery  []MasteryRequirement `bson:"mastery,omitempty" json:"mastery,omitempty"`
+}
+
+// MasteryRequirement is a minimum number of completed kana and kanji at a JLPT level
+type MasteryRequirement struct {
+	Level JLPTLevel `bson:"level" json:"level"`
+	Kana  int       `bson:"kana,omitempty" json:"kana,omitempty"`
+	Kanji int       `bson:"kanji,omitempty" json:"kanji,omitempty"`
+}
+
+// unmet lists the prerequisites of l that progress does not satisfy; prev is the
+// learner's completion of the previous lesson, nil for the first lesson
+func (l *Lesson) unmet(prev *LessonCompletion, mastery map[JLPTLevel]LevelMastery) []string {
+	p := l.Prerequisites
+	if p == nil {
+		return nil
+	}
+
+	var unmet []string
+	if p.PreviousLesson && prev != nil && prev.Status != LessonCompleted {
+		unmet = append(unmet, PrerequisitePreviousLesson)
+	}
+	if p.MinScore > 0 && prev != nil && (prev.AverageScore == nil || *prev.AverageScore < float64(p.MinScore)) {
+		unmet = append(unmet, PrerequisiteMinScore)
+	}
+	for _, req := range p.Mastery {
+		m := mastery[req.Level]
+		if m.KanaMastered < req.Kana || m.KanjiMastered < req.Kanji {
+			unmet = append(unmet, PrerequisiteMastery)
+			break
+		}
+	}
+	return unmet
 }
@@ -16,6 +16,15 @@ const (
 	ExerciseEntity EntityType = "exercise"
 )
 
+// Valid reports whether t is one of the known entity types
+func (t EntityType) Valid() bool {
+	switch t {
+	case SyllableEntity, KanjiEntity, LessonEntity, ExerciseEntity:
+		return true
+	}
+	return false
+}
+
 // Progress represents user progress on learning entities
 type Progress struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
@@ -26,3 +35,13 @@ type Progress struct {
 	Score       int                `bson:"score" json:"score"` // For exercises
 	CompletedAt *time.Time         `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
 }
+
+// Merge folds other, progress on the same entity by another account, into p: the best
+// score and the earliest completion are kept
+func (p *Progress) Merge(other Progress) {
+	p.Score = max(p.Score, other.Score)
+	p.Completed = p.Completed || other.Completed
+	if other.CompletedAt != nil && (p.CompletedAt == nil || other.CompletedAt.Before(*p.CompletedAt)) {
+		p.CompletedAt = other.CompletedAt
+	}
+}
@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LessonStatus is how far a learner is through a lesson
+type LessonStatus string
+
+const (
+	LessonNotStarted LessonStatus = "not_started"
+	LessonInProgress LessonStatus = "in_progress"
+	LessonCompleted  LessonStatus = "completed"
+)
+
+// LessonProgressStats is a learner's progress on one lesson and its exercises, aggregated
+// from their progress records
+type LessonProgressStats struct {
+	CourseID           primitive.ObjectID `bson:"course_id"`
+	CourseName         string             `bson:"course_name"`
+	CourseLevel        JLPTLevel          `bson:"course_level"`
+	LessonID           primitive.ObjectID `bson:"lesson_id"`
+	LessonTitle        string             `bson:"lesson_title"`
+	Started            bool               `bson:"started"` // Any progress on the lesson or its exercises
+	LessonCompleted    bool               `bson:"lesson_completed"`
+	ExercisesTotal     int                `bson:"exercises_total"`
+	ExercisesCompleted int                `bson:"exercises_completed"`
+	ExercisesAttempted int                `bson:"exercises_attempted"`
+	ScoreSum           int                `bson:"score_sum"` // Over attempted exercises
+}
+
+// Status derives the lesson status; a lesson whose exercises are all completed counts as
+// completed even if the lesson itself was never marked
+func (s LessonProgressStats) Status() LessonStatus {
+	switch {
+	case s.LessonCompleted || (s.ExercisesTotal > 0 && s.ExercisesCompleted >= s.ExercisesTotal):
+		return LessonCompleted
+	case s.Started:
+		return LessonInProgress
+	default:
+		return LessonNotStarted
+	}
+}
+
+// LevelMastery counts the kana and kanji a learner has completed at a JLPT level. Kana are
+// counted at N5, the level that introduces them.
+type LevelMastery struct {
+	Level         JLPTLevel `json:"level"`
+	KanaMastered  int       `json:"kana_mastered"`
+	KanaTotal     int       `json:"kana_total"`
+	KanjiMastered int       `json:"kanji_mastered"`
+	KanjiTotal    int       `json:"kanji_total"`
+}
+
+// LessonCompletion is a lesson as shown in a progress summary
+type LessonCompletion struct {
+	LessonID           primitive.ObjectID `json:"lesson_id"`
+	Title              string             `json:"title"`
+	Status             LessonStatus       `json:"status"`
+	ExercisesCompleted int                `json:"exercises_completed"`
+	ExercisesTotal     int                `json:"exercises_total"`
+	AverageScore       *float64           `json:"average_score"` // nil until an exercise is attempted
+}
+
+// CourseCompletion is how far a learner is through a course
+type CourseCompletion struct {
+	CourseID             primitive.ObjectID `json:"course_id"`
+	Name                 string             `json:"name"`
+	Level                JLPTLevel          `json:"level"`
+	PercentComplete      float64            `json:"percent_complete"` // Share of completed lessons
+	LessonsCompleted     int                `json:"lessons_completed"`
+	LessonsTotal         int                `json:"lessons_total"`
+	AverageExerciseScore *float64           `json:"average_exercise_score"`
+	Lessons              []LessonCompletion `json:"lessons"`
+}
+
+// ProgressSummary is a learner's completion across all courses and JLPT levels
+type ProgressSummary struct {
+	Courses     []CourseCompletion `json:"courses"`
+	Levels      []LevelMastery     `json:"levels"`
+	GeneratedAt time.Time          `json:"generated_at"`
+}
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FollowStatus is whether a follow is in effect
+type FollowStatus string
+
+const (
+	// FollowPending is a request waiting for the followee's approval
+	FollowPending  FollowStatus = "pending"
+	FollowAccepted FollowStatus = "accepted"
+)
+
+// Follow is one user following another. Two users following each other are friends.
+type Follow struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	FollowerID primitive.ObjectID `bson:"follower_id" json:"follower_id"`
+	FolloweeID primitive.ObjectID `bson:"followee_id" json:"followee_id"`
+	Status     FollowStatus       `bson:"status" json:"status"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	AcceptedAt *time.Time         `bson:"accepted_at,omitempty" json:"accepted_at,omitempty"`
+}
+
+// ActivityVisibility is who sees a user's milestones in their feed
+type ActivityVisibility string
+
+const (
+	VisibleToFollowers ActivityVisibility = "followers"
+	VisibleToFriends   ActivityVisibility = "friends"
+	VisibleToNobody    ActivityVisibility = "private"
+)
+
+// Visibility returns who sees the user's milestones; followers unless they chose otherwise
+func (u *User) Visibility() ActivityVisibility {
+	if u.ActivityVisibility == "" {
+		return VisibleToFollowers
+	}
+	return u.ActivityVisibility
+}
+
+// ActivityKind is the milestone an activity records
+type ActivityKind string
+
+const (
+	ActivityLessonCompleted ActivityKind = "lesson_completed"
+	ActivityStreakMilestone ActivityKind = "streak_milestone"
+	ActivityLevelReached    ActivityKind = "level_reached"
+)
+
+// Activity is a milestone shown in the feed of the user's followers
+type Activity struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Kind   ActivityKind       `bson:"kind" json:"kind"`
+	// Key identifies the milestone among those of its kind, so each is recorded once
+	Key string `bson:"key" json:"-"`
+	// Visibility is copied from the user and updated with their settings
+	Visibility  ActivityVisibility  `bson:"visibility" json:"-"`
+	LessonID    *primitive.ObjectID `bson:"lesson_id,omitempty" json:"lesson_id,omitempty"`
+	LessonTitle string              `bson:"lesson_title,omitempty" json:"lesson_title,omitempty"`
+	CourseName  string              `bson:"course_name,omitempty" json:"course_name,omitempty"`
+	Value       int                 `bson:"value,omitempty" json:"value,omitempty"` // Streak days or level reached
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// FeedItem is an activity with the name of whoever it belongs to
+type FeedItem struct {
+	Activity
+	Name string `json:"name"`
+}
+
+// FeedPage is a page of a feed, newest first. NextCursor fetches the following page and
+// is empty on the last one.
+type FeedPage struct {
+	Items      []FeedItem `json:"items"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// Connection is another user as seen in the lists of followers, following and requests
+type Connection struct {
+	UserID primitive.ObjectID `json:"user_id"`
+	Name   string             `json:"name"`
+	Status FollowStatus       `json:"status"`
+	Mutual bool               `json:"mutual"` // Both follow each other: they are friends
+	Since  time.Time          `json:"since"`
+}
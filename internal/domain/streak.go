@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DayLayout formats calendar days, e.g. 2024-03-10
+const DayLayout = "2006-01-02"
+
+// maxFrozenDays bounds how many days kept by a freeze a streak remembers
+const maxFrozenDays = 30
+
+// DayIn returns the calendar day t falls on in loc
+func DayIn(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(DayLayout)
+}
+
+// DaysBetween returns how many calendar days day b is after day a. Days are compared as
+// dates, so DST changes in the user's timezone never produce 23 or 25 hour "days".
+func DaysBetween(a, b string) int {
+	ta, errA := time.Parse(DayLayout, a)
+	tb, errB := time.Parse(DayLayout, b)
+	if errA != nil || errB != nil {
+		return 0
+	}
+	return int(tb.Sub(ta).Hours() / 24)
+}
+
+// AddDays returns the calendar day n days after day
+func AddDays(day string, n int) string {
+	t, err := time.Parse(DayLayout, day)
+	if err != nil {
+		return day
+	}
+	return t.AddDate(0, 0, n).Format(DayLayout)
+}
+
+// StreakRules tune how streak freezes are earned
+type StreakRules struct {
+	MaxFreezes      int // Earned freezes stop accumulating at this many; purchases can exceed it
+	EarnFreezeEvery int // A freeze is earned every this many streak days; 0 disables earning
+}
+
+// Streak counts consecutive calendar days, in the user's timezone, with learning activity.
+// A freeze covers one missed day.
+type Streak struct {
+	UserID        primitive.ObjectID `bson:"_id" json:"-"`
+	Current       int                `bson:"current" json:"current"`
+	Longest       int                `bson:"longest" json:"longest"`
+	LastActiveDay string             `bson:"last_active_day,omitempty" json:"last_active_day,omitempty"`
+	Freezes       int                `bson:"freezes" json:"freezes"`
+	FrozenDays    []string           `bson:"frozen_days,omitempty" json:"frozen_days,omitempty"` // Recent days kept by a freeze
+	// CreditedPurchases are the store purchase IDs already turned into freezes
+	CreditedPurchases []string  `bson:"credited_purchases,omitempty" json:"-"`
+	Version           int64     `bson:"version" json:"-"` // Incremented on every save
+	UpdatedAt         time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// RecordActivity counts day as active. Days missed since the last active day are covered
+// by freezes if there are enough of them; otherwise the streak starts again. It returns
+// false if nothing changed because the day was already counted.
+func (s *Streak) RecordActivity(day string, rules StreakRules) bool {
+	if s.LastActiveDay == "" {
+		s.Current = 1
+	} else {
+		gap := DaysBetween(s.LastActiveDay, day)
+		if gap <= 0 {
+			// Same day, or an earlier one after the user moved west across timezones
+			return false
+		}
+
+		missed := gap - 1
+		switch {
+		case missed == 0:
+			s.Current++
+		case missed <= s.Freezes:
+			s.Freezes -= missed
+			for i := 1; i <= missed; i++ {
+				s.FrozenDays = append(s.FrozenDays, AddDays(s.LastActiveDay, i))
+			}
+			if len(s.FrozenDays) > maxFrozenDays {
+				s.FrozenDays = s.FrozenDays[len(s.FrozenDays)-maxFrozenDays:]
+			}
+			s.Current++
+		default:
+			s.Current = 1
+		}
+	}
+
+	s.LastActiveDay = day
+	s.Longest = max(s.Longest, s.Current)
+	if rules.EarnFreezeEvery > 0 && s.Current%rules.EarnFreezeEvery == 0 && s.Freezes < rules.MaxFreezes {
+		s.Freezes++
+	}
+	return true
+}
+
+// StreakStatus is a streak as seen on a given day
+type StreakStatus struct {
+	Current       int      `json:"current"`
+	Longest       int      `json:"longest"`
+	Freezes       int      `json:"freezes"`
+	ActiveToday   bool     `json:"active_today"`
+	LastActiveDay string   `json:"last_active_day,omitempty"`
+	FrozenDays    []string `json:"frozen_days,omitempty"`
+	Today         string   `json:"today"` // In the user's timezone
+}
+
+// StatusOn returns the streak as seen on today. A streak with more missed days than
+// freezes shows as 0, although it is only reset by the next activity.
+func (s *Streak) StatusOn(today string) StreakStatus {
+	status := StreakStatus{Today: today}
+	if s == nil || s.LastActiveDay == "" {
+		return status
+	}
+
+	status.Longest = s.Longest
+	status.Freezes = s.Freezes
+	status.LastActiveDay = s.LastActiveDay
+	status.FrozenDays = s.FrozenDays
+
+	gap := DaysBetween(s.LastActiveDay, today)
+	switch {
+	case gap <= 0:
+		status.Current = s.Current
+		status.ActiveToday = true
+	case gap-1 <= s.Freezes:
+		// Still alive: today can extend it, spending freezes on the missed days
+		status.Current = s.Current
+	}
+	return status
+}
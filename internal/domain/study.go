@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StudySession is one sitting of study, recorded by the app and uploaded once it ends.
+// It is unrelated to Session, which is a logged-in device. ClientID is chosen by the app
+// so a batch can be sent again without counting its sessions twice.
+type StudySession struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"user_id" json:"user_id"`
+	ClientID     string             `bson:"client_id" json:"client_id"`
+	StartedAt    time.Time          `bson:"started_at" json:"started_at"`
+	EndedAt      time.Time          `bson:"ended_at" json:"ended_at"`
+	ItemsSeen    int                `bson:"items_seen" json:"items_seen"`
+	ItemsCorrect int                `bson:"items_correct" json:"items_correct"`
+	Device       string             `bson:"device,omitempty" json:"device,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Duration is how long the session lasted
+func (s StudySession) Duration() time.Duration {
+	return s.EndedAt.Sub(s.StartedAt)
+}
+
+// Accuracy is the share of items answered correctly, from 0 to 1
+func (s StudySession) Accuracy() float64 {
+	if s.ItemsSeen == 0 {
+		return 0
+	}
+	return float64(s.ItemsCorrect) / float64(s.ItemsSeen)
+}
+
+// SessionDay sums up the study sessions started on one calendar day
+type SessionDay struct {
+	Day          string `bson:"_id"`
+	Sessions     int    `bson:"sessions"`
+	Seconds      int    `bson:"seconds"`
+	ItemsSeen    int    `bson:"items_seen"`
+	ItemsCorrect int    `bson:"items_correct"`
+}
+
+// AttemptDay sums up the answers given on one calendar day. Reviews are the first answer
+// of the day on items already answered on an earlier day; Retained are those answered
+// correctly.
+type AttemptDay struct {
+	Day      string `bson:"_id"`
+	Attempts int    `bson:"attempts"`
+	Correct  int    `bson:"correct"`
+	Reviews  int    `bson:"reviews"`
+	Retained int    `bson:"retained"`
+}
+
+// StudyDay is the study done on one calendar day, one cell of a heatmap. Rates are nil
+// when there is nothing to compute them from.
+type StudyDay struct {
+	Day       string `json:"day,omitempty"`
+	Sessions  int    `json:"sessions"`
+	Minutes   int    `json:"minutes"`
+	ItemsSeen int    `json:"items_seen"`
+	Attempts  int    `json:"attempts"`
+	// Accuracy is the share of attempts answered correctly, or of the items seen in
+	// sessions if no attempts were logged
+	Accuracy      *float64 `json:"accuracy"`
+	Reviews       int      `json:"reviews"`
+	Retained      int      `json:"retained"`
+	RetentionRate *float64 `json:"retention_rate"` // Share of reviews retained
+}
+
+// StudyStats is the study done over a range of calendar days in the user's timezone
+type StudyStats struct {
+	From     string     `json:"from"`
+	To       string     `json:"to"`
+	Timezone string     `json:"timezone"`
+	Days     []StudyDay `json:"days"` // Every day of the range, oldest first
+	Totals   StudyDay   `json:"totals"`
+}
@@ -9,22 +9,38 @@ import (
 type SubscriptionStatus string
 
 const (
-	SubscriptionActive    SubscriptionStatus = "active"
-	SubscriptionCancelled SubscriptionStatus = "cancelled"
-	SubscriptionExpired   SubscriptionStatus = "expired"
+	SubscriptionActive      SubscriptionStatus = "active"
+	SubscriptionGracePeriod SubscriptionStatus = "grace_period"
+	SubscriptionCancelled   SubscriptionStatus = "cancelled"
+	SubscriptionExpired     SubscriptionStatus = "expired"
 )
 
 type Subscription struct {
-	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
-	InternalUserID *primitive.ObjectID `bson:"internal_user_id,omitempty" json:"internal_user_id"`
-	ExternalUserID string              `bson:"external_user_id" json:"external_user_id"` // RevenueCat app_user_id
-	ProductID      string              `bson:"product_id" json:"product_id"`
-	EventID        string              `bson:"event_id" json:"event_id"` // For idempotency
-	Status         SubscriptionStatus  `bson:"status" json:"status"`
-	ExpiresAt      time.Time           `bson:"expires_at" json:"expires_at"`
-	EventType      string              `bson:"event_type" json:"event_type"`
-	CreatedAt      time.Time           `bson:"created_at" json:"created_at"`
-	UpdatedAt      time.Time           `bson:"updated_at" json:"updated_at"`
+	ID                   primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	InternalUserID       *primitive.ObjectID `bson:"internal_user_id,omitempty" json:"internal_user_id"`
+	ExternalUserID       string              `bson:"external_user_id" json:"external_user_id"` // RevenueCat app_user_id
+	ProductID            string              `bson:"product_id" json:"product_id"`
+	Entitlements         []string            `bson:"entitlements,omitempty" json:"entitlements,omitempty"` // Internal entitlements from the catalog
+	EventID              string              `bson:"event_id" json:"event_id"`                             // For idempotency
+	Status               SubscriptionStatus  `bson:"status" json:"status"`
+	ExpiresAt            time.Time           `bson:"expires_at" json:"expires_at"`
+	BillingIssueAt       *time.Time          `bson:"billing_issue_at,omitempty" json:"billing_issue_at,omitempty"`
+	GracePeriodExpiresAt *time.Time          `bson:"grace_period_expires_at,omitempty" json:"grace_period_expires_at,omitempty"`
+	EventType            string              `bson:"event_type" json:"event_type"`
+	LastEventAt          time.Time           `bson:"last_event_at,omitempty" json:"last_event_at"`           // Timestamp of the newest applied event
+	ReconciledAt         *time.Time          `bson:"reconciled_at,omitempty" json:"reconciled_at,omitempty"` // Last checked against the provider
+	CreatedAt            time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt            time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// SubscriptionAccess summarises what a user's subscription allows right now
+type SubscriptionAccess struct {
+	HasPremium           bool               `json:"has_premium"`
+	Entitlements         []string           `json:"entitlements"`
+	Status               SubscriptionStatus `json:"status,omitempty"`
+	ExpiresAt            *time.Time         `json:"expires_at,omitempty"`
+	BillingIssue         bool               `json:"billing_issue"`
+	GracePeriodExpiresAt *time.Time         `json:"grace_period_expires_at,omitempty"`
 }
 
 // NewSubscription crea una nueva suscripción con valores por defecto
@@ -48,4 +64,56 @@ func (s *Subscription) UpdateStatus(status SubscriptionStatus, expiresAt time.Ti
 	if !expiresAt.IsZero() {
 		s.ExpiresAt = expiresAt
 	}
+	// Any status other than grace clears a pending billing issue
+	if status != SubscriptionGracePeriod {
+		s.BillingIssueAt = nil
+		s.GracePeriodExpiresAt = nil
+	}
+}
+
+// EnterGracePeriod keeps access for the given duration after a billing issue was detected
+func (s *Subscription) EnterGracePeriod(detectedAt time.Time, gracePeriod time.Duration) {
+	graceEnds := detectedAt.Add(gracePeriod)
+	s.Status = SubscriptionGracePeriod
+	s.BillingIssueAt = &detectedAt
+	s.GracePeriodExpiresAt = &graceEnds
+	s.UpdatedAt = time.Now()
+}
+
+// ExpireIfGraceEnded moves a subscription whose grace period has elapsed to expired.
+// It reports whether the status changed so callers know to persist it.
+func (s *Subscription) ExpireIfGraceEnded(now time.Time) bool {
+	if s.Status != SubscriptionGracePeriod || s.GracePeriodExpiresAt == nil {
+		return false
+	}
+	if now.Before(*s.GracePeriodExpiresAt) {
+		return false
+	}
+	s.Status = SubscriptionExpired
+	s.UpdatedAt = now
+	return true
+}
+
+// HasAccess reports whether the subscription currently grants premium access
+func (s *Subscription) HasAccess(now time.Time) bool {
+	switch s.Status {
+	case SubscriptionActive:
+		return true
+	case SubscriptionGracePeriod:
+		return s.GracePeriodExpiresAt != nil && now.Before(*s.GracePeriodExpiresAt)
+	case SubscriptionCancelled:
+		// Cancelled means auto-renew is off; access lasts until the paid period ends
+		return now.Before(s.ExpiresAt)
+	default:
+		return false
+	}
+}
+
+// GrantedEntitlements returns the entitlements this subscription grants while it has access.
+// Records stored before the catalog existed only ever granted premium.
+func (s *Subscription) GrantedEntitlements() []string {
+	if len(s.Entitlements) == 0 {
+		return []string{PremiumEntitlement}
+	}
+	return s.Entitlements
 }
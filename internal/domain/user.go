@@ -6,13 +6,83 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// UserRole represents the authorization role of a user
+type UserRole string
+
+const (
+	RoleStudent UserRole = "student"
+	RoleTeacher UserRole = "teacher"
+	RoleAdmin   UserRole = "admin"
+	// RoleGuest is an anonymous account bound to one device, limited to free content
+	RoleGuest UserRole = "guest"
+)
+
 // User represents a user in the system
 type User struct {
 	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Name             string             `bson:"name" json:"name" validate:"required,min=2,max=100"`
 	Email            string             `bson:"email" json:"email" validate:"required,email"`
-	Password         string             `bson:"password" json:"-" validate:"required,min=8"` // Never expose password in JSON
+	EmailVerified    bool               `bson:"email_verified" json:"email_verified"`
+	EmailVerifiedAt  *time.Time         `bson:"email_verified_at,omitempty" json:"email_verified_at,omitempty"`
+	PendingEmail     string             `bson:"pending_email,omitempty" json:"pending_email,omitempty"` // Awaiting confirmation from the new address
+	Password         string             `bson:"password" json:"-" validate:"required,min=8"`            // Never expose password in JSON
 	RevenueCatUserID string             `bson:"revenue_cat_user_id" json:"revenue_cat_user_id"`
-	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+	Role             UserRole           `bson:"role,omitempty" json:"role,omitempty"`
+	Identities       []Identity         `bson:"identities,omitempty" json:"identities,omitempty"`
+	TwoFactor        *TwoFactor         `bson:"two_factor,omitempty" json:"-"`
+	GuestSecretHash  string             `bson:"guest_secret_hash,omitempty" json:"-"`             // SHA-256 of the device credential of a guest
+	Locale           string             `bson:"locale,omitempty" json:"locale,omitempty"`         // BCP 47 tag, e.g. "es-CO"
+	Timezone         string             `bson:"timezone,omitempty" json:"timezone,omitempty"`     // IANA name, e.g. "America/Bogota"
+	DailyGoal        int                `bson:"daily_goal,omitempty" json:"daily_goal,omitempty"` // Daily XP target
+	// LeaderboardOptOut keeps the user off leaderboards
+	LeaderboardOptOut bool `bson:"leaderboard_opt_out,omitempty" json:"leaderboard_opt_out"`
+	// FollowApproval makes follows requests that the user approves
+	FollowApproval bool `bson:"follow_approval,omitempty" json:"follow_approval"`
+	// ActivityVisibility is who sees the user's milestones; empty means followers
+	ActivityVisibility ActivityVisibility `bson:"activity_visibility,omitempty" json:"activity_visibility,omitempty"`
+	// DeletionScheduledAt is when a deletion requested by the user takes effect; logging in before then cancels it
+	DeletionScheduledAt *time.Time `bson:"deletion_scheduled_at,omitempty" json:"deletion_scheduled_at,omitempty"`
+	CreatedAt           time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt           time.Time  `bson:"updated_at" json:"updated_at"`
+}
+
+// IsGuest reports whether the user is an anonymous guest
+func (u *User) IsGuest() bool {
+	return u.Role == RoleGuest
+}
+
+// Identity is an external sign-in (Apple, Google...) linked to a user
+type Identity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"-"`
+	Email    string    `bson:"email,omitempty" json:"email,omitempty"`
+	LinkedAt time.Time `bson:"linked_at" json:"linked_at"`
+}
+
+// HasIdentity reports whether the provider account is already linked to the user
+func (u *User) HasIdentity(provider, subject string) bool {
+	for _, id := range u.Identities {
+		if id.Provider == provider && id.Subject == subject {
+			return true
+		}
+	}
+	return false
+}
+
+// TwoFactor holds a user's TOTP second factor
+type TwoFactor struct {
+	// Secret is the confirmed TOTP secret; empty until enrolment is confirmed
+	Secret string `bson:"secret,omitempty"`
+	// PendingSecret is a secret handed out by enrolment that has not been confirmed with a code yet
+	PendingSecret string `bson:"pending_secret,omitempty"`
+	// RecoveryCodes are SHA-256 hashes of the unused one-time recovery codes
+	RecoveryCodes []string   `bson:"recovery_codes,omitempty"`
+	EnabledAt     *time.Time `bson:"enabled_at,omitempty"`
+	// LastUsedStep is the TOTP time step of the last accepted code, so a code cannot be replayed
+	LastUsedStep int64 `bson:"last_used_step,omitempty"`
+}
+
+// TwoFactorEnabled reports whether the user has a confirmed second factor
+func (u *User) TwoFactorEnabled() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Secret != ""
 }
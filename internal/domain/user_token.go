@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TokenPurpose tells what a single-use user token can be exchanged for
+type TokenPurpose string
+
+const (
+	PasswordResetPurpose     TokenPurpose = "password_reset"
+	EmailVerificationPurpose TokenPurpose = "email_verification"
+	AccountUnlockPurpose     TokenPurpose = "account_unlock"
+	EmailChangePurpose       TokenPurpose = "email_change"
+	// TwoFactorChallengePurpose links the two steps of a login with 2FA
+	TwoFactorChallengePurpose TokenPurpose = "two_factor_challenge"
+)
+
+// UserToken is a single-use, expiring token sent to a user out of band (e.g. by email).
+// Only the SHA-256 hash of the token is stored.
+type UserToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Purpose   TokenPurpose       `bson:"purpose" json:"purpose"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty" json:"used_at,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// XPReason is why experience points were awarded
+type XPReason string
+
+const (
+	XPCompletion XPReason = "completion" // First completion of an entity
+	XPReview     XPReason = "review"     // Completing an entity again on a later day
+)
+
+// XPEvent is one entry of the experience points ledger. A user earns XP for an entity
+// at most once per day.
+type XPEvent struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	EntityID   primitive.ObjectID `bson:"entity_id" json:"entity_id"`
+	EntityType EntityType         `bson:"entity_type" json:"entity_type"`
+	Difficulty JLPTLevel          `bson:"difficulty" json:"difficulty"`
+	Reason     XPReason           `bson:"reason" json:"reason"`
+	XP         int                `bson:"xp" json:"xp"`
+	Day        string             `bson:"day" json:"day"` // In the user's timezone when awarded
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// XPDay totals a user's XP on one calendar day. Goal is the daily goal in effect when XP
+// was last earned that day.
+type XPDay struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"-"`
+	Day       string             `bson:"day" json:"day"`
+	XP        int                `bson:"xp" json:"xp"`
+	Goal      int                `bson:"goal" json:"goal"`
+	GoalMetAt *time.Time         `bson:"goal_met_at,omitempty" json:"goal_met_at,omitempty"`
+}
+
+// XPRule is the XP an entity type is worth at the easiest difficulty
+type XPRule struct {
+	Completion int
+	Review     int
+}
+
+// XPRules decide how much XP an entity is worth
+type XPRules struct {
+	ByEntityType map[EntityType]XPRule
+	// Difficulty multiplies the XP of entities at a JLPT level; levels not listed count as 1
+	Difficulty map[JLPTLevel]float64
+}
+
+// Award returns the XP for completing an entity of type t at difficulty level
+func (r XPRules) Award(t EntityType, level JLPTLevel, reason XPReason) int {
+	rule := r.ByEntityType[t]
+	xp := rule.Completion
+	if reason == XPReview {
+		xp = rule.Review
+	}
+
+	multiplier, ok := r.Difficulty[level]
+	if !ok {
+		multiplier = 1
+	}
+	return int(float64(xp)*multiplier + 0.5)
+}
+
+// XPLevel is the level a total amount of XP reaches
+type XPLevel struct {
+	Level       int   `json:"level"`
+	TotalXP     int64 `json:"total_xp"`
+	LevelXP     int64 `json:"level_xp"`      // Earned since reaching Level
+	NextLevelXP int64 `json:"next_level_xp"` // Needed to go from Level to the next one
+}
+
+// LevelFor returns the level reached with total XP. Going from level n to n+1 takes
+// n*base XP, so level 2 needs base XP, level 3 another 2*base and so on.
+func LevelFor(total int64, base int) XPLevel {
+	if base <= 0 {
+		base = 1
+	}
+	level := XPLevel{Level: 1, TotalXP: total, LevelXP: total, NextLevelXP: int64(base)}
+	for level.LevelXP >= level.NextLevelXP {
+		level.LevelXP -= level.NextLevelXP
+		level.Level++
+		level.NextLevelXP = int64(level.Level * base)
+	}
+	return level
+}
+
+// XPDayStatus is a day of XP against the daily goal
+type XPDayStatus struct {
+	Day     string `json:"day"`
+	XP      int    `json:"xp"`
+	Goal    int    `json:"goal"`
+	GoalMet bool   `json:"goal_met"`
+}
+
+// XPStatus is a user's XP, level and daily goal progress
+type XPStatus struct {
+	XPLevel
+	Today   XPDayStatus   `json:"today"`
+	History []XPDayStatus `json:"history"` // Oldest first, ending with today
+}
@@ -0,0 +1,29 @@
+package ports
+
+import (
+	"context"
+	"errors"
+
+	"nihongo-api/internal/domain"
+)
+
+// AchievementRepository defines the interface for achievement definitions and the
+// achievements users earned
+type AchievementRepository interface {
+	// Definitions returns the enabled achievements by their order
+	Definitions(ctx context.Context) ([]domain.AchievementDefinition, error)
+	// EnsureDefinitions adds the definitions whose ID is not stored yet; stored ones are
+	// left as they are
+	EnsureDefinitions(ctx context.Context, definitions []domain.AchievementDefinition) error
+
+	// Earned returns the achievements the user earned
+	Earned(ctx context.Context, userID string) ([]domain.UserAchievement, error)
+	// Award records an earned achievement. It returns ErrAchievementAlreadyEarned if the
+	// user already has it.
+	Award(ctx context.Context, achievement *domain.UserAchievement) error
+	// DeleteByUser removes the user's achievements and returns how many were removed
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+}
+
+// ErrAchievementAlreadyEarned is returned when an achievement is awarded twice
+var ErrAchievementAlreadyEarned = errors.New("achievement already earned")
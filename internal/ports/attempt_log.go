@@ -0,0 +1,28 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"nihongo-api/internal/domain"
+)
+
+// AttemptLog defines the interface for the answers learners give, kept for mistake analysis
+type AttemptLog interface {
+	Record(ctx context.Context, attempts []domain.Attempt) error
+	// ItemStats sums up the user's attempts since the given time per entity, for the
+	// entities answered wrong at least once. An empty entity type means all of them.
+	ItemStats(ctx context.Context, userID string, entityType domain.EntityType, since time.Time) ([]domain.ItemAttempts, error)
+	// Confusions returns the pairs of answers the user gave one for the other at least
+	// minCount times since the given time, most frequent first
+	Confusions(ctx context.Context, userID string, entityType domain.EntityType, since time.Time, minCount, limit int) ([]domain.ConfusionPair, error)
+	// DailyStats sums up the user's attempts per calendar day in loc, from the first to
+	// the last day inclusive, oldest first. Days without attempts are left out.
+	DailyStats(ctx context.Context, userID string, loc *time.Location, from, to string) ([]domain.AttemptDay, error)
+	// ListByUser returns all of a user's attempts, oldest first
+	ListByUser(ctx context.Context, userID string) ([]domain.Attempt, error)
+	// Reassign moves attempts from one user to another and returns how many were moved
+	Reassign(ctx context.Context, fromUserID, toUserID string) (int64, error)
+	// DeleteByUser removes the user's attempts and returns how many were removed
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+}
@@ -0,0 +1,19 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+// AttemptStore defines the interface for failure counters and temporary locks shared by all replicas
+type AttemptStore interface {
+	// Increment adds one to the counter at key and returns the new value. The counter
+	// expires window after its first increment.
+	Increment(ctx context.Context, key string, window time.Duration) (int64, error)
+	// Lock blocks key for ttl, replacing any shorter or longer existing lock
+	Lock(ctx context.Context, key string, ttl time.Duration) error
+	// LockedFor returns how long key stays locked, or 0 if it is not locked
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// Reset removes counters and locks
+	Reset(ctx context.Context, keys ...string) error
+}
@@ -0,0 +1,17 @@
+package ports
+
+import (
+	"context"
+
+	"nihongo-api/internal/domain"
+)
+
+// AuditLog defines the interface for recording security events
+type AuditLog interface {
+	Record(ctx context.Context, event *domain.AuditEvent) error
+	// ListByUser returns a user's events, newest first
+	ListByUser(ctx context.Context, userID string) ([]*domain.AuditEvent, error)
+	// AnonymizeUser strips the user ID, email and IP from a user's events and returns how
+	// many were changed
+	AnonymizeUser(ctx context.Context, userID string) (int64, error)
+}
@@ -0,0 +1,11 @@
+package ports
+
+import (
+	"context"
+	"nihongo-api/internal/domain"
+)
+
+// CatalogRepository defines the interface for product catalog overrides
+type CatalogRepository interface {
+	GetOverrides(ctx context.Context) ([]domain.CatalogEntry, error)
+}
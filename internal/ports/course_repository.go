@@ -2,16 +2,25 @@ package ports
 
 import (
 	"context"
+	"errors"
 	"nihongo-api/internal/domain"
 )
 
 // CourseRepository defines the interface for course data operations
 type CourseRepository interface {
 	Create(ctx context.Context, course *domain.Course) error
+	// GetByID returns ErrCourseNotFound if the course does not exist
 	GetByID(ctx context.Context, id string) (*domain.Course, error)
+	// GetByLessonID returns the course containing the lesson, or ErrCourseNotFound
+	GetByLessonID(ctx context.Context, lessonID string) (*domain.Course, error)
+	// GetByExerciseID returns the course containing the exercise, or ErrCourseNotFound
+	GetByExerciseID(ctx context.Context, exerciseID string) (*domain.Course, error)
 	GetAll(ctx context.Context) ([]domain.Course, error)
 	GetByLevel(ctx context.Context, level domain.JLPTLevel) ([]domain.Course, error)
 	GetPremium(ctx context.Context) ([]domain.Course, error)
 	Update(ctx context.Context, course *domain.Course) error
 	Delete(ctx context.Context, id string) error
 }
+
+// ErrCourseNotFound is returned when no course matches the lookup
+var ErrCourseNotFound = errors.New("course not found")
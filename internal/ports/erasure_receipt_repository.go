@@ -0,0 +1,20 @@
+package ports
+
+import (
+	"context"
+
+	"nihongo-api/internal/domain"
+)
+
+// ErasureReceiptRepository defines the interface for the append-only erasure receipt chain
+type ErasureReceiptRepository interface {
+	// Append stores a sealed receipt. It fails if a receipt with the same sequence exists,
+	// so two writers cannot fork the chain.
+	Append(ctx context.Context, receipt *domain.ErasureReceipt) error
+	// Last returns the receipt with the highest sequence, or nil if there are none
+	Last(ctx context.Context) (*domain.ErasureReceipt, error)
+	// GetBySubject returns the receipt for the subject hash, or nil if there is none
+	GetBySubject(ctx context.Context, subjectHash string) (*domain.ErasureReceipt, error)
+	// List returns every receipt in sequence order
+	List(ctx context.Context) ([]*domain.ErasureReceipt, error)
+}
@@ -0,0 +1,26 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// VerifiedIdentity is the subset of ID token claims we rely on after verification
+type VerifiedIdentity struct {
+	Provider      string
+	Subject       string // Stable user ID at the provider ("sub" claim)
+	Email         string
+	EmailVerified bool
+	Name          string
+	IssuedAt      time.Time // Zero when the token has no "iat" claim
+}
+
+// IdentityVerifier verifies ID tokens issued by an external identity provider
+type IdentityVerifier interface {
+	Verify(ctx context.Context, idToken string) (*VerifiedIdentity, error)
+}
@@ -2,15 +2,20 @@ package ports
 
 import (
 	"context"
+	"errors"
 	"nihongo-api/internal/domain"
 )
 
 // KanjiRepository defines the interface for kanji data operations
 type KanjiRepository interface {
 	Create(ctx context.Context, kanji *domain.Kanji) error
+	// GetByID returns ErrKanjiNotFound if the kanji does not exist
 	GetByID(ctx context.Context, id string) (*domain.Kanji, error)
 	GetAll(ctx context.Context) ([]domain.Kanji, error)
 	GetByLevel(ctx context.Context, level domain.JLPTLevel) ([]domain.Kanji, error)
 	Update(ctx context.Context, kanji *domain.Kanji) error
 	Delete(ctx context.Context, id string) error
 }
+
+// ErrKanjiNotFound is returned when a kanji does not exist
+var ErrKanjiNotFound = errors.New("kanji not found")
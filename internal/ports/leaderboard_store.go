@@ -0,0 +1,43 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nihongo-api/internal/domain"
+)
+
+// LeaderboardStore defines the interface for live leaderboard scores. A board is named by
+// a key such as "weekly:2024-W19:n3" and ranks users by their total points on it.
+type LeaderboardStore interface {
+	// Submit raises the points the user holds on the board for one entity to points, if
+	// that is more, and adds the difference to their score. A board with a ttl expires
+	// that long after its last submission.
+	Submit(ctx context.Context, board, userID, entityID string, points int64, ttl time.Duration) error
+	// SetName stores the name shown for the user on every board
+	SetName(ctx context.Context, userID, name string) error
+	// Top returns the first n entries of the board
+	Top(ctx context.Context, board string, n int) ([]domain.LeaderboardEntry, error)
+	// Around returns the user's entry with up to radius entries above and below it, or
+	// nothing if the user is not on the board
+	Around(ctx context.Context, board, userID string, radius int) ([]domain.LeaderboardEntry, error)
+	// Remove takes the user off the boards and forgets their name; it returns how many
+	// boards they were on
+	Remove(ctx context.Context, boards []string, userID string) (int64, error)
+	// Delete drops a board
+	Delete(ctx context.Context, board string) error
+}
+
+// LeaderboardArchiveRepository defines the interface for results of past weeks
+type LeaderboardArchiveRepository interface {
+	// Save stores the archive, replacing one for the same board and week
+	Save(ctx context.Context, archive *domain.LeaderboardArchive) error
+	// Get returns ErrLeaderboardArchiveNotFound if the week was not archived
+	Get(ctx context.Context, board, week string) (*domain.LeaderboardArchive, error)
+	// RemoveUser takes the user out of every archive and returns how many they were in
+	RemoveUser(ctx context.Context, userID string) (int64, error)
+}
+
+// ErrLeaderboardArchiveNotFound is returned when a board has no archive for a week
+var ErrLeaderboardArchiveNotFound = errors.New("leaderboard archive not found")
@@ -0,0 +1,12 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+// Locker defines the interface for a distributed lock shared by all replicas
+type Locker interface {
+	// TryLock takes key for ttl if nobody holds it and reports whether it was acquired
+	TryLock(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
@@ -0,0 +1,15 @@
+package ports
+
+import "context"
+
+// Email is a plain-text message to a single recipient
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer defines the interface for sending transactional email
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
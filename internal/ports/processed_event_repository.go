@@ -0,0 +1,15 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+// ProcessedEventRepository records the IDs of the webhook events that were applied, so
+// redeliveries are recognised even after later events replaced the subscription's event_id
+type ProcessedEventRepository interface {
+	// Exists reports whether the event was recorded
+	Exists(ctx context.Context, eventID string) (bool, error)
+	// Record stores the event ID and returns ErrDuplicateEvent if it was already recorded
+	Record(ctx context.Context, eventID string, processedAt time.Time) error
+}
@@ -2,15 +2,34 @@ package ports
 
 import (
 	"context"
+	"errors"
 	"nihongo-api/internal/domain"
 )
 
 // ProgressRepository defines the interface for progress data operations
 type ProgressRepository interface {
+	// Create returns ErrProgressExists if the user already has progress on the entity
 	Create(ctx context.Context, progress *domain.Progress) error
 	GetByID(ctx context.Context, id string) (*domain.Progress, error)
 	GetByUserID(ctx context.Context, userID string) ([]domain.Progress, error)
+	// GetByUserAndEntity returns ErrProgressNotFound if the user has no progress on the entity
 	GetByUserAndEntity(ctx context.Context, userID, entityID string, entityType domain.EntityType) (*domain.Progress, error)
+	// GetByUserAndEntities returns the user's progress on any of the entities
+	GetByUserAndEntities(ctx context.Context, userID string, entityIDs []string) ([]domain.Progress, error)
 	Update(ctx context.Context, progress *domain.Progress) error
 	Delete(ctx context.Context, id string) error
+	// DeleteByUser removes all progress of a user and returns how many records were removed
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+	// LessonStats returns the user's progress on every lesson of every course, ordered by
+	// course and by lesson position
+	LessonStats(ctx context.Context, userID string) ([]domain.LessonProgressStats, error)
+	// MasteryByLevel returns completed and total kana and kanji for every JLPT level
+	MasteryByLevel(ctx context.Context, userID string) ([]domain.LevelMastery, error)
 }
+
+var (
+	// ErrProgressNotFound is returned when there is no progress record for the lookup
+	ErrProgressNotFound = errors.New("progress not found")
+	// ErrProgressExists is returned when creating a second record for the same entity
+	ErrProgressExists = errors.New("progress already exists")
+)
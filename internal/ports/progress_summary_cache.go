@@ -0,0 +1,20 @@
+package ports
+
+import (
+	"context"
+	"nihongo-api/internal/domain"
+	"time"
+)
+
+// ProgressSummaryCache defines the interface for caching progress summaries until the
+// user's progress changes. Summaries are stored per version, so a summary computed before
+// a write can never be served after it.
+type ProgressSummaryCache interface {
+	// Version returns the current version of the user's progress
+	Version(ctx context.Context, userID string) (int64, error)
+	// Get returns the summary stored for version, or nil if there is none
+	Get(ctx context.Context, userID string, version int64) (*domain.ProgressSummary, error)
+	Set(ctx context.Context, userID string, version int64, summary *domain.ProgressSummary, ttl time.Duration) error
+	// Invalidate moves the user to a new version, dropping their cached summary
+	Invalidate(ctx context.Context, userID string) error
+}
@@ -0,0 +1,32 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nihongo-api/internal/domain"
+)
+
+// SessionRepository defines the interface for login session storage
+type SessionRepository interface {
+	Create(ctx context.Context, session *domain.Session) error
+	// GetByID returns ErrSessionNotFound if the session does not exist
+	GetByID(ctx context.Context, id string) (*domain.Session, error)
+	// ListByUser returns all of a user's sessions, including revoked and expired ones
+	ListByUser(ctx context.Context, userID string) ([]*domain.Session, error)
+	// Touch records that the session was used from ip
+	Touch(ctx context.Context, id, ip string, now time.Time) error
+	// Revoke marks one of the user's active sessions as revoked. It returns
+	// ErrSessionNotFound if the user has no such active session.
+	Revoke(ctx context.Context, userID, id string, now time.Time) error
+	// RevokeAllByUser marks all of the user's active sessions except exceptID (empty for
+	// none) as revoked and returns how many were revoked
+	RevokeAllByUser(ctx context.Context, userID, exceptID string, now time.Time) (int64, error)
+	// DeleteByUser removes all of a user's sessions and returns how many were removed
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+}
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+)
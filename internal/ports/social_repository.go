@@ -0,0 +1,57 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nihongo-api/internal/domain"
+)
+
+// FollowRepository defines the interface for follows between users
+type FollowRepository interface {
+	// Create stores a follow. It returns ErrFollowExists if the follower already follows,
+	// or asked to follow, the followee.
+	Create(ctx context.Context, follow *domain.Follow) error
+	// Get returns ErrFollowNotFound if there is no follow between the two
+	Get(ctx context.Context, followerID, followeeID string) (*domain.Follow, error)
+	// Accept accepts a pending follow. It returns ErrFollowNotFound if there is none.
+	Accept(ctx context.Context, followerID, followeeID string, at time.Time) error
+	// AcceptAll accepts every pending follow of the followee and returns how many there were
+	AcceptAll(ctx context.Context, followeeID string, at time.Time) (int64, error)
+	// Delete removes a follow, pending or not. It returns ErrFollowNotFound if there is none.
+	Delete(ctx context.Context, followerID, followeeID string) error
+	// Following returns the follows of the follower with the status, newest first
+	Following(ctx context.Context, followerID string, status domain.FollowStatus) ([]domain.Follow, error)
+	// Followers returns the follows of the followee with the status, newest first
+	Followers(ctx context.Context, followeeID string, status domain.FollowStatus) ([]domain.Follow, error)
+	// CountFollowing counts the follows of the follower, pending ones included
+	CountFollowing(ctx context.Context, followerID string) (int64, error)
+	// FollowersAmong returns which of userIDs follow the followee, accepted follows only
+	FollowersAmong(ctx context.Context, followeeID string, userIDs []string) ([]string, error)
+	// DeleteByUser removes the follows from and to the user and returns how many were removed
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+}
+
+// ActivityRepository defines the interface for the milestones shown in feeds
+type ActivityRepository interface {
+	// Record stores an activity. It returns ErrActivityExists if the user already has one
+	// of the same kind and key.
+	Record(ctx context.Context, activity *domain.Activity) error
+	// Feed returns up to limit activities, newest first, of followers' activities visible
+	// to followers and of friends' visible to followers or friends. If before is set only
+	// activities older than the one with that ID are returned.
+	Feed(ctx context.Context, followers, friends []string, before string, limit int) ([]domain.Activity, error)
+	// ByUser returns all of the user's activities, newest first
+	ByUser(ctx context.Context, userID string) ([]domain.Activity, error)
+	// SetVisibility changes the visibility of the user's activities
+	SetVisibility(ctx context.Context, userID string, visibility domain.ActivityVisibility) error
+	// DeleteByUser removes the user's activities and returns how many were removed
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+}
+
+var (
+	ErrFollowExists   = errors.New("already following")
+	ErrFollowNotFound = errors.New("follow not found")
+	ErrActivityExists = errors.New("activity already recorded")
+)
@@ -0,0 +1,22 @@
+package ports
+
+import (
+	"context"
+	"errors"
+
+	"nihongo-api/internal/domain"
+)
+
+// StreakRepository defines the interface for daily streak storage
+type StreakRepository interface {
+	// Get returns the user's streak, or nil if they have never been active
+	Get(ctx context.Context, userID string) (*domain.Streak, error)
+	// Save stores the streak if its Version is still the stored one and increments it.
+	// It returns ErrStreakConflict if the streak was saved by someone else in between.
+	Save(ctx context.Context, streak *domain.Streak) error
+	// Delete removes the user's streak and returns how many were removed
+	Delete(ctx context.Context, userID string) (int64, error)
+}
+
+// ErrStreakConflict is returned when a streak changed since it was read
+var ErrStreakConflict = errors.New("streak was modified concurrently")
@@ -0,0 +1,25 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"nihongo-api/internal/domain"
+)
+
+// StudySessionRepository defines the interface for study session data access
+type StudySessionRepository interface {
+	// Save stores the sessions, skipping those whose client ID the user already saved,
+	// and returns how many were new
+	Save(ctx context.Context, sessions []domain.StudySession) (int64, error)
+	// DailyStats sums up the user's sessions per calendar day in loc, from the first to
+	// the last day inclusive, oldest first. Days without sessions are left out.
+	DailyStats(ctx context.Context, userID string, loc *time.Location, from, to string) ([]domain.SessionDay, error)
+	// ListByUser returns all of a user's sessions, oldest first
+	ListByUser(ctx context.Context, userID string) ([]domain.StudySession, error)
+	// Reassign moves sessions from one user to another and returns how many were moved.
+	// Sessions the other user already has are dropped.
+	Reassign(ctx context.Context, fromUserID, toUserID string) (int64, error)
+	// DeleteByUser removes the user's sessions and returns how many were removed
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+}
@@ -0,0 +1,53 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Subscriber is the provider-side view of a customer's purchases
+type Subscriber struct {
+	AppUserID         string
+	OriginalAppUserID string                            // The first app user ID of the customer; differs from AppUserID for aliases
+	Entitlements      map[string]SubscriberEntitlement  // Keyed by RevenueCat entitlement ID
+	Subscriptions     map[string]SubscriberSubscription // Keyed by store product ID
+	NonSubscriptions  map[string][]SubscriberPurchase   // Keyed by store product ID
+}
+
+// SubscriberEntitlement is an entitlement as reported by the provider
+type SubscriberEntitlement struct {
+	ProductID   string
+	PurchasedAt time.Time
+	ExpiresAt   *time.Time // nil for lifetime entitlements
+}
+
+// SubscriberSubscription is a renewable subscription as reported by the provider
+type SubscriberSubscription struct {
+	Store                   string
+	PeriodType              string
+	PurchasedAt             time.Time
+	ExpiresAt               *time.Time
+	GracePeriodExpiresAt    *time.Time
+	UnsubscribeDetectedAt   *time.Time
+	BillingIssuesDetectedAt *time.Time
+	RefundedAt              *time.Time
+	IsSandbox               bool
+}
+
+// SubscriberPurchase is a one-off (non-renewing) purchase as reported by the provider
+type SubscriberPurchase struct {
+	ID          string
+	Store       string
+	PurchasedAt time.Time
+	IsSandbox   bool
+}
+
+// SubscriberProvider defines the interface for fetching subscriber state from the billing provider
+type SubscriberProvider interface {
+	GetSubscriber(ctx context.Context, appUserID string) (*Subscriber, error)
+}
+
+var (
+	ErrSubscriberNotFound = errors.New("subscriber not found")
+)
@@ -3,6 +3,7 @@ package ports
 import (
 	"context"
 	"errors"
+	"time"
 
 	"nihongo-api/internal/domain"
 )
@@ -11,9 +12,24 @@ type SubscriptionRepository interface {
 	Create(ctx context.Context, sub *domain.Subscription) error
 	GetByEventID(ctx context.Context, eventID string) (*domain.Subscription, error)
 	UpdateByEventID(ctx context.Context, eventID string, sub *domain.Subscription) error
+	Update(ctx context.Context, sub *domain.Subscription) error
 	GetByExternalUserID(ctx context.Context, externalUserID string) ([]*domain.Subscription, error)
+	GetByInternalUserID(ctx context.Context, internalUserID string) ([]*domain.Subscription, error)
 	UpdateInternalUserID(ctx context.Context, externalUserID string, internalUserID string) error // Para sincronización
-	// Opcional: GetActiveByInternalUserID(ctx context.Context, internalUserID string) (*domain.Subscription, error)
+	// DetachInternalUserID unlinks a user's subscriptions from them, keeping the records,
+	// and returns how many were unlinked
+	DetachInternalUserID(ctx context.Context, internalUserID string) (int64, error)
+	// ReassignInternalUserID moves every subscription of one user to another and returns
+	// how many were moved
+	ReassignInternalUserID(ctx context.Context, fromUserID, toUserID string) (int64, error)
+	// FindOverdue returns up to limit subscriptions that still grant access although their
+	// paid period or grace period ended before cutoff
+	FindOverdue(ctx context.Context, cutoff time.Time, limit int) ([]*domain.Subscription, error)
+	// FindUnreconciled returns up to limit app user IDs with an active or grace period
+	// subscription not reconciled since before, those never reconciled first
+	FindUnreconciled(ctx context.Context, before time.Time, limit int) ([]string, error)
+	// MarkReconciled records when the subscriber's subscriptions were last reconciled
+	MarkReconciled(ctx context.Context, externalUserID string, at time.Time) error
 }
 
 // Common errors for repositories
@@ -2,15 +2,20 @@ package ports
 
 import (
 	"context"
+	"errors"
 	"nihongo-api/internal/domain"
 )
 
 // SyllableRepository defines the interface for syllable data operations
 type SyllableRepository interface {
 	Create(ctx context.Context, syllable *domain.Syllable) error
+	// GetByID returns ErrSyllableNotFound if the syllable does not exist
 	GetByID(ctx context.Context, id string) (*domain.Syllable, error)
 	GetAll(ctx context.Context) ([]domain.Syllable, error)
 	GetByType(ctx context.Context, syllableType domain.SyllableType) ([]domain.Syllable, error)
 	Update(ctx context.Context, syllable *domain.Syllable) error
 	Delete(ctx context.Context, id string) error
 }
+
+// ErrSyllableNotFound is returned when a syllable does not exist
+var ErrSyllableNotFound = errors.New("syllable not found")
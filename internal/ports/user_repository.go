@@ -3,15 +3,21 @@ package ports
 import (
 	"context"
 	"nihongo-api/internal/domain"
+	"time"
 )
 
 // UserRepository defines the interface for user data operations
 type UserRepository interface {
 	Create(ctx context.Context, user *domain.User) error
 	GetByID(ctx context.Context, id string) (*domain.User, error)
+	// GetByIDs returns the users that exist among ids, in no particular order
+	GetByIDs(ctx context.Context, ids []string) ([]*domain.User, error)
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 	Update(ctx context.Context, user *domain.User) error
 	Delete(ctx context.Context, id string) error
 	LinkRevenueCatUserID(ctx context.Context, userID, revenueCatUserID string) error
 	GetByRevenueCatID(ctx context.Context, revenueCatID string) (*domain.User, error)
+	GetByIdentity(ctx context.Context, provider, subject string) (*domain.User, error)
+	// FindDeletionDue returns up to limit users whose scheduled deletion is before cutoff
+	FindDeletionDue(ctx context.Context, cutoff time.Time, limit int) ([]*domain.User, error)
 }
@@ -0,0 +1,26 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nihongo-api/internal/domain"
+)
+
+// UserTokenRepository defines the interface for single-use user token storage
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *domain.UserToken) error
+	// Consume atomically marks an unused, unexpired token as used and returns it.
+	// It returns ErrTokenInvalid if no such token exists.
+	Consume(ctx context.Context, purpose domain.TokenPurpose, tokenHash string, now time.Time) (*domain.UserToken, error)
+	// DeleteByUser removes every token of the given purpose issued to the user
+	DeleteByUser(ctx context.Context, userID string, purpose domain.TokenPurpose) error
+	// IssuedSince reports whether an unused token of the given purpose was issued to the
+	// user at or after since
+	IssuedSince(ctx context.Context, userID string, purpose domain.TokenPurpose, since time.Time) (bool, error)
+}
+
+var (
+	ErrTokenInvalid = errors.New("token is invalid or expired")
+)
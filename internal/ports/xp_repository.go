@@ -0,0 +1,37 @@
+package ports
+
+import (
+	"context"
+	"errors"
+
+	"nihongo-api/internal/domain"
+)
+
+// XPRepository defines the interface for the experience points ledger
+type XPRepository interface {
+	// Record appends an event to the ledger. It returns ErrXPAlreadyAwarded if the user
+	// already earned XP for the entity on that day.
+	Record(ctx context.Context, event *domain.XPEvent) error
+	// HasEvents reports whether the user ever earned XP for the entity
+	HasEvents(ctx context.Context, userID, entityID string) (bool, error)
+	// Events returns the user's ledger, oldest first
+	Events(ctx context.Context, userID string) ([]domain.XPEvent, error)
+	// Total sums the user's XP
+	Total(ctx context.Context, userID string) (int64, error)
+
+	// AddToDay adds xp to the user's total for day, sets the day's goal and returns the
+	// updated day
+	AddToDay(ctx context.Context, userID, day string, xp, goal int) (*domain.XPDay, error)
+	// MarkGoalMet records when the daily goal was met; it returns false if it already was
+	MarkGoalMet(ctx context.Context, userID, day string) (bool, error)
+	// Days returns the user's days from the first to the last day inclusive, oldest first.
+	// Days without XP are left out.
+	Days(ctx context.Context, userID, from, to string) ([]domain.XPDay, error)
+
+	// DeleteByUser removes the user's ledger and days and returns how many documents
+	// were removed
+	DeleteByUser(ctx context.Context, userID string) (int64, error)
+}
+
+// ErrXPAlreadyAwarded is returned when XP for an entity was already earned that day
+var ErrXPAlreadyAwarded = errors.New("xp already awarded for this entity today")
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/joho/godotenv"
@@ -13,10 +14,22 @@ import (
 
 // Config represents the application configuration structure
 type Config struct {
-	Server     ServerConfig     `mapstructure:"server" validate:"required"`
-	Database   DatabaseConfig   `mapstructure:"database" validate:"required"`
-	Auth       AuthConfig       `mapstructure:"auth" validate:"required"`
-	RevenueCat RevenueCatConfig `mapstructure:"revenuecat" validate:"required"`
+	Server       ServerConfig       `mapstructure:"server" validate:"required"`
+	Database     DatabaseConfig     `mapstructure:"database" validate:"required"`
+	Auth         AuthConfig         `mapstructure:"auth" validate:"required"`
+	RevenueCat   RevenueCatConfig   `mapstructure:"revenuecat" validate:"required"`
+	Subscription SubscriptionConfig `mapstructure:"subscription"`
+	Catalog      CatalogConfig      `mapstructure:"catalog"`
+	Mail         MailConfig         `mapstructure:"mail"`
+	OAuth        OAuthConfig        `mapstructure:"oauth"`
+	Account      AccountConfig      `mapstructure:"account"`
+	Streak       StreakConfig       `mapstructure:"streak"`
+	XP           XPConfig           `mapstructure:"xp"`
+	Achievements AchievementsConfig `mapstructure:"achievements"`
+	Leaderboard  LeaderboardConfig  `mapstructure:"leaderboard"`
+	Social       SocialConfig       `mapstructure:"social"`
+	Mistakes     MistakesConfig     `mapstructure:"mistakes"`
+	Study        StudyConfig        `mapstructure:"study"`
 }
 
 // ServerConfig holds server-related settings
@@ -32,7 +45,79 @@ type DatabaseConfig struct {
 
 // AuthConfig holds authentication settings
 type AuthConfig struct {
-	JWTSecret string `mapstructure:"jwt_secret" validate:"required,min=32"`
+	// SigningKeyFiles and SigningKeys (PEM blocks, usually from APP_AUTH_SIGNING_KEYS) hold the
+	// RS256/EdDSA token keys. The first private key signs; the others only verify, for rotation.
+	SigningKeyFiles []string `mapstructure:"signing_key_files"`
+	SigningKeys     string   `mapstructure:"signing_keys"`
+	// JWTSecret is the former HS256 secret. When set, tokens it signed are still accepted
+	// so the switch to signing keys logs nobody out; remove it once they have expired.
+	JWTSecret string        `mapstructure:"jwt_secret" validate:"omitempty,min=32"`
+	TokenTTL  time.Duration `mapstructure:"token_ttl" validate:"gt=0"`
+	// PasswordResetURL is the page or app deep link sent in reset emails (?token=... is appended)
+	PasswordResetURL string        `mapstructure:"password_reset_url" validate:"required,url"`
+	PasswordResetTTL time.Duration `mapstructure:"password_reset_ttl" validate:"gt=0"`
+	// PasswordResetCooldown is how long after a reset email no other one is sent
+	PasswordResetCooldown time.Duration `mapstructure:"password_reset_cooldown" validate:"gte=0"`
+	// EmailVerificationURL is the page or app deep link sent in verification emails
+	EmailVerificationURL string        `mapstructure:"email_verification_url" validate:"required,url"`
+	EmailVerificationTTL time.Duration `mapstructure:"email_verification_ttl" validate:"gt=0"`
+	// UnverifiedAccess decides what users with an unverified email may do:
+	// "full" (no restriction), "free" (login allowed, premium content locked) or "none" (login refused)
+	UnverifiedAccess string          `mapstructure:"unverified_access" validate:"oneof=full free none"`
+	Lockout          LockoutConfig   `mapstructure:"lockout"`
+	TwoFactor        TwoFactorConfig `mapstructure:"two_factor"`
+}
+
+// TwoFactorConfig holds TOTP two-factor authentication settings
+type TwoFactorConfig struct {
+	// Issuer is the account name shown in authenticator apps
+	Issuer string `mapstructure:"issuer" validate:"required"`
+	// RequiredRoles must use 2FA: their privileged routes need a 2FA login and they cannot disable it
+	RequiredRoles []string `mapstructure:"required_roles" validate:"dive,oneof=student teacher admin"`
+	// ChallengeTTL is how long the second login step may take after the password step
+	ChallengeTTL time.Duration `mapstructure:"challenge_ttl" validate:"gt=0"`
+}
+
+// LockoutConfig holds brute-force protection settings for password login
+type LockoutConfig struct {
+	MaxAccountFailures int           `mapstructure:"max_account_failures" validate:"gt=0"`
+	MaxIPFailures      int           `mapstructure:"max_ip_failures" validate:"gt=0"`
+	FailureWindow      time.Duration `mapstructure:"failure_window" validate:"gt=0"`
+	Duration           time.Duration `mapstructure:"duration" validate:"gt=0"`
+	// Failed attempts beyond DelayAfter wait BaseDelay, doubling up to MaxDelay
+	DelayAfter int           `mapstructure:"delay_after" validate:"gte=0"`
+	BaseDelay  time.Duration `mapstructure:"base_delay" validate:"gt=0"`
+	MaxDelay   time.Duration `mapstructure:"max_delay" validate:"gtefield=BaseDelay"`
+	// UnlockURL is the page or app deep link sent in lockout emails (?token=... is appended)
+	UnlockURL string `mapstructure:"unlock_url" validate:"required,url"`
+}
+
+// OAuthConfig holds the identity providers accepted by /api/auth/oauth/:provider
+type OAuthConfig struct {
+	Google OAuthProviderConfig `mapstructure:"google"`
+	Apple  OAuthProviderConfig `mapstructure:"apple"`
+	// JWKSRefreshInterval is how often provider signing keys are refetched
+	JWKSRefreshInterval time.Duration `mapstructure:"jwks_refresh_interval" validate:"gt=0"`
+}
+
+// OAuthProviderConfig configures one identity provider. It is disabled while ClientIDs is empty.
+type OAuthProviderConfig struct {
+	// ClientIDs are the accepted token audiences (iOS, Android and web client IDs / Apple bundle and service IDs)
+	ClientIDs []string `mapstructure:"client_ids"`
+	JWKSURL   string   `mapstructure:"jwks_url" validate:"required,url"`
+	Issuers   []string `mapstructure:"issuers" validate:"min=1"`
+}
+
+// MailConfig holds outgoing email settings. The "log" driver writes emails to the
+// log (or to OutputDir as .eml files) instead of sending them, for development and tests.
+type MailConfig struct {
+	Driver       string `mapstructure:"driver" validate:"oneof=smtp log"`
+	From         string `mapstructure:"from" validate:"required"`
+	SMTPHost     string `mapstructure:"smtp_host" validate:"required_if=Driver smtp"`
+	SMTPPort     int    `mapstructure:"smtp_port" validate:"required_if=Driver smtp"`
+	SMTPUsername string `mapstructure:"smtp_username"`
+	SMTPPassword string `mapstructure:"smtp_password"`
+	OutputDir    string `mapstructure:"output_dir"`
 }
 
 // RevenueCatConfig holds RevenueCat integration settings
@@ -41,6 +126,129 @@ type RevenueCatConfig struct {
 	BaseURL string `mapstructure:"base_url" validate:"required,url"`
 	// WebhookSecrets is a comma-separated list of accepted webhook secrets for rotation
 	WebhookSecrets string `mapstructure:"webhook_secrets" validate:"required"`
+	// Timeout bounds each REST API attempt; MaxRetries is the number of extra attempts on 429/5xx
+	Timeout    time.Duration `mapstructure:"timeout" validate:"gt=0"`
+	MaxRetries int           `mapstructure:"max_retries" validate:"gte=0,lte=10"`
+}
+
+// SubscriptionConfig holds subscription lifecycle settings
+type SubscriptionConfig struct {
+	// GracePeriod is how long premium access is kept after a BILLING_ISSUE event
+	GracePeriod time.Duration `mapstructure:"grace_period" validate:"gte=0"`
+	// ExpirySweepInterval is how often overdue subscriptions are expired in the background
+	ExpirySweepInterval time.Duration `mapstructure:"expiry_sweep_interval" validate:"gt=0"`
+	// ExpiryTolerance is how long past expires_at to wait for the EXPIRATION webhook first
+	ExpiryTolerance time.Duration `mapstructure:"expiry_tolerance" validate:"gte=0"`
+	// ReconcileInterval is how often subscribers are checked against RevenueCat in the
+	// background; each is checked again once ReconcileMaxAge has passed
+	ReconcileInterval  time.Duration `mapstructure:"reconcile_interval" validate:"gt=0"`
+	ReconcileMaxAge    time.Duration `mapstructure:"reconcile_max_age" validate:"gt=0"`
+	ReconcileBatchSize int           `mapstructure:"reconcile_batch_size" validate:"gt=0"`
+}
+
+// AccountConfig holds self-service account settings
+type AccountConfig struct {
+	// DeletionGracePeriod is how long a deleted account can be restored by logging in
+	DeletionGracePeriod time.Duration `mapstructure:"deletion_grace_period" validate:"gte=0"`
+	// DeletionSweepInterval is how often accounts past their grace period are purged
+	DeletionSweepInterval time.Duration `mapstructure:"deletion_sweep_interval" validate:"gt=0"`
+}
+
+// StreakConfig holds daily streak settings
+type StreakConfig struct {
+	// MaxFreezes caps the freezes a user can earn; purchased freezes can go beyond it
+	MaxFreezes int `mapstructure:"max_freezes" validate:"gte=0"`
+	// EarnFreezeEvery grants a freeze every this many streak days (0 = never)
+	EarnFreezeEvery int `mapstructure:"earn_freeze_every" validate:"gte=0"`
+	// FreezeProducts are consumable store product IDs that each grant one freeze
+	FreezeProducts []string `mapstructure:"freeze_products"`
+}
+
+// XPConfig holds experience points settings
+type XPConfig struct {
+	// Rules is the XP per entity type (syllable, kanji, lesson, exercise) at N5
+	Rules map[string]XPRuleConfig `mapstructure:"rules" validate:"dive,keys,oneof=syllable kanji lesson exercise,endkeys"`
+	// Difficulty multiplies the XP of entities by JLPT level; unlisted levels count as 1
+	Difficulty map[string]float64 `mapstructure:"difficulty" validate:"dive,keys,oneof=n5 n4 n3 n2 n1 N5 N4 N3 N2 N1,endkeys,gt=0"`
+	// LevelBase is the XP from level 1 to 2; each further level takes that much more
+	LevelBase        int `mapstructure:"level_base" validate:"gt=0"`
+	DefaultDailyGoal int `mapstructure:"default_daily_goal" validate:"gt=0"`
+	MaxHistoryDays   int `mapstructure:"max_history_days" validate:"gt=0"`
+}
+
+// XPRuleConfig is the XP for completing an entity the first time and on later days
+type XPRuleConfig struct {
+	Completion int `mapstructure:"completion" validate:"gte=0"`
+	Review     int `mapstructure:"review" validate:"gte=0"`
+}
+
+// AchievementsConfig holds achievement evaluation settings
+type AchievementsConfig struct {
+	// Workers evaluate achievements in the background after progress writes
+	Workers int `mapstructure:"workers" validate:"gt=0"`
+	// QueueSize is how many users can wait for evaluation; beyond it evaluations are skipped
+	QueueSize int `mapstructure:"queue_size" validate:"gt=0"`
+	// RefreshInterval is how often definitions are re-read from the achievements collection
+	RefreshInterval time.Duration `mapstructure:"refresh_interval" validate:"gte=0"`
+}
+
+// LeaderboardConfig holds leaderboard settings
+type LeaderboardConfig struct {
+	// CompletionPoints are scored for every completed entity
+	CompletionPoints int64 `mapstructure:"completion_points" validate:"gt=0"`
+	// MaxScorePoints are added for an exercise scored 100, proportionally less below
+	MaxScorePoints int64 `mapstructure:"max_score_points" validate:"gte=0"`
+	MaxTop         int   `mapstructure:"max_top" validate:"gt=0"`
+	Neighbours     int   `mapstructure:"neighbours" validate:"gte=0"`
+	ArchiveSize    int   `mapstructure:"archive_size" validate:"gt=0"`
+	// ArchiveInterval is how often finished weeks are looked for and archived
+	ArchiveInterval time.Duration `mapstructure:"archive_interval" validate:"gt=0"`
+}
+
+// SocialConfig holds follow and activity feed settings
+type SocialConfig struct {
+	// MaxFollowing bounds how many users one can follow, which bounds the work of a feed read
+	MaxFollowing int `mapstructure:"max_following" validate:"gt=0"`
+	MaxFeedPage  int `mapstructure:"max_feed_page" validate:"gt=0"`
+	// StreakMilestones are the streak lengths, in days, shown in feeds
+	StreakMilestones []int `mapstructure:"streak_milestones" validate:"dive,gt=0"`
+}
+
+// MistakesConfig holds mistake analysis settings
+type MistakesConfig struct {
+	// Window is how far back attempts are analysed
+	Window time.Duration `mapstructure:"window" validate:"gt=0"`
+	// LeechFailures are the failures within the window that make an item a leech
+	LeechFailures int `mapstructure:"leech_failures" validate:"gt=0"`
+	// WeakAccuracy is the share of correct answers below which an item is weak
+	WeakAccuracy  float64 `mapstructure:"weak_accuracy" validate:"gte=0,lte=1"`
+	MinConfusions int     `mapstructure:"min_confusions" validate:"gt=0"`
+	MaxItems      int     `mapstructure:"max_items" validate:"gt=0"`
+}
+
+// StudyConfig holds study session settings
+type StudyConfig struct {
+	// MaxSessionLength rejects sessions longer than any real sitting, e.g. from a bad clock
+	MaxSessionLength time.Duration `mapstructure:"max_session_length" validate:"gt=0"`
+	// MaxRangeDays bounds how many days of stats one request can compute
+	MaxRangeDays int `mapstructure:"max_range_days" validate:"gt=0"`
+}
+
+// CatalogConfig holds the product and entitlement catalog. Entries can be
+// overridden at runtime through the catalog_overrides Mongo collection.
+type CatalogConfig struct {
+	Products        []CatalogItemConfig `mapstructure:"products" validate:"dive"`
+	Entitlements    []CatalogItemConfig `mapstructure:"entitlements" validate:"dive"`
+	RefreshInterval time.Duration       `mapstructure:"refresh_interval" validate:"gte=0"`
+}
+
+// CatalogItemConfig maps an external product or entitlement ID to internal entitlements
+type CatalogItemConfig struct {
+	ID                  string   `mapstructure:"id" validate:"required"`
+	Entitlements        []string `mapstructure:"entitlements" validate:"required,min=1"`
+	DefaultDurationDays int      `mapstructure:"default_duration_days" validate:"gte=0"`
+	// Lifetime marks a product whose purchases never expire; ignored for entitlements
+	Lifetime bool `mapstructure:"lifetime"`
 }
 
 // Load loads and validates the configuration
@@ -76,6 +284,78 @@ func Load() (*Config, error) {
 	// Replace dots and underscores in env keys for nested configs
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
 
+	// Defaults for optional settings
+	v.SetDefault("subscription.grace_period", "72h")
+	v.SetDefault("subscription.expiry_sweep_interval", "10m")
+	v.SetDefault("subscription.expiry_tolerance", "1h")
+	v.SetDefault("subscription.reconcile_interval", "10m")
+	v.SetDefault("subscription.reconcile_max_age", "24h")
+	v.SetDefault("subscription.reconcile_batch_size", 100)
+	v.SetDefault("catalog.refresh_interval", "1m")
+	v.SetDefault("account.deletion_grace_period", "720h")
+	v.SetDefault("account.deletion_sweep_interval", "1h")
+	v.SetDefault("streak.max_freezes", 2)
+	v.SetDefault("streak.earn_freeze_every", 7)
+	v.SetDefault("streak.freeze_products", []string{})
+	v.SetDefault("xp.rules", map[string]any{
+		"syllable": map[string]any{"completion": 5, "review": 2},
+		"kanji":    map[string]any{"completion": 10, "review": 4},
+		"lesson":   map[string]any{"completion": 20, "review": 0},
+		"exercise": map[string]any{"completion": 10, "review": 5},
+	})
+	v.SetDefault("xp.difficulty", map[string]any{"n5": 1.0, "n4": 1.25, "n3": 1.5, "n2": 1.75, "n1": 2.0})
+	v.SetDefault("xp.level_base", 100)
+	v.SetDefault("xp.default_daily_goal", 30)
+	v.SetDefault("xp.max_history_days", 90)
+	v.SetDefault("achievements.workers", 2)
+	v.SetDefault("achievements.queue_size", 1000)
+	v.SetDefault("achievements.refresh_interval", "1m")
+	v.SetDefault("leaderboard.completion_points", 10)
+	v.SetDefault("leaderboard.max_score_points", 10)
+	v.SetDefault("leaderboard.max_top", 100)
+	v.SetDefault("leaderboard.neighbours", 2)
+	v.SetDefault("leaderboard.archive_size", 100)
+	v.SetDefault("leaderboard.archive_interval", "1h")
+	v.SetDefault("social.max_following", 1000)
+	v.SetDefault("social.max_feed_page", 50)
+	v.SetDefault("social.streak_milestones", []int{7, 30, 100, 365})
+	v.SetDefault("mistakes.window", "720h")
+	v.SetDefault("mistakes.leech_failures", 4)
+	v.SetDefault("mistakes.weak_accuracy", 0.8)
+	v.SetDefault("mistakes.min_confusions", 2)
+	v.SetDefault("mistakes.max_items", 50)
+	v.SetDefault("study.max_session_length", "12h")
+	v.SetDefault("study.max_range_days", 366)
+	v.SetDefault("auth.signing_key_files", []string{})
+	v.SetDefault("auth.signing_keys", "")
+	v.SetDefault("auth.jwt_secret", "")
+	v.SetDefault("auth.token_ttl", "72h")
+	v.SetDefault("auth.password_reset_ttl", "1h")
+	v.SetDefault("auth.password_reset_cooldown", "5m")
+	v.SetDefault("auth.email_verification_ttl", "48h")
+	v.SetDefault("auth.unverified_access", "free")
+	v.SetDefault("auth.two_factor.issuer", "Nihongo")
+	v.SetDefault("auth.two_factor.required_roles", []string{"admin", "teacher"})
+	v.SetDefault("auth.two_factor.challenge_ttl", "5m")
+	v.SetDefault("auth.lockout.max_account_failures", 10)
+	v.SetDefault("auth.lockout.max_ip_failures", 50)
+	v.SetDefault("auth.lockout.failure_window", "15m")
+	v.SetDefault("auth.lockout.duration", "30m")
+	v.SetDefault("auth.lockout.delay_after", 3)
+	v.SetDefault("auth.lockout.base_delay", "1s")
+	v.SetDefault("auth.lockout.max_delay", "30s")
+	v.SetDefault("oauth.google.client_ids", []string{})
+	v.SetDefault("oauth.google.jwks_url", "https://www.googleapis.com/oauth2/v3/certs")
+	v.SetDefault("oauth.google.issuers", []string{"https://accounts.google.com", "accounts.google.com"})
+	v.SetDefault("oauth.apple.client_ids", []string{})
+	v.SetDefault("oauth.apple.jwks_url", "https://appleid.apple.com/auth/keys")
+	v.SetDefault("oauth.apple.issuers", []string{"https://appleid.apple.com"})
+	v.SetDefault("oauth.jwks_refresh_interval", "1h")
+	v.SetDefault("mail.driver", "log")
+	v.SetDefault("mail.smtp_port", 587)
+	v.SetDefault("revenuecat.timeout", "10s")
+	v.SetDefault("revenuecat.max_retries", 3)
+
 	// Load config.yml as fallback for defaults (only non-sensitive)
 	v.SetConfigName("config")
 	v.SetConfigType("yml")